@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -69,8 +70,22 @@ func VerifyJWT(tokenString string) (*jwt.MapClaims, error) {
 }
 
 func CurrentUserID(c *gin.Context) string {
+	return strconv.FormatUint(uint64(CurrentEmployeeID(c)), 10)
+}
+
+// CurrentEmployeeID returns the ID of the logged in employee. The ID is signed into
+// the token as a number, which the JWT parser decodes as a float64. Requests authorized by
+// a stream ticket carry the employee of the ticket instead.
+func CurrentEmployeeID(c *gin.Context) uint {
+	if employeeId, ok := c.Get(employeeIdKey); ok {
+		return employeeId.(uint)
+	}
 	token, _ := c.Get("token")
-	claims, _ := VerifyJWT(token.(string))
+	claims, err := VerifyJWT(token.(string))
+	if err != nil {
+		return 0
+	}
 	claimMap := *claims
-	return claimMap["empID"].(string)
+	empID, _ := claimMap["empID"].(float64)
+	return uint(empID)
 }
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"easystore/db"
+	"easystore/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrganizationMiddleware puts the organization of the logged in employee on the request, so
+// that db.Tenant only sees its records. It must run after JWTMiddleware.
+func OrganizationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var employee models.Employee
+		tx := db.DB.Omit("password").First(&employee, CurrentEmployeeID(c))
+		if tx.Error != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "Unable to find the logged in employee"})
+			c.Abort()
+			return
+		}
+
+		var organization models.Organization
+		tx = db.DB.First(&organization, employee.OrganizationId)
+		if tx.Error != nil {
+			c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "Employee does not belong to an organization"})
+			c.Abort()
+			return
+		}
+		if organization.Status != "active" {
+			c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "Organization is not active"})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(db.WithOrganization(c.Request.Context(), organization.ID))
+		c.Set("organization_owner", organization.OwnerId != nil && *organization.OwnerId == employee.ID)
+
+		c.Next()
+	}
+}
+
+// RequireOrganizationOwner lets the request through only for the owner of the organization.
+// It must run after OrganizationMiddleware.
+func RequireOrganizationOwner() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("organization_owner") {
+			c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "You are not allowed to access this resource"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
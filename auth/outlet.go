@@ -8,9 +8,6 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var outlet models.Outlet
-var outletEmployee models.OutletEmployee
-
 func OutletMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		outlet_id := c.Param("outlet_id") // Extract tenant_id from URL param
@@ -21,26 +18,50 @@ func OutletMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		tx := db.DB.First(&outletEmployee, CurrentUserID(c))
-		if tx.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get user details"})
-			return
-		}
-
-		tx = db.DB.First(&outlet, outlet_id)
+		// Outlets of other organizations are not found
+		var outlet models.Outlet
+		tx := db.Tenant(c).First(&outlet, outlet_id)
 		if tx.Error != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get outlet details"})
+			c.Abort()
 			return
 		}
 
-		if outlet.ID != outletEmployee.OutletId {
-			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid outlet id"})
-			c.Abort()
-			return
+		// The manager of an outlet and the owner of its organization do not need to be listed
+		// as its employees
+		employeeID := CurrentEmployeeID(c)
+		role := models.RoleManager
+		if outlet.ManagerId != employeeID && !c.GetBool("organization_owner") {
+			var outletEmployee models.OutletEmployee
+			tx = db.Tenant(c).Where("outlet_id = ? AND employee_id = ?", outlet.ID, employeeID).First(&outletEmployee)
+			if tx.Error != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid outlet id"})
+				c.Abort()
+				return
+			}
+			role = outletEmployee.Role
 		}
 
 		c.Set("outlet_id", outlet_id)
+		c.Set("outlet_role", role)
 
 		c.Next()
 	}
 }
+
+// RequireOutletRole lets the request through only when the role of the employee at the
+// outlet is one of roles. It must run after OutletMiddleware.
+func RequireOutletRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("outlet_role")
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": "You are not allowed to access this resource"})
+		c.Abort()
+	}
+}
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"easystore/db"
+	"easystore/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StoreMiddleware puts the organization named by the public_key parameter on the request,
+// so that storefronts, which do not log in, only see the outlets of that organization
+func StoreMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var organization models.Organization
+		tx := db.DB.Where("public_key = ? AND status = ?", c.Param("public_key"), "active").First(&organization)
+		if tx.Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Store not found"})
+			c.Abort()
+			return
+		}
+
+		c.Request = c.Request.WithContext(db.WithOrganization(c.Request.Context(), organization.ID))
+		c.Next()
+	}
+}
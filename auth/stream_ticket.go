@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"easystore/db"
+	"easystore/models"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// StreamTicketTTL is how long a stream ticket can be used after it is issued
+const StreamTicketTTL = time.Minute
+
+// employeeIdKey holds the employee a request was authorized for without a token
+const employeeIdKey = "employee_id"
+
+var ErrInvalidStreamTicket = errors.New("stream ticket is invalid, used or expired")
+
+// IssueStreamTicket returns a new single use ticket for the employee to open the event
+// stream or socket of an order of the outlet
+func IssueStreamTicket(tx *gorm.DB, employeeId uint, outletId uint, orderId uint) (string, models.StreamTicket, error) {
+	secret := make([]byte, 24)
+	if _, err := rand.Read(secret); err != nil {
+		return "", models.StreamTicket{}, err
+	}
+	token := hex.EncodeToString(secret)
+	ticket := models.StreamTicket{
+		TokenHash:  hashTicket(token),
+		EmployeeId: employeeId,
+		OutletId:   outletId,
+		OrderId:    orderId,
+		ExpiresAt:  time.Now().Add(StreamTicketTTL),
+	}
+	err := tx.Create(&ticket).Error
+	return token, ticket, err
+}
+
+// StreamAuthMiddleware authorizes event streams and sockets of an order. Browsers can not set
+// the Authorization header on them, so they pass a ticket from IssueStreamTicket in the
+// ticket query parameter instead. Requests with the header are verified by JWTMiddleware.
+func StreamAuthMiddleware() gin.HandlerFunc {
+	verifyJWT := JWTMiddleware()
+	return func(c *gin.Context) {
+		token := c.Query("ticket")
+		if token == "" || c.GetHeader("Authorization") != "" {
+			verifyJWT(c)
+			return
+		}
+
+		ticket, err := redeemStreamTicket(token)
+		if err == nil && (strconv.FormatUint(uint64(ticket.OutletId), 10) != c.Param("outlet_id") || strconv.FormatUint(uint64(ticket.OrderId), 10) != c.Param("order_id")) {
+			err = ErrInvalidStreamTicket
+		}
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"status": "failed", "message": "Unable to verify the stream ticket", "result": gin.H{"error": err.Error()}})
+			c.Abort()
+			return
+		}
+		c.Set(employeeIdKey, ticket.EmployeeId)
+
+		c.Next()
+	}
+}
+
+// Private methods
+
+// redeemStreamTicket marks an unused ticket used in the same statement that finds it, so
+// a ticket can not be used twice even by requests arriving together
+var redeemStreamTicket = func(token string) (models.StreamTicket, error) {
+	var ticket models.StreamTicket
+	now := time.Now()
+	result := db.DB.Model(&ticket).Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashTicket(token), now).
+		Update("used_at", now)
+	if result.Error != nil {
+		return ticket, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ticket, ErrInvalidStreamTicket
+	}
+	return ticket, nil
+}
+
+var hashTicket = func(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,319 @@
+package carts
+
+import (
+	"easystore/hours"
+	"easystore/inventory"
+	"easystore/models"
+	"easystore/pricing"
+	"easystore/promotions"
+	"easystore/tax"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidQuantity    = errors.New("Quantity should be positive")
+	ErrVarientUnavailable = errors.New("Product varient is not sold at this outlet")
+	ErrCartNotActive      = errors.New("Cart has already been ordered")
+	ErrCartEmpty          = errors.New("Cart has no lines")
+)
+
+// Changes revalidation makes to a line
+const (
+	ChangeRemoved  = "removed"
+	ChangePrice    = "price_changed"
+	ChangeQuantity = "quantity_reduced"
+)
+
+// Reasons for a change to a line
+const (
+	ReasonUnavailable    = "varient_unavailable"
+	ReasonInactive       = "product_inactive"
+	ReasonNoPrice        = "no_current_price"
+	ReasonOutOfStock     = "out_of_stock"
+	ReasonInsufficient   = "insufficient_stock"
+	ReasonPriceIncreased = "price_increased"
+	ReasonPriceDecreased = "price_decreased"
+)
+
+// Line is a cart line with its name, savings, promotions and tax. Discount is what the
+// price saves on the MRP, PromotionDiscount what promotions take off the price.
+type Line struct {
+	models.CartLine
+	Name              string               `json:"name"`
+	Discount          models.Money         `json:"discount"`
+	PromotionDiscount models.Money         `json:"promotion_discount"`
+	Promotions        []promotions.Applied `json:"promotions"`
+	Breakdown         tax.Breakdown        `json:"tax"`
+}
+
+// Summary is a cart with its totals computed at the prices stored on its lines
+type Summary struct {
+	Cart       models.Cart       `json:"cart"`
+	Lines      []Line            `json:"lines"`
+	Promotions promotions.Result `json:"promotions"`
+	Taxes      []tax.Breakdown   `json:"taxes"`
+	Mrp        models.Money      `json:"mrp"`
+	Discount   models.Money      `json:"discount"`
+	Totals     tax.Totals        `json:"totals"`
+}
+
+// Change is what revalidation did to a line and why
+type Change struct {
+	LineId       uint          `json:"line_id"`
+	VarientId    uint          `json:"varient_id"`
+	Name         string        `json:"name"`
+	Change       string        `json:"change"`
+	Reason       string        `json:"reason"`
+	OldUnitPrice *models.Money `json:"old_unit_price,omitempty"`
+	NewUnitPrice *models.Money `json:"new_unit_price,omitempty"`
+	OldQuantity  *int          `json:"old_quantity,omitempty"`
+	NewQuantity  *int          `json:"new_quantity,omitempty"`
+}
+
+// Open returns the active cart of the customer at the outlet, creating an empty one when
+// there is none. With lock the cart row stays locked for the rest of the transaction.
+func Open(tx *gorm.DB, outletId uint, customerId uint, lock bool) (models.Cart, error) {
+	cart := models.Cart{OutletId: outletId, CustomerId: customerId, Status: models.CartActive}
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Outlet", "Customer", "Lines").Create(&cart).Error
+	if err != nil {
+		return cart, err
+	}
+
+	query := tx.Where("outlet_id = ? AND customer_id = ? AND status = ?", outletId, customerId, models.CartActive)
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	if err := query.First(&cart).Error; err != nil {
+		return cart, err
+	}
+	// Varients taken off the catalog are still loaded so their lines can be named
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+	err = tx.Where("cart_id = ?", cart.ID).Preload("Varient", unscoped).Preload("Varient.Product", unscoped).Order("id").Find(&cart.Lines).Error
+	return cart, err
+}
+
+// Add puts quantity of a varient of the outlet into the cart at its current price. A
+// varient already in the cart has its quantity raised and keeps its price.
+func Add(tx *gorm.DB, cart models.Cart, varientId uint, quantity int) error {
+	if quantity <= 0 {
+		return ErrInvalidQuantity
+	}
+	for _, line := range cart.Lines {
+		if line.VarientId == varientId {
+			return tx.Model(&line).Update("quantity", line.Quantity+quantity).Error
+		}
+	}
+
+	varient, err := activeVarient(tx, cart.OutletId, varientId)
+	if err != nil {
+		return err
+	}
+	price, err := pricing.EffectivePrice(tx, varient, time.Now())
+	if err != nil {
+		return err
+	}
+	line := models.CartLine{CartId: cart.ID, VarientId: varient.ID, Quantity: quantity, UnitPrice: price.SellingPrice, Mrp: price.Mrp}
+	return tx.Omit("Varient").Create(&line).Error
+}
+
+// SetQuantity changes the quantity of a line of the cart. A quantity of zero removes it.
+func SetQuantity(tx *gorm.DB, cart models.Cart, lineId uint, quantity int) error {
+	if quantity < 0 {
+		return ErrInvalidQuantity
+	}
+	if quantity == 0 {
+		return Remove(tx, cart, lineId)
+	}
+	result := tx.Model(&models.CartLine{}).Where("id = ? AND cart_id = ?", lineId, cart.ID).Update("quantity", quantity)
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Remove takes a line out of the cart
+func Remove(tx *gorm.DB, cart models.Cart, lineId uint) error {
+	result := tx.Unscoped().Where("id = ? AND cart_id = ?", lineId, cart.ID).Delete(&models.CartLine{})
+	if result.Error == nil && result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return result.Error
+}
+
+// Clear takes every line out of the cart
+func Clear(tx *gorm.DB, cart models.Cart) error {
+	return tx.Unscoped().Where("cart_id = ?", cart.ID).Delete(&models.CartLine{}).Error
+}
+
+// Summarize computes the savings, promotions, taxes and totals of the cart. Taxes are
+// computed on the prices after the promotions, for the delivery address of the cart or
+// within the state of the outlet when it has none.
+func Summarize(tx *gorm.DB, outlet models.Outlet, cart models.Cart) (Summary, error) {
+	summary := Summary{Cart: cart, Lines: []Line{}, Taxes: []tax.Breakdown{}}
+	summary.Cart.Lines = nil
+
+	placeOfSupply := tax.OutletState(outlet.StateCode, outlet.Location)
+	if cart.AddressId != nil {
+		var address models.CustomerAddress
+		err := tx.Where("customer_id = ?", cart.CustomerId).First(&address, *cart.AddressId).Error
+		if err == nil {
+			placeOfSupply = tax.StateFromLocation(address.State)
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return summary, err
+		}
+	}
+
+	items := make([]promotions.Item, 0, len(cart.Lines))
+	for _, line := range cart.Lines {
+		items = append(items, promotions.Item{Key: line.ID, VarientId: line.VarientId, ProductId: line.Varient.ProductId, CategoryId: line.Varient.Product.CategoryId, Quantity: line.Quantity, UnitPrice: line.UnitPrice})
+	}
+	context := promotions.Context{OutletId: cart.OutletId, Channel: models.ChannelOnline, CustomerId: &cart.CustomerId, Coupon: cart.CouponCode, At: time.Now().In(hours.Of(outlet))}
+	result, err := promotions.Evaluate(tx, context, items)
+	if err != nil {
+		return summary, err
+	}
+
+	taxLines := make([]tax.Line, 0, len(cart.Lines))
+	for _, line := range cart.Lines {
+		taxLines = append(taxLines, tax.LineFor(line.Varient.Product, line.UnitPrice, line.Quantity, result.Line(line.ID).Discount))
+	}
+	breakdowns, totals, err := tax.ComputeLines(taxLines, tax.ModeFor(outlet), tax.InterstateFor(outlet, placeOfSupply))
+	if err != nil {
+		return summary, err
+	}
+
+	for i, line := range cart.Lines {
+		discount := (line.Mrp - line.UnitPrice) * models.Money(line.Quantity)
+		if discount < 0 {
+			discount = 0
+		}
+		promotion := result.Line(line.ID)
+		summary.Lines = append(summary.Lines, Line{CartLine: line, Name: name(line.Varient), Discount: discount, PromotionDiscount: promotion.Discount, Promotions: promotion.Applied, Breakdown: breakdowns[i]})
+		summary.Mrp += line.Mrp * models.Money(line.Quantity)
+		summary.Discount += discount
+	}
+	summary.Promotions = result
+	summary.Taxes = breakdowns
+	summary.Totals = totals
+	return summary, nil
+}
+
+// Revalidate checks every line of the cart against the current price, status and stock of
+// its varient, fixing the lines that no longer hold and reporting each change made.
+// Lines whose product is gone or out of stock are removed, prices are brought up to date
+// and quantities are cut down to the stock available.
+func Revalidate(tx *gorm.DB, cart *models.Cart) ([]Change, error) {
+	changes := []Change{}
+	now := time.Now()
+	kept := cart.Lines[:0]
+	for _, line := range cart.Lines {
+		change := Change{LineId: line.ID, VarientId: line.VarientId, Name: name(line.Varient)}
+		remove := func(reason string) error {
+			change.Change = ChangeRemoved
+			change.Reason = reason
+			changes = append(changes, change)
+			return tx.Unscoped().Delete(&models.CartLine{}, line.ID).Error
+		}
+
+		varient, err := activeVarient(tx, cart.OutletId, line.VarientId)
+		if errors.Is(err, ErrVarientUnavailable) {
+			reason := ReasonUnavailable
+			if line.Varient.ID != 0 && line.Varient.Product.ID != 0 && line.Varient.Product.Status != "active" {
+				reason = ReasonInactive
+			}
+			if err := remove(reason); err != nil {
+				return changes, err
+			}
+			continue
+		} else if err != nil {
+			return changes, err
+		}
+
+		price, err := pricing.EffectivePrice(tx, varient, now)
+		if errors.Is(err, pricing.ErrNoPrice) {
+			if err := remove(ReasonNoPrice); err != nil {
+				return changes, err
+			}
+			continue
+		} else if err != nil {
+			return changes, err
+		}
+
+		available, err := inventory.Available(tx, line.VarientId)
+		if err != nil {
+			return changes, err
+		}
+		if available <= 0 {
+			if err := remove(ReasonOutOfStock); err != nil {
+				return changes, err
+			}
+			continue
+		}
+
+		updates := map[string]interface{}{}
+		if price.SellingPrice != line.UnitPrice || price.Mrp != line.Mrp {
+			oldPrice, newPrice := line.UnitPrice, price.SellingPrice
+			priceChange := change
+			priceChange.Change = ChangePrice
+			priceChange.Reason = ReasonPriceDecreased
+			if newPrice > oldPrice {
+				priceChange.Reason = ReasonPriceIncreased
+			}
+			priceChange.OldUnitPrice, priceChange.NewUnitPrice = &oldPrice, &newPrice
+			// A change of MRP alone does not change what the customer pays
+			if newPrice != oldPrice {
+				changes = append(changes, priceChange)
+			}
+			line.UnitPrice, line.Mrp = price.SellingPrice, price.Mrp
+			updates["unit_price"], updates["mrp"] = line.UnitPrice, line.Mrp
+		}
+		if available < line.Quantity {
+			oldQuantity, newQuantity := line.Quantity, available
+			quantityChange := change
+			quantityChange.Change = ChangeQuantity
+			quantityChange.Reason = ReasonInsufficient
+			quantityChange.OldQuantity, quantityChange.NewQuantity = &oldQuantity, &newQuantity
+			changes = append(changes, quantityChange)
+			line.Quantity = available
+			updates["quantity"] = line.Quantity
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&models.CartLine{}).Where("id = ?", line.ID).Updates(updates).Error; err != nil {
+				return changes, err
+			}
+		}
+		line.Varient = varient
+		kept = append(kept, line)
+	}
+	cart.Lines = kept
+	return changes, nil
+}
+
+// IsCartError reports whether err was caused by the request rather than the server
+func IsCartError(err error) bool {
+	for _, cartErr := range []error{ErrInvalidQuantity, ErrVarientUnavailable, ErrCartNotActive, ErrCartEmpty, ErrAddressRequired, ErrCartChanged, pricing.ErrNoPrice, gorm.ErrRecordNotFound} {
+		if errors.Is(err, cartErr) {
+			return true
+		}
+	}
+	return false
+}
+
+func activeVarient(tx *gorm.DB, outletId uint, varientId uint) (models.ProductVarient, error) {
+	var varient models.ProductVarient
+	err := tx.Joins("Product").
+		Where("\"Product\".outlet_id = ? AND \"Product\".status = ?", outletId, "active").
+		First(&varient, varientId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return varient, ErrVarientUnavailable
+	}
+	return varient, err
+}
+
+func name(varient models.ProductVarient) string {
+	return varient.Product.Title + " " + varient.Name
+}
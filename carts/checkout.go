@@ -0,0 +1,82 @@
+package carts
+
+import (
+	"easystore/models"
+	"easystore/orders"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAddressRequired = errors.New("Cart has no delivery address")
+	ErrCartChanged     = errors.New("Cart changed since it was last seen, review it before ordering")
+)
+
+// CheckoutRequest is everything besides the cart needed to order it
+type CheckoutRequest struct {
+	Outlet        models.Outlet
+	Customer      models.Customer
+	PaymentMethod string
+	Slot          *orders.SlotRequest
+	Points        int
+	GiftCards     []orders.GiftCardRequest
+	StoreCredit   models.Money
+}
+
+// Checkout places an order for the active cart of the customer and marks the cart ordered.
+// The cart is revalidated first. When that changes anything the changes are kept, nothing
+// is ordered and ErrCartChanged is returned with the changes, so the customer never pays a
+// price they have not seen.
+func Checkout(tx *gorm.DB, request CheckoutRequest, actor orders.Actor) (models.Order, []Change, error) {
+	var order models.Order
+	var changes []Change
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		cart, err := Open(tx, request.Outlet.ID, request.Customer.ID, true)
+		if err != nil {
+			return err
+		}
+		if len(cart.Lines) == 0 {
+			return ErrCartEmpty
+		}
+		if cart.AddressId == nil {
+			return ErrAddressRequired
+		}
+		var address models.CustomerAddress
+		err = tx.Where("customer_id = ?", cart.CustomerId).First(&address, *cart.AddressId).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAddressRequired
+		} else if err != nil {
+			return err
+		}
+
+		changes, err = Revalidate(tx, &cart)
+		if err != nil || len(changes) > 0 {
+			return err
+		}
+
+		place := orders.PlaceRequest{
+			Outlet:        request.Outlet,
+			Customer:      request.Customer,
+			Address:       address,
+			PaymentMethod: request.PaymentMethod,
+			Slot:          request.Slot,
+			Coupon:        cart.CouponCode,
+			Points:        request.Points,
+			GiftCards:     request.GiftCards,
+			StoreCredit:   request.StoreCredit,
+		}
+		for _, line := range cart.Lines {
+			place.Lines = append(place.Lines, orders.LineRequest{VarientId: line.VarientId, Quantity: line.Quantity})
+		}
+		order, err = orders.Place(tx, place, actor)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&cart).Updates(map[string]interface{}{"status": models.CartOrdered, "order_id": order.ID}).Error
+	})
+	if err == nil && len(changes) > 0 {
+		err = ErrCartChanged
+	}
+	return order, changes, err
+}
@@ -0,0 +1,158 @@
+package customers
+
+import (
+	"easystore/models"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidPhone   = errors.New("Phone number must be 10 digits")
+	ErrInvalidPincode = errors.New("Pincode must be 6 digits and can not start with 0")
+	ErrPhoneExists    = errors.New("A customer with this phone number already exists")
+	ErrMergeSelf      = errors.New("A customer can not be merged into itself")
+)
+
+func ValidatePhone(phone string) error {
+	if len(phone) != 10 || !digits(phone) {
+		return ErrInvalidPhone
+	}
+	return nil
+}
+
+func ValidatePincode(pincode string) error {
+	if len(pincode) != 6 || !digits(pincode) || pincode[0] == '0' {
+		return ErrInvalidPincode
+	}
+	return nil
+}
+
+// Find returns a customer of the chain. A customer that was merged is resolved to the
+// customer it was merged into.
+func Find(tx *gorm.DB, chainId uint, customerId uint) (models.Customer, error) {
+	var customer models.Customer
+	err := tx.Unscoped().Where("chain_id = ?", chainId).First(&customer, customerId).Error
+	if err != nil {
+		return customer, err
+	}
+	if customer.DeletedAt.Valid {
+		if customer.MergedIntoId == nil {
+			return customer, gorm.ErrRecordNotFound
+		}
+		return Find(tx, chainId, *customer.MergedIntoId)
+	}
+	return customer, nil
+}
+
+// FindByPhone returns the customer of the chain with the phone number
+func FindByPhone(tx *gorm.DB, chainId uint, phone string) (models.Customer, error) {
+	var customer models.Customer
+	err := tx.Where("chain_id = ? AND phone = ?", chainId, phone).First(&customer).Error
+	return customer, err
+}
+
+// PhoneTaken reports whether another customer of the chain already uses the phone number
+func PhoneTaken(tx *gorm.DB, chainId uint, phone string, exceptId uint) (bool, error) {
+	var count int64
+	err := tx.Model(&models.Customer{}).Where("chain_id = ? AND phone = ? AND id <> ?", chainId, phone, exceptId).Count(&count).Error
+	return count > 0, err
+}
+
+// HistoryIds returns the customer and every customer that was merged into it, so the
+// purchases made under any of them can be listed together
+func HistoryIds(tx *gorm.DB, customerId uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Unscoped().Model(&models.Customer{}).Where("id = ? OR merged_into_id = ?", customerId, customerId).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// Merge folds the duplicate into the customer. Addresses and open bills move over, missing
+// details are copied and the most recent marketing consent wins. Sales are immutable and
+// keep pointing at the duplicate, which is soft deleted and remembers what replaced it.
+func Merge(tx *gorm.DB, chainId uint, customerId uint, duplicateId uint) (models.Customer, error) {
+	var customer, duplicate models.Customer
+	if customerId == duplicateId {
+		return customer, ErrMergeSelf
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// Lock both rows in id order so two merges of the same pair can not deadlock
+		var locked []models.Customer
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("chain_id = ? AND id IN ?", chainId, []uint{customerId, duplicateId}).
+			Order("id").Find(&locked).Error
+		if err != nil {
+			return err
+		}
+		if len(locked) != 2 {
+			return gorm.ErrRecordNotFound
+		}
+		for _, c := range locked {
+			if c.ID == customerId {
+				customer = c
+			} else {
+				duplicate = c
+			}
+		}
+
+		if customer.Name == "" {
+			customer.Name = duplicate.Name
+		}
+		if customer.Email == "" {
+			customer.Email = duplicate.Email
+		}
+		if duplicate.ConsentUpdatedAt != nil && (customer.ConsentUpdatedAt == nil || duplicate.ConsentUpdatedAt.After(*customer.ConsentUpdatedAt)) {
+			customer.MarketingSms = duplicate.MarketingSms
+			customer.MarketingEmail = duplicate.MarketingEmail
+			customer.MarketingWhatsapp = duplicate.MarketingWhatsapp
+			customer.ConsentUpdatedAt = duplicate.ConsentUpdatedAt
+		}
+		err = tx.Model(&customer).Select("name", "email", "marketing_sms", "marketing_email", "marketing_whatsapp", "consent_updated_at").Updates(&customer).Error
+		if err != nil {
+			return err
+		}
+
+		// The default address of the customer stays the default one
+		var hasDefault int64
+		err = tx.Model(&models.CustomerAddress{}).Where("customer_id = ? AND is_default", customer.ID).Count(&hasDefault).Error
+		if err != nil {
+			return err
+		}
+		addresses := map[string]interface{}{"customer_id": customer.ID}
+		if hasDefault > 0 {
+			addresses["is_default"] = false
+		}
+		err = tx.Model(&models.CustomerAddress{}).Where("customer_id = ?", duplicate.ID).Updates(addresses).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Model(&models.Bill{}).Where("customer_id = ? AND status = ?", duplicate.ID, models.BillOpen).Update("customer_id", customer.ID).Error
+		if err != nil {
+			return err
+		}
+
+		// Customers merged into the duplicate earlier now point at the customer
+		err = tx.Unscoped().Model(&models.Customer{}).Where("merged_into_id = ?", duplicate.ID).Update("merged_into_id", customer.ID).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&duplicate).Update("merged_into_id", customer.ID).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&duplicate).Error
+	})
+	return customer, err
+}
+
+func digits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,7 +1,6 @@
 package db
 
 import (
-	"easystore/models"
 	"os"
 
 	"gorm.io/driver/postgres"
@@ -18,12 +17,5 @@ func Connect() {
 		panic("Failed to connect to database!")
 	}
 
-	DB.AutoMigrate(&models.Outlet{})
-	DB.AutoMigrate(&models.Employee{})
-	DB.AutoMigrate(&models.OutletEmployee{})
-	DB.AutoMigrate(&models.OutletServicePincode{})
-	DB.AutoMigrate(&models.Product{})
-	DB.AutoMigrate(&models.ProductCategory{})
-	DB.AutoMigrate(&models.ProductVarient{})
-	DB.AutoMigrate(&models.Stock{})
+	registerTenancy(DB)
 }
@@ -0,0 +1,155 @@
+package db
+
+import (
+	"easystore/models"
+
+	"gorm.io/gorm"
+)
+
+// migrations bring the database up to date, in order. Data migrations run between the
+// tables they read and those whose new columns or indexes need them.
+var migrations = []func(*gorm.DB) error{
+	autoMigrate(
+		&models.Organization{},
+		&models.Outlet{},
+		&models.Employee{},
+	),
+	migrateOrganizations,
+	migrateOrganizationKeys,
+	autoMigrate(
+		&models.OutletEmployee{},
+	),
+	migratePincodeDuplicates,
+	autoMigrate(
+		&models.OutletServicePincode{},
+		&models.Customer{},
+		&models.CustomerAddress{},
+		&models.Cart{},
+		&models.CartLine{},
+		&models.Product{},
+		&models.ProductCategory{},
+	),
+	migrateVarientOutlets,
+	autoMigrate(
+		&models.ProductVarient{},
+		&models.Stock{},
+		&models.ProductVarientPrice{},
+		&models.Bill{},
+		&models.BillLine{},
+		&models.BillPayment{},
+		&models.Sale{},
+		&models.SaleLine{},
+		&models.SalePayment{},
+		&models.Shift{},
+		&models.ShiftCashEvent{},
+		&models.ShiftCount{},
+		&models.DeliverySlotTemplate{},
+		&models.DeliverySlotOverride{},
+		&models.OutletHours{},
+		&models.OutletHoliday{},
+		&models.OutletSettings{},
+		&models.DeliverySlot{},
+		&models.Order{},
+		&models.OrderLine{},
+		&models.OrderHistory{},
+		&models.OrderEvent{},
+		&models.StreamTicket{},
+		&models.Payment{},
+		&models.PaymentRefund{},
+		&models.PaymentWebhook{},
+		&models.Return{},
+		&models.ReturnLine{},
+		&models.ReturnRefund{},
+		&models.StoreCreditEntry{},
+		&models.InvoiceSeries{},
+		&models.Invoice{},
+		&models.InvoicePrint{},
+		&models.Promotion{},
+		&models.PromotionTarget{},
+		&models.PromotionRedemption{},
+		&models.LoyaltyRule{},
+		&models.LoyaltyEntry{},
+		&models.GiftCard{},
+		&models.GiftCardEntry{},
+		&models.Rider{},
+		&models.DeliveryAssignment{},
+		&models.CatalogImportJob{},
+		&models.CatalogImportError{},
+	),
+}
+
+// migratedModels are the models of every table the migrations create
+var migratedModels []interface{}
+
+// Migrate brings the tables up to date with the models and moves existing data along,
+// stopping at the first step that fails
+func Migrate() error {
+	for _, migrate := range migrations {
+		if err := migrate(DB); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Private methods
+
+// autoMigrate creates the tables of models and adds their missing columns and indexes
+func autoMigrate(tables ...interface{}) func(*gorm.DB) error {
+	migratedModels = append(migratedModels, tables...)
+	return func(db *gorm.DB) error {
+		for _, model := range tables {
+			if err := db.AutoMigrate(model); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// migrateVarientOutlets adds the outlet to existing varients, taken from their product,
+// before the index making SKUs unique within an outlet is created
+func migrateVarientOutlets(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.ProductVarient{}) || db.Migrator().HasColumn(&models.ProductVarient{}, "OutletId") {
+		return nil
+	}
+	if err := db.Migrator().AddColumn(&models.ProductVarient{}, "OutletId"); err != nil {
+		return err
+	}
+	return db.Exec("UPDATE product_varients SET outlet_id = products.outlet_id FROM products WHERE products.id = product_varients.product_id").Error
+}
+
+// migratePincodeDuplicates clears the pincodes of outlets of the rows the unique index on
+// outlet and pincode would refuse, before it is created: deleted rows, which are no longer
+// kept, and all but the first row of a pincode assigned to an outlet more than once
+func migratePincodeDuplicates(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&models.OutletServicePincode{}) || db.Migrator().HasIndex(&models.OutletServicePincode{}, "idx_outlet_service_pincode") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM outlet_service_pincodes WHERE deleted_at IS NOT NULL").Error; err != nil {
+			return err
+		}
+		return tx.Exec(`DELETE FROM outlet_service_pincodes WHERE id IN (
+			SELECT id FROM (SELECT id, ROW_NUMBER() OVER (PARTITION BY outlet_id, pincode ORDER BY id) AS position FROM outlet_service_pincodes) AS rows
+			WHERE rows.position > 1)`).Error
+	})
+}
+
+// migrateOrganizationKeys gives the organizations created before public keys one
+func migrateOrganizationKeys(db *gorm.DB) error {
+	var organizations []models.Organization
+	if err := db.Unscoped().Where("public_key IS NULL OR public_key = ''").Find(&organizations).Error; err != nil {
+		return err
+	}
+	for _, organization := range organizations {
+		key, err := models.NewPublicKey()
+		if err != nil {
+			return err
+		}
+		if err := db.Model(&organization).Unscoped().Update("public_key", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// organizationKey is the context key holding the organization of a request
+type organizationKey struct{}
+
+var ErrCrossOrganization = errors.New("record belongs to another organization")
+
+// ErrUnscopedTable is returned for statements of an organization on a table not known to
+// belong to one, rather than letting them see the records of every organization
+var ErrUnscopedTable = errors.New("table is not scoped to an organization")
+
+// tenantFields are the fields naming the organization a record belongs to. Chain ids of
+// customers, loyalty rules, gift cards and settings are organization ids.
+var tenantFields = []string{"OrganizationId", "ChainId"}
+
+// parent is the record a record without an organization or outlet of its own belongs to,
+// by the column naming it and its model
+type parent struct {
+	column string
+	model  interface{}
+}
+
+// parentTables are the tables without an organization or outlet of their own, scoped
+// through the record they belong to
+var parentTables = map[string]parent{
+	"customer_addresses":     {"customer_id", &models.Customer{}},
+	"cart_lines":             {"cart_id", &models.Cart{}},
+	"stocks":                 {"varient_id", &models.ProductVarient{}},
+	"product_varient_prices": {"varient_id", &models.ProductVarient{}},
+	"bill_lines":             {"bill_id", &models.Bill{}},
+	"bill_payments":          {"bill_id", &models.Bill{}},
+	"sale_lines":             {"sale_id", &models.Sale{}},
+	"sale_payments":          {"sale_id", &models.Sale{}},
+	"shift_cash_events":      {"shift_id", &models.Shift{}},
+	"shift_counts":           {"shift_id", &models.Shift{}},
+	"order_lines":            {"order_id", &models.Order{}},
+	"order_histories":        {"order_id", &models.Order{}},
+	"order_events":           {"order_id", &models.Order{}},
+	"payments":               {"order_id", &models.Order{}},
+	"payment_refunds":        {"order_id", &models.Order{}},
+	"return_lines":           {"return_id", &models.Return{}},
+	"return_refunds":         {"return_id", &models.Return{}},
+	"invoice_prints":         {"invoice_id", &models.Invoice{}},
+	"promotion_targets":      {"promotion_id", &models.Promotion{}},
+	"promotion_redemptions":  {"promotion_id", &models.Promotion{}},
+	"riders":                 {"employee_id", &models.Employee{}},
+	"catalog_import_errors":  {"job_id", &models.CatalogImportJob{}},
+}
+
+// sharedTables are the tables belonging to no organization. Payment webhooks are received
+// before the order they are for is known.
+var sharedTables = map[string]bool{
+	"payment_webhooks": true,
+}
+
+// schemas caches the schemas of parent models
+var schemas sync.Map
+
+// chainTables are the tables with a chain id, which named the manager of the chain before
+// there were organizations
+var chainTables = []string{"customers", "loyalty_rules", "gift_cards", "outlet_settings"}
+
+// Tenant returns the database scoped to the organization in ctx. Queries, updates and
+// deletes of records belonging to an organization only see those of that organization, and
+// records created get it. Records of an outlet, or of a record of an outlet, are scoped
+// through the organization of the outlet, and statements on tables not known to belong to
+// an organization fail. Raw SQL and Exec are not scoped, and must only name records already
+// found through the tenant database.
+func Tenant(ctx context.Context) *gorm.DB {
+	return DB.WithContext(ctx)
+}
+
+// OrganizationOf returns the organization in ctx, zero when there is none
+func OrganizationOf(ctx context.Context) uint {
+	if ctx == nil {
+		return 0
+	}
+	organizationId, _ := ctx.Value(organizationKey{}).(uint)
+	return organizationId
+}
+
+// WithOrganization returns ctx carrying organizationId, for work running outside of the
+// request that started it
+func WithOrganization(ctx context.Context, organizationId uint) context.Context {
+	return context.WithValue(ctx, organizationKey{}, organizationId)
+}
+
+// Private methods
+
+// registerTenancy scopes every statement run with an organization in its context
+func registerTenancy(db *gorm.DB) {
+	db.Callback().Query().Before("gorm:query").Register("tenancy:query", scopeStatement)
+	db.Callback().Row().Before("gorm:row").Register("tenancy:row", scopeStatement)
+	db.Callback().Update().Before("gorm:update").Register("tenancy:update", scopeStatement)
+	db.Callback().Delete().Before("gorm:delete").Register("tenancy:delete", scopeStatement)
+	db.Callback().Create().Before("gorm:create").Register("tenancy:create", assignOrganization)
+}
+
+// scopeStatement limits a statement to the records of the organization
+func scopeStatement(tx *gorm.DB) {
+	organizationId := OrganizationOf(tx.Statement.Context)
+	if organizationId == 0 || tx.Statement.Schema == nil {
+		return
+	}
+
+	scope, err := organizationScope(tx.Statement.Schema, clause.CurrentTable, organizationId, tx.NamingStrategy)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	if scope != nil {
+		tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{scope}})
+	}
+}
+
+// organizationScope returns the condition limiting the records of s, named through table,
+// to those of the organization. It is nil for shared tables.
+func organizationScope(s *schema.Schema, table string, organizationId uint, namer schema.Namer) (clause.Expression, error) {
+	if s.Table == "organizations" {
+		return clause.Eq{Column: clause.Column{Table: table, Name: "id"}, Value: organizationId}, nil
+	}
+	if field := tenantField(s); field != nil {
+		return clause.Eq{Column: clause.Column{Table: table, Name: field.DBName}, Value: organizationId}, nil
+	}
+	if field := s.LookUpField("OutletId"); field != nil {
+		return clause.Expr{
+			SQL:  "? IN (SELECT id FROM outlets WHERE organization_id = ?)",
+			Vars: []interface{}{clause.Column{Table: table, Name: field.DBName}, organizationId},
+		}, nil
+	}
+	if parent, ok := parentTables[s.Table]; ok {
+		parentSchema, err := schema.Parse(parent.model, &schemas, namer)
+		if err != nil {
+			return nil, err
+		}
+		scope, err := organizationScope(parentSchema, parentSchema.Table, organizationId, namer)
+		if err != nil || scope == nil {
+			return nil, err
+		}
+		return clause.Expr{
+			SQL:  "? IN (SELECT id FROM " + parentSchema.Table + " WHERE ?)",
+			Vars: []interface{}{clause.Column{Table: table, Name: parent.column}, scope},
+		}, nil
+	}
+	if sharedTables[s.Table] {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnscopedTable, s.Table)
+}
+
+// assignOrganization gives records created without an organization the one of the
+// statement, and refuses records of another organization
+func assignOrganization(tx *gorm.DB) {
+	organizationId := OrganizationOf(tx.Statement.Context)
+	if organizationId == 0 || tx.Statement.Schema == nil {
+		return
+	}
+	field := tenantField(tx.Statement.Schema)
+	if field == nil {
+		return
+	}
+
+	assign := func(record reflect.Value) {
+		value, zero := field.ValueOf(tx.Statement.Context, record)
+		if zero {
+			if err := field.Set(tx.Statement.Context, record, organizationId); err != nil {
+				tx.AddError(err)
+			}
+		} else if id, ok := value.(uint); ok && id != organizationId {
+			tx.AddError(ErrCrossOrganization)
+		}
+	}
+	switch tx.Statement.ReflectValue.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < tx.Statement.ReflectValue.Len(); i++ {
+			assign(reflect.Indirect(tx.Statement.ReflectValue.Index(i)))
+		}
+	case reflect.Struct:
+		assign(tx.Statement.ReflectValue)
+	}
+}
+
+func tenantField(s *schema.Schema) *schema.Field {
+	for _, name := range tenantFields {
+		if field := s.LookUpField(name); field != nil {
+			return field
+		}
+	}
+	return nil
+}
+
+// migrateOrganizations puts the outlets of each manager without an organization into one
+// of their own, as chains were the outlets of a manager before organizations. Employees of
+// those outlets join it, the first one found for employees of more than one chain, and
+// chain ids move from the manager to the organization.
+func migrateOrganizations(db *gorm.DB) error {
+	var managerIds []uint
+	err := db.Model(&models.Outlet{}).Unscoped().Where("organization_id = 0").Distinct().Pluck("manager_id", &managerIds).Error
+	if err != nil || len(managerIds) == 0 {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Customers pointed at the manager of their chain
+		if tx.Migrator().HasConstraint(&models.Customer{}, "fk_customers_chain") {
+			if err := tx.Migrator().DropConstraint(&models.Customer{}, "fk_customers_chain"); err != nil {
+				return err
+			}
+		}
+
+		var chains []string
+		var args []interface{}
+		for _, managerId := range managerIds {
+			var manager models.Employee
+			name := fmt.Sprintf("Chain %d", managerId)
+			if tx.Unscoped().Omit("password").Limit(1).Find(&manager, managerId).RowsAffected > 0 {
+				name = manager.Name
+			}
+			owner := managerId
+			organization := models.Organization{Name: name, OwnerId: &owner, Status: "active"}
+			if err := tx.Create(&organization).Error; err != nil {
+				return err
+			}
+
+			err := tx.Model(&models.Outlet{}).Unscoped().Where("manager_id = ? AND organization_id = 0", managerId).Update("organization_id", organization.ID).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Exec("UPDATE employees SET organization_id = ? WHERE organization_id = 0 AND (id = ? OR id IN (SELECT outlet_employees.employee_id FROM outlet_employees JOIN outlets ON outlets.id = outlet_employees.outlet_id WHERE outlets.manager_id = ?))",
+				organization.ID, managerId, managerId).Error
+			if err != nil {
+				return err
+			}
+			chains = append(chains, "(?::bigint, ?::bigint)")
+			args = append(args, managerId, organization.ID)
+		}
+
+		// Chain ids are negated on the way so that an organization id equal to the id of
+		// another manager is neither moved again nor taken by two chains at once
+		for _, table := range chainTables {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+			err := tx.Exec("UPDATE "+table+" SET chain_id = -chains.organization_id FROM (VALUES "+strings.Join(chains, ", ")+") AS chains(manager_id, organization_id) WHERE "+table+".chain_id = chains.manager_id", args...).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE " + table + " SET chain_id = -chain_id WHERE chain_id < 0").Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
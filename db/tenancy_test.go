@@ -0,0 +1,66 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+func TestEveryMigratedModelIsScoped(t *testing.T) {
+	var cache sync.Map
+	namer := schema.NamingStrategy{}
+	for _, model := range migratedModels {
+		s, err := schema.Parse(model, &cache, namer)
+		if err != nil {
+			t.Fatalf("schema.Parse(%T) error = %v", model, err)
+		}
+		scope, err := organizationScope(s, clause.CurrentTable, 1, namer)
+		if err != nil {
+			t.Errorf("%s is not scoped: %v", s.Table, err)
+		} else if scope == nil && !sharedTables[s.Table] {
+			t.Errorf("%s has no scope", s.Table)
+		}
+	}
+}
+
+func TestParentTablesAreMigrated(t *testing.T) {
+	var cache sync.Map
+	namer := schema.NamingStrategy{}
+	tables := map[string]bool{}
+	for _, model := range migratedModels {
+		s, err := schema.Parse(model, &cache, namer)
+		if err != nil {
+			t.Fatalf("schema.Parse(%T) error = %v", model, err)
+		}
+		tables[s.Table] = true
+	}
+	for table, parent := range parentTables {
+		if !tables[table] {
+			t.Errorf("%s is not migrated", table)
+		}
+		s, err := schema.Parse(parent.model, &cache, namer)
+		if err != nil {
+			t.Fatalf("schema.Parse(%T) error = %v", parent.model, err)
+		}
+		if _, ok := s.FieldsByDBName["id"]; !ok {
+			t.Errorf("parent %s of %s has no id", s.Table, table)
+		}
+	}
+}
+
+func TestUnknownTableFailsClosed(t *testing.T) {
+	type Unknown struct {
+		ID   uint
+		Name string
+	}
+	s, err := schema.Parse(&Unknown{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := organizationScope(s, clause.CurrentTable, 1, schema.NamingStrategy{}); !errors.Is(err, ErrUnscopedTable) {
+		t.Errorf("organizationScope(unknowns) error = %v, want ErrUnscopedTable", err)
+	}
+}
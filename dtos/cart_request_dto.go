@@ -0,0 +1,25 @@
+package dtos
+
+import "easystore/models"
+
+type CartLine struct {
+	VarientId uint `json:"varient_id" example:"1"`
+	Quantity  int  `json:"quantity" example:"1"`
+}
+
+type CartLineUpdate struct {
+	Quantity int `json:"quantity" example:"2"`
+}
+
+// CartAddress sets the delivery address of a cart. An empty body removes it.
+type CartAddress struct {
+	AddressId uint `json:"address_id" example:"1"`
+}
+
+type Checkout struct {
+	PaymentMethod string           `json:"payment_method" example:"online"`
+	Slot          *OrderSlot       `json:"slot"`
+	Points        int              `json:"points" example:"200"`
+	GiftCards     []GiftCardTender `json:"gift_cards"`
+	StoreCredit   models.Money     `json:"store_credit" swaggertype:"number" example:"0"`
+}
@@ -0,0 +1,35 @@
+package dtos
+
+type Customer struct {
+	Phone   string          `json:"phone" example:"9876543210"`
+	Name    string          `json:"name" example:"Anu Thomas"`
+	Email   string          `json:"email" example:"anu@example.com"`
+	Consent CustomerConsent `json:"consent"`
+}
+
+type CustomerUpdate struct {
+	Phone string `json:"phone" example:"9876543210"`
+	Name  string `json:"name" example:"Anu Thomas"`
+	Email string `json:"email" example:"anu@example.com"`
+}
+
+// CustomerConsent changes only the flags that are present
+type CustomerConsent struct {
+	MarketingSms      *bool `json:"marketing_sms" example:"true"`
+	MarketingEmail    *bool `json:"marketing_email" example:"false"`
+	MarketingWhatsapp *bool `json:"marketing_whatsapp" example:"true"`
+}
+
+type CustomerAddress struct {
+	Label     string `json:"label" example:"Home"`
+	Line1     string `json:"line1" example:"TC 12/345, Temple Road"`
+	Line2     string `json:"line2" example:"Near Post Office"`
+	City      string `json:"city" example:"Attingal"`
+	State     string `json:"state" example:"Kerala"`
+	Pincode   string `json:"pincode" example:"695101"`
+	IsDefault bool   `json:"is_default" example:"true"`
+}
+
+type CustomerMerge struct {
+	DuplicateId uint `json:"duplicate_id" example:"12"`
+}
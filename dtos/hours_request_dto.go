@@ -0,0 +1,20 @@
+package dtos
+
+// BusinessHours replaces the weekly opening hours of an outlet. An outlet without any hours
+// is open around the clock. "00:00" as the closing time means midnight.
+type BusinessHours struct {
+	Timezone string         `json:"timezone" example:"Asia/Kolkata"`
+	Hours    []OpeningHours `json:"hours"`
+}
+
+// OpeningHours opens an outlet between open and close on every weekday given
+type OpeningHours struct {
+	Weekdays []int  `json:"weekdays" example:"1,2,3,4,5,6"`
+	Open     string `json:"open" example:"09:00"`
+	Close    string `json:"close" example:"21:00"`
+}
+
+type Holiday struct {
+	Date string `json:"date" example:"2026-11-01"`
+	Name string `json:"name" example:"Kerala Piravi"`
+}
@@ -0,0 +1,8 @@
+package dtos
+
+// Invoice names the sale, delivered order or return to issue the invoice or credit note of
+type Invoice struct {
+	SaleId   uint `json:"sale_id" example:"1"`
+	OrderId  uint `json:"order_id" example:"0"`
+	ReturnId uint `json:"return_id" example:"0"`
+}
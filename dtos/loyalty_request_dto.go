@@ -0,0 +1,24 @@
+package dtos
+
+import "easystore/models"
+
+// LoyaltyRule sets the loyalty program of the chain of an outlet, or of the outlet alone
+// with scope outlet
+type LoyaltyRule struct {
+	Scope              string       `json:"scope" example:"chain"`
+	PointsPer100       int          `json:"points_per_100" example:"1"`
+	SilverPointsPer100 int          `json:"silver_points_per_100" example:"2"`
+	GoldPointsPer100   int          `json:"gold_points_per_100" example:"3"`
+	SilverSpend        models.Money `json:"silver_spend" swaggertype:"number" example:"10000.00"`
+	GoldSpend          models.Money `json:"gold_spend" swaggertype:"number" example:"50000.00"`
+	PointValue         models.Money `json:"point_value" swaggertype:"number" example:"0.25"`
+	MinRedeemPoints    int          `json:"min_redeem_points" example:"100"`
+	MaxRedeemPercent   int          `json:"max_redeem_percent" example:"50"`
+	ExpiryDays         int          `json:"expiry_days" example:"365"`
+	Active             *bool        `json:"active" example:"true"`
+}
+
+// LoyaltyPoints is the loyalty points a customer pays with
+type LoyaltyPoints struct {
+	Points int `json:"points" example:"200"`
+}
@@ -0,0 +1,26 @@
+package dtos
+
+import "easystore/models"
+
+type Order struct {
+	CustomerId    uint             `json:"customer_id" example:"1"`
+	AddressId     uint             `json:"address_id" example:"1"`
+	PaymentMethod string           `json:"payment_method" example:"cod"`
+	AutoRoute     bool             `json:"auto_route" example:"false"`
+	Slot          *OrderSlot       `json:"slot"`
+	Coupon        string           `json:"coupon" example:"DAIRY10"`
+	Points        int              `json:"points" example:"0"`
+	GiftCards     []GiftCardTender `json:"gift_cards"`
+	StoreCredit   models.Money     `json:"store_credit" swaggertype:"number" example:"0"`
+	Lines         []OrderLine      `json:"lines"`
+}
+
+type OrderLine struct {
+	VarientId uint `json:"varient_id" example:"1"`
+	Quantity  int  `json:"quantity" example:"2"`
+}
+
+type OrderTransition struct {
+	Status string `json:"status" example:"confirmed"`
+	Reason string `json:"reason" example:"Customer asked to cancel"`
+}
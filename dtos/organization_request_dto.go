@@ -0,0 +1,11 @@
+package dtos
+
+// OrganizationSignup creates an organization with the employee who owns it
+type OrganizationSignup struct {
+	Name  string         `json:"name" example:"Superstore"`
+	Owner EmployeeCreate `json:"owner"`
+}
+
+type Organization struct {
+	Name string `json:"name" example:"Superstore"`
+}
@@ -1,15 +1,28 @@
 package dtos
 
 type Outlet struct {
-	Name        string `json:"name" example:"Superstore Attingal"`
-	Description string `json:"description" example:"Superstore Attingal is a supermarket located in Attingal, Kerala"`
-	Location    string `json:"location" example:"Attingal, Kerala"`
-	Phone       string `json:"phone" example:"9876543210"`
-	Email       string `json:"email" example:"attingal@superstore.com"`
-	Website     string `json:"website" example:"attingal.superstore.com"`
-	Status      string `json:"status" example:"active"`
+	Name         string   `json:"name" example:"Superstore Attingal"`
+	Description  string   `json:"description" example:"Superstore Attingal is a supermarket located in Attingal, Kerala"`
+	Location     string   `json:"location" example:"Attingal, Kerala"`
+	AddressLine1 string   `json:"address_line1" example:"TB Junction"`
+	AddressLine2 string   `json:"address_line2" example:"Near KSRTC Bus Stand"`
+	City         string   `json:"city" example:"Attingal"`
+	State        string   `json:"state" example:"Kerala"`
+	Pincode      string   `json:"pincode" example:"695101"`
+	Latitude     *float64 `json:"latitude" example:"8.6967"`
+	Longitude    *float64 `json:"longitude" example:"76.8150"`
+	Timezone     string   `json:"timezone" example:"Asia/Kolkata"`
+	StateCode    string   `json:"state_code" example:"32"`
+	Gstin        string   `json:"gstin" example:"32AAPFU0939F1Z4"`
+	UpiId        string   `json:"upi_id" example:"superstore.attingal@okaxis"`
+	PricingMode  string   `json:"pricing_mode" example:"inclusive"`
+	Phone        string   `json:"phone" example:"9876543210"`
+	Email        string   `json:"email" example:"attingal@superstore.com"`
+	Website      string   `json:"website" example:"attingal.superstore.com"`
+	Status       string   `json:"status" example:"active"`
 }
 
 type OutletPincodes struct {
-	Pincodes []string `json:"pincodes" example:"["695606", 695101", "695103"]"`
+	Pincodes []string `json:"pincodes" example:"695606,695101,695103"`
+	Priority int      `json:"priority" example:"10"`
 }
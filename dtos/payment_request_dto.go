@@ -0,0 +1,7 @@
+package dtos
+
+// MockPayment is a webhook event for the mock provider to send, one of payment.authorized,
+// payment.captured or payment.failed
+type MockPayment struct {
+	Event string `json:"event" example:"payment.captured"`
+}
@@ -0,0 +1,44 @@
+package dtos
+
+import "easystore/models"
+
+type BillLine struct {
+	VarientId uint   `json:"varient_id" example:"1"`
+	Barcode   string `json:"barcode" example:"8901234567890"`
+	Quantity  int    `json:"quantity" example:"1"`
+}
+
+type BillLineUpdate struct {
+	Quantity int `json:"quantity" example:"2"`
+}
+
+type BillPayment struct {
+	Method    string       `json:"method" example:"cash"`
+	Amount    models.Money `json:"amount" swaggertype:"number" example:"100.00"`
+	Reference string       `json:"reference" example:"UPI-123456"`
+}
+
+type ShiftOpen struct {
+	OpeningFloat models.Money `json:"opening_float" swaggertype:"number" example:"2000.00"`
+}
+
+type ShiftCashEvent struct {
+	Type   string       `json:"type" example:"cash_out"`
+	Amount models.Money `json:"amount" swaggertype:"number" example:"500.00"`
+	Reason string       `json:"reason" example:"Paid for milk delivery"`
+}
+
+type ShiftClose struct {
+	Counts []ShiftCount `json:"counts"`
+}
+
+type ShiftCount struct {
+	Method  string       `json:"method" example:"cash"`
+	Counted models.Money `json:"counted" swaggertype:"number" example:"5230.00"`
+}
+
+// BillCustomer attaches a customer to a bill by id or phone. An empty body detaches it.
+type BillCustomer struct {
+	CustomerId uint   `json:"customer_id" example:"1"`
+	Phone      string `json:"phone" example:"9876543210"`
+}
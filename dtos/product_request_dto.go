@@ -1,20 +1,37 @@
 package dtos
 
+import (
+	"easystore/models"
+	"time"
+)
+
 type Product struct {
 	Title       string           `json:"title"`
 	Description string           `json:"description"`
 	CategoryId  uint             `json:"category_id"`
 	Status      string           `json:"status"`
+	HsnCode     string           `json:"hsn_code" example:"0401"`
+	GstRate     int              `json:"gst_rate" example:"5"`
+	CessRate    int              `json:"cess_rate" example:"0"`
 	Varients    []ProductVarient `josn:"varients"`
 }
 
 type ProductVarient struct {
-	Name         string  `json:"name"`
-	SellingPrice float64 `json:"selling_price"`
-	Mrp          float64 `json:"mrp"`
+	Name         string       `json:"name"`
+	Sku          string       `json:"sku"`
+	Barcode      string       `json:"barcode"`
+	SellingPrice models.Money `json:"selling_price" swaggertype:"number" example:"95.00"`
+	Mrp          models.Money `json:"mrp" swaggertype:"number" example:"100.00"`
 }
 
 type ProductCategory struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	ReturnWindowDays *int   `json:"return_window_days" example:"7"`
+}
+
+type ProductVarientPriceSchedule struct {
+	SellingPrice  models.Money `json:"selling_price" swaggertype:"number" example:"95.00"`
+	Mrp           models.Money `json:"mrp" swaggertype:"number" example:"100.00"`
+	EffectiveFrom time.Time    `json:"effective_from" example:"2025-04-01T00:00:00+05:30"`
 }
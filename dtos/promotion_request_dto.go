@@ -0,0 +1,44 @@
+package dtos
+
+import (
+	"easystore/models"
+	"time"
+)
+
+type Promotion struct {
+	Name             string            `json:"name" example:"Weekend dairy sale"`
+	Description      string            `json:"description" example:"10% off all dairy products on weekends"`
+	Type             string            `json:"type" example:"percent"`
+	PercentOff       int               `json:"percent_off" example:"10"`
+	AmountOff        models.Money      `json:"amount_off" swaggertype:"number" example:"0"`
+	BuyQuantity      int               `json:"buy_quantity" example:"0"`
+	GetQuantity      int               `json:"get_quantity" example:"0"`
+	BundleQuantity   int               `json:"bundle_quantity" example:"0"`
+	BundlePrice      models.Money      `json:"bundle_price" swaggertype:"number" example:"0"`
+	MinSubtotal      models.Money      `json:"min_subtotal" swaggertype:"number" example:"200.00"`
+	MaxDiscount      models.Money      `json:"max_discount" swaggertype:"number" example:"100.00"`
+	StartsAt         *time.Time        `json:"starts_at" example:"2025-04-01T00:00:00+05:30"`
+	EndsAt           *time.Time        `json:"ends_at" example:"2025-04-30T23:59:59+05:30"`
+	Days             string            `json:"days" example:"0,6"`
+	StartTime        string            `json:"start_time" example:"17:00"`
+	EndTime          string            `json:"end_time" example:"19:00"`
+	Channel          string            `json:"channel" example:"all"`
+	CouponCode       string            `json:"coupon_code" example:"DAIRY10"`
+	UsageLimit       int               `json:"usage_limit" example:"500"`
+	PerCustomerLimit int               `json:"per_customer_limit" example:"1"`
+	Priority         int               `json:"priority" example:"10"`
+	Stackable        bool              `json:"stackable" example:"false"`
+	Status           string            `json:"status" example:"active"`
+	Targets          []PromotionTarget `json:"targets"`
+}
+
+// PromotionTarget names one varient, product or category a promotion covers
+type PromotionTarget struct {
+	VarientId  *uint `json:"varient_id" example:"0"`
+	ProductId  *uint `json:"product_id" example:"0"`
+	CategoryId *uint `json:"category_id" example:"3"`
+}
+
+type Coupon struct {
+	Code string `json:"code" example:"DAIRY10"`
+}
@@ -0,0 +1,30 @@
+package dtos
+
+type ReturnLine struct {
+	LineId      uint   `json:"line_id" example:"1"`
+	Quantity    int    `json:"quantity" example:"1"`
+	Disposition string `json:"disposition" example:"restock"`
+	Reason      string `json:"reason" example:"Damaged packaging"`
+}
+
+// Return brings back lines of either a sale or a delivered order
+type Return struct {
+	SaleId       uint         `json:"sale_id" example:"1"`
+	OrderId      uint         `json:"order_id" example:"0"`
+	RefundMethod string       `json:"refund_method" example:"original"`
+	Reason       string       `json:"reason" example:"Wrong size"`
+	Lines        []ReturnLine `json:"lines"`
+}
+
+// Exchange returns lines of a sale or delivered order and sells other lines in their place.
+// The payments cover what the new lines cost beyond the value returned, and anything left
+// of the value returned is refunded with the refund method.
+type Exchange struct {
+	SaleId       uint          `json:"sale_id" example:"1"`
+	OrderId      uint          `json:"order_id" example:"0"`
+	RefundMethod string        `json:"refund_method" example:"store_credit"`
+	Reason       string        `json:"reason" example:"Wrong size"`
+	Returns      []ReturnLine  `json:"returns"`
+	Lines        []BillLine    `json:"lines"`
+	Payments     []BillPayment `json:"payments"`
+}
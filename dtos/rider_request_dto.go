@@ -0,0 +1,23 @@
+package dtos
+
+type Rider struct {
+	EmployeeId uint `json:"employee_id" example:"1"`
+}
+
+type RiderStatus struct {
+	Status string `json:"status" example:"available"`
+}
+
+type RiderAssignment struct {
+	Strategy string `json:"strategy" example:"manual"`
+	RiderId  uint   `json:"rider_id" example:"1"`
+}
+
+type DeliveryProof struct {
+	Otp string `json:"otp" example:"123456"`
+}
+
+type RiderLocation struct {
+	Latitude  float64 `json:"latitude" example:"12.9716"`
+	Longitude float64 `json:"longitude" example:"77.5946"`
+}
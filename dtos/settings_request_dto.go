@@ -0,0 +1,19 @@
+package dtos
+
+import "easystore/models"
+
+// OutletSettings changes the settings of the chain of an outlet, or of the outlet alone
+// with scope outlet. Settings left out are kept and those named in reset are inherited
+// again.
+type OutletSettings struct {
+	Scope            string        `json:"scope" example:"outlet"`
+	Version          int           `json:"version" example:"3"`
+	CurrencyCode     *string       `json:"currency_code" example:"INR"`
+	TaxRegistration  *string       `json:"tax_registration" example:"regular"`
+	ReceiptFooter    *string       `json:"receipt_footer" example:"Thank you, visit again!"`
+	RoundingMode     *string       `json:"rounding_mode" example:"nearest"`
+	RoundingUnit     *models.Money `json:"rounding_unit" swaggertype:"number" example:"1.00"`
+	ReturnWindowDays *int          `json:"return_window_days" example:"7"`
+	AllowedTenders   []string      `json:"allowed_tenders" example:"cash,card,upi"`
+	Reset            []string      `json:"reset" example:"receipt_footer"`
+}
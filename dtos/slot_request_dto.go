@@ -0,0 +1,30 @@
+package dtos
+
+// SlotTemplate creates the windows between start and end on every weekday given. With a
+// window length the time is cut into consecutive windows of that many minutes.
+type SlotTemplate struct {
+	Weekdays      []int  `json:"weekdays" example:"1,2,3,4,5"`
+	Start         string `json:"start" example:"08:00"`
+	End           string `json:"end" example:"20:00"`
+	WindowMinutes int    `json:"window_minutes" example:"120"`
+	Capacity      int    `json:"capacity" example:"15"`
+	CutoffMinutes int    `json:"cutoff_minutes" example:"60"`
+}
+
+type SlotTemplateUpdate struct {
+	Capacity      *int  `json:"capacity" example:"20"`
+	CutoffMinutes *int  `json:"cutoff_minutes" example:"90"`
+	Active        *bool `json:"active" example:"true"`
+}
+
+type SlotOverride struct {
+	Date     string `json:"date" example:"2026-11-01"`
+	Closed   bool   `json:"closed" example:"true"`
+	Capacity *int   `json:"capacity" example:"5"`
+	Reason   string `json:"reason" example:"Kerala Piravi"`
+}
+
+type OrderSlot struct {
+	TemplateId uint   `json:"template_id" example:"1"`
+	Date       string `json:"date" example:"2026-10-21"`
+}
@@ -0,0 +1,16 @@
+package dtos
+
+import "easystore/models"
+
+type TaxBreakdown struct {
+	PlaceOfSupply string             `json:"place_of_supply" example:"32"`
+	PricingMode   string             `json:"pricing_mode" example:"inclusive"`
+	Lines         []TaxBreakdownLine `json:"lines"`
+}
+
+type TaxBreakdownLine struct {
+	VarientId uint         `json:"varient_id" example:"1"`
+	Quantity  int          `json:"quantity" example:"2"`
+	UnitPrice models.Money `json:"unit_price" swaggertype:"number" example:"95.00"`
+	Discount  models.Money `json:"discount" swaggertype:"number" example:"0"`
+}
@@ -0,0 +1,27 @@
+package dtos
+
+import "easystore/models"
+
+// GiftCard issues a gift card. Without expiry days the card never expires.
+type GiftCard struct {
+	Amount     models.Money `json:"amount" swaggertype:"number" example:"1000.00"`
+	ExpiryDays int          `json:"expiry_days" example:"365"`
+	CustomerId *uint        `json:"customer_id" example:"1"`
+	Reason     string       `json:"reason" example:"Diwali gift"`
+}
+
+type GiftCardStatus struct {
+	Status string `json:"status" example:"blocked"`
+}
+
+// GiftCardTender is an amount paid from a gift card. At the POS an empty amount takes as
+// much of the balance as the bill needs.
+type GiftCardTender struct {
+	Code   string       `json:"code" example:"K7QM-2XPA-9HTR-4WNB"`
+	Amount models.Money `json:"amount" swaggertype:"number" example:"250.00"`
+}
+
+// StoreCreditTender is an amount paid from the store credit of the customer
+type StoreCreditTender struct {
+	Amount models.Money `json:"amount" swaggertype:"number" example:"150.00"`
+}
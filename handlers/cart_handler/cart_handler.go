@@ -0,0 +1,507 @@
+package cart_handler
+
+import (
+	"easystore/auth"
+	"easystore/carts"
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/orders"
+	"easystore/payments"
+	"easystore/slots"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Get the cart of a customer
+// @Description  Returns the active cart of a customer at the outlet with its savings, taxes and totals at the prices stored on its lines. An empty cart is created when the customer has none.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart [get]
+func GetCart(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+	respondWithCart(c, outlet, customer, http.StatusOK, "Cart fetched successfully")
+}
+
+// @Summary      Add to the cart
+// @Description  Adds a varient of the outlet to the cart of a customer at its current price. Adding a varient already in the cart raises its quantity.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Accept       json
+// @Produce      json
+// @Param        line  body  dtos.CartLine  true  "Cart Line"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/lines [post]
+func AddLine(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	var lineDTO dtos.CartLine
+	err := c.ShouldBindBodyWithJSON(&lineDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if lineDTO.Quantity == 0 {
+		lineDTO.Quantity = 1
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return carts.Add(tx, cart, lineDTO.VarientId, lineDTO.Quantity)
+	})
+	if !respondWithError(c, err, "Unable to add the line") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Line added successfully")
+}
+
+// @Summary      Change the quantity of a cart line
+// @Description  Changes the quantity of a line of the cart of a customer. A quantity of zero removes the line.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Param line_id path string true "Cart Line ID"
+// @Tags         Cart
+// @Accept       json
+// @Produce      json
+// @Param        line  body  dtos.CartLineUpdate  true  "Quantity"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/lines/{line_id} [put]
+func UpdateLine(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+	lineId, ok := setLineId(c)
+	if !ok {
+		return
+	}
+
+	var lineDTO dtos.CartLineUpdate
+	err := c.ShouldBindBodyWithJSON(&lineDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return carts.SetQuantity(tx, cart, lineId, lineDTO.Quantity)
+	})
+	if !respondWithError(c, err, "Unable to update the line") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Line updated successfully")
+}
+
+// @Summary      Remove a cart line
+// @Description  Takes a line out of the cart of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Param line_id path string true "Cart Line ID"
+// @Tags         Cart
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/lines/{line_id} [delete]
+func RemoveLine(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+	lineId, ok := setLineId(c)
+	if !ok {
+		return
+	}
+
+	err := db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return carts.Remove(tx, cart, lineId)
+	})
+	if !respondWithError(c, err, "Unable to remove the line") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Line removed successfully")
+}
+
+// @Summary      Empty the cart
+// @Description  Takes every line out of the cart of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart [delete]
+func ClearCart(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	err := db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return carts.Clear(tx, cart)
+	})
+	if !respondWithError(c, err, "Unable to empty the cart") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Cart emptied successfully")
+}
+
+// @Summary      Set the delivery address of the cart
+// @Description  Picks the address of the customer the cart is to be delivered to, which decides whether its taxes are intra or inter state. An empty body removes the address.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Accept       json
+// @Produce      json
+// @Param        address  body  dtos.CartAddress  true  "Address"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/address [put]
+func SetAddress(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	var addressDTO dtos.CartAddress
+	err := c.ShouldBindBodyWithJSON(&addressDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var addressId *uint
+	if addressDTO.AddressId != 0 {
+		var address models.CustomerAddress
+		tx := db.Tenant(c).Where("customer_id = ?", customer.ID).First(&address, addressDTO.AddressId)
+		if tx.Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Address not found"})
+			return
+		}
+		addressId = &address.ID
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&cart).Update("address_id", addressId).Error
+	})
+	if !respondWithError(c, err, "Unable to set the address") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Address set successfully")
+}
+
+// @Summary      Apply a coupon to the cart
+// @Description  Puts a coupon code on the cart of a customer. The cart is returned with the promotions that apply and, when the coupon does not, the reason why. A cart with a coupon that does not apply can not be checked out.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Accept       json
+// @Produce      json
+// @Param        coupon  body  dtos.Coupon  true  "Coupon"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/coupon [put]
+func SetCoupon(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	var couponDTO dtos.Coupon
+	err := c.ShouldBindBodyWithJSON(&couponDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(couponDTO.Code))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Coupon code is required"})
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&cart).Update("coupon_code", code).Error
+	})
+	if !respondWithError(c, err, "Unable to apply the coupon") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Coupon applied successfully")
+}
+
+// @Summary      Remove the coupon from the cart
+// @Description  Takes the coupon code off the cart of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/coupon [delete]
+func RemoveCoupon(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	err := db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&cart).Update("coupon_code", "").Error
+	})
+	if !respondWithError(c, err, "Unable to remove the coupon") {
+		return
+	}
+
+	respondWithCart(c, outlet, customer, http.StatusAccepted, "Coupon removed successfully")
+}
+
+// @Summary      Revalidate the cart
+// @Description  Checks every line of the cart of a customer against the current price, product status and available stock. Lines that no longer hold are fixed: unavailable or out of stock lines are removed, prices are brought up to date and quantities are cut down to the stock available. Each change is reported with the line, what changed and why.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/revalidate [post]
+func Revalidate(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	var summary carts.Summary
+	var changes []carts.Change
+	err := db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		cart, err := carts.Open(tx, outlet.ID, customer.ID, true)
+		if err != nil {
+			return err
+		}
+		changes, err = carts.Revalidate(tx, &cart)
+		if err != nil {
+			return err
+		}
+		summary, err = carts.Summarize(tx, outlet, cart)
+		return err
+	})
+	if !respondWithError(c, err, "Unable to revalidate the cart") {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Cart revalidated successfully", "result": gin.H{"cart": summary, "changed": len(changes) > 0, "changes": changes}})
+}
+
+// @Summary      Check out the cart
+// @Description  Places a delivery order for the cart of a customer to its delivery address and marks the cart ordered. The cart is revalidated first, and when that changes anything nothing is ordered and the changes are returned with 409 so they can be reviewed. Loyalty points, gift cards and store credit given pay for part of the order. Online orders start their payment straight away for what is left.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Cart
+// @Accept       json
+// @Produce      json
+// @Param        checkout  body  dtos.Checkout  true  "Checkout"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      409  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/cart/checkout [post]
+func Checkout(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	var checkoutDTO dtos.Checkout
+	err := c.ShouldBindBodyWithJSON(&checkoutDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	request := carts.CheckoutRequest{Outlet: outlet, Customer: customer, PaymentMethod: checkoutDTO.PaymentMethod, Points: checkoutDTO.Points, StoreCredit: checkoutDTO.StoreCredit}
+	for _, giftCard := range checkoutDTO.GiftCards {
+		request.GiftCards = append(request.GiftCards, orders.GiftCardRequest{Code: giftCard.Code, Amount: giftCard.Amount})
+	}
+	if checkoutDTO.Slot != nil {
+		date, err := slots.ParseDate(outlet, checkoutDTO.Slot.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Slot date should be in YYYY-MM-DD format"})
+			return
+		}
+		request.Slot = &orders.SlotRequest{TemplateId: checkoutDTO.Slot.TemplateId, Date: date}
+	}
+
+	order, changes, err := carts.Checkout(db.Tenant(c), request, orders.EmployeeActor(auth.CurrentEmployeeID(c)))
+	if errors.Is(err, carts.ErrCartChanged) {
+		cart, err := carts.Open(db.Tenant(c), outlet.ID, customer.ID, false)
+		var summary carts.Summary
+		if err == nil {
+			summary, err = carts.Summarize(db.Tenant(c), outlet, cart)
+		}
+		if !respondWithError(c, err, "Unable to check out the cart") {
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": carts.ErrCartChanged.Error(), "result": gin.H{"cart": summary, "changes": changes}})
+		return
+	}
+	if !respondWithError(c, err, "Unable to check out the cart") {
+		return
+	}
+
+	result := gin.H{"order": order}
+	if order.PaymentMethod == models.PaymentOnline && order.PaymentStatus == models.PaymentPending {
+		// The order stands even when the payment can not be started, it can be started
+		// again from the order
+		provider, err := payments.Current()
+		var payment models.Payment
+		if err == nil {
+			payment, err = payments.Start(c.Request.Context(), db.Tenant(c), provider, order)
+		}
+		if err != nil {
+			result["payment_error"] = err.Error()
+		} else {
+			result["payment"] = payment
+		}
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Cart checked out successfully", "result": result})
+}
+
+// Private methods
+
+var setCustomer = func(c *gin.Context) (models.Outlet, models.Customer, bool) {
+	var outlet models.Outlet
+	var customer models.Customer
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, customer, false
+	}
+
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid customer id"})
+		return outlet, customer, false
+	}
+	customer, err = customers.Find(db.Tenant(c), outlet.ChainId(), uint(customerId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Customer not found"})
+		return outlet, customer, false
+	}
+	return outlet, customer, true
+}
+
+var setLineId = func(c *gin.Context) (uint, bool) {
+	lineId, err := strconv.Atoi(c.Param("line_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid line id"})
+		return 0, false
+	}
+	return uint(lineId), true
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if carts.IsCartError(err) || orders.IsOrderError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
+
+var respondWithCart = func(c *gin.Context, outlet models.Outlet, customer models.Customer, status int, message string) {
+	cart, err := carts.Open(db.Tenant(c), outlet.ID, customer.ID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the cart", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	summary, err := carts.Summarize(db.Tenant(c), outlet, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the cart", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": gin.H{"cart": summary}})
+}
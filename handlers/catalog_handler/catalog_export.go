@@ -0,0 +1,201 @@
+package catalog_handler
+
+import (
+	"easystore/models"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// Export columns follow the import columns so an exported file can be imported again
+var exportColumns = []string{"product_id", "product_title", "product_description", "product_status", "category_title", "category_description", "hsn_code", "gst_rate", "cess_rate", "varient_id", "varient_name", "sku", "selling_price", "mrp", "stock"}
+
+type catalogExportRow struct {
+	ProductId           uint         `json:"product_id"`
+	ProductTitle        string       `json:"product_title"`
+	ProductDescription  string       `json:"product_description"`
+	ProductStatus       string       `json:"product_status"`
+	CategoryTitle       string       `json:"category_title"`
+	CategoryDescription string       `json:"category_description"`
+	HsnCode             string       `json:"hsn_code"`
+	GstRate             int          `json:"gst_rate"`
+	CessRate            int          `json:"cess_rate"`
+	VarientId           uint         `json:"varient_id"`
+	VarientName         string       `json:"varient_name"`
+	Sku                 string       `json:"sku"`
+	SellingPrice        models.Money `json:"selling_price"`
+	Mrp                 models.Money `json:"mrp"`
+	Stock               int          `json:"stock"`
+}
+
+func (row catalogExportRow) values() []string {
+	return []string{
+		strconv.FormatUint(uint64(row.ProductId), 10),
+		row.ProductTitle,
+		row.ProductDescription,
+		row.ProductStatus,
+		row.CategoryTitle,
+		row.CategoryDescription,
+		row.HsnCode,
+		strconv.Itoa(row.GstRate),
+		strconv.Itoa(row.CessRate),
+		strconv.FormatUint(uint64(row.VarientId), 10),
+		row.VarientName,
+		row.Sku,
+		row.SellingPrice.String(),
+		row.Mrp.String(),
+		strconv.Itoa(row.Stock),
+	}
+}
+
+// catalogExportQuery selects one row per varient of the outlet along with its current stock
+func catalogExportQuery(tx *gorm.DB, outletId uint) *gorm.DB {
+	return tx.Table("product_varients").
+		Select(`products.id AS product_id, products.title AS product_title, products.description AS product_description,
+			products.status AS product_status, product_categories.title AS category_title,
+			product_categories.description AS category_description, products.hsn_code, products.gst_rate,
+			products.cess_rate, product_varients.id AS varient_id,
+			product_varients.name AS varient_name, product_varients.sku, product_varients.selling_price,
+			product_varients.mrp, COALESCE(SUM(stocks.quantity), 0) AS stock`).
+		Joins("JOIN products ON products.id = product_varients.product_id AND products.deleted_at IS NULL").
+		Joins("LEFT JOIN product_categories ON product_categories.id = products.category_id AND product_categories.deleted_at IS NULL").
+		Joins("LEFT JOIN stocks ON stocks.varient_id = product_varients.id AND stocks.deleted_at IS NULL").
+		Where("products.outlet_id = ? AND product_varients.deleted_at IS NULL", outletId).
+		Group("products.id, product_categories.id, product_varients.id").
+		Order("products.id, product_varients.id")
+}
+
+// catalogWriter writes export rows one at a time so the catalog is never held in memory.
+// Flush passes the rows buffered so far on to the underlying writer. Fail ends an export
+// that could not be finished with a marker, so a client never takes it for a complete one.
+type catalogWriter interface {
+	Write(row catalogExportRow) error
+	Flush() error
+	Close() error
+	Fail(message string) error
+}
+
+type csvCatalogWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVCatalogWriter(w io.Writer) (catalogWriter, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return &csvCatalogWriter{writer: writer}, nil
+}
+
+func (w *csvCatalogWriter) Write(row catalogExportRow) error {
+	return w.writer.Write(row.values())
+}
+
+func (w *csvCatalogWriter) Flush() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+func (w *csvCatalogWriter) Close() error {
+	return w.Flush()
+}
+
+// Fail ends the file with a comment row after the rows written so far
+func (w *csvCatalogWriter) Fail(message string) error {
+	if err := w.writer.Write([]string{"# export failed: " + message}); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// jsonCatalogWriter writes newline delimited JSON, one object per varient
+type jsonCatalogWriter struct {
+	encoder *json.Encoder
+}
+
+func newJSONCatalogWriter(w io.Writer) (catalogWriter, error) {
+	return &jsonCatalogWriter{encoder: json.NewEncoder(w)}, nil
+}
+
+func (w *jsonCatalogWriter) Write(row catalogExportRow) error {
+	return w.encoder.Encode(row)
+}
+
+func (w *jsonCatalogWriter) Flush() error {
+	return nil
+}
+
+func (w *jsonCatalogWriter) Close() error {
+	return nil
+}
+
+// Fail ends the stream with an object holding only the error
+func (w *jsonCatalogWriter) Fail(message string) error {
+	return w.encoder.Encode(map[string]string{"error": message})
+}
+
+// xlsxCatalogWriter uses the excelize stream writer which keeps only a small
+// buffer in memory and spills the sheet to a temporary file
+type xlsxCatalogWriter struct {
+	out    io.Writer
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	row    int
+}
+
+func newXLSXCatalogWriter(w io.Writer) (catalogWriter, error) {
+	file := excelize.NewFile()
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return nil, err
+	}
+
+	writer := &xlsxCatalogWriter{out: w, file: file, stream: stream, row: 1}
+	header := make([]interface{}, len(exportColumns))
+	for i, column := range exportColumns {
+		header[i] = column
+	}
+	if err := writer.writeRow(header); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *xlsxCatalogWriter) writeRow(values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	w.row++
+	return w.stream.SetRow(cell, values)
+}
+
+func (w *xlsxCatalogWriter) Write(row catalogExportRow) error {
+	return w.writeRow([]interface{}{
+		row.ProductId, row.ProductTitle, row.ProductDescription, row.ProductStatus, row.CategoryTitle,
+		row.CategoryDescription, row.HsnCode, row.GstRate, row.CessRate, row.VarientId, row.VarientName, row.Sku, row.SellingPrice.Float64(), row.Mrp.Float64(), row.Stock,
+	})
+}
+
+// Flush does nothing as the workbook can only be written out once the sheet is complete
+func (w *xlsxCatalogWriter) Flush() error {
+	return nil
+}
+
+func (w *xlsxCatalogWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.out)
+}
+
+// Fail leaves the workbook unwritten. Nothing of it is sent before Close, so the client is
+// left with an empty body it cannot open.
+func (w *xlsxCatalogWriter) Fail(message string) error {
+	return w.file.Close()
+}
@@ -0,0 +1,119 @@
+package catalog_handler
+
+import (
+	"easystore/db"
+	"easystore/models"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportErrorTrailer is the HTTP trailer naming why an export stopped early, left out of
+// exports that finished
+const exportErrorTrailer = "X-Export-Error"
+
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+	newWriter   func(w io.Writer) (catalogWriter, error)
+}{
+	"csv":  {"text/csv", "csv", newCSVCatalogWriter},
+	"json": {"application/x-ndjson", "ndjson", newJSONCatalogWriter},
+	"xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", "xlsx", newXLSXCatalogWriter},
+}
+
+// @Summary      Export the catalog of an outlet
+// @Description  Streams every product varient of an outlet with its category, prices and current stock as CSV, newline delimited JSON or XLSX. An export failing part way ends with a "# export failed" CSV row or an {"error"} JSON line and sets the X-Export-Error trailer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param format query string false "Export format: csv, json or xlsx" default(csv)
+// @Tags         Catalog
+// @Produce      text/csv
+// @Produce      application/x-ndjson
+// @Produce      application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Success      200
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/catalog/export [get]
+func Export(c *gin.Context) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	format, ok := exportFormats[c.DefaultQuery("format", "csv")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Format must be csv, json or xlsx"})
+		return
+	}
+
+	rows, err := catalogExportQuery(db.Tenant(c), outlet.ID).Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to export the catalog", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	defer rows.Close()
+
+	fileName := fmt.Sprintf("catalog-%s-%s.%s", outlet.Identifier, time.Now().Format("20060102"), format.extension)
+	c.Header("Content-Type", format.contentType)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Header("Trailer", exportErrorTrailer)
+	c.Status(http.StatusOK)
+
+	writer, err := format.newWriter(c.Writer)
+	if err != nil {
+		log.Printf("Unable to start catalog export of outlet %d: %v", outlet.ID, err)
+		c.Writer.Header().Set(exportErrorTrailer, "Unable to start the export")
+		return
+	}
+
+	// The status is sent with the first rows, so an export failing after them is marked
+	// as failed in the body and in a trailer instead
+	fail := func(message string, err error) {
+		log.Printf("%s of outlet %d: %v", message, outlet.ID, err)
+		if err := writer.Fail(message); err != nil {
+			log.Printf("Unable to mark the catalog export of outlet %d as failed: %v", outlet.ID, err)
+		}
+		c.Writer.Header().Set(exportErrorTrailer, message)
+	}
+
+	count := 0
+	for rows.Next() {
+		var row catalogExportRow
+		if err := db.Tenant(c).ScanRows(rows, &row); err != nil {
+			fail("Unable to read catalog export row", err)
+			return
+		}
+		if err := writer.Write(row); err != nil {
+			fail("Unable to write catalog export row", err)
+			return
+		}
+
+		// Push the rows out periodically so the client starts receiving data early
+		count++
+		if count%500 == 0 {
+			if err := writer.Flush(); err != nil {
+				fail("Unable to write catalog export", err)
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		fail("Unable to read catalog export", err)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("Unable to finish catalog export of outlet %d: %v", outlet.ID, err)
+		c.Writer.Header().Set(exportErrorTrailer, "Unable to finish the export")
+	}
+}
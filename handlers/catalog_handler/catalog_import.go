@@ -0,0 +1,300 @@
+package catalog_handler
+
+import (
+	"easystore/models"
+	"easystore/pricing"
+	"easystore/tax"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Columns every import file must carry. Descriptions, status and tax columns are optional.
+var requiredImportColumns = []string{"product_title", "category_title", "varient_name", "sku", "selling_price", "mrp"}
+
+type importRow struct {
+	Line                int
+	ProductTitle        string
+	ProductDescription  string
+	ProductStatus       string
+	CategoryTitle       string
+	CategoryDescription string
+	HsnCode             string
+	GstRate             int
+	CessRate            int
+	VarientName         string
+	Sku                 string
+	SellingPrice        models.Money
+	Mrp                 models.Money
+}
+
+type importRowError struct {
+	Row     int    `json:"row"`
+	Sku     string `json:"sku"`
+	Message string `json:"message"`
+}
+
+// readImportFile reads the raw records of a CSV or XLSX file, header row included
+func readImportFile(fileName string, file io.Reader) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".csv":
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		return reader.ReadAll()
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(file)
+		if err != nil {
+			return nil, err
+		}
+		defer workbook.Close()
+
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("workbook has no sheets")
+		}
+		return workbook.GetRows(sheets[0])
+	default:
+		return nil, errors.New("only .csv and .xlsx files are supported")
+	}
+}
+
+// parseImportRows maps the records to import rows and validates every row.
+// Rows with validation errors are left out of the returned rows.
+func parseImportRows(records [][]string) ([]importRow, []importRowError, error) {
+	if len(records) == 0 {
+		return nil, nil, errors.New("file is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")] = i
+	}
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, nil, fmt.Errorf("missing column %q", name)
+		}
+	}
+
+	value := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []importRow
+	var rowErrors []importRowError
+	seenSkus := make(map[string]int)
+	for i, record := range records[1:] {
+		// Line numbers are 1 based and count the header row
+		line := i + 2
+		row := importRow{
+			Line:                line,
+			ProductTitle:        value(record, "product_title"),
+			ProductDescription:  value(record, "product_description"),
+			ProductStatus:       value(record, "product_status"),
+			CategoryTitle:       value(record, "category_title"),
+			CategoryDescription: value(record, "category_description"),
+			HsnCode:             value(record, "hsn_code"),
+			VarientName:         value(record, "varient_name"),
+			Sku:                 value(record, "sku"),
+		}
+
+		if row.ProductTitle == "" && row.VarientName == "" && row.Sku == "" {
+			// Skip blank lines
+			continue
+		}
+
+		message := validateImportRow(&row, value(record, "selling_price"), value(record, "mrp"))
+		if message == "" {
+			message = validateImportTax(&row, value(record, "gst_rate"), value(record, "cess_rate"))
+		}
+		if message == "" {
+			if firstLine, ok := seenSkus[row.Sku]; ok {
+				message = fmt.Sprintf("Duplicate SKU, already used on row %d", firstLine)
+			}
+		}
+		if message != "" {
+			rowErrors = append(rowErrors, importRowError{Row: line, Sku: row.Sku, Message: message})
+			continue
+		}
+
+		seenSkus[row.Sku] = line
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+func validateImportRow(row *importRow, sellingPrice string, mrp string) string {
+	if row.ProductTitle == "" {
+		return "Product title is required"
+	}
+	if row.VarientName == "" {
+		return "Varient name is required"
+	}
+	if row.Sku == "" {
+		return "SKU is required"
+	}
+
+	if row.ProductStatus == "" {
+		row.ProductStatus = "active"
+	}
+	if row.ProductStatus != "active" && row.ProductStatus != "inactive" {
+		return "Status must be active or inactive"
+	}
+
+	category := models.ProductCategory{Title: row.CategoryTitle, Description: row.CategoryDescription}
+	if err := category.Validate(); err != nil {
+		return err.Error()
+	}
+	if row.CategoryTitle == "" {
+		return "Category title is required"
+	}
+
+	var err error
+	row.SellingPrice, err = models.ParseMoney(sellingPrice)
+	if err != nil {
+		return "Selling price must be a number"
+	}
+	row.Mrp, err = models.ParseMoney(mrp)
+	if err != nil {
+		return "MRP must be a number"
+	}
+	if err := models.ValidatePrice(row.SellingPrice, row.Mrp); err != nil {
+		return err.Error()
+	}
+
+	return ""
+}
+
+func validateImportTax(row *importRow, gstRate string, cessRate string) string {
+	if err := tax.ValidateHsn(row.HsnCode); err != nil {
+		return err.Error()
+	}
+
+	var err error
+	if gstRate != "" {
+		if row.GstRate, err = strconv.Atoi(gstRate); err != nil {
+			return "GST rate must be a number"
+		}
+	}
+	if cessRate != "" {
+		if row.CessRate, err = strconv.Atoi(cessRate); err != nil {
+			return "Cess rate must be a number"
+		}
+	}
+	if err := tax.ValidateSlab(row.GstRate, row.CessRate); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// findVarientBySku looks up a varient of the outlet using its SKU, which is unique within
+// the outlet
+func findVarientBySku(tx *gorm.DB, outletId uint, sku string) (models.ProductVarient, error) {
+	var varient models.ProductVarient
+	err := tx.Where("outlet_id = ? AND sku = ?", outletId, sku).First(&varient).Error
+	return varient, err
+}
+
+// applyImportRow upserts the category, product and varient of a row using the SKU as the key.
+// It reports whether the varient was created or an existing one was updated.
+func applyImportRow(tx *gorm.DB, outletId uint, row importRow, changedById uint) (bool, error) {
+	var category models.ProductCategory
+	err := tx.Where("outlet_id = ? AND title = ?", outletId, row.CategoryTitle).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		category = models.ProductCategory{OutletId: outletId, Title: row.CategoryTitle, Description: row.CategoryDescription}
+		if err := category.Validate(); err != nil {
+			return false, err
+		}
+		if err := tx.Create(&category).Error; err != nil {
+			return false, err
+		}
+	} else if err != nil {
+		return false, err
+	}
+
+	varient, err := findVarientBySku(tx, outletId, row.Sku)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, err
+	}
+	created := errors.Is(err, gorm.ErrRecordNotFound)
+
+	var product models.Product
+	if created {
+		err = tx.Where("outlet_id = ? AND title = ?", outletId, row.ProductTitle).First(&product).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+	} else {
+		err = tx.First(&product, varient.ProductId).Error
+		if err != nil {
+			return false, err
+		}
+	}
+
+	product.OutletId = outletId
+	product.Title = row.ProductTitle
+	if row.ProductDescription != "" || product.ID == 0 {
+		product.Description = row.ProductDescription
+	}
+	product.CategoryId = category.ID
+	product.Status = row.ProductStatus
+	product.HsnCode = row.HsnCode
+	product.GstRate = row.GstRate
+	product.CessRate = row.CessRate
+	if err := tx.Save(&product).Error; err != nil {
+		return false, err
+	}
+
+	previous := varient
+	varient.ProductId = product.ID
+	varient.OutletId = outletId
+	varient.Name = row.VarientName
+	varient.Sku = row.Sku
+	varient.SellingPrice = row.SellingPrice
+	varient.Mrp = row.Mrp
+	if created {
+		// A varient with the SKU created since it was looked up, by another import or by
+		// hand, is left alone here and updated below instead of duplicated
+		result := tx.Omit("Product").Clauses(clause.OnConflict{
+			Columns:     []clause.Column{{Name: "outlet_id"}, {Name: "sku"}},
+			TargetWhere: clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "sku <> '' AND deleted_at IS NULL"}}},
+			DoNothing:   true,
+		}).Create(&varient)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 0 {
+			created = false
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ? AND sku = ?", outletId, row.Sku).First(&previous).Error
+			if err != nil {
+				return false, err
+			}
+			varient.ID, varient.CreatedAt = previous.ID, previous.CreatedAt
+		}
+	}
+	if !created {
+		if err := tx.Omit("Product").Save(&varient).Error; err != nil {
+			return false, err
+		}
+	}
+
+	if created {
+		err = pricing.Record(tx, varient, nil, changedById)
+	} else {
+		err = pricing.Record(tx, varient, &previous, changedById)
+	}
+	return created, err
+}
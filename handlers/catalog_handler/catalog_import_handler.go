@@ -0,0 +1,198 @@
+package catalog_handler
+
+import (
+	"context"
+	"easystore/auth"
+	"easystore/db"
+	"easystore/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Import products from a CSV or XLSX file
+// @Description  Imports products, categories and varients of an outlet. Varients are matched by SKU and updated when they exist. With dry_run the rows are only validated, otherwise a background job is started and returned for polling.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param dry_run query bool false "Validate the file without saving"
+// @Param file formData file true "CSV or XLSX file"
+// @Tags         Catalog
+// @Accept       multipart/form-data
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/catalog/import [post]
+func Import(c *gin.Context) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "File is required", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to read the file", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	defer file.Close()
+
+	records, err := readImportFile(fileHeader.Filename, file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to read the file", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	rows, rowErrors, err := parseImportRows(records)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid file", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+	if dryRun {
+		creates, updates := 0, 0
+		for _, row := range rows {
+			_, err := findVarientBySku(db.Tenant(c), outlet.ID, row.Sku)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				creates++
+			} else if err == nil {
+				updates++
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to validate the file", "result": gin.H{"error": err.Error()}})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Import validated", "result": gin.H{"total_rows": len(rows) + len(rowErrors), "valid_rows": len(rows), "create": creates, "update": updates, "errors": rowErrors}})
+		return
+	}
+
+	job := models.CatalogImportJob{
+		OutletId:      outlet.ID,
+		FileName:      fileHeader.Filename,
+		Status:        "queued",
+		TotalRows:     len(rows) + len(rowErrors),
+		ProcessedRows: len(rowErrors),
+		FailedRows:    len(rowErrors),
+	}
+	for _, rowError := range rowErrors {
+		job.RowErrors = append(job.RowErrors, models.CatalogImportError{Line: rowError.Row, Sku: rowError.Sku, Message: rowError.Message})
+	}
+	tx = db.Tenant(c).Create(&job)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create import job", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	go runImportJob(db.WithOrganization(context.Background(), db.OrganizationOf(c)), job, rows, auth.CurrentEmployeeID(c))
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Import started", "result": gin.H{"job": job}})
+}
+
+// @Summary      Get a catalog import job
+// @Description  Returns the progress and row errors of a catalog import job
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param job_id path string true "Import Job ID"
+// @Tags         Catalog
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/catalog/import/{job_id} [get]
+func GetImportJob(c *gin.Context) {
+	var job models.CatalogImportJob
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Preload("RowErrors", func(db *gorm.DB) *gorm.DB {
+		return db.Order("line")
+	}).First(&job, c.Param("job_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Import job not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Import job fetched successfully", "result": gin.H{"job": job}})
+}
+
+// Private methods
+
+// runImportJob saves the rows one by one so a bad row does not fail the whole file. The job
+// ends failed when it can not go on, so that it is never left running.
+func runImportJob(ctx context.Context, job models.CatalogImportJob, rows []importRow, changedById uint) {
+	status := "failed"
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Catalog import job %d stopped: %v", job.ID, r)
+			status = "failed"
+		}
+		finishImportJob(ctx, job.ID, status)
+	}()
+
+	if !updateImportJob(ctx, job.ID, map[string]interface{}{"status": "running"}) {
+		return
+	}
+
+	for _, row := range rows {
+		var created bool
+		err := db.Tenant(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			created, err = applyImportRow(tx, job.OutletId, row, changedById)
+			return err
+		})
+
+		job.ProcessedRows++
+		if err != nil {
+			job.FailedRows++
+			rowError := models.CatalogImportError{JobId: job.ID, Line: row.Line, Sku: row.Sku, Message: err.Error()}
+			if err := db.Tenant(ctx).Create(&rowError).Error; err != nil {
+				log.Printf("Unable to record row %d of catalog import job %d: %v", row.Line, job.ID, err)
+			}
+		} else if created {
+			job.CreatedRows++
+		} else {
+			job.UpdatedRows++
+		}
+
+		if !updateImportJob(ctx, job.ID, map[string]interface{}{
+			"processed_rows": job.ProcessedRows,
+			"created_rows":   job.CreatedRows,
+			"updated_rows":   job.UpdatedRows,
+			"failed_rows":    job.FailedRows,
+		}) {
+			return
+		}
+	}
+	status = "completed"
+}
+
+var updateImportJob = func(ctx context.Context, jobId uint, updates map[string]interface{}) bool {
+	err := db.Tenant(ctx).Model(&models.CatalogImportJob{}).Where("id = ?", jobId).Updates(updates).Error
+	if err != nil {
+		log.Printf("Unable to update catalog import job %d: %v", jobId, err)
+		return false
+	}
+	return true
+}
+
+// finishImportJob sets the final status of a job, trying again for a while as a job left
+// running would be polled forever
+var finishImportJob = func(ctx context.Context, jobId uint, status string) {
+	for attempt := 1; attempt <= 5; attempt++ {
+		if updateImportJob(ctx, jobId, map[string]interface{}{"status": status}) {
+			return
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
@@ -0,0 +1,196 @@
+package customer_handler
+
+import (
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Add an address
+// @Description  Adds a delivery address to a customer. A default address replaces the previous default.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        address  body  dtos.CustomerAddress  true  "Address"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/addresses [post]
+func AddAddress(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var addressDTO dtos.CustomerAddress
+	err := c.ShouldBindBodyWithJSON(&addressDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if addressDTO.Line1 == "" || addressDTO.City == "" || addressDTO.State == "" || addressDTO.Pincode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Line1, city, state and pincode are required"})
+		return
+	}
+	if err := customers.ValidatePincode(addressDTO.Pincode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+
+	address := models.CustomerAddress{
+		CustomerId: customer.ID,
+		Label:      addressDTO.Label,
+		Line1:      addressDTO.Line1,
+		Line2:      addressDTO.Line2,
+		City:       addressDTO.City,
+		State:      addressDTO.State,
+		Pincode:    addressDTO.Pincode,
+		IsDefault:  addressDTO.IsDefault,
+	}
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		// The first address of a customer is the default one
+		var count int64
+		if err := tx.Model(&models.CustomerAddress{}).Where("customer_id = ?", customer.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+		if address.IsDefault {
+			if err := clearDefault(tx, customer.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(&address).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to add the address", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Address added successfully")
+}
+
+// @Summary      Update an address
+// @Description  Updates a delivery address of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Param address_id path string true "Address ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        address  body  dtos.CustomerAddress  true  "Address"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/addresses/{address_id} [put]
+func UpdateAddress(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var addressDTO dtos.CustomerAddress
+	err := c.ShouldBindBodyWithJSON(&addressDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if addressDTO.Pincode != "" {
+		if err := customers.ValidatePincode(addressDTO.Pincode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var address models.CustomerAddress
+		if err := tx.Where("customer_id = ?", customer.ID).First(&address, c.Param("address_id")).Error; err != nil {
+			return err
+		}
+		if addressDTO.IsDefault {
+			if err := clearDefault(tx, customer.ID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(&address).Updates(models.CustomerAddress{
+			Label:     addressDTO.Label,
+			Line1:     addressDTO.Line1,
+			Line2:     addressDTO.Line2,
+			City:      addressDTO.City,
+			State:     addressDTO.State,
+			Pincode:   addressDTO.Pincode,
+			IsDefault: addressDTO.IsDefault,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Address not found"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the address", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Address updated successfully")
+}
+
+// @Summary      Remove an address
+// @Description  Removes a delivery address of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Param address_id path string true "Address ID"
+// @Tags         Customer
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/addresses/{address_id} [delete]
+func RemoveAddress(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+
+	tx := db.Tenant(c).Where("customer_id = ?", customer.ID).Delete(&models.CustomerAddress{}, c.Param("address_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to remove the address", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	} else if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Address not found"})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Address removed successfully")
+}
+
+// Private methods
+
+var clearDefault = func(tx *gorm.DB, customerId uint) error {
+	return tx.Model(&models.CustomerAddress{}).Where("customer_id = ? AND is_default", customerId).Update("is_default", false).Error
+}
@@ -0,0 +1,368 @@
+package customer_handler
+
+import (
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Create a customer
+// @Description  Creates a customer identified by phone. Customers are shared by all outlets of the chain.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        customer  body  dtos.Customer  true  "Customer Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers [post]
+func Create(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var customerDTO dtos.Customer
+	err := c.ShouldBindBodyWithJSON(&customerDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if !validPhone(c, outlet.ChainId(), customerDTO.Phone, 0) {
+		return
+	}
+
+	customer := models.Customer{ChainId: outlet.ChainId(), Phone: customerDTO.Phone, Name: customerDTO.Name, Email: customerDTO.Email}
+	applyConsent(&customer, customerDTO.Consent)
+	tx := db.Tenant(c).Omit("Chain").Create(&customer)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create the customer", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Customer created successfully", "result": gin.H{"customer": customer}})
+}
+
+// @Summary      Look up a customer by phone
+// @Description  Finds the customer of the chain with the given phone number, as done at the counter
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param phone query string true "Phone number"
+// @Tags         Customer
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers [get]
+func Lookup(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	phone := c.Query("phone")
+	if err := customers.ValidatePhone(phone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	customer, err := customers.FindByPhone(db.Tenant(c), outlet.ChainId(), phone)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Customer not found"})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusOK, "Customer fetched successfully")
+}
+
+// @Summary      Get a customer
+// @Description  Returns a customer with their addresses. A merged customer returns the customer it was merged into.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id} [get]
+func GetCustomer(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusOK, "Customer fetched successfully")
+}
+
+// @Summary      Update a customer
+// @Description  Updates the phone, name or email of a customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        customer  body  dtos.CustomerUpdate  true  "Customer Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id} [put]
+func Update(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var customerDTO dtos.CustomerUpdate
+	err := c.ShouldBindBodyWithJSON(&customerDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if customerDTO.Phone == "" && customerDTO.Name == "" && customerDTO.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Atleast one field is required"})
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+	if customerDTO.Phone != "" && !validPhone(c, outlet.ChainId(), customerDTO.Phone, customer.ID) {
+		return
+	}
+
+	tx := db.Tenant(c).Model(&customer).Updates(models.Customer{Phone: customerDTO.Phone, Name: customerDTO.Name, Email: customerDTO.Email})
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the customer", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Customer updated successfully")
+}
+
+// @Summary      Update marketing consent
+// @Description  Records the marketing consent of a customer for SMS, email and WhatsApp. Only the flags sent are changed.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        consent  body  dtos.CustomerConsent  true  "Consent Flags"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/consent [put]
+func UpdateConsent(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var consentDTO dtos.CustomerConsent
+	err := c.ShouldBindBodyWithJSON(&consentDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if consentDTO.MarketingSms == nil && consentDTO.MarketingEmail == nil && consentDTO.MarketingWhatsapp == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Atleast one consent flag is required"})
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+
+	applyConsent(&customer, consentDTO)
+	tx := db.Tenant(c).Model(&customer).Select("marketing_sms", "marketing_email", "marketing_whatsapp", "consent_updated_at").Updates(&customer)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the consent", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Consent updated successfully")
+}
+
+// @Summary      Get the purchase history of a customer
+// @Description  Lists the sales of a customer across all outlets of the chain, newest first, including sales made under customers merged into it
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/purchases [get]
+func GetPurchases(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	customer, ok := setCustomer(c, outlet)
+	if !ok {
+		return
+	}
+
+	ids, err := customers.HistoryIds(db.Tenant(c), customer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the purchases", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var sales []models.Sale
+	tx := db.Tenant(c).Where("customer_id IN ?", ids).Preload("Lines").Preload("Payments").Order("created_at DESC").Find(&sales)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the purchases", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	var total models.Money
+	for _, sale := range sales {
+		total += sale.Total
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Purchases fetched successfully", "result": gin.H{"sales": sales, "count": len(sales), "total": total}})
+}
+
+// @Summary      Merge a duplicate customer
+// @Description  Merges a duplicate customer into this one. Addresses, open bills and purchase history move over and the duplicate is removed. Only managers can merge customers.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Customer
+// @Accept       json
+// @Produce      json
+// @Param        merge  body  dtos.CustomerMerge  true  "Duplicate Customer"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      403  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/merge [post]
+func Merge(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var mergeDTO dtos.CustomerMerge
+	err := c.ShouldBindBodyWithJSON(&mergeDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid customer id"})
+		return
+	}
+
+	customer, err := customers.Merge(db.Tenant(c), outlet.ChainId(), uint(customerId), mergeDTO.DuplicateId)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to merge the customers", "result": gin.H{"error": "Customer not found"}})
+		return
+	} else if errors.Is(err, customers.ErrMergeSelf) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to merge the customers", "result": gin.H{"error": err.Error()}})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to merge the customers", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	respondWithCustomer(c, outlet, customer.ID, http.StatusAccepted, "Customers merged successfully")
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+var setCustomer = func(c *gin.Context, outlet models.Outlet) (models.Customer, bool) {
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid customer id"})
+		return models.Customer{}, false
+	}
+
+	customer, err := customers.Find(db.Tenant(c), outlet.ChainId(), uint(customerId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Customer not found"})
+		return customer, false
+	}
+	return customer, true
+}
+
+var validPhone = func(c *gin.Context, chainId uint, phone string, customerId uint) bool {
+	if err := customers.ValidatePhone(phone); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return false
+	}
+
+	taken, err := customers.PhoneTaken(db.Tenant(c), chainId, phone, customerId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the phone number", "result": gin.H{"error": err.Error()}})
+		return false
+	}
+	if taken {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": customers.ErrPhoneExists.Error()})
+		return false
+	}
+	return true
+}
+
+var applyConsent = func(customer *models.Customer, consent dtos.CustomerConsent) {
+	if consent.MarketingSms == nil && consent.MarketingEmail == nil && consent.MarketingWhatsapp == nil {
+		return
+	}
+	if consent.MarketingSms != nil {
+		customer.MarketingSms = *consent.MarketingSms
+	}
+	if consent.MarketingEmail != nil {
+		customer.MarketingEmail = *consent.MarketingEmail
+	}
+	if consent.MarketingWhatsapp != nil {
+		customer.MarketingWhatsapp = *consent.MarketingWhatsapp
+	}
+	now := time.Now()
+	customer.ConsentUpdatedAt = &now
+}
+
+var respondWithCustomer = func(c *gin.Context, outlet models.Outlet, customerId uint, status int, message string) {
+	var customer models.Customer
+	tx := db.Tenant(c).Where("chain_id = ?", outlet.ChainId()).Preload("Addresses", func(db *gorm.DB) *gorm.DB {
+		return db.Order("is_default DESC, id")
+	}).First(&customer, customerId)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the customer", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": gin.H{"customer": customer}})
+}
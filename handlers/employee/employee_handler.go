@@ -5,6 +5,7 @@ import (
 	"easystore/dtos"
 	handler_helper "easystore/handlers/helpers"
 	"easystore/models"
+	"easystore/tax"
 	"net/http"
 	"regexp"
 	"strconv"
@@ -39,6 +40,7 @@ func Create(c *gin.Context) {
 	}
 
 	employee.Status = "active"
+	employee.OrganizationId = db.OrganizationOf(c)
 	err = employee.HashPassword()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to hash password"})
@@ -46,7 +48,7 @@ func Create(c *gin.Context) {
 	}
 
 	// Save employee to database
-	tx := db.DB.Create(&employee)
+	tx := db.Tenant(c).Create(&employee)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to create employee"})
 		return
@@ -87,8 +89,10 @@ func Update(c *gin.Context) {
 			return
 		}
 	}
+	// Employees can not be moved to another organization
+	employee.OrganizationId = 0
 	// Save employee to database
-	tx := db.DB.Model(&models.Employee{}).Where("id = ?", id).Updates(&employee)
+	tx := db.Tenant(c).Model(&models.Employee{}).Where("id = ?", id).Updates(&employee)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update employee"})
 		return
@@ -158,7 +162,7 @@ func Login(c *gin.Context) {
 // @Router       /employee/{employee_id} [get]
 func GetEmployee(c *gin.Context) {
 	id := c.Param("employee_id")
-	tx := db.DB.Where("id = ?", id).First(&employee)
+	tx := db.Tenant(c).Where("id = ?", id).First(&employee)
 	if tx.RowsAffected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Employee not found"})
 		return
@@ -171,7 +175,7 @@ func GetEmployee(c *gin.Context) {
 }
 
 // @Summary      Get all employees
-// @Description  Gets all employees
+// @Description  Gets all employees of the organization of the logged in employee
 // @Param Authorization header string true "Bearer Token"
 // @Tags         Employee
 // @Accept       json
@@ -182,7 +186,7 @@ func GetEmployee(c *gin.Context) {
 // @Router       /employee [get]
 func GetEmployees(c *gin.Context) {
 	var employees []models.Employee
-	tx := db.DB.Omit("password").Find(&employees)
+	tx := db.Tenant(c).Omit("password").Find(&employees)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to get employees"})
 		return
@@ -206,7 +210,7 @@ func GetEmployees(c *gin.Context) {
 func CreateOutlet(c *gin.Context) {
 	managerIDStr := c.Param("employee_id")
 	var manager models.Employee
-	tx := db.DB.Omit("password").First(&manager, managerIDStr)
+	tx := db.Tenant(c).Omit("password").First(&manager, managerIDStr)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status":"failed", "message":"Unable find manager", "result":gin.H{"error":tx.Error.Error()}})
 		return
@@ -221,9 +225,11 @@ func CreateOutlet(c *gin.Context) {
 
 	managerID, err := strconv.Atoi(managerIDStr)
 	outlet.ManagerId = uint(managerID)
+	outlet.OrganizationId = manager.OrganizationId
 	outlet.Identifier = handler_helper.GenerateUUID()
+	outlet.StateCode = tax.OutletState(outlet.StateCode, outlet.Location)
 
-	tx = db.DB.Create(&outlet)
+	tx = db.Tenant(c).Create(&outlet)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to create outlet", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -252,6 +258,7 @@ var validEmployeeFields = func(operation string, employee models.Employee, c *gi
 			return false
 		}
 
+		// Emails and phones are unique across organizations, they log employees in
 		if operation == "update" {
 			tx = db.DB.Where("email = ?", employee.Email).Not("id = ?", employee.ID).First(&employee)
 		} else {
@@ -0,0 +1,221 @@
+package hours_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/hours"
+	"easystore/models"
+	"easystore/slots"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// @Summary      Get the business hours of an outlet
+// @Description  Returns the weekly opening hours of an outlet in its time zone, its holidays from today onwards and whether it is open now, with when it closes or opens next
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Business Hours
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/hours [get]
+func GetHours(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	respondWithHours(c, outlet, http.StatusOK, "Business hours fetched successfully")
+}
+
+// @Summary      Set the business hours of an outlet
+// @Description  Replaces the weekly opening hours of an outlet and optionally its time zone. A day can have more than one window, which should not overlap. An outlet without any hours is open around the clock. Orders without a delivery slot are refused while the outlet is closed, and delivery slots can not be booked on the days it does not open.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Business Hours
+// @Accept       json
+// @Produce      json
+// @Param        hours  body  dtos.BusinessHours  true  "Business Hours"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/hours [put]
+func SetHours(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var hoursDTO dtos.BusinessHours
+	err := c.ShouldBindBodyWithJSON(&hoursDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if hoursDTO.Timezone != "" {
+		if err := hours.ValidateTimezone(hoursDTO.Timezone); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+		outlet.Timezone = hoursDTO.Timezone
+	}
+
+	var week []models.OutletHours
+	for _, opening := range hoursDTO.Hours {
+		openMinute, err := slots.ParseClock(opening.Open)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+		closeMinute, err := slots.ParseClock(opening.Close)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+		// "24:00" can not be parsed, so "00:00" as the closing time means midnight
+		if closeMinute == 0 {
+			closeMinute = 24 * 60
+		}
+		for _, weekday := range opening.Weekdays {
+			week = append(week, models.OutletHours{OutletId: outlet.ID, Weekday: weekday, OpenMinute: openMinute, CloseMinute: closeMinute})
+		}
+	}
+	if err := hours.ValidateWeek(week); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("outlet_id = ?", outlet.ID).Delete(&models.OutletHours{}).Error
+		if err != nil {
+			return err
+		}
+		if len(week) > 0 {
+			if err := tx.Omit("Outlet").Create(&week).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&outlet).Update("timezone", outlet.Timezone).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to set the business hours", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	respondWithHours(c, outlet, http.StatusAccepted, "Business hours set successfully")
+}
+
+// @Summary      Add a holiday
+// @Description  Closes an outlet for a whole date whatever its weekly hours. Adding a holiday again for the same date renames it.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Business Hours
+// @Accept       json
+// @Produce      json
+// @Param        holiday  body  dtos.Holiday  true  "Holiday"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/holidays [post]
+func AddHoliday(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var holidayDTO dtos.Holiday
+	err := c.ShouldBindBodyWithJSON(&holidayDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	date, err := slots.ParseDate(outlet, holidayDTO.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Date should be in YYYY-MM-DD format"})
+		return
+	}
+	if holidayDTO.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Holiday name is required"})
+		return
+	}
+
+	holiday := models.OutletHoliday{OutletId: outlet.ID, Date: date, Name: holidayDTO.Name}
+	tx := db.Tenant(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "outlet_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "updated_at", "deleted_at"}),
+	}).Omit("Outlet").Create(&holiday)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to add the holiday", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Holiday added successfully", "result": gin.H{"holiday": holiday}})
+}
+
+// @Summary      Delete a holiday
+// @Description  Removes a holiday so the date follows the weekly hours again
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param holiday_id path string true "Holiday ID"
+// @Tags         Business Hours
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/holidays/{holiday_id} [delete]
+func DeleteHoliday(c *gin.Context) {
+	tx := db.Tenant(c).Unscoped().Where("outlet_id = ?", c.Param("outlet_id")).Delete(&models.OutletHoliday{}, c.Param("holiday_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the holiday", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	} else if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Holiday not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Holiday deleted successfully"})
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// respondWithHours writes the weekly hours, upcoming holidays and open status of the outlet
+var respondWithHours = func(c *gin.Context, outlet models.Outlet, status int, message string) {
+	var week []models.OutletHours
+	err := db.Tenant(c).Where("outlet_id = ?", outlet.ID).Order("weekday, open_minute").Find(&week).Error
+	var holidays []models.OutletHoliday
+	if err == nil {
+		today := time.Now().In(hours.Of(outlet)).Format(hours.DateLayout)
+		err = db.Tenant(c).Where("outlet_id = ? AND date >= ?", outlet.ID, today).Order("date").Find(&holidays).Error
+	}
+	var open hours.Status
+	if err == nil {
+		open, err = hours.Get(db.Tenant(c), outlet, time.Now())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the business hours", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	days := make([]gin.H, 0, len(week))
+	for _, window := range week {
+		days = append(days, gin.H{"id": window.ID, "weekday": window.Weekday, "open": slots.FormatClock(window.OpenMinute), "close": slots.FormatClock(window.CloseMinute)})
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": gin.H{"timezone": hours.Of(outlet).String(), "hours": days, "holidays": holidays, "open_status": open}})
+}
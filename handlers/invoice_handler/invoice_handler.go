@@ -0,0 +1,208 @@
+package invoice_handler
+
+import (
+	"bytes"
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/invoices"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Issue an invoice
+// @Description  Issues the tax invoice of a sale or delivered order, or the credit note of a return, of the outlet. Invoices are issued on their own when a bill is finalized, an order is delivered or goods are returned, so this is only needed for those recorded before invoicing was turned on. The invoice already issued is returned if there is one.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Invoice
+// @Accept       json
+// @Produce      json
+// @Param        invoice  body  dtos.Invoice  true  "Invoice Source"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/invoices [post]
+func Create(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var invoiceDTO dtos.Invoice
+	err := c.ShouldBindBodyWithJSON(&invoiceDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var invoice models.Invoice
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		switch {
+		case invoiceDTO.SaleId != 0:
+			var sale models.Sale
+			if err := tx.Where("outlet_id = ?", outlet.ID).First(&sale, invoiceDTO.SaleId).Error; err != nil {
+				return err
+			}
+			invoice, err = invoices.IssueSale(tx, sale)
+		case invoiceDTO.OrderId != 0:
+			var order models.Order
+			if err := tx.Where("outlet_id = ?", outlet.ID).First(&order, invoiceDTO.OrderId).Error; err != nil {
+				return err
+			}
+			if order.Status != models.OrderDelivered {
+				return invoices.ErrNotDelivered
+			}
+			invoice, err = invoices.IssueOrder(tx, order)
+		case invoiceDTO.ReturnId != 0:
+			var ret models.Return
+			if err := tx.Where("outlet_id = ?", outlet.ID).First(&ret, invoiceDTO.ReturnId).Error; err != nil {
+				return err
+			}
+			invoice, err = invoices.IssueCreditNote(tx, ret)
+		default:
+			err = invoices.ErrNoSource
+		}
+		return err
+	})
+	if !respondWithError(c, err, "Unable to issue the invoice") {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Invoice issued successfully", "result": gin.H{"invoice": invoice}})
+}
+
+// @Summary      Get invoices
+// @Description  Lists the invoices and credit notes of an outlet, newest first, optionally of a type, a financial year or a sale, order or return
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param type query string false "invoice or credit_note"
+// @Param financial_year query string false "Financial year such as 2025-26"
+// @Param sale_id query string false "Sale ID"
+// @Param order_id query string false "Order ID"
+// @Param return_id query string false "Return ID"
+// @Tags         Invoice
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/invoices [get]
+func GetInvoices(c *gin.Context) {
+	var invoiceList []models.Invoice
+	query := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id"))
+	for _, filter := range []string{"type", "financial_year", "sale_id", "order_id", "return_id"} {
+		if value := c.Query(filter); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+	tx := query.Order("created_at DESC").Find(&invoiceList)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the invoices", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Invoices fetched successfully", "result": gin.H{"invoices": invoiceList}})
+}
+
+// @Summary      Get an invoice
+// @Description  Returns an invoice or credit note with its lines, HSN summary and the times it was printed
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param invoice_id path string true "Invoice ID"
+// @Tags         Invoice
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/invoices/{invoice_id} [get]
+func GetInvoice(c *gin.Context) {
+	var invoice models.Invoice
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).
+		Preload("Prints", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&invoice, c.Param("invoice_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invoice not found"})
+		return
+	}
+
+	document, err := invoices.Load(db.Tenant(c), invoice)
+	if !respondWithError(c, err, "Unable to get the invoice") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Invoice fetched successfully", "result": document})
+}
+
+// @Summary      Download an invoice
+// @Description  Returns an invoice or credit note as a PDF. Every download is recorded, the first one is the original for the recipient and the ones after it are marked as duplicates.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param invoice_id path string true "Invoice ID"
+// @Tags         Invoice
+// @Produce      application/pdf
+// @Success      200  {file}  file
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/invoices/{invoice_id}/pdf [get]
+func DownloadInvoice(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var invoiceId uint
+	if _, err := fmt.Sscan(c.Param("invoice_id"), &invoiceId); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid invoice id", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	employeeId := auth.CurrentEmployeeID(c)
+	document, err := invoices.Print(db.Tenant(c), outlet.ID, invoiceId, &employeeId)
+	if !respondWithError(c, err, "Unable to print the invoice") {
+		return
+	}
+
+	var pdf bytes.Buffer
+	if err := invoices.Render(document, &pdf); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to render the invoice", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	filename := strings.ReplaceAll(document.Invoice.Number, "/", "-") + ".pdf"
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/pdf", pdf.Bytes())
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if invoices.IsInvoiceError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+package loyalty_handler
+
+import (
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/loyalty"
+	"easystore/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Scopes of a loyalty rule
+const (
+	scopeChain  = "chain"
+	scopeOutlet = "outlet"
+)
+
+// @Summary      Get the loyalty rules
+// @Description  Fetches the loyalty rule of the chain of an outlet, the rule of the outlet itself if it has one and the rule in effect at the outlet
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Loyalty
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/loyalty/rules [get]
+func GetRules(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	chain, err := findRule(c, outlet, scopeChain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty rules", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	own, err := findRule(c, outlet, scopeOutlet)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty rules", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	var effective *models.LoyaltyRule
+	rule, err := loyalty.Rule(db.Tenant(c), outlet)
+	if err == nil {
+		effective = &rule
+	} else if !errors.Is(err, loyalty.ErrNoProgram) {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty rules", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Loyalty rules fetched successfully", "result": gin.H{"chain": chain, "outlet": own, "effective": effective}})
+}
+
+// @Summary      Set a loyalty rule
+// @Description  Sets how customers earn and spend points across the chain of an outlet, or at the outlet alone with scope outlet. Points are earned for every 100 rupees paid at the rate of the tier of the customer, silver or gold once their spend over the last year reaches the tier. Earned points expire after expiry_days, never when zero.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Loyalty
+// @Accept       json
+// @Produce      json
+// @Param        rule  body  dtos.LoyaltyRule  true  "Loyalty Rule"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/loyalty/rules [put]
+func SetRule(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var ruleDTO dtos.LoyaltyRule
+	err := c.ShouldBindBodyWithJSON(&ruleDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if ruleDTO.Scope == "" {
+		ruleDTO.Scope = scopeChain
+	}
+	if ruleDTO.Scope != scopeChain && ruleDTO.Scope != scopeOutlet {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Scope should be chain or outlet"})
+		return
+	}
+
+	existing, err := findRule(c, outlet, ruleDTO.Scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to set the loyalty rule", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	rule := models.LoyaltyRule{ChainId: outlet.ChainId(), Active: true}
+	if existing != nil {
+		rule = *existing
+	}
+	if ruleDTO.Scope == scopeOutlet {
+		rule.OutletId = &outlet.ID
+	}
+	rule.PointsPer100 = ruleDTO.PointsPer100
+	rule.SilverPointsPer100 = ruleDTO.SilverPointsPer100
+	rule.GoldPointsPer100 = ruleDTO.GoldPointsPer100
+	rule.SilverSpend = ruleDTO.SilverSpend
+	rule.GoldSpend = ruleDTO.GoldSpend
+	rule.PointValue = ruleDTO.PointValue
+	rule.MinRedeemPoints = ruleDTO.MinRedeemPoints
+	rule.MaxRedeemPercent = ruleDTO.MaxRedeemPercent
+	if rule.MaxRedeemPercent == 0 {
+		rule.MaxRedeemPercent = 100
+	}
+	rule.ExpiryDays = ruleDTO.ExpiryDays
+	if ruleDTO.Active != nil {
+		rule.Active = *ruleDTO.Active
+	}
+	if err := loyalty.ValidateRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	tx := db.Tenant(c).Save(&rule)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to set the loyalty rule", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Loyalty rule set successfully", "result": gin.H{"rule": rule}})
+}
+
+// @Summary      Delete a loyalty rule
+// @Description  Removes the loyalty rule of the chain of an outlet, or of the outlet alone with scope outlet, which then follows the rule of its chain. Points already earned are kept.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param scope query string false "Scope, chain or outlet"
+// @Tags         Loyalty
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/loyalty/rules [delete]
+func DeleteRule(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	scope := c.DefaultQuery("scope", scopeChain)
+	if scope != scopeChain && scope != scopeOutlet {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Scope should be chain or outlet"})
+		return
+	}
+	rule, err := findRule(c, outlet, scope)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the loyalty rule", "result": gin.H{"error": err.Error()}})
+		return
+	} else if rule == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Loyalty rule not found"})
+		return
+	}
+
+	tx := db.Tenant(c).Delete(rule)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the loyalty rule", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Loyalty rule deleted successfully"})
+}
+
+// @Summary      Get the loyalty points of a customer
+// @Description  Fetches the points balance of a customer with what it is worth, their tier and spend over the last year under the loyalty program of the outlet, what is left to spend for the next tier and the points still to expire, soonest first
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Loyalty
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/loyalty [get]
+func GetAccount(c *gin.Context) {
+	outlet, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	account, err := loyalty.Get(db.Tenant(c), outlet, customer.ID, time.Now())
+	if errors.Is(err, loyalty.ErrNoProgram) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty points", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Loyalty points fetched successfully", "result": gin.H{"loyalty": account}})
+}
+
+// @Summary      Get the loyalty ledger of a customer
+// @Description  Lists the points a customer earned, spent, had expire, taken back or given back, newest first, including those of customers merged into them
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Param type query string false "Entry type, earn, redeem, expire, reverse or restore"
+// @Tags         Loyalty
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/loyalty/entries [get]
+func GetEntries(c *gin.Context) {
+	_, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	ids, err := customers.HistoryIds(db.Tenant(c), customer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty ledger", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	query := db.Tenant(c).Where("customer_id IN ?", ids)
+	if entryType := c.Query("type"); entryType != "" {
+		query = query.Where("type = ?", entryType)
+	}
+
+	var entries []models.LoyaltyEntry
+	tx := query.Order("id desc").Find(&entries)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the loyalty ledger", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Loyalty ledger fetched successfully", "result": gin.H{"entries": entries}})
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+var setCustomer = func(c *gin.Context) (models.Outlet, models.Customer, bool) {
+	var customer models.Customer
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return outlet, customer, false
+	}
+
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid customer id"})
+		return outlet, customer, false
+	}
+	customer, err = customers.Find(db.Tenant(c), outlet.ChainId(), uint(customerId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Customer not found"})
+		return outlet, customer, false
+	}
+	return outlet, customer, true
+}
+
+// findRule returns the loyalty rule of the chain of the outlet or of the outlet itself, nil
+// when there is none
+var findRule = func(c *gin.Context, outlet models.Outlet, scope string) (*models.LoyaltyRule, error) {
+	query := db.Tenant(c).Where("chain_id = ?", outlet.ChainId())
+	if scope == scopeOutlet {
+		query = query.Where("outlet_id = ?", outlet.ID)
+	} else {
+		query = query.Where("outlet_id IS NULL")
+	}
+
+	var rule models.LoyaltyRule
+	err := query.First(&rule).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
@@ -0,0 +1,291 @@
+package order_handler
+
+import (
+	"easystore/auth"
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/orders"
+	"easystore/payments"
+	"easystore/serviceability"
+	"easystore/slots"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Place an order
+// @Description  Places a delivery order for a customer of the chain to one of their addresses, paid cash on delivery or online. Prices and taxes are fixed when the order is placed and the stock is reserved. Online orders start their payment straight away. With auto_route the order is placed at the outlet of the chain picked by the pincode overlap policy, matching varients by SKU. A coupon code applies its promotion to the order, which then fails to place when the coupon does not apply. Loyalty points, gift cards and store credit given pay for part of the order.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Order
+// @Accept       json
+// @Produce      json
+// @Param        order  body  dtos.Order  true  "Order Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders [post]
+func Create(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var orderDTO dtos.Order
+	err := c.ShouldBindBodyWithJSON(&orderDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	customer, err := customers.Find(db.Tenant(c), outlet.ChainId(), orderDTO.CustomerId)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Customer not found"})
+		return
+	}
+	var address models.CustomerAddress
+	tx := db.Tenant(c).Where("customer_id = ?", customer.ID).First(&address, orderDTO.AddressId)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Address not found"})
+		return
+	}
+
+	request := orders.PlaceRequest{Outlet: outlet, Customer: customer, Address: address, PaymentMethod: orderDTO.PaymentMethod, Coupon: strings.ToUpper(strings.TrimSpace(orderDTO.Coupon)), Points: orderDTO.Points, StoreCredit: orderDTO.StoreCredit}
+	for _, giftCard := range orderDTO.GiftCards {
+		request.GiftCards = append(request.GiftCards, orders.GiftCardRequest{Code: giftCard.Code, Amount: giftCard.Amount})
+	}
+	for _, line := range orderDTO.Lines {
+		request.Lines = append(request.Lines, orders.LineRequest{VarientId: line.VarientId, Quantity: line.Quantity})
+	}
+	if orderDTO.Slot != nil {
+		date, err := slots.ParseDate(outlet, orderDTO.Slot.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Slot date should be in YYYY-MM-DD format"})
+			return
+		}
+		request.Slot = &orders.SlotRequest{TemplateId: orderDTO.Slot.TemplateId, Date: date}
+	}
+
+	// Routed orders go to whichever outlet of the chain should deliver to the address,
+	// with the varients matched by SKU
+	if orderDTO.AutoRoute {
+		request.Outlet, err = serviceability.Route(db.Tenant(c), outlet.ChainId(), address.Pincode, serviceability.CurrentPolicy())
+		if !respondWithError(c, err, "Unable to route the order") {
+			return
+		}
+		request.Lines, err = orders.MatchLines(db.Tenant(c), outlet.ID, request.Outlet.ID, request.Lines)
+		if !respondWithError(c, err, "Unable to route the order") {
+			return
+		}
+	}
+	order, err := orders.Place(db.Tenant(c), request, orders.EmployeeActor(auth.CurrentEmployeeID(c)))
+	if !respondWithError(c, err, "Unable to place the order") {
+		return
+	}
+
+	message := "Order placed successfully"
+	if order.PaymentMethod == models.PaymentOnline && order.PaymentStatus == models.PaymentPending {
+		// The order stands even when the payment can not be started, it can be started
+		// again from the order
+		provider, err := payments.Current()
+		if err == nil {
+			_, err = payments.Start(c.Request.Context(), db.Tenant(c), provider, order)
+		}
+		if err != nil {
+			message = "Order placed, unable to start the payment: " + err.Error()
+		}
+	}
+	respondWithOrder(c, request.Outlet, order.ID, http.StatusAccepted, message)
+}
+
+// @Summary      Get orders
+// @Description  Lists the orders of an outlet, newest first, optionally filtered by status
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param status query string false "Order status"
+// @Tags         Order
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders [get]
+func GetOrders(c *gin.Context) {
+	var orderList []models.Order
+	query := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	tx := query.Order("created_at DESC").Find(&orderList)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the orders", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Orders fetched successfully", "result": gin.H{"orders": orderList}})
+}
+
+// @Summary      Get an order
+// @Description  Returns an order with its lines, its status history and the statuses it can move to next
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Order
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id} [get]
+func GetOrder(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	orderId, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid order id"})
+		return
+	}
+	respondWithOrder(c, outlet, uint(orderId), http.StatusOK, "Order fetched successfully")
+}
+
+// @Summary      Change the status of an order
+// @Description  Moves an order to its next status through the order state machine. Cancelling reserved stock releases it, delivering commits it and cancelled or failed paid orders are flagged for refund. Cancelling after confirmation and failing a delivery need a reason.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Order
+// @Accept       json
+// @Produce      json
+// @Param        transition  body  dtos.OrderTransition  true  "Next Status"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/transitions [post]
+func Transition(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var transitionDTO dtos.OrderTransition
+	err := c.ShouldBindBodyWithJSON(&transitionDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	orderId, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid order id"})
+		return
+	}
+
+	order, err := orders.Transition(db.Tenant(c), outlet.ID, uint(orderId), transitionDTO.Status, orders.EmployeeActor(auth.CurrentEmployeeID(c)), transitionDTO.Reason)
+	if !respondWithError(c, err, "Unable to change the order status") {
+		return
+	}
+
+	respondWithOrder(c, outlet, order.ID, http.StatusAccepted, "Order status changed successfully")
+}
+
+// @Summary      Book a delivery slot for an order
+// @Description  Books the order into a delivery slot, giving back the slot it was booked into before. Orders can be rescheduled until they go out for delivery.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Order
+// @Accept       json
+// @Produce      json
+// @Param        slot  body  dtos.OrderSlot  true  "Delivery Slot"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/slot [post]
+func BookSlot(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var slotDTO dtos.OrderSlot
+	err := c.ShouldBindBodyWithJSON(&slotDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	date, err := slots.ParseDate(outlet, slotDTO.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Slot date should be in YYYY-MM-DD format"})
+		return
+	}
+
+	orderId, err := strconv.Atoi(c.Param("order_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid order id"})
+		return
+	}
+
+	order, err := orders.Reschedule(db.Tenant(c), outlet, uint(orderId), orders.SlotRequest{TemplateId: slotDTO.TemplateId, Date: date})
+	if !respondWithError(c, err, "Unable to book the slot") {
+		return
+	}
+
+	respondWithOrder(c, outlet, order.ID, http.StatusAccepted, "Slot booked successfully")
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if orders.IsOrderError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
+
+var respondWithOrder = func(c *gin.Context, outlet models.Outlet, orderId uint, status int, message string) {
+	var order models.Order
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("History", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Slot").
+		Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&order, orderId)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the order", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	result := gin.H{"order": order, "next": orders.Next(order.Status)}
+	// Staff can read the delivery OTP out to a customer who did not get it
+	if order.Status == models.OrderOutForDelivery {
+		result["delivery_otp"] = order.DeliveryOtp
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": result})
+}
@@ -0,0 +1,167 @@
+package organization_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	handler_helper "easystore/handlers/helpers"
+	"easystore/models"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var emailRegex = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+// @Summary      Sign up an organization
+// @Description  Creates an organization, a retail chain, with the employee who owns it and returns an access token for the owner. The owner is a manager at every outlet of the organization. Everything the organization creates is only visible to its own employees.
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        organization  body  dtos.OrganizationSignup  true  "Organization Details"
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /organizations [post]
+func SignUp(c *gin.Context) {
+	var signupDTO dtos.OrganizationSignup
+	err := c.ShouldBindBodyWithJSON(&signupDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	signupDTO.Name = strings.TrimSpace(signupDTO.Name)
+	if signupDTO.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Organization name is required"})
+		return
+	}
+	if !validOwner(signupDTO.Owner, c) {
+		return
+	}
+
+	organization := models.Organization{Name: signupDTO.Name, Status: "active"}
+	owner := models.Employee{Name: signupDTO.Owner.Name, Phone: signupDTO.Owner.Phone, Email: signupDTO.Owner.Email, Password: signupDTO.Owner.Password, Status: "active"}
+	if err := owner.HashPassword(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to hash password"})
+		return
+	}
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+		owner.OrganizationId = organization.ID
+		if err := tx.Create(&owner).Error; err != nil {
+			return err
+		}
+		organization.OwnerId = &owner.ID
+		return tx.Model(&organization).Update("owner_id", owner.ID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create the organization", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	owner.OmitPassword()
+	token, err := handler_helper.GenerateEmployeeLoginJwt(&owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to generate token", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Organization created successfully", "result": gin.H{"organization": organization, "owner": owner, "accessToken": token}})
+}
+
+// @Summary      Get the organization
+// @Description  Fetches the organization of the logged in employee with how many outlets and employees it has
+// @Param Authorization header string true "Bearer Token"
+// @Tags         Organization
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /organization [get]
+func GetOrganization(c *gin.Context) {
+	var organization models.Organization
+	err := db.Tenant(c).First(&organization, db.OrganizationOf(c)).Error
+	var outlets, employees int64
+	if err == nil {
+		err = db.Tenant(c).Model(&models.Outlet{}).Count(&outlets).Error
+	}
+	if err == nil {
+		err = db.Tenant(c).Model(&models.Employee{}).Count(&employees).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the organization", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Organization fetched successfully", "result": gin.H{"organization": organization, "outlets": outlets, "employees": employees}})
+}
+
+// @Summary      Rename the organization
+// @Description  Renames the organization of the logged in employee, who should be its owner
+// @Param Authorization header string true "Bearer Token"
+// @Tags         Organization
+// @Accept       json
+// @Produce      json
+// @Param        organization  body  dtos.Organization  true  "Organization Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /organization [put]
+func UpdateOrganization(c *gin.Context) {
+	var organizationDTO dtos.Organization
+	err := c.ShouldBindBodyWithJSON(&organizationDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	organizationDTO.Name = strings.TrimSpace(organizationDTO.Name)
+	if organizationDTO.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Organization name is required"})
+		return
+	}
+
+	var organization models.Organization
+	tx := db.Tenant(c).First(&organization, db.OrganizationOf(c))
+	if tx.Error == nil {
+		tx = db.Tenant(c).Model(&organization).Update("name", organizationDTO.Name)
+	}
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to rename the organization", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Organization renamed successfully", "result": gin.H{"organization": organization}})
+}
+
+// Private methods
+
+// validOwner checks the employee signing an organization up, whose email and phone should
+// not be taken by an employee of any organization
+var validOwner = func(owner dtos.EmployeeCreate, c *gin.Context) bool {
+	if owner.Name == "" || owner.Phone == "" || owner.Email == "" || owner.Password == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Name, phone, email and password of the owner are required"})
+		return false
+	}
+	if len(owner.Phone) != 10 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Phone number must be 10 digits"})
+		return false
+	}
+	if !emailRegex.MatchString(owner.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid email address"})
+		return false
+	}
+
+	var taken int64
+	tx := db.DB.Model(&models.Employee{}).Where("email = ? OR phone = ?", owner.Email, owner.Phone).Count(&taken)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the owner", "result": gin.H{"error": tx.Error.Error()}})
+		return false
+	}
+	if taken > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Email or phone number already exists"})
+		return false
+	}
+	return true
+}
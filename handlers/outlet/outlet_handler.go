@@ -1,13 +1,19 @@
 package outlet_handler
 
 import (
+	"easystore/customers"
 	"easystore/db"
 	"easystore/dtos"
 	handler_helper "easystore/handlers/helpers"
+	"easystore/hours"
 	"easystore/models"
+	"easystore/serviceability"
+	"easystore/tax"
+	"errors"
 	"net/http"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,8 +21,10 @@ import (
 
 var outlet models.Outlet
 
+var upiIdRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{2,256}@[a-zA-Z]{2,64}$`)
+
 // @Summary      Create an outlet
-// @Description  Creates a new outlet and returns the created outlet object
+// @Description  Creates a new outlet and returns the created outlet object. An outlet given a structured address without a location shows the address as its location. Latitude and longitude place it for the nearest outlet lookup.
 // @Param Authorization header string true "Bearer Token"
 // @Tags         Outlet
 // @Accept       json
@@ -34,15 +42,28 @@ func Create(c *gin.Context) {
 		return
 	}
 
+	// Outlets given an address without a location show the address as their location
+	if outlet.Location == "" {
+		outlet.Location = formatAddress(outlet)
+	}
+	// Outlets created without a state code get it from their location
+	outlet.StateCode = tax.OutletState(outlet.StateCode, outlet.Location)
+	outlet.Gstin = strings.ToUpper(outlet.Gstin)
 	if !validOutletFields(outlet, c) {
 		return
 	}
+	// Outlets belong to the organization of the employee creating them, and are managed by
+	// one of its employees
+	outlet.OrganizationId = db.OrganizationOf(c)
+	if !validOutletManager(outlet, c) {
+		return
+	}
 
 	// Generate unique identifier for outlet
 	outlet.Identifier = handler_helper.GenerateUUID()
 
 	// Save outlet to database
-	tx := db.DB.Create(&outlet)
+	tx := db.Tenant(c).Create(&outlet)
 
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to create outlet"})
@@ -72,13 +93,34 @@ func Update(c *gin.Context) {
 		return
 	}
 
-	if outlet.Name == "" && outlet.Description == "" && outlet.Location == "" && outlet.Phone == "" && outlet.Email == "" && outlet.Website == "" && outlet.Status == "" {
+	if outlet.Name == "" && outlet.Description == "" && outlet.Location == "" && outlet.Phone == "" && outlet.Email == "" && outlet.Website == "" && outlet.Status == "" && outlet.StateCode == "" && outlet.Gstin == "" && outlet.UpiId == "" && outlet.PricingMode == "" && outlet.Timezone == "" && outlet.AddressLine1 == "" && outlet.AddressLine2 == "" && outlet.City == "" && outlet.State == "" && outlet.Pincode == "" && outlet.Latitude == nil && outlet.Longitude == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Atleast one field is required"})
 		return
 	}
+	outlet.Gstin = strings.ToUpper(outlet.Gstin)
+
+	if !validOutletTaxFields(&outlet, c) {
+		return
+	}
+	if outlet.UpiId != "" && !upiIdRegex.MatchString(outlet.UpiId) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid UPI id"})
+		return
+	}
+	if outlet.Timezone != "" && hours.ValidateTimezone(outlet.Timezone) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": hours.ErrInvalidTimezone.Error()})
+		return
+	}
+	if !validOutletAddress(&outlet, c) {
+		return
+	}
+	// Outlets can not be moved to another organization
+	outlet.OrganizationId = 0
+	if outlet.ManagerId != 0 && !validOutletManager(outlet, c) {
+		return
+	}
 
 	// Save outlet to database
-	tx := db.DB.Model(models.Outlet{}).Where("id = ?", id).Updates(&outlet)
+	tx := db.Tenant(c).Model(models.Outlet{}).Where("id = ?", id).Updates(&outlet)
 
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Failed to update outlet"})
@@ -88,7 +130,7 @@ func Update(c *gin.Context) {
 }
 
 // @Summary      Get all outlets
-// @Description  Returns a list of all outlets
+// @Description  Returns a list of all outlets of the organization of the logged in employee
 // @Param Authorization header string true "Bearer Token"
 // @Tags         Outlet
 // @Accept       json
@@ -99,7 +141,7 @@ func Update(c *gin.Context) {
 // @Router       /outlet [get]
 func GetOutlets(c *gin.Context) {
 	var outlets []models.Outlet
-	tx := db.DB.Preload("Manager", func(db *gorm.DB) *gorm.DB {
+	tx := db.Tenant(c).Preload("Manager", func(db *gorm.DB) *gorm.DB {
 		return db.Omit("password")
 	}).Find(&outlets)
 	if tx.Error != nil {
@@ -122,7 +164,7 @@ func GetOutlets(c *gin.Context) {
 // @Router       /outlet/{outlet_id} [get]
 func GetOutlet(c *gin.Context) {
 	id := c.Param("outlet_id")
-	tx := db.DB.Where("id = ?", id).Preload("Manager", func(db *gorm.DB) *gorm.DB {
+	tx := db.Tenant(c).Where("id = ?", id).Preload("Manager", func(db *gorm.DB) *gorm.DB {
 		return db.Omit("password")
 	}).First(&outlet)
 	if tx.Error != nil {
@@ -133,7 +175,7 @@ func GetOutlet(c *gin.Context) {
 }
 
 // @Summary      Assign Pincodes
-// @Description  Assign service area pincodes of an outlet
+// @Description  Assign service area pincodes of an outlet. Under the exclusive overlap policy a pincode served by another outlet is refused.
 // @Param  outlet_id path string true "Outlet ID"
 // @Param Authorization header string true "Bearer Token"
 // @Tags         Outlet
@@ -141,49 +183,155 @@ func GetOutlet(c *gin.Context) {
 // @Produce      json
 // @Param        pincodes  body  dtos.OutletPincodes  true  "Service Pincodes"
 // @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
 // @Failure      500  {object}  dtos.ErrorResponse
 // @Security BearerAuth
-// @Router       /outlet/{outlet_id}/assign-pincodes [get]
+// @Router       /outlet/{outlet_id}/assign-pincodes [post]
 func AssignOutletServicePincode(c *gin.Context) {
 	var pincodes dtos.OutletPincodes
 	c.ShouldBindBodyWithJSON(&pincodes)
 
-	outletId := c.Param("outlet_id")
-
 	// Check if outlet ID pincodes are provided
 	if len(pincodes.Pincodes) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Pincodes are required"})
 		return
 	}
 
-	// Find outlet
-	tx := db.DB.First(&outlet)
-	if tx.RowsAffected == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Outlet not found with the given ID"})
+	outletIdNum, ok := servicePincodeOutlet(c)
+	if !ok {
 		return
 	}
 
-	outletIdNum, err := strconv.Atoi(outletId)
+	policy := serviceability.CurrentPolicy()
+	var failedPincodes []gin.H
+	var successPincodes []string
+	for _, pincode := range pincodes.Pincodes {
+		err := customers.ValidatePincode(pincode)
+		if err == nil {
+			err = serviceability.Assign(db.Tenant(c), outletIdNum, pincode, pincodes.Priority, policy)
+		}
+		if err == nil {
+			successPincodes = append(successPincodes, pincode)
+		} else {
+			failedPincodes = append(failedPincodes, gin.H{"pincode": pincode, "error": err.Error()})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Pincodes assigned to the outlet", "result": gin.H{"success": successPincodes, "failed": failedPincodes, "policy": policy}})
+}
+
+// @Summary      Unassign Pincodes
+// @Description  Stops an outlet from delivering to the given pincodes
+// @Param  outlet_id path string true "Outlet ID"
+// @Param Authorization header string true "Bearer Token"
+// @Tags         Outlet
+// @Accept       json
+// @Produce      json
+// @Param        pincodes  body  dtos.OutletPincodes  true  "Service Pincodes"
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/unassign-pincodes [post]
+func UnassignOutletServicePincode(c *gin.Context) {
+	var pincodes dtos.OutletPincodes
+	c.ShouldBindBodyWithJSON(&pincodes)
+
+	if len(pincodes.Pincodes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Pincodes are required"})
+		return
+	}
+
+	outletIdNum, ok := servicePincodeOutlet(c)
+	if !ok {
+		return
+	}
+
+	removed, err := serviceability.Unassign(db.Tenant(c), outletIdNum, pincodes.Pincodes)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to convert outlet id to number", "result": gin.H{"error": "error"}})
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to unassign the pincodes", "result": gin.H{"error": err.Error()}})
 		return
 	}
 
-	var failedPincodes []string
-	var successPincodes []string
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Pincodes unassigned from the outlet", "result": gin.H{"removed": removed}})
+}
+
+// @Summary      Replace Pincodes
+// @Description  Replaces every service area pincode of an outlet with the given ones. Nothing is changed when any of the pincodes can not be assigned.
+// @Param  outlet_id path string true "Outlet ID"
+// @Param Authorization header string true "Bearer Token"
+// @Tags         Outlet
+// @Accept       json
+// @Produce      json
+// @Param        pincodes  body  dtos.OutletPincodes  true  "Service Pincodes"
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pincodes [put]
+func ReplaceOutletServicePincodes(c *gin.Context) {
+	var pincodes dtos.OutletPincodes
+	err := c.ShouldBindBodyWithJSON(&pincodes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
 	for _, pincode := range pincodes.Pincodes {
-		var outletServicePincode models.OutletServicePincode
-		outletServicePincode.OutletId = uint(outletIdNum)
-		outletServicePincode.Pincode = pincode
-		tx := db.DB.Create(outletServicePincode)
-		if tx.Error == nil {
-			successPincodes = append(successPincodes, pincode)
-		} else {
-			failedPincodes = append(failedPincodes, pincode)
+		if err := customers.ValidatePincode(pincode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "result": gin.H{"pincode": pincode}})
+			return
+		}
+	}
+
+	outletIdNum, ok := servicePincodeOutlet(c)
+	if !ok {
+		return
+	}
+
+	policy := serviceability.CurrentPolicy()
+	failed := ""
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("outlet_id = ? AND pincode NOT IN ?", outletIdNum, append(pincodes.Pincodes, "")).Delete(&models.OutletServicePincode{}).Error
+		if err != nil {
+			return err
 		}
+		for _, pincode := range pincodes.Pincodes {
+			if err := serviceability.Assign(tx, outletIdNum, pincode, pincodes.Priority, policy); err != nil {
+				failed = pincode
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, serviceability.ErrPincodeTaken) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error(), "result": gin.H{"pincode": failed}})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to replace the pincodes", "result": gin.H{"error": err.Error()}})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Pincodes assigned to the outlet", "result": gin.H{"success": successPincodes, "failed": failedPincodes}})
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Pincodes of the outlet replaced", "result": gin.H{"pincodes": pincodes.Pincodes, "policy": policy}})
+}
+
+// @Summary      Get Pincodes
+// @Description  Lists the service area pincodes of an outlet
+// @Param  outlet_id path string true "Outlet ID"
+// @Param Authorization header string true "Bearer Token"
+// @Tags         Outlet
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pincodes [get]
+func GetOutletServicePincodes(c *gin.Context) {
+	var pincodes []models.OutletServicePincode
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Order("pincode").Find(&pincodes)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the pincodes", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Get pincodes", "result": gin.H{"pincodes": pincodes, "policy": serviceability.CurrentPolicy()}})
 }
 
 // Private methods
@@ -204,12 +352,33 @@ var validOutletFields = func(outlet models.Outlet, c *gin.Context) bool {
 		return false
 	}
 
+	if outlet.StateCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "State code is required when the location does not name a state"})
+		return false
+	}
+	if !validOutletTaxFields(&outlet, c) {
+		return false
+	}
+
+	if outlet.UpiId != "" && !upiIdRegex.MatchString(outlet.UpiId) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid UPI id"})
+		return false
+	}
+	if outlet.Timezone != "" && hours.ValidateTimezone(outlet.Timezone) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": hours.ErrInvalidTimezone.Error()})
+		return false
+	}
+	if !validOutletAddress(&outlet, c) {
+		return false
+	}
+
 	emailRegex := regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
 	if !emailRegex.MatchString(outlet.Email) {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid email address"})
 		return false
 	}
 
+	// Emails, phones and websites of outlets are unique across organizations
 	tx := db.DB.Where("email = ?", outlet.Email).First(&outlet)
 	if tx.RowsAffected > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Email already exists"})
@@ -229,3 +398,87 @@ var validOutletFields = func(outlet models.Outlet, c *gin.Context) bool {
 	}
 	return true
 }
+
+var validOutletTaxFields = func(outlet *models.Outlet, c *gin.Context) bool {
+	if outlet.StateCode != "" && !tax.ValidStateCode(outlet.StateCode) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid GST state code"})
+		return false
+	}
+
+	if err := tax.ValidateGstin(outlet.Gstin, outlet.StateCode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return false
+	}
+
+	if outlet.PricingMode != "" {
+		if _, err := tax.ParseMode(outlet.PricingMode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return false
+		}
+	}
+
+	return true
+}
+
+// validOutletManager checks that the manager of an outlet works for its organization
+var validOutletManager = func(outlet models.Outlet, c *gin.Context) bool {
+	var manager models.Employee
+	tx := db.Tenant(c).Omit("password").First(&manager, outlet.ManagerId)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Manager should be an employee of the organization"})
+		return false
+	}
+	return true
+}
+
+// validOutletAddress checks the pincode and coordinates of an outlet, which are given
+// together or not at all
+var validOutletAddress = func(outlet *models.Outlet, c *gin.Context) bool {
+	if outlet.Pincode != "" {
+		if err := customers.ValidatePincode(outlet.Pincode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return false
+		}
+	}
+
+	if (outlet.Latitude == nil) != (outlet.Longitude == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Latitude and longitude should be given together"})
+		return false
+	}
+	if outlet.Latitude != nil {
+		if err := serviceability.ValidateCoordinates(*outlet.Latitude, *outlet.Longitude); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return false
+		}
+	}
+
+	return true
+}
+
+// formatAddress writes the address of an outlet on one line
+var formatAddress = func(outlet models.Outlet) string {
+	var parts []string
+	for _, part := range []string{outlet.AddressLine1, outlet.AddressLine2, outlet.City, strings.TrimSpace(outlet.State + " " + outlet.Pincode)} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+var servicePincodeOutlet = func(c *gin.Context) (uint, bool) {
+	outletIdNum, err := strconv.Atoi(c.Param("outlet_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to convert outlet id to number", "result": gin.H{"error": err.Error()}})
+		return 0, false
+	}
+
+	// Find outlet
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, outletIdNum)
+	if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Outlet not found with the given ID"})
+		return 0, false
+	}
+	return outlet.ID, true
+}
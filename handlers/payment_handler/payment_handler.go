@@ -0,0 +1,211 @@
+package payment_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/payments"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Receive a payment webhook
+// @Description  Applies a webhook of a payment provider after checking its signature. Deliveries are applied once, redeliveries are acknowledged without being applied again. Authorized payments are captured straight away.
+// @Param provider path string true "Payment Provider"
+// @Tags         Payment
+// @Accept       json
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /payments/webhooks/{provider} [post]
+func Webhook(c *gin.Context) {
+	provider, err := payments.Provider(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Unknown payment provider"})
+		return
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	handleWebhook(c, provider, c.Request.Header, body)
+}
+
+// @Summary      Pay with the mock provider
+// @Description  Makes the mock payment provider send the signed webhook it would send when a payment is authorized, captured or fails, and applies it. Not available in production.
+// @Param intent_ref path string true "Intent Reference"
+// @Tags         Payment
+// @Accept       json
+// @Produce      json
+// @Param        event  body  dtos.MockPayment  true  "Event"
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Router       /payments/mock/{intent_ref} [post]
+func MockPay(c *gin.Context) {
+	if os.Getenv("ENV") == "Production" {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Mock payments are not available"})
+		return
+	}
+
+	var mockDTO dtos.MockPayment
+	err := c.ShouldBindBodyWithJSON(&mockDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if mockDTO.Event != payments.EventAuthorized && mockDTO.Event != payments.EventCaptured && mockDTO.Event != payments.EventFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Event should be payment.authorized, payment.captured or payment.failed"})
+		return
+	}
+
+	provider, err := payments.Provider("mock")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Mock payments are not available"})
+		return
+	}
+	mock := provider.(*payments.MockProvider)
+
+	var payment models.Payment
+	tx := db.DB.Where("provider = ? AND intent_ref = ?", mock.Name(), c.Param("intent_ref")).First(&payment)
+	if tx.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Payment not found"})
+		return
+	}
+	header, body, err := mock.Simulate(mockDTO.Event, payment.IntentRef, payment.PaymentRef, payment.Amount, payment.Currency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to build the webhook", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	handleWebhook(c, mock, header, body)
+}
+
+// @Summary      Start paying for an order
+// @Description  Starts a new online payment for what is still due on an order. The client pays against the intent reference of the payment with the provider. A payment started earlier and paid later is refunded.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Payment
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/payments [post]
+func StartPayment(c *gin.Context) {
+	order, ok := setOrder(c)
+	if !ok {
+		return
+	}
+
+	provider, err := payments.Current()
+	if !respondWithError(c, err, "Unable to start the payment") {
+		return
+	}
+	payment, err := payments.Start(c.Request.Context(), db.Tenant(c), provider, order)
+	if !respondWithError(c, err, "Unable to start the payment") {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Payment started successfully", "result": gin.H{"payment": payment}})
+}
+
+// @Summary      Get the payments of an order
+// @Description  Lists the online payments started for an order and the refunds made against them
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Payment
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/payments [get]
+func GetPayments(c *gin.Context) {
+	order, ok := setOrder(c)
+	if !ok {
+		return
+	}
+
+	var paymentList []models.Payment
+	var refundList []models.PaymentRefund
+	tx := db.Tenant(c).Where("order_id = ?", order.ID).Order("id").Find(&paymentList)
+	if tx.Error == nil {
+		tx = db.Tenant(c).Where("order_id = ?", order.ID).Order("id").Find(&refundList)
+	}
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the payments", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Payments fetched successfully", "result": gin.H{"payment_status": order.PaymentStatus, "amount_paid": order.AmountPaid, "amount_refunded": order.AmountRefunded, "payments": paymentList, "refunds": refundList}})
+}
+
+// Private methods
+
+var setOrder = func(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).First(&order, c.Param("order_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// handleWebhook verifies and applies a webhook. Any answer but a 2xx makes the provider
+// deliver it again, so only deliveries that can never be applied are refused for good.
+var handleWebhook = func(c *gin.Context, provider payments.PaymentProvider, header http.Header, body []byte) {
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to verify the webhook", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	payment, duplicate, err := payments.Apply(db.DB, provider, event)
+	if errors.Is(err, payments.ErrUnknownPayment) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Unable to apply the webhook", "result": gin.H{"error": err.Error()}})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to apply the webhook", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	// A capture that failed is tried again when the authorization is delivered again
+	if payment.Status == models.PaymentAuthorized {
+		payment, err = payments.Capture(c.Request.Context(), db.DB, provider, payment.ID)
+		if err != nil {
+			log.Printf("Unable to capture payment %d: %v", payment.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to capture the payment", "result": gin.H{"error": err.Error()}})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Webhook applied successfully", "result": gin.H{"event": event.Type, "duplicate": duplicate, "payment": payment}})
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if payments.IsPaymentError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
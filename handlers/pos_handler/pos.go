@@ -0,0 +1,310 @@
+package pos_handler
+
+import (
+	"easystore/hours"
+	"easystore/inventory"
+	"easystore/invoices"
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/promotions"
+	"easystore/receipts"
+	"easystore/returns"
+	"easystore/settings"
+	"easystore/tax"
+	"easystore/wallets"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBillNotOpen        = errors.New("Bill is not open")
+	ErrBillEmpty          = errors.New("Bill has no lines")
+	ErrBillUnpaid         = errors.New("Payments do not cover the bill total")
+	ErrChangeWithoutCash  = errors.New("Change can only be returned from a cash tender")
+	ErrExchangeEmpty      = errors.New("Exchange has no lines to sell")
+	ErrInvalidQuantity    = errors.New("Quantity should be positive")
+	ErrVarientUnavailable = errors.New("Unable to find an active product varient")
+	ErrPointsChanged      = errors.New("Loyalty points are worth something else now, apply them again")
+	ErrPointsExceedDue    = errors.New("Points are worth more than is due on the bill")
+	ErrTenderExceedsDue   = errors.New("Amount is more than is due on the bill")
+)
+
+// billSummary is a bill with its promotions, tax and tender totals computed
+type billSummary struct {
+	Bill       models.Bill       `json:"bill"`
+	Promotions promotions.Result `json:"promotions"`
+	Taxes      []tax.Breakdown   `json:"taxes"`
+	Totals     tax.Totals        `json:"totals"`
+	// RoundOff takes the total to what is payable under the rounding of the outlet
+	RoundOff models.Money `json:"round_off"`
+	// Payable, Paid, Due and Change are in the currency of the outlet
+	Payable  models.Amount `json:"payable"`
+	Paid     models.Amount `json:"paid"`
+	Due      models.Amount `json:"due"`
+	Change   models.Amount `json:"change"`
+	settings settings.Settings
+}
+
+// isBillError reports whether err was caused by the bill itself rather than the server
+func isBillError(err error) bool {
+	for _, billErr := range []error{ErrBillNotOpen, ErrBillEmpty, ErrBillUnpaid, ErrChangeWithoutCash, ErrExchangeEmpty, ErrInvalidQuantity, ErrVarientUnavailable, ErrPointsChanged, ErrPointsExceedDue, ErrTenderExceedsDue, ErrNoOpenShift, ErrShiftOpen, ErrShiftNotOpen, ErrInvalidCashType, inventory.ErrInsufficientStock, gorm.ErrRecordNotFound} {
+		if errors.Is(err, billErr) {
+			return true
+		}
+	}
+	return returns.IsReturnError(err) || receipts.IsReceiptError(err) || promotions.IsPromotionError(err) || loyalty.IsLoyaltyError(err) || wallets.IsWalletError(err) ||
+		settings.IsSettingsError(err)
+}
+
+// checkTender refuses a tender the outlet does not take at the counter
+func checkTender(tx *gorm.DB, outlet models.Outlet, method string) error {
+	outletSettings, err := settings.Get(tx, outlet)
+	if err != nil {
+		return err
+	}
+	return outletSettings.CheckTender(method)
+}
+
+func validTender(method string) bool {
+	for _, tender := range models.TenderMethods {
+		if tender == method {
+			return true
+		}
+	}
+	return false
+}
+
+// loadBill fetches a bill of the outlet with its lines and payments. With lock the bill row
+// is locked for the rest of the transaction.
+func loadBill(tx *gorm.DB, outletId uint, billId string, lock bool) (models.Bill, error) {
+	var bill models.Bill
+	query := tx.Where("outlet_id = ?", outletId)
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	err := query.First(&bill, billId).Error
+	if err != nil {
+		return bill, err
+	}
+
+	err = tx.Where("bill_id = ?", bill.ID).Preload("Varient.Product").Order("id").Find(&bill.Lines).Error
+	if err != nil {
+		return bill, err
+	}
+	err = tx.Where("bill_id = ?", bill.ID).Order("id").Find(&bill.Payments).Error
+	return bill, err
+}
+
+// summarize computes the promotions, taxes, totals and tenders of a bill. Taxes are computed
+// on the prices after the promotions and the total is rounded as the outlet rounds bills.
+// Counter sales are always supplied within the state of the outlet.
+func summarize(tx *gorm.DB, outlet models.Outlet, bill models.Bill) (billSummary, error) {
+	summary := billSummary{Bill: bill}
+	var err error
+	summary.settings, err = settings.Get(tx, outlet)
+	if err != nil {
+		return summary, err
+	}
+
+	items := make([]promotions.Item, 0, len(bill.Lines))
+	for _, line := range bill.Lines {
+		items = append(items, promotions.Item{Key: line.ID, VarientId: line.VarientId, ProductId: line.Varient.ProductId, CategoryId: line.Varient.Product.CategoryId, Quantity: line.Quantity, UnitPrice: line.UnitPrice})
+	}
+	summary.Promotions, err = promotions.Evaluate(tx, promotionContext(outlet, bill), items)
+	if err != nil {
+		return summary, err
+	}
+
+	lines := make([]tax.Line, 0, len(bill.Lines))
+	for _, line := range bill.Lines {
+		lines = append(lines, tax.LineFor(line.Varient.Product, line.UnitPrice, line.Quantity, summary.Promotions.Line(line.ID).Discount))
+	}
+
+	summary.Taxes, summary.Totals, err = tax.ComputeLines(lines, tax.ModeFor(outlet), false)
+	if err != nil {
+		return summary, err
+	}
+
+	payable := summary.settings.Round(summary.Totals.Total)
+	summary.RoundOff = payable - summary.Totals.Total
+	var paid, due, change models.Money
+	for _, payment := range bill.Payments {
+		paid += payment.Amount
+	}
+	if paid < payable {
+		due = payable - paid
+	} else {
+		change = paid - payable
+	}
+	currency := summary.settings.Currency
+	summary.Payable, summary.Paid, summary.Due, summary.Change = currency.Amount(payable), currency.Amount(paid), currency.Amount(due), currency.Amount(change)
+	return summary, nil
+}
+
+// finalize turns an open bill into a sale on the open shift of the employee. The bill row
+// stays locked until the surrounding transaction ends, so a bill can only be finalized once.
+// Loyalty points, gift cards and store credit tendered are spent and the customer earns
+// points on what was not paid with points.
+func finalize(tx *gorm.DB, outlet models.Outlet, billId string, employeeId uint) (models.Sale, error) {
+	var sale models.Sale
+	shift, err := openShift(tx, outlet.ID, employeeId)
+	if err != nil {
+		return sale, err
+	}
+
+	bill, err := loadBill(tx, outlet.ID, billId, true)
+	if err != nil {
+		return sale, err
+	}
+	if bill.Status != models.BillOpen {
+		return sale, ErrBillNotOpen
+	}
+	if len(bill.Lines) == 0 {
+		return sale, ErrBillEmpty
+	}
+
+	summary, err := summarize(tx, outlet, bill)
+	if err != nil {
+		return sale, err
+	}
+	if summary.Due.Amount > 0 {
+		return sale, ErrBillUnpaid
+	}
+
+	// Tenders are checked again in case the outlet stopped taking one while the bill was open
+	var cash models.Money
+	for _, payment := range bill.Payments {
+		if payment.Method != models.TenderExchange {
+			if err := summary.settings.CheckTender(payment.Method); err != nil {
+				return sale, err
+			}
+		}
+		if payment.Method == models.TenderCash {
+			cash += payment.Amount
+		}
+	}
+	if summary.Change.Amount > cash {
+		return sale, ErrChangeWithoutCash
+	}
+
+	sale = models.Sale{
+		OutletId:     outlet.ID,
+		BillId:       bill.ID,
+		EmployeeId:   employeeId,
+		ShiftId:      &shift.ID,
+		CustomerId:   bill.CustomerId,
+		Discount:     summary.Promotions.Discount,
+		TaxableValue: summary.Totals.TaxableValue,
+		Cgst:         summary.Totals.Cgst,
+		Sgst:         summary.Totals.Sgst,
+		Igst:         summary.Totals.Igst,
+		Cess:         summary.Totals.Cess,
+		TotalTax:     summary.Totals.TotalTax,
+		Total:        summary.Totals.Total,
+		RoundOff:     summary.RoundOff,
+		Paid:         summary.Paid.Amount,
+		Change:       summary.Change.Amount,
+	}
+	for i, line := range bill.Lines {
+		if err := inventory.Decrement(tx, line.VarientId, line.Quantity); err != nil {
+			return sale, err
+		}
+
+		breakdown := summary.Taxes[i]
+		sale.Lines = append(sale.Lines, models.SaleLine{
+			VarientId:    line.VarientId,
+			ProductId:    line.Varient.ProductId,
+			Name:         line.Varient.Product.Title + " " + line.Varient.Name,
+			HsnCode:      breakdown.HsnCode,
+			Quantity:     line.Quantity,
+			UnitPrice:    line.UnitPrice,
+			Mrp:          line.Mrp,
+			Discount:     summary.Promotions.Line(line.ID).Discount,
+			GstRate:      breakdown.GstRate,
+			CessRate:     breakdown.CessRate,
+			TaxableValue: breakdown.TaxableValue,
+			Cgst:         breakdown.Cgst,
+			Sgst:         breakdown.Sgst,
+			Igst:         breakdown.Igst,
+			Cess:         breakdown.Cess,
+			Total:        breakdown.Total,
+		})
+	}
+	var pointsValue models.Money
+	for _, payment := range bill.Payments {
+		sale.Payments = append(sale.Payments, models.SalePayment{Method: payment.Method, Amount: payment.Amount, Reference: payment.Reference, Points: payment.Points})
+		if payment.Method == models.TenderLoyaltyPoints {
+			pointsValue += payment.Amount
+		}
+	}
+
+	if err := tx.Create(&sale).Error; err != nil {
+		return sale, err
+	}
+	if err := promotions.Redeem(tx, summary.Promotions, promotionContext(outlet, bill), &sale.ID, nil); err != nil {
+		return sale, err
+	}
+	for _, payment := range bill.Payments {
+		switch payment.Method {
+		case models.TenderLoyaltyPoints:
+			if bill.CustomerId == nil {
+				return sale, loyalty.ErrCustomerRequired
+			}
+			entry, err := loyalty.Redeem(tx, outlet, *bill.CustomerId, payment.Points, sale.Total, loyalty.Source{SaleId: &sale.ID})
+			if err != nil {
+				return sale, err
+			}
+			if -entry.Value != payment.Amount {
+				return sale, ErrPointsChanged
+			}
+		case models.TenderGiftCard:
+			_, err := wallets.RedeemGiftCard(tx, outlet, payment.Reference, payment.Amount, wallets.Source{SaleId: &sale.ID}, time.Now())
+			if err != nil {
+				return sale, err
+			}
+		case models.TenderStoreCredit:
+			if bill.CustomerId == nil {
+				return sale, wallets.ErrCustomerRequired
+			}
+			_, err := wallets.SpendStoreCredit(tx, outlet.ID, *bill.CustomerId, payment.Amount, wallets.Source{SaleId: &sale.ID})
+			if err != nil {
+				return sale, err
+			}
+		}
+	}
+	if bill.CustomerId != nil {
+		err := loyalty.Earn(tx, outlet, *bill.CustomerId, sale.Total-pointsValue, loyalty.Source{SaleId: &sale.ID}, time.Now())
+		if err != nil {
+			return sale, err
+		}
+	}
+
+	err = tx.Model(&models.Bill{}).Where("id = ?", bill.ID).Updates(map[string]interface{}{"status": models.BillFinalized, "sale_id": sale.ID}).Error
+	if err != nil {
+		return sale, err
+	}
+
+	_, err = invoices.IssueSale(tx, sale)
+	return sale, err
+}
+
+// promotionContext is what promotions are evaluated against for a bill
+func promotionContext(outlet models.Outlet, bill models.Bill) promotions.Context {
+	return promotions.Context{OutletId: bill.OutletId, Channel: models.ChannelPos, CustomerId: bill.CustomerId, Coupon: bill.CouponCode, At: time.Now().In(hours.Of(outlet))}
+}
+
+// currentOutlet loads the outlet checked by the outlet middleware
+func currentOutlet(tx *gorm.DB, c *gin.Context) (models.Outlet, error) {
+	var outlet models.Outlet
+	outletId, err := strconv.Atoi(c.Param("outlet_id"))
+	if err != nil {
+		return outlet, err
+	}
+	err = tx.First(&outlet, outletId).Error
+	return outlet, err
+}
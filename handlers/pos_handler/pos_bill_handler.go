@@ -0,0 +1,833 @@
+package pos_handler
+
+import (
+	"easystore/auth"
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/pricing"
+	"easystore/wallets"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Open a bill
+// @Description  Opens a new bill at the counter of an outlet for the logged in employee
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills [post]
+func OpenBill(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	bill := models.Bill{OutletId: outlet.ID, EmployeeId: auth.CurrentEmployeeID(c), Status: models.BillOpen}
+	tx := db.Tenant(c).Create(&bill)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to open the bill", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Bill opened successfully", "result": gin.H{"bill": bill}})
+}
+
+// @Summary      Get a bill
+// @Description  Returns a bill with its lines, payments, taxes and the amount still due
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id} [get]
+func GetBill(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+	respondWithBill(c, outlet, http.StatusOK, "Bill fetched successfully")
+}
+
+// @Summary      Add a line to a bill
+// @Description  Adds a product varient to an open bill by varient id or barcode at its current selling price. Adding a varient already on the bill increases its quantity.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        line  body  dtos.BillLine  true  "Bill Line"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      422  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/lines [post]
+func AddLine(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var lineDTO dtos.BillLine
+	err := c.ShouldBindBodyWithJSON(&lineDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if lineDTO.Quantity == 0 {
+		lineDTO.Quantity = 1
+	}
+	if lineDTO.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Quantity should be positive"})
+		return
+	}
+
+	var varient models.ProductVarient
+	query := db.Tenant(c).Joins("Product").Where("\"Product\".outlet_id = ? AND \"Product\".status = ?", outlet.ID, "active")
+	if lineDTO.Barcode != "" {
+		query = query.Where("product_varients.barcode = ?", lineDTO.Barcode)
+	} else {
+		query = query.Where("product_varients.id = ?", lineDTO.VarientId)
+	}
+	tx := query.First(&varient)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find an active product varient", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		bill, err := loadBill(tx, outlet.ID, c.Param("bill_id"), true)
+		if err != nil {
+			return err
+		}
+		if bill.Status != models.BillOpen {
+			return ErrBillNotOpen
+		}
+
+		for _, line := range bill.Lines {
+			if line.VarientId == varient.ID {
+				return tx.Model(&line).Update("quantity", line.Quantity+lineDTO.Quantity).Error
+			}
+		}
+
+		price, err := pricing.EffectivePrice(tx, varient, time.Now())
+		if err != nil {
+			return err
+		}
+		line := models.BillLine{BillId: bill.ID, VarientId: varient.ID, Quantity: lineDTO.Quantity, UnitPrice: price.SellingPrice, Mrp: price.Mrp}
+		return tx.Omit("Varient").Create(&line).Error
+	})
+	if !respondWithError(c, err, "Unable to add the line") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Line added successfully")
+}
+
+// @Summary      Change the quantity of a bill line
+// @Description  Changes the quantity of a line of an open bill. A quantity of zero removes the line.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Param line_id path string true "Bill Line ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        line  body  dtos.BillLineUpdate  true  "Quantity"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/lines/{line_id} [put]
+func UpdateLine(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var lineDTO dtos.BillLineUpdate
+	err := c.ShouldBindBodyWithJSON(&lineDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if lineDTO.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Quantity should not be negative"})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		var line models.BillLine
+		if err := tx.Where("bill_id = ?", bill.ID).First(&line, c.Param("line_id")).Error; err != nil {
+			return err
+		}
+		if lineDTO.Quantity == 0 {
+			return tx.Unscoped().Delete(&line).Error
+		}
+		return tx.Model(&line).Update("quantity", lineDTO.Quantity).Error
+	})
+	if !respondWithError(c, err, "Unable to update the line") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Line updated successfully")
+}
+
+// @Summary      Remove a line from a bill
+// @Description  Removes a line from an open bill
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Param line_id path string true "Bill Line ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/lines/{line_id} [delete]
+func RemoveLine(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		result := tx.Unscoped().Where("bill_id = ?", bill.ID).Delete(&models.BillLine{}, c.Param("line_id"))
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if !respondWithError(c, err, "Unable to remove the line") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Line removed successfully")
+}
+
+// @Summary      Attach a customer to a bill
+// @Description  Attaches a customer of the chain to an open bill by id or phone so the sale shows up in their purchase history. An empty body detaches the customer. Loyalty points and store credit tendered on the bill are taken off.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        customer  body  dtos.BillCustomer  true  "Customer"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/customer [put]
+func SetCustomer(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var customerDTO dtos.BillCustomer
+	err := c.ShouldBindBodyWithJSON(&customerDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var customerId *uint
+	if customerDTO.CustomerId != 0 || customerDTO.Phone != "" {
+		var customer models.Customer
+		if customerDTO.CustomerId != 0 {
+			customer, err = customers.Find(db.Tenant(c), outlet.ChainId(), customerDTO.CustomerId)
+		} else {
+			customer, err = customers.FindByPhone(db.Tenant(c), outlet.ChainId(), customerDTO.Phone)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Customer not found"})
+			return
+		}
+		customerId = &customer.ID
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		// Points and store credit tendered belong to the customer the bill had
+		err := tx.Unscoped().Where("bill_id = ? AND method IN ?", bill.ID, []string{models.TenderLoyaltyPoints, models.TenderStoreCredit}).Delete(&models.BillPayment{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&bill).Update("customer_id", customerId).Error
+	})
+	if !respondWithError(c, err, "Unable to set the customer") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Customer set successfully")
+}
+
+// @Summary      Add a payment to a bill
+// @Description  Records a tender against an open bill. A bill can be split across cash, card and UPI.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        payment  body  dtos.BillPayment  true  "Payment"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/payments [post]
+func AddPayment(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var paymentDTO dtos.BillPayment
+	err := c.ShouldBindBodyWithJSON(&paymentDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if !validTender(paymentDTO.Method) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid payment method", "result": gin.H{"methods": models.TenderMethods}})
+		return
+	}
+	if paymentDTO.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Amount should be greater than zero"})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		if err := checkTender(tx, outlet, paymentDTO.Method); err != nil {
+			return err
+		}
+		payment := models.BillPayment{BillId: bill.ID, Method: paymentDTO.Method, Amount: paymentDTO.Amount, Reference: paymentDTO.Reference}
+		return tx.Create(&payment).Error
+	})
+	if !respondWithError(c, err, "Unable to add the payment") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Payment added successfully")
+}
+
+// @Summary      Remove a payment from a bill
+// @Description  Removes a tender from an open bill
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Param payment_id path string true "Bill Payment ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/payments/{payment_id} [delete]
+func RemovePayment(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		result := tx.Unscoped().Where("bill_id = ?", bill.ID).Delete(&models.BillPayment{}, c.Param("payment_id"))
+		if result.Error == nil && result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return result.Error
+	})
+	if !respondWithError(c, err, "Unable to remove the payment") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Payment removed successfully")
+}
+
+// @Summary      Apply a coupon to a bill
+// @Description  Puts a coupon code on an open bill. The bill is returned with the promotions that apply and, when the coupon does not, the reason why. A bill with a coupon that does not apply can not be finalized.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        coupon  body  dtos.Coupon  true  "Coupon"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/coupon [put]
+func SetCoupon(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var couponDTO dtos.Coupon
+	err := c.ShouldBindBodyWithJSON(&couponDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	code := strings.ToUpper(strings.TrimSpace(couponDTO.Code))
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Coupon code is required"})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		return tx.Model(&bill).Update("coupon_code", code).Error
+	})
+	if !respondWithError(c, err, "Unable to apply the coupon") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Coupon applied successfully")
+}
+
+// @Summary      Remove the coupon from a bill
+// @Description  Takes the coupon code off an open bill
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/coupon [delete]
+func RemoveCoupon(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		return tx.Model(&bill).Update("coupon_code", "").Error
+	})
+	if !respondWithError(c, err, "Unable to remove the coupon") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Coupon removed successfully")
+}
+
+// @Summary      Pay with loyalty points
+// @Description  Tenders loyalty points of the customer of an open bill, replacing any points tendered before. The points should be at least the minimum of the loyalty program of the outlet, within the balance of the customer and worth no more than is due and the share of the bill points can pay for. They are spent when the bill is finalized.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        points  body  dtos.LoyaltyPoints  true  "Points"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/points [put]
+func SetPoints(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var pointsDTO dtos.LoyaltyPoints
+	err := c.ShouldBindBodyWithJSON(&pointsDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		if bill.CustomerId == nil {
+			return loyalty.ErrCustomerRequired
+		}
+		if err := checkTender(tx, outlet, models.TenderLoyaltyPoints); err != nil {
+			return err
+		}
+		err := tx.Unscoped().Where("bill_id = ? AND method = ?", bill.ID, models.TenderLoyaltyPoints).Delete(&models.BillPayment{}).Error
+		if err != nil {
+			return err
+		}
+		payments := bill.Payments[:0]
+		for _, payment := range bill.Payments {
+			if payment.Method != models.TenderLoyaltyPoints {
+				payments = append(payments, payment)
+			}
+		}
+		bill.Payments = payments
+
+		summary, err := summarize(tx, outlet, bill)
+		if err != nil {
+			return err
+		}
+		value, err := loyalty.Quote(tx, outlet, *bill.CustomerId, pointsDTO.Points, summary.Totals.Total)
+		if err != nil {
+			return err
+		}
+		if value > summary.Due.Amount {
+			return ErrPointsExceedDue
+		}
+		payment := models.BillPayment{BillId: bill.ID, Method: models.TenderLoyaltyPoints, Amount: value, Points: pointsDTO.Points}
+		return tx.Create(&payment).Error
+	})
+	if !respondWithError(c, err, "Unable to pay with points") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Points applied successfully")
+}
+
+// @Summary      Remove the loyalty points from a bill
+// @Description  Takes the loyalty points tendered off an open bill
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/points [delete]
+func RemovePoints(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		return tx.Unscoped().Where("bill_id = ? AND method = ?", bill.ID, models.TenderLoyaltyPoints).Delete(&models.BillPayment{}).Error
+	})
+	if !respondWithError(c, err, "Unable to remove the points") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Points removed successfully")
+}
+
+// @Summary      Pay with a gift card
+// @Description  Tenders a gift card of the chain on an open bill, replacing what was tendered from the same card before. Without an amount as much of the balance as is due is taken. The amount should be within the balance of the card and no more than is due. It is spent when the bill is finalized.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        gift_card  body  dtos.GiftCardTender  true  "Gift card"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/gift-cards [post]
+func AddGiftCard(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var giftCardDTO dtos.GiftCardTender
+	err := c.ShouldBindBodyWithJSON(&giftCardDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	code := wallets.NormalizeCode(giftCardDTO.Code)
+	if code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Gift card code is required"})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		if err := checkTender(tx, outlet, models.TenderGiftCard); err != nil {
+			return err
+		}
+		bill, err := withoutTender(tx, bill, models.TenderGiftCard, code)
+		if err != nil {
+			return err
+		}
+		summary, err := summarize(tx, outlet, bill)
+		if err != nil {
+			return err
+		}
+		amount := giftCardDTO.Amount
+		if amount == 0 {
+			card, err := wallets.FindGiftCard(tx, outlet.ChainId(), code)
+			if err != nil {
+				return err
+			}
+			amount, err = wallets.GiftCardBalance(tx, card.ID)
+			if err != nil {
+				return err
+			}
+			if amount > summary.Due.Amount {
+				amount = summary.Due.Amount
+			}
+		}
+		if amount > summary.Due.Amount {
+			return ErrTenderExceedsDue
+		}
+		if _, _, err := wallets.CheckGiftCard(tx, outlet, code, amount, time.Now()); err != nil {
+			return err
+		}
+		payment := models.BillPayment{BillId: bill.ID, Method: models.TenderGiftCard, Amount: amount, Reference: code}
+		return tx.Create(&payment).Error
+	})
+	if !respondWithError(c, err, "Unable to pay with the gift card") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Gift card applied successfully")
+}
+
+// @Summary      Pay with store credit
+// @Description  Tenders store credit of the customer of an open bill, replacing any store credit tendered before. The amount should be within the balance of the customer and no more than is due. It is spent when the bill is finalized.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        store_credit  body  dtos.StoreCreditTender  true  "Store credit"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/store-credit [put]
+func SetStoreCredit(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var creditDTO dtos.StoreCreditTender
+	err := c.ShouldBindBodyWithJSON(&creditDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	err = changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		if bill.CustomerId == nil {
+			return wallets.ErrCustomerRequired
+		}
+		if err := checkTender(tx, outlet, models.TenderStoreCredit); err != nil {
+			return err
+		}
+		bill, err := withoutTender(tx, bill, models.TenderStoreCredit, "")
+		if err != nil {
+			return err
+		}
+		summary, err := summarize(tx, outlet, bill)
+		if err != nil {
+			return err
+		}
+		if creditDTO.Amount > summary.Due.Amount {
+			return ErrTenderExceedsDue
+		}
+		if _, err := wallets.CheckStoreCredit(tx, *bill.CustomerId, creditDTO.Amount); err != nil {
+			return err
+		}
+		payment := models.BillPayment{BillId: bill.ID, Method: models.TenderStoreCredit, Amount: creditDTO.Amount}
+		return tx.Create(&payment).Error
+	})
+	if !respondWithError(c, err, "Unable to pay with store credit") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Store credit applied successfully")
+}
+
+// @Summary      Remove the store credit from a bill
+// @Description  Takes the store credit tendered off an open bill
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/store-credit [delete]
+func RemoveStoreCredit(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		_, err := withoutTender(tx, bill, models.TenderStoreCredit, "")
+		return err
+	})
+	if !respondWithError(c, err, "Unable to remove the store credit") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Store credit removed successfully")
+}
+
+// @Summary      Finalize a bill
+// @Description  Finalizes a fully paid bill on the open shift of the logged in employee. Stock is decremented and an immutable sale is recorded in a single transaction.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/finalize [post]
+func FinalizeBill(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var sale models.Sale
+	err := db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		sale, err = finalize(tx, outlet, c.Param("bill_id"), auth.CurrentEmployeeID(c))
+		return err
+	})
+	if !respondWithError(c, err, "Unable to finalize the bill") {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Bill finalized successfully", "result": gin.H{"sale": sale}})
+}
+
+// @Summary      Void a bill
+// @Description  Voids an open bill so it can no longer be finalized
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param bill_id path string true "Bill ID"
+// @Tags         POS
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/bills/{bill_id}/void [post]
+func VoidBill(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	err := changeOpenBill(c, outlet, c.Param("bill_id"), func(tx *gorm.DB, bill models.Bill) error {
+		return tx.Model(&bill).Update("status", models.BillVoided).Error
+	})
+	if !respondWithError(c, err, "Unable to void the bill") {
+		return
+	}
+
+	respondWithBill(c, outlet, http.StatusAccepted, "Bill voided successfully")
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	outlet, err := currentOutlet(db.Tenant(c), c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": err.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// changeOpenBill runs change in a transaction holding the lock of the bill, after checking
+// that the bill is still open
+var changeOpenBill = func(c *gin.Context, outlet models.Outlet, billId string, change func(tx *gorm.DB, bill models.Bill) error) error {
+	return db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		bill, err := loadBill(tx, outlet.ID, billId, true)
+		if err != nil {
+			return err
+		}
+		if bill.Status != models.BillOpen {
+			return ErrBillNotOpen
+		}
+		return change(tx, bill)
+	})
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if errors.Is(err, ErrShiftNotOwned) {
+		c.JSON(http.StatusForbidden, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else if errors.Is(err, pricing.ErrNoPrice) {
+		// The varient has no price to sell it at, which the catalog has to fix
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else if isBillError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
+
+var respondWithBill = func(c *gin.Context, outlet models.Outlet, status int, message string) {
+	bill, err := loadBill(db.Tenant(c), outlet.ID, c.Param("bill_id"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the bill", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	summary, err := summarize(db.Tenant(c), outlet, bill)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to compute the bill totals", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": summary})
+}
+
+// withoutTender deletes the payments of a bill made with method, only those with reference
+// when one is given, and returns the bill with the payments left
+var withoutTender = func(tx *gorm.DB, bill models.Bill, method string, reference string) (models.Bill, error) {
+	query := tx.Unscoped().Where("bill_id = ? AND method = ?", bill.ID, method)
+	if reference != "" {
+		query = query.Where("reference = ?", reference)
+	}
+	if err := query.Delete(&models.BillPayment{}).Error; err != nil {
+		return bill, err
+	}
+
+	payments := make([]models.BillPayment, 0, len(bill.Payments))
+	for _, payment := range bill.Payments {
+		if payment.Method != method || (reference != "" && payment.Reference != reference) {
+			payments = append(payments, payment)
+		}
+	}
+	bill.Payments = payments
+	return bill, nil
+}
@@ -0,0 +1,185 @@
+package pos_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/pricing"
+	"easystore/returns"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Exchange goods
+// @Description  Takes back lines of a sale or delivered order of the outlet and sells other varients in their place, in a single transaction on the open shift of the logged in employee. The value of the returned lines, worked out from the prices and taxes they were sold at, pays for the new sale first. The payments cover the rest of the new sale, and whatever is left of the value returned is refunded with the refund method.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        exchange  body  dtos.Exchange  true  "Exchange Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      422  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/exchanges [post]
+func Exchange(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var exchangeDTO dtos.Exchange
+	err := c.ShouldBindBodyWithJSON(&exchangeDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if exchangeDTO.RefundMethod == models.RefundToExchange {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Refund method should be original or store_credit"})
+		return
+	}
+	for _, payment := range exchangeDTO.Payments {
+		if !validTender(payment.Method) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid payment method", "result": gin.H{"methods": models.TenderMethods}})
+			return
+		}
+		if payment.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Amount should be greater than zero"})
+			return
+		}
+	}
+
+	employeeId := auth.CurrentEmployeeID(c)
+	request := returns.Request{
+		Outlet:       outlet,
+		SaleId:       exchangeDTO.SaleId,
+		OrderId:      exchangeDTO.OrderId,
+		EmployeeId:   employeeId,
+		RefundMethod: models.RefundToExchange,
+		Reason:       exchangeDTO.Reason,
+	}
+	for _, line := range exchangeDTO.Returns {
+		request.Lines = append(request.Lines, returns.LineRequest{LineId: line.LineId, Quantity: line.Quantity, Disposition: line.Disposition, Reason: line.Reason})
+	}
+
+	var ret models.Return
+	var sale models.Sale
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		ret, err = returns.Create(tx, request)
+		if err != nil {
+			return err
+		}
+
+		bill := models.Bill{OutletId: outlet.ID, EmployeeId: employeeId, CustomerId: ret.CustomerId, Status: models.BillOpen}
+		if err := tx.Omit("Outlet", "Employee", "Lines", "Payments").Create(&bill).Error; err != nil {
+			return err
+		}
+		if err := addExchangeLines(tx, outlet, bill, exchangeDTO.Lines); err != nil {
+			return err
+		}
+		billId := fmt.Sprint(bill.ID)
+		bill, err = loadBill(tx, outlet.ID, billId, true)
+		if err != nil {
+			return err
+		}
+		summary, err := summarize(tx, outlet, bill)
+		if err != nil {
+			return err
+		}
+
+		// The value returned pays for the new sale first
+		credit := returns.Outstanding(ret)
+		if credit > summary.Payable.Amount {
+			credit = summary.Payable.Amount
+		}
+		if credit > 0 {
+			payment := models.BillPayment{BillId: bill.ID, Method: models.TenderExchange, Amount: credit, Reference: fmt.Sprintf("return:%d", ret.ID)}
+			if err := tx.Create(&payment).Error; err != nil {
+				return err
+			}
+			if err := returns.Refund(tx, &ret, credit, models.RefundToExchange); err != nil {
+				return err
+			}
+		}
+		for _, paymentDTO := range exchangeDTO.Payments {
+			payment := models.BillPayment{BillId: bill.ID, Method: paymentDTO.Method, Amount: paymentDTO.Amount, Reference: paymentDTO.Reference}
+			if err := tx.Create(&payment).Error; err != nil {
+				return err
+			}
+		}
+
+		sale, err = finalize(tx, outlet, billId, employeeId)
+		if err != nil {
+			return err
+		}
+
+		refundMethod := exchangeDTO.RefundMethod
+		if refundMethod == "" {
+			refundMethod = models.RefundToOriginal
+		}
+		return returns.Refund(tx, &ret, returns.Outstanding(ret), refundMethod)
+	})
+	if !respondWithError(c, err, "Unable to make the exchange") {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Exchange made successfully", "result": gin.H{"return": ret, "sale": sale}})
+}
+
+// Private methods
+
+// addExchangeLines puts the varients sold in an exchange on its bill at their current
+// prices, adding up the quantities of a varient asked for more than once
+var addExchangeLines = func(tx *gorm.DB, outlet models.Outlet, bill models.Bill, lines []dtos.BillLine) error {
+	if len(lines) == 0 {
+		return ErrExchangeEmpty
+	}
+
+	now := time.Now()
+	added := map[uint]*models.BillLine{}
+	for _, lineDTO := range lines {
+		if lineDTO.Quantity == 0 {
+			lineDTO.Quantity = 1
+		}
+		if lineDTO.Quantity < 0 {
+			return ErrInvalidQuantity
+		}
+
+		var varient models.ProductVarient
+		query := tx.Joins("Product").Where("\"Product\".outlet_id = ? AND \"Product\".status = ?", outlet.ID, "active")
+		if lineDTO.Barcode != "" {
+			query = query.Where("product_varients.barcode = ?", lineDTO.Barcode)
+		} else {
+			query = query.Where("product_varients.id = ?", lineDTO.VarientId)
+		}
+		if err := query.First(&varient).Error; err != nil {
+			return fmt.Errorf("%w: %v", ErrVarientUnavailable, err)
+		}
+
+		if line, ok := added[varient.ID]; ok {
+			line.Quantity += lineDTO.Quantity
+			if err := tx.Model(line).Update("quantity", line.Quantity).Error; err != nil {
+				return err
+			}
+			continue
+		}
+		price, err := pricing.EffectivePrice(tx, varient, now)
+		if err != nil {
+			return err
+		}
+		line := models.BillLine{BillId: bill.ID, VarientId: varient.ID, Quantity: lineDTO.Quantity, UnitPrice: price.SellingPrice, Mrp: price.Mrp}
+		if err := tx.Omit("Varient").Create(&line).Error; err != nil {
+			return err
+		}
+		added[varient.ID] = &line
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package pos_handler
+
+import (
+	"easystore/db"
+	"easystore/models"
+	"easystore/receipts"
+	"easystore/settings"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Get the receipt of a sale
+// @Description  Renders a finalized sale as a receipt for a thermal printer. The escpos format returns the raw ESC/POS bytes for the terminal to forward to the printer, the text format a plain text receipt for terminals without one. The QR code holds a UPI payment link on the UPI id of the outlet or a link to the invoice, by default the invoice link when INVOICE_LINK_URL is set, else the UPI link when the outlet has a UPI id.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param sale_id path string true "Sale ID"
+// @Param paper query string false "80mm (default) or 58mm"
+// @Param format query string false "escpos (default) or text"
+// @Param qr query string false "upi, invoice or none"
+// @Tags         POS
+// @Produce      octet-stream
+// @Produce      plain
+// @Success      200  {file}  file
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/sales/{sale_id}/receipt [get]
+func GetReceipt(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	paper, err := receipts.ParsePaper(c.Query("paper"))
+	if !respondWithError(c, err, "Unable to print the receipt") {
+		return
+	}
+	format := c.DefaultQuery("format", "escpos")
+	if format != "escpos" && format != "text" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Format should be escpos or text"})
+		return
+	}
+
+	var sale models.Sale
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&sale, c.Param("sale_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Sale not found"})
+		return
+	}
+
+	var invoice *models.Invoice
+	var invoices []models.Invoice
+	if err := db.Tenant(c).Where("sale_id = ?", sale.ID).Limit(1).Find(&invoices).Error; !respondWithError(c, err, "Unable to get the invoice") {
+		return
+	}
+	if len(invoices) > 0 {
+		invoice = &invoices[0]
+	}
+
+	outletSettings, err := settings.Get(db.Tenant(c), outlet)
+	if !respondWithError(c, err, "Unable to get the settings") {
+		return
+	}
+	options := receipts.Options{Paper: paper, Qr: c.Query("qr"), InvoiceLink: os.Getenv("INVOICE_LINK_URL"), Settings: outletSettings}
+	if options.Qr == "" {
+		options.Qr = defaultQr(outlet, invoice, options.InvoiceLink)
+	}
+	receipt, err := receipts.Build(sale, outlet, invoice, options)
+	if !respondWithError(c, err, "Unable to print the receipt") {
+		return
+	}
+
+	if format == "text" {
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(receipt.Text()))
+		return
+	}
+	c.Data(http.StatusOK, "application/octet-stream", receipt.ESCPOS())
+}
+
+// Private methods
+
+var defaultQr = func(outlet models.Outlet, invoice *models.Invoice, invoiceLink string) string {
+	if invoice != nil && invoiceLink != "" {
+		return receipts.QrInvoice
+	}
+	if outlet.UpiId != "" {
+		return receipts.QrUpi
+	}
+	return receipts.QrNone
+}
@@ -0,0 +1,30 @@
+package pos_handler
+
+import (
+	"easystore/db"
+	"easystore/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Get a sale
+// @Description  Returns a finalized sale with its lines, taxes and payments
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param sale_id path string true "Sale ID"
+// @Tags         POS
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/sales/{sale_id} [get]
+func GetSale(c *gin.Context) {
+	var sale models.Sale
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Preload("Lines").Preload("Payments").First(&sale, c.Param("sale_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Sale not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Sale fetched successfully", "result": gin.H{"sale": sale}})
+}
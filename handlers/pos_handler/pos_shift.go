@@ -0,0 +1,195 @@
+package pos_handler
+
+import (
+	"easystore/models"
+	"errors"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoOpenShift     = errors.New("Open a shift before finalizing bills")
+	ErrShiftOpen       = errors.New("Employee already has an open shift at this outlet")
+	ErrShiftNotOpen    = errors.New("Shift is not open")
+	ErrInvalidCashType = errors.New("Type should be cash_in or cash_out")
+	ErrShiftNotOwned   = errors.New("Only the employee who opened the shift or a manager can change it")
+)
+
+type tenderReport struct {
+	Method   string       `json:"method"`
+	Expected models.Money `json:"expected"`
+	Counted  models.Money `json:"counted"`
+	Variance models.Money `json:"variance"`
+}
+
+// tenderTotal is what a tender took in over a shift, less what it refunded
+type tenderTotal struct {
+	Method string       `json:"method"`
+	Amount models.Money `json:"amount"`
+}
+
+// shiftReport is the X report of an open shift or the Z report of a closed one. Tenders are
+// the counter tenders reconciled at the close, Settled the gift cards, store credit, loyalty
+// points and exchanges that never reach the drawer or a terminal.
+type shiftReport struct {
+	Shift   models.Shift   `json:"shift"`
+	Sales   int64          `json:"sales"`
+	Total   models.Money   `json:"total"`
+	CashIn  models.Money   `json:"cash_in"`
+	CashOut models.Money   `json:"cash_out"`
+	Refunds models.Money   `json:"refunds"`
+	Tenders []tenderReport `json:"tenders"`
+	Settled []tenderTotal  `json:"settled"`
+}
+
+// openShift returns the open shift of the employee at the outlet. The shift row is share
+// locked so it can not be closed while a sale is being recorded on it.
+func openShift(tx *gorm.DB, outletId uint, employeeId uint) (models.Shift, error) {
+	var shift models.Shift
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("outlet_id = ? AND employee_id = ? AND status = ?", outletId, employeeId, models.ShiftOpen).First(&shift).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return shift, ErrNoOpenShift
+	}
+	return shift, err
+}
+
+func loadShift(tx *gorm.DB, outletId uint, shiftId string, lock bool) (models.Shift, error) {
+	var shift models.Shift
+	query := tx.Where("outlet_id = ?", outletId)
+	if lock {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	err := query.First(&shift, shiftId).Error
+	if err != nil {
+		return shift, err
+	}
+
+	err = tx.Where("shift_id = ?", shift.ID).Order("id").Find(&shift.CashEvents).Error
+	if err != nil {
+		return shift, err
+	}
+	err = tx.Where("shift_id = ?", shift.ID).Order("id").Find(&shift.Counts).Error
+	return shift, err
+}
+
+// report computes the amount expected for every counter tender. Cash starts with the opening
+// float, takes the cash of every sale less the change returned, and moves with the cash
+// events of the shift. Refunds of returns are paid out of the tender they went back to.
+// Other tenders are totalled apart as nothing is counted for them.
+func report(tx *gorm.DB, shift models.Shift) (shiftReport, error) {
+	result := shiftReport{Shift: shift}
+
+	var sales struct {
+		Count  int64
+		Total  models.Money
+		Change models.Money
+	}
+	err := tx.Model(&models.Sale{}).
+		Select("COUNT(*) AS count, COALESCE(SUM(total), 0) AS total, COALESCE(SUM(change), 0) AS change").
+		Where("shift_id = ?", shift.ID).
+		Scan(&sales).Error
+	if err != nil {
+		return result, err
+	}
+	result.Sales = sales.Count
+	result.Total = sales.Total
+
+	var tenders []struct {
+		Method string
+		Amount models.Money
+	}
+	err = tx.Model(&models.SalePayment{}).
+		Select("sale_payments.method, COALESCE(SUM(sale_payments.amount), 0) AS amount").
+		Joins("JOIN sales ON sales.id = sale_payments.sale_id").
+		Where("sales.shift_id = ?", shift.ID).
+		Group("sale_payments.method").
+		Scan(&tenders).Error
+	if err != nil {
+		return result, err
+	}
+
+	var refunds []struct {
+		Method string
+		Amount models.Money
+	}
+	err = tx.Model(&models.ReturnRefund{}).
+		Select("method, COALESCE(SUM(amount), 0) AS amount").
+		Where("shift_id = ?", shift.ID).
+		Group("method").
+		Scan(&refunds).Error
+	if err != nil {
+		return result, err
+	}
+
+	for _, event := range shift.CashEvents {
+		if event.Type == models.CashIn {
+			result.CashIn += event.Amount
+		} else {
+			result.CashOut += event.Amount
+		}
+	}
+
+	expected := map[string]models.Money{models.TenderCash: shift.OpeningFloat + result.CashIn - result.CashOut - sales.Change}
+	settled := make(map[string]models.Money)
+	for _, tender := range tenders {
+		if validTender(tender.Method) {
+			expected[tender.Method] += tender.Amount
+		} else {
+			settled[tender.Method] += tender.Amount
+		}
+	}
+	for _, refund := range refunds {
+		if validTender(refund.Method) {
+			expected[refund.Method] -= refund.Amount
+		} else {
+			settled[refund.Method] -= refund.Amount
+		}
+		result.Refunds += refund.Amount
+	}
+
+	counted := make(map[string]models.Money)
+	for _, count := range shift.Counts {
+		if !validTender(count.Method) {
+			continue
+		}
+		counted[count.Method] = count.Counted
+		if _, ok := expected[count.Method]; !ok {
+			expected[count.Method] = 0
+		}
+	}
+
+	for _, method := range tenderOrder(expected) {
+		tender := tenderReport{Method: method, Expected: expected[method]}
+		if count, ok := counted[method]; ok {
+			tender.Counted = count
+			tender.Variance = count - tender.Expected
+		}
+		result.Tenders = append(result.Tenders, tender)
+	}
+	for _, method := range tenderOrder(settled) {
+		result.Settled = append(result.Settled, tenderTotal{Method: method, Amount: settled[method]})
+	}
+	return result, nil
+}
+
+// tenderOrder lists the known tenders first, in their usual order, then any other method
+func tenderOrder(amounts map[string]models.Money) []string {
+	var methods []string
+	known := make(map[string]bool)
+	for _, method := range models.TenderMethods {
+		known[method] = true
+		if _, ok := amounts[method]; ok {
+			methods = append(methods, method)
+		}
+	}
+	var others []string
+	for method := range amounts {
+		if !known[method] {
+			others = append(others, method)
+		}
+	}
+	sort.Strings(others)
+	return append(methods, others...)
+}
@@ -0,0 +1,288 @@
+package pos_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Open a shift
+// @Description  Opens a drawer shift for the logged in employee with the cash float placed in the drawer. An employee can only have one open shift per outlet.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        shift  body  dtos.ShiftOpen  true  "Opening Float"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/shifts [post]
+func OpenShift(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var shiftDTO dtos.ShiftOpen
+	err := c.ShouldBindBodyWithJSON(&shiftDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if shiftDTO.OpeningFloat < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Opening float should not be negative"})
+		return
+	}
+
+	shift := models.Shift{
+		OutletId:     outlet.ID,
+		EmployeeId:   auth.CurrentEmployeeID(c),
+		Status:       models.ShiftOpen,
+		OpeningFloat: shiftDTO.OpeningFloat,
+		OpenedAt:     time.Now(),
+	}
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		_, err := openShift(tx, shift.OutletId, shift.EmployeeId)
+		if err == nil {
+			return ErrShiftOpen
+		} else if !errors.Is(err, ErrNoOpenShift) {
+			return err
+		}
+		return tx.Create(&shift).Error
+	})
+	if !respondWithError(c, err, "Unable to open the shift") {
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Shift opened successfully", "result": gin.H{"shift": shift}})
+}
+
+// @Summary      Get the current shift
+// @Description  Returns the open shift of the logged in employee with its X report
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         POS
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/shifts/current [get]
+func GetCurrentShift(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	shift, err := openShift(db.Tenant(c), outlet.ID, auth.CurrentEmployeeID(c))
+	if !respondWithError(c, err, "Unable to get the current shift") {
+		return
+	}
+	respondWithShift(c, outlet, shift.ID, http.StatusOK, "Shift fetched successfully")
+}
+
+// @Summary      Add a cash event to a shift
+// @Description  Records cash put into (cash_in) or taken out of (cash_out) the drawer of an open shift outside of a sale
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param shift_id path string true "Shift ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        event  body  dtos.ShiftCashEvent  true  "Cash Event"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      403  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/shifts/{shift_id}/cash-events [post]
+func AddCashEvent(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var eventDTO dtos.ShiftCashEvent
+	err := c.ShouldBindBodyWithJSON(&eventDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if eventDTO.Type != models.CashIn && eventDTO.Type != models.CashOut {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": ErrInvalidCashType.Error()})
+		return
+	}
+	if eventDTO.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Amount should be greater than zero"})
+		return
+	}
+
+	var shift models.Shift
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		shift, err = loadShift(tx, outlet.ID, c.Param("shift_id"), true)
+		if err != nil {
+			return err
+		}
+		if shift.Status != models.ShiftOpen {
+			return ErrShiftNotOpen
+		}
+		if err := checkShiftOwner(c, shift); err != nil {
+			return err
+		}
+
+		event := models.ShiftCashEvent{ShiftId: shift.ID, EmployeeId: auth.CurrentEmployeeID(c), Type: eventDTO.Type, Amount: eventDTO.Amount, Reason: eventDTO.Reason}
+		return tx.Create(&event).Error
+	})
+	if !respondWithError(c, err, "Unable to add the cash event") {
+		return
+	}
+
+	respondWithShift(c, outlet, shift.ID, http.StatusAccepted, "Cash event added successfully")
+}
+
+// @Summary      Get the report of a shift
+// @Description  Returns the X report of an open shift or the Z report of a closed one, with the amount expected for every counter tender. Gift cards, store credit, loyalty points and exchanges are totalled under settled and not counted.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param shift_id path string true "Shift ID"
+// @Tags         POS
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/shifts/{shift_id}/report [get]
+func GetShiftReport(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	shift, err := loadShift(db.Tenant(c), outlet.ID, c.Param("shift_id"), false)
+	if !respondWithError(c, err, "Unable to get the shift") {
+		return
+	}
+	respondWithShift(c, outlet, shift.ID, http.StatusOK, "Shift report fetched successfully")
+}
+
+// @Summary      Close a shift
+// @Description  Closes an open shift with the amount counted in the drawer for every tender and returns the Z report with the variance against the expected amounts
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param shift_id path string true "Shift ID"
+// @Tags         POS
+// @Accept       json
+// @Produce      json
+// @Param        counts  body  dtos.ShiftClose  true  "Counted Amounts"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      403  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/pos/shifts/{shift_id}/close [post]
+func CloseShift(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var closeDTO dtos.ShiftClose
+	err := c.ShouldBindBodyWithJSON(&closeDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	counted := make(map[string]models.Money)
+	for _, count := range closeDTO.Counts {
+		if !validTender(count.Method) {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid payment method", "result": gin.H{"methods": models.TenderMethods}})
+			return
+		}
+		if count.Counted < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Counted amount should not be negative"})
+			return
+		}
+		counted[count.Method] += count.Counted
+	}
+
+	var shift models.Shift
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		shift, err = loadShift(tx, outlet.ID, c.Param("shift_id"), true)
+		if err != nil {
+			return err
+		}
+		if shift.Status != models.ShiftOpen {
+			return ErrShiftNotOpen
+		}
+		if err := checkShiftOwner(c, shift); err != nil {
+			return err
+		}
+
+		// A tender that was expected but not counted is counted as nothing
+		xReport, err := report(tx, shift)
+		if err != nil {
+			return err
+		}
+		expected := make(map[string]models.Money)
+		for _, tender := range xReport.Tenders {
+			expected[tender.Method] = tender.Expected
+			if _, ok := counted[tender.Method]; !ok {
+				counted[tender.Method] = 0
+			}
+		}
+
+		for _, method := range tenderOrder(counted) {
+			count := models.ShiftCount{ShiftId: shift.ID, Method: method, Expected: expected[method], Counted: counted[method], Variance: counted[method] - expected[method]}
+			if err := tx.Create(&count).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		return tx.Model(&shift).Updates(map[string]interface{}{"status": models.ShiftClosed, "closed_at": &now}).Error
+	})
+	if !respondWithError(c, err, "Unable to close the shift") {
+		return
+	}
+
+	respondWithShift(c, outlet, shift.ID, http.StatusAccepted, "Shift closed successfully")
+}
+
+// Private methods
+
+// checkShiftOwner lets only the employee who opened a shift, or a manager of the outlet,
+// change it
+var checkShiftOwner = func(c *gin.Context, shift models.Shift) error {
+	if shift.EmployeeId != auth.CurrentEmployeeID(c) && c.GetString("outlet_role") != models.RoleManager {
+		return ErrShiftNotOwned
+	}
+	return nil
+}
+
+var respondWithShift = func(c *gin.Context, outlet models.Outlet, shiftId uint, status int, message string) {
+	shift, err := loadShift(db.Tenant(c), outlet.ID, fmt.Sprint(shiftId), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the shift", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	shiftReport, err := report(db.Tenant(c), shift)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to compute the shift report", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": shiftReport})
+}
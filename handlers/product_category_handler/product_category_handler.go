@@ -33,19 +33,19 @@ func Create(c *gin.Context) {
 		return
 	}
 
-	tx := db.DB.First(&outlet, outlet_id)
+	tx := db.Tenant(c).First(&outlet, outlet_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to find the outlet details", "result": gin.H{"error": tx.Error.Error()}})
 		return
 	}
 
 	productCategory.OutletId = outlet.ID
-	if productCategory.Title == "" && productCategory.Description == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Title and description should not be empty"})
+	if err := productCategory.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
 		return
 	}
 
-	tx = db.DB.Create(&productCategory)
+	tx = db.Tenant(c).Create(&productCategory)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to craete category", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -71,7 +71,7 @@ func GetProductCategoryDetail(c *gin.Context) {
 	category_id := c.Param("category_id")
 
 	// Step 2 -> Search the category using the id on db
-	tx := db.DB.First(&productCategory, category_id)
+	tx := db.Tenant(c).First(&productCategory, category_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the category details", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -94,7 +94,7 @@ func GetProductCategoryDetail(c *gin.Context) {
 func GetProductCategories(c *gin.Context) {
 	var productCategories []models.ProductCategory
 	// Step 1 -> Search the category using the id on db
-	tx := db.DB.Find(&productCategories)
+	tx := db.Tenant(c).Find(&productCategories)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the categories", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -125,15 +125,15 @@ func Update(c *gin.Context) {
 		return
 	}
 
-	tx := db.DB.First(&outlet, outlet_id)
+	tx := db.Tenant(c).First(&outlet, outlet_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to find the outlet details", "result": gin.H{"error": tx.Error.Error()}})
 		return
 	}
 
 	productCategory.OutletId = outlet.ID
-	if productCategory.Title == "" && productCategory.Description == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Title and description should not be empty"})
+	if err := productCategory.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
 		return
 	}
 
@@ -146,7 +146,7 @@ func Update(c *gin.Context) {
 	}
 	productCategory.ID = uint(catId)
 
-	tx = db.DB.Save(&productCategory)
+	tx = db.Tenant(c).Save(&productCategory)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to craete category", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -1,12 +1,15 @@
 package product_varient_handler
 
 import (
+	"easystore/auth"
 	"easystore/db"
 	"easystore/models"
+	"easystore/pricing"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 var productVarient models.ProductVarient
@@ -39,17 +42,27 @@ func Create(c *gin.Context) {
 	}
 
 	product := &productVarient.Product
-	tx := db.DB.First(product, productId)
+	tx := db.Tenant(c).First(product, productId)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the product details", "result": gin.H{"error": tx.Error.Error()}})
 		return
 	}
 
 	productVarient.ProductId = product.ID
+	productVarient.OutletId = product.OutletId
+	if err := productVarient.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
 
-	tx = db.DB.Create(&productVarient)
-	if tx.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create product varient", "result": gin.H{"error": tx.Error.Error()}})
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&productVarient).Error; err != nil {
+			return err
+		}
+		return pricing.Record(tx, productVarient, nil, auth.CurrentEmployeeID(c))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create product varient", "result": gin.H{"error": err.Error()}})
 		return
 	}
 
@@ -73,7 +86,7 @@ func Create(c *gin.Context) {
 func Update(c *gin.Context) {
 	varient_id := c.Param("varient_id")
 	product_id := c.Param("product_id")
-	tx := db.DB.Where("product_id = ?", product_id).First(&productVarient, varient_id)
+	tx := db.Tenant(c).Where("product_id = ?", product_id).First(&productVarient, varient_id)
 
 	if tx.Error != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid product varient id"})
@@ -88,10 +101,28 @@ func Update(c *gin.Context) {
 	}
 
 	updatedProductVarient.ID = productVarient.ID
-	tx = db.DB.Where("product_id = ?", product_id).Updates(&updatedProductVarient)
+	// A varient stays with its product and the outlet of the product
+	updatedProductVarient.ProductId = productVarient.ProductId
+	updatedProductVarient.OutletId = productVarient.OutletId
+	previousVarient := productVarient
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", product_id).Updates(&updatedProductVarient).Error; err != nil {
+			return err
+		}
+
+		// Keep the old price in the history instead of losing it
+		var currentVarient models.ProductVarient
+		if err := tx.First(&currentVarient, previousVarient.ID).Error; err != nil {
+			return err
+		}
+		if err := currentVarient.Validate(); err != nil {
+			return err
+		}
+		return pricing.Record(tx, currentVarient, &previousVarient, auth.CurrentEmployeeID(c))
+	})
 
-	if tx.Error != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable update product varient", "result": gin.H{"error": tx.Error.Error()}})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable update product varient", "result": gin.H{"error": err.Error()}})
 		return
 	}
 
@@ -115,7 +146,7 @@ func GetProductVarients(c *gin.Context) {
 	productIdStr := c.Param("product_id")
 	var varients []models.ProductVarient
 
-	tx := db.DB.Where("product_id = ?", productIdStr).Find(&varients)
+	tx := db.Tenant(c).Where("product_id = ?", productIdStr).Find(&varients)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the product varients"})
 		return
@@ -143,7 +174,7 @@ func GetProductVarient(c *gin.Context) {
 	productIdStr := c.Param("product_id")
 	vaientIdStr := c.Param("varient_id")
 
-	tx := db.DB.Where("product_id = ?", productIdStr).First(&productVarient, vaientIdStr)
+	tx := db.Tenant(c).Where("product_id = ?", productIdStr).First(&productVarient, vaientIdStr)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the product varient"})
 		return
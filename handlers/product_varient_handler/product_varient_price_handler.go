@@ -0,0 +1,181 @@
+package product_varient_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/pricing"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Get the price history of a product varient
+// @Description  Returns every recorded and scheduled price of a product varient with the employee who made the change
+// @Param Authorization header string true "Bearer Token"
+// @Param product_id path string true "Product ID"
+// @Param varient_id path string true "Product Varient ID"
+// @Tags         Product Varient
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /product/{product_id}/product-varient/{varient_id}/prices [get]
+func GetPriceHistory(c *gin.Context) {
+	varient, ok := findVarient(c)
+	if !ok {
+		return
+	}
+
+	var prices []models.ProductVarientPrice
+	tx := db.Tenant(c).Where("varient_id = ?", varient.ID).Preload("ChangedBy", func(db *gorm.DB) *gorm.DB {
+		return db.Omit("password")
+	}).Order("effective_from DESC, id DESC").Find(&prices)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the price history", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Price history fetched successfully", "result": gin.H{"prices": prices}})
+}
+
+// @Summary      Schedule a price change for a product varient
+// @Description  Stores a future dated price which becomes the price of the varient at effective_from
+// @Param Authorization header string true "Bearer Token"
+// @Param product_id path string true "Product ID"
+// @Param varient_id path string true "Product Varient ID"
+// @Tags         Product Varient
+// @Accept       json
+// @Produce      json
+// @Param        price  body  dtos.ProductVarientPriceSchedule  true  "Scheduled Price"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /product/{product_id}/product-varient/{varient_id}/prices [post]
+func SchedulePrice(c *gin.Context) {
+	varient, ok := findVarient(c)
+	if !ok {
+		return
+	}
+
+	var schedule dtos.ProductVarientPriceSchedule
+	err := c.ShouldBindBodyWithJSON(&schedule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	if !schedule.EffectiveFrom.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Effective from should be in the future"})
+		return
+	}
+	if err := models.ValidatePrice(schedule.SellingPrice, schedule.Mrp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	price, err := pricing.Schedule(db.Tenant(c), varient, schedule.SellingPrice, schedule.Mrp, schedule.EffectiveFrom, auth.CurrentEmployeeID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to schedule the price", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Price scheduled successfully", "result": gin.H{"price": price}})
+}
+
+// @Summary      Cancel a scheduled price change
+// @Description  Cancels a scheduled price of a product varient which has not been applied yet
+// @Param Authorization header string true "Bearer Token"
+// @Param product_id path string true "Product ID"
+// @Param varient_id path string true "Product Varient ID"
+// @Param price_id path string true "Scheduled Price ID"
+// @Tags         Product Varient
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /product/{product_id}/product-varient/{varient_id}/prices/{price_id} [delete]
+func CancelScheduledPrice(c *gin.Context) {
+	varient, ok := findVarient(c)
+	if !ok {
+		return
+	}
+
+	priceId, err := strconv.Atoi(c.Param("price_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid price id", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	price, err := pricing.Cancel(db.Tenant(c), varient.ID, uint(priceId))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "No pending scheduled price with the given id"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to cancel the scheduled price", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Scheduled price cancelled successfully", "result": gin.H{"price": price}})
+}
+
+// @Summary      Get the effective price of a product varient
+// @Description  Returns the price of a product varient that was in effect at the given time, or now when no time is given
+// @Param Authorization header string true "Bearer Token"
+// @Param product_id path string true "Product ID"
+// @Param varient_id path string true "Product Varient ID"
+// @Param at query string false "RFC 3339 timestamp" example(2025-04-01T10:30:00+05:30)
+// @Tags         Product Varient
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /product/{product_id}/product-varient/{varient_id}/price [get]
+func GetEffectivePrice(c *gin.Context) {
+	varient, ok := findVarient(c)
+	if !ok {
+		return
+	}
+
+	at := time.Now()
+	if atStr := c.Query("at"); atStr != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid timestamp, expected RFC 3339", "result": gin.H{"error": err.Error()}})
+			return
+		}
+	}
+
+	price, err := pricing.EffectivePrice(db.Tenant(c), varient, at)
+	if errors.Is(err, pricing.ErrNoPrice) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "No price was effective at the given time"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the effective price", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Effective price fetched successfully", "result": gin.H{"at": at, "price": price}})
+}
+
+// Private methods
+
+var findVarient = func(c *gin.Context) (models.ProductVarient, bool) {
+	var varient models.ProductVarient
+	tx := db.Tenant(c).Where("product_id = ?", c.Param("product_id")).First(&varient, c.Param("varient_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid product varient id"})
+		return varient, false
+	}
+	return varient, true
+}
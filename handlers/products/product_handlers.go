@@ -1,9 +1,13 @@
 package product_handler
 
 import (
+	"easystore/auth"
 	"easystore/db"
 	"easystore/dtos"
 	"easystore/models"
+	"easystore/pricing"
+	"easystore/tax"
+	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -31,7 +35,7 @@ func GetProductDetails(c *gin.Context) {
 		return
 	}
 	product_id := c.Param("product_id")
-	tx := db.DB.Where("outlet_id = ?", outlet.ID).First(&product, product_id)
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).First(&product, product_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get product details", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -66,8 +70,12 @@ func Create(c *gin.Context) {
 		return
 	}
 
+	if !validTaxFields(productDTO, c) {
+		return
+	}
+
 	var category models.ProductCategory
-	tx := db.DB.First(&category, productDTO.CategoryId)
+	tx := db.Tenant(c).First(&category, productDTO.CategoryId)
 	if tx.Error != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get product category", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -78,32 +86,46 @@ func Create(c *gin.Context) {
 	product.Description = productDTO.Description
 	product.CategoryId = category.ID
 	product.Status = productDTO.Status
+	product.HsnCode = productDTO.HsnCode
+	product.GstRate = productDTO.GstRate
+	product.CessRate = productDTO.CessRate
 
 	var productVarients []models.ProductVarient
-	err = db.DB.Transaction(func(tx *gorm.DB) error {
-		tx = db.DB.Create(&product)
-		if tx.Error != nil {
-			return tx.Error
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&product).Error; err != nil {
+			return err
 		}
 
 		for _, varientDTO := range productDTO.Varients {
 			var varient models.ProductVarient
 			varient.Name = varientDTO.Name
+			varient.Sku = varientDTO.Sku
+			varient.Barcode = varientDTO.Barcode
 			varient.ProductId = product.ID
 			varient.Mrp = varientDTO.Mrp
 			varient.SellingPrice = varientDTO.SellingPrice
+			if err := varient.Validate(); err != nil {
+				return fmt.Errorf("%s: %w", varient.Name, err)
+			}
 
 			productVarients = append(productVarients, varient)
 		}
 
-		tx = db.DB.Create(&productVarients)
+		if len(productVarients) == 0 {
+			return nil
+		}
 
-		if tx.Error != nil {
-			return tx.Error
+		if err := tx.Create(&productVarients).Error; err != nil {
+			return err
 		}
 
-		return nil
+		for _, varient := range productVarients {
+			if err := pricing.Record(tx, varient, nil, auth.CurrentEmployeeID(c)); err != nil {
+				return err
+			}
+		}
 
+		return nil
 	})
 
 	if err != nil {
@@ -135,7 +157,7 @@ func Update(c *gin.Context) {
 	}
 
 	product_id := c.Param("product_id")
-	tx := db.DB.Where("outlet_id = ?", outlet.ID).First(&product, product_id)
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).First(&product, product_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get product details", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -148,8 +170,12 @@ func Update(c *gin.Context) {
 		return
 	}
 
+	if !validTaxFields(productDTO, c) {
+		return
+	}
+
 	var category models.ProductCategory
-	tx = db.DB.Where("outlet_id = ?", outlet.ID).First(&category, productDTO.CategoryId)
+	tx = db.Tenant(c).Where("outlet_id = ?", outlet.ID).First(&category, productDTO.CategoryId)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get category details", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -159,8 +185,11 @@ func Update(c *gin.Context) {
 	product.Description = productDTO.Description
 	product.CategoryId = category.ID
 	product.Status = productDTO.Status
+	product.HsnCode = productDTO.HsnCode
+	product.GstRate = productDTO.GstRate
+	product.CessRate = productDTO.CessRate
 
-	tx = db.DB.Where("outlet_id = ?", outlet.ID).Save(&product)
+	tx = db.Tenant(c).Where("outlet_id = ?", outlet.ID).Save(&product)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update product", "result": gin.H{"error": tx.Error.Error()}})
 		return
@@ -172,7 +201,7 @@ func Update(c *gin.Context) {
 var setOutletFromContext = func(c *gin.Context) bool {
 	outlet_id := c.Param("outlet_id")
 
-	tx := db.DB.First(&outlet, outlet_id)
+	tx := db.Tenant(c).First(&outlet, outlet_id)
 	if tx.Error != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
 		return false
@@ -180,3 +209,17 @@ var setOutletFromContext = func(c *gin.Context) bool {
 
 	return true
 }
+
+var validTaxFields = func(productDTO dtos.Product, c *gin.Context) bool {
+	if err := tax.ValidateHsn(productDTO.HsnCode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return false
+	}
+
+	if err := tax.ValidateSlab(productDTO.GstRate, productDTO.CessRate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return false
+	}
+
+	return true
+}
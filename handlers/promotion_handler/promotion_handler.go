@@ -0,0 +1,298 @@
+package promotion_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Create a promotion
+// @Description  Creates a percent, flat, buy X get Y or bundle promotion of an outlet. Promotions cover the varients, products and categories given as targets, or everything sold at the outlet without targets. They can be limited to a date range, weekdays, happy hours, a channel and a number of uses, overall and per customer. Promotions with a coupon code only apply when the code is given.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Promotion
+// @Accept       json
+// @Produce      json
+// @Param        promotion  body  dtos.Promotion  true  "Promotion"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/promotions [post]
+func Create(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+
+	var promotionDTO dtos.Promotion
+	err := c.ShouldBindBodyWithJSON(&promotionDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	promotion := models.Promotion{OutletId: outletId}
+	if !setPromotionFields(c, &promotion, promotionDTO) {
+		return
+	}
+
+	tx := db.Tenant(c).Omit("Outlet").Create(&promotion)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create the promotion", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Promotion created successfully", "result": gin.H{"promotion": promotion}})
+}
+
+// @Summary      Get promotions
+// @Description  Lists the promotions of an outlet from the highest priority down, optionally filtered by status, channel or coupon code
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param status query string false "Status, active or inactive"
+// @Param channel query string false "Channel, all, pos or online"
+// @Param coupon_code query string false "Coupon code"
+// @Tags         Promotion
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/promotions [get]
+func GetPromotions(c *gin.Context) {
+	query := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id"))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if channel := c.Query("channel"); channel != "" {
+		query = query.Where("channel = ?", channel)
+	}
+	if code := c.Query("coupon_code"); code != "" {
+		query = query.Where("coupon_code = ?", strings.ToUpper(code))
+	}
+
+	var promotions []models.Promotion
+	tx := query.Preload("Targets").Order("priority desc, id").Find(&promotions)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the promotions", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Promotions fetched successfully", "result": gin.H{"promotions": promotions}})
+}
+
+// @Summary      Get a promotion
+// @Description  Fetches a promotion of an outlet with its targets and the number of times it has been used
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param promotion_id path string true "Promotion ID"
+// @Tags         Promotion
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/promotions/{promotion_id} [get]
+func GetPromotion(c *gin.Context) {
+	var promotion models.Promotion
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Preload("Targets").First(&promotion, c.Param("promotion_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Promotion not found"})
+		return
+	}
+
+	var uses int64
+	tx = db.Tenant(c).Model(&models.PromotionRedemption{}).Where("promotion_id = ?", promotion.ID).Count(&uses)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the promotion", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Promotion fetched successfully", "result": gin.H{"promotion": promotion, "uses": uses}})
+}
+
+// @Summary      Update a promotion
+// @Description  Replaces a promotion of an outlet and its targets. Uses already counted stay against the new limits.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param promotion_id path string true "Promotion ID"
+// @Tags         Promotion
+// @Accept       json
+// @Produce      json
+// @Param        promotion  body  dtos.Promotion  true  "Promotion"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/promotions/{promotion_id} [put]
+func Update(c *gin.Context) {
+	var promotionDTO dtos.Promotion
+	err := c.ShouldBindBodyWithJSON(&promotionDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var promotion models.Promotion
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).First(&promotion, c.Param("promotion_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Promotion not found"})
+		return
+	}
+	if !setPromotionFields(c, &promotion, promotionDTO) {
+		return
+	}
+
+	err = db.Tenant(c).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&promotion).Omit("Outlet", "Targets").Select("*").Updates(&promotion).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("promotion_id = ?", promotion.ID).Delete(&models.PromotionTarget{}).Error
+		if err != nil {
+			return err
+		}
+		for i := range promotion.Targets {
+			promotion.Targets[i].PromotionId = promotion.ID
+		}
+		if len(promotion.Targets) == 0 {
+			return nil
+		}
+		return tx.Create(&promotion.Targets).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the promotion", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Promotion updated successfully", "result": gin.H{"promotion": promotion}})
+}
+
+// @Summary      Delete a promotion
+// @Description  Removes a promotion of an outlet. Sales and orders it was used on keep their discount.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param promotion_id path string true "Promotion ID"
+// @Tags         Promotion
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/promotions/{promotion_id} [delete]
+func Delete(c *gin.Context) {
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Delete(&models.Promotion{}, c.Param("promotion_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the promotion", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	} else if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Promotion not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Promotion deleted successfully"})
+}
+
+// Private methods
+
+var setOutletId = func(c *gin.Context) (uint, bool) {
+	outletId, err := strconv.Atoi(c.Param("outlet_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid outlet id"})
+		return 0, false
+	}
+
+	var outlet models.Outlet
+	err = db.Tenant(c).First(&outlet, outletId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Outlet not found with the given ID"})
+		return 0, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": err.Error()}})
+		return 0, false
+	}
+	return outlet.ID, true
+}
+
+// setPromotionFields copies the request onto the promotion and validates it, responding
+// with the reason when it is not valid
+var setPromotionFields = func(c *gin.Context, promotion *models.Promotion, promotionDTO dtos.Promotion) bool {
+	promotion.Name = strings.TrimSpace(promotionDTO.Name)
+	promotion.Description = promotionDTO.Description
+	promotion.Type = promotionDTO.Type
+	promotion.PercentOff = promotionDTO.PercentOff
+	promotion.AmountOff = promotionDTO.AmountOff
+	promotion.BuyQuantity = promotionDTO.BuyQuantity
+	promotion.GetQuantity = promotionDTO.GetQuantity
+	promotion.BundleQuantity = promotionDTO.BundleQuantity
+	promotion.BundlePrice = promotionDTO.BundlePrice
+	promotion.MinSubtotal = promotionDTO.MinSubtotal
+	promotion.MaxDiscount = promotionDTO.MaxDiscount
+	promotion.StartsAt = promotionDTO.StartsAt
+	promotion.EndsAt = promotionDTO.EndsAt
+	promotion.Days = strings.ReplaceAll(promotionDTO.Days, " ", "")
+	promotion.StartTime = promotionDTO.StartTime
+	promotion.EndTime = promotionDTO.EndTime
+	promotion.Channel = promotionDTO.Channel
+	promotion.CouponCode = strings.ToUpper(strings.TrimSpace(promotionDTO.CouponCode))
+	promotion.UsageLimit = promotionDTO.UsageLimit
+	promotion.PerCustomerLimit = promotionDTO.PerCustomerLimit
+	promotion.Priority = promotionDTO.Priority
+	promotion.Stackable = promotionDTO.Stackable
+	promotion.Status = promotionDTO.Status
+	if promotion.Channel == "" {
+		promotion.Channel = models.ChannelAll
+	}
+	if promotion.Status == "" {
+		promotion.Status = models.PromotionActive
+	}
+	// Buy X get Y gives the units away unless a percentage is given
+	if promotion.Type == models.PromotionBuyXGetY && promotion.PercentOff == 0 {
+		promotion.PercentOff = 100
+	}
+
+	promotion.Targets = nil
+	for _, target := range promotionDTO.Targets {
+		promotion.Targets = append(promotion.Targets, models.PromotionTarget{VarientId: target.VarientId, ProductId: target.ProductId, CategoryId: target.CategoryId})
+	}
+
+	if err := promotion.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return false
+	}
+
+	if promotion.CouponCode != "" {
+		var used int64
+		err := db.Tenant(c).Model(&models.Promotion{}).Where("outlet_id = ? AND coupon_code = ? AND id <> ?", promotion.OutletId, promotion.CouponCode, promotion.ID).Count(&used).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the coupon code", "result": gin.H{"error": err.Error()}})
+			return false
+		} else if used > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Coupon code is already used by another promotion of the outlet"})
+			return false
+		}
+	}
+
+	for _, target := range promotion.Targets {
+		var found int64
+		var err error
+		switch {
+		case target.VarientId != nil:
+			err = db.Tenant(c).Model(&models.ProductVarient{}).Joins("Product").Where("\"Product\".outlet_id = ? AND product_varients.id = ?", promotion.OutletId, *target.VarientId).Count(&found).Error
+		case target.ProductId != nil:
+			err = db.Tenant(c).Model(&models.Product{}).Where("outlet_id = ? AND id = ?", promotion.OutletId, *target.ProductId).Count(&found).Error
+		default:
+			err = db.Tenant(c).Model(&models.ProductCategory{}).Where("outlet_id = ? AND id = ?", promotion.OutletId, *target.CategoryId).Count(&found).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the promotion targets", "result": gin.H{"error": err.Error()}})
+			return false
+		} else if found == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Promotion targets should be varients, products or categories of the outlet"})
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package return_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/returns"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Return goods
+// @Description  Records goods brought back from a sale or a delivered order of the outlet within the return window of their category. Each line is put back into stock or written off, and the refund is worked out from the prices and taxes the goods were sold at. Refunds go back to the original tenders, with counter tenders paid out of the open shift of the logged in employee, or to the store credit of the customer.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Return
+// @Accept       json
+// @Produce      json
+// @Param        return  body  dtos.Return  true  "Return Details"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/returns [post]
+func Create(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var returnDTO dtos.Return
+	err := c.ShouldBindBodyWithJSON(&returnDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if returnDTO.RefundMethod == models.RefundToExchange {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Exchanges are made at the counter"})
+		return
+	}
+
+	request := returns.Request{
+		Outlet:       outlet,
+		SaleId:       returnDTO.SaleId,
+		OrderId:      returnDTO.OrderId,
+		EmployeeId:   auth.CurrentEmployeeID(c),
+		RefundMethod: returnDTO.RefundMethod,
+		Reason:       returnDTO.Reason,
+	}
+	for _, line := range returnDTO.Lines {
+		request.Lines = append(request.Lines, returns.LineRequest{LineId: line.LineId, Quantity: line.Quantity, Disposition: line.Disposition, Reason: line.Reason})
+	}
+	ret, err := returns.Create(db.Tenant(c), request)
+	if !respondWithError(c, err, "Unable to record the return") {
+		return
+	}
+
+	respondWithReturn(c, outlet, ret.ID, http.StatusAccepted, "Return recorded successfully")
+}
+
+// @Summary      Get returns
+// @Description  Lists the returns of an outlet, newest first, optionally for a sale or an order
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param sale_id query string false "Sale ID"
+// @Param order_id query string false "Order ID"
+// @Tags         Return
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/returns [get]
+func GetReturns(c *gin.Context) {
+	var returnList []models.Return
+	query := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id"))
+	if saleId := c.Query("sale_id"); saleId != "" {
+		query = query.Where("sale_id = ?", saleId)
+	}
+	if orderId := c.Query("order_id"); orderId != "" {
+		query = query.Where("order_id = ?", orderId)
+	}
+	tx := query.Preload("Lines").Preload("Refunds").Order("created_at DESC").Find(&returnList)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the returns", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Returns fetched successfully", "result": gin.H{"returns": returnList}})
+}
+
+// @Summary      Get a return
+// @Description  Returns a return with its lines and refunds
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param return_id path string true "Return ID"
+// @Tags         Return
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/returns/{return_id} [get]
+func GetReturn(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var ret models.Return
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).First(&ret, c.Param("return_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Return not found"})
+		return
+	}
+	respondWithReturn(c, outlet, ret.ID, http.StatusOK, "Return fetched successfully")
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if returns.IsReturnError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
+
+var respondWithReturn = func(c *gin.Context, outlet models.Outlet, returnId uint, status int, message string) {
+	var ret models.Return
+	tx := db.Tenant(c).Where("outlet_id = ?", outlet.ID).
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Refunds", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		First(&ret, returnId)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the return", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": gin.H{"return": ret}})
+}
@@ -0,0 +1,198 @@
+package rider_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/riders"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// @Summary      Add a rider to an outlet
+// @Description  Gives an existing employee the rider role at the outlet. A rider starts offline until they mark themselves available.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Rider
+// @Accept       json
+// @Produce      json
+// @Param        rider  body  dtos.Rider  true  "Rider"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/riders [post]
+func AddRider(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+
+	var riderDTO dtos.Rider
+	err := c.ShouldBindBodyWithJSON(&riderDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	err = riders.Add(db.Tenant(c), outletId, riderDTO.EmployeeId)
+	if !respondWithError(c, err, "Unable to add the rider") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Rider added successfully"})
+}
+
+// @Summary      Get riders of an outlet
+// @Description  Lists the riders of an outlet with their status and the orders they have open, least loaded first
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/riders [get]
+func GetRiders(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+
+	loads, err := riders.List(db.Tenant(c), outletId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the riders", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Riders fetched successfully", "result": gin.H{"riders": loads}})
+}
+
+// @Summary      Remove a rider from an outlet
+// @Description  Takes the rider role at the outlet away from an employee. Riders with open assignments at the outlet can not be removed.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param rider_id path string true "Rider Employee ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/riders/{rider_id} [delete]
+func RemoveRider(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	riderId, ok := setId(c, "rider_id", "Invalid rider id")
+	if !ok {
+		return
+	}
+
+	err := riders.Remove(db.Tenant(c), outletId, riderId)
+	if !respondWithError(c, err, "Unable to remove the rider") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Rider removed successfully"})
+}
+
+// @Summary      Assign an order to a rider
+// @Description  Hands a confirmed or packed order to a rider of the outlet. With the manual strategy rider_id is used, with least_loaded the available rider with the fewest open orders is picked. An order not yet picked up is taken away from its previous rider.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Rider
+// @Accept       json
+// @Produce      json
+// @Param        assignment  body  dtos.RiderAssignment  true  "Assignment"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/rider [post]
+func Assign(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	orderId, ok := setId(c, "order_id", "Invalid order id")
+	if !ok {
+		return
+	}
+
+	var assignmentDTO dtos.RiderAssignment
+	err := c.ShouldBindBodyWithJSON(&assignmentDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	assignment, err := riders.Assign(db.Tenant(c), outletId, orderId, assignmentDTO.Strategy, assignmentDTO.RiderId, auth.CurrentEmployeeID(c))
+	if !respondWithError(c, err, "Unable to assign the order") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Order assigned successfully", "result": gin.H{"assignment": assignment}})
+}
+
+// @Summary      Unassign an order from its rider
+// @Description  Takes an order away from its rider before it is picked up
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/rider [delete]
+func Unassign(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	orderId, ok := setId(c, "order_id", "Invalid order id")
+	if !ok {
+		return
+	}
+
+	err := riders.Unassign(db.Tenant(c), outletId, orderId)
+	if !respondWithError(c, err, "Unable to unassign the order") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Order unassigned successfully"})
+}
+
+// Private methods
+
+var setOutletId = func(c *gin.Context) (uint, bool) {
+	return setId(c, "outlet_id", "Invalid outlet id")
+}
+
+var setId = func(c *gin.Context, param string, message string) (uint, bool) {
+	id, err := strconv.Atoi(c.Param(param))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWithError writes the failure response for err and reports whether the handler
+// can go on
+var respondWithError = func(c *gin.Context, err error, message string) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": "Not found"}})
+	} else if riders.IsRiderError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	} else {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": message, "result": gin.H{"error": err.Error()}})
+	}
+	return false
+}
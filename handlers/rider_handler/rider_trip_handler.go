@@ -0,0 +1,261 @@
+package rider_handler
+
+import (
+	"easystore/auth"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/riders"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProofPhotoSize is the largest photo a rider can upload as proof of delivery
+const maxProofPhotoSize = 5 << 20
+
+// @Summary      Get my assignments
+// @Description  Lists the orders of the outlet assigned to the logged in rider that are not delivered yet, along with the rider status
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/assignments [get]
+func GetAssignments(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	riderId := auth.CurrentEmployeeID(c)
+
+	status, err := riders.Status(db.Tenant(c), riderId)
+	if !respondWithError(c, err, "Unable to get the assignments") {
+		return
+	}
+	assignments, err := riders.Assignments(db.Tenant(c), outletId, riderId)
+	if !respondWithError(c, err, "Unable to get the assignments") {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Assignments fetched successfully", "result": gin.H{"rider_status": status, "assignments": assignments}})
+}
+
+// @Summary      Set my rider status
+// @Description  Marks the logged in rider as available for new orders or offline. A rider carrying a picked up order is shown as on trip until it is delivered.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Rider
+// @Accept       json
+// @Produce      json
+// @Param        status  body  dtos.RiderStatus  true  "Status"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/status [put]
+func SetStatus(c *gin.Context) {
+	var statusDTO dtos.RiderStatus
+	err := c.ShouldBindBodyWithJSON(&statusDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	riderId := auth.CurrentEmployeeID(c)
+	err = riders.SetStatus(db.Tenant(c), riderId, statusDTO.Status)
+	if !respondWithError(c, err, "Unable to set the status") {
+		return
+	}
+	status, err := riders.Status(db.Tenant(c), riderId)
+	if !respondWithError(c, err, "Unable to set the status") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Status set successfully", "result": gin.H{"rider_status": status}})
+}
+
+// @Summary      Accept an assignment
+// @Description  The logged in rider agrees to deliver an order assigned to them
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param assignment_id path string true "Assignment ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/assignments/{assignment_id}/accept [post]
+func Accept(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	assignmentId, ok := setId(c, "assignment_id", "Invalid assignment id")
+	if !ok {
+		return
+	}
+
+	assignment, err := riders.Accept(db.Tenant(c), outletId, auth.CurrentEmployeeID(c), assignmentId)
+	if !respondWithError(c, err, "Unable to accept the assignment") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Assignment accepted successfully", "result": gin.H{"assignment": assignment}})
+}
+
+// @Summary      Pick up an order
+// @Description  The logged in rider collects a packed order from the outlet, which sends it out for delivery and issues the customer a delivery OTP
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param assignment_id path string true "Assignment ID"
+// @Tags         Rider
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/assignments/{assignment_id}/pickup [post]
+func Pickup(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	assignmentId, ok := setId(c, "assignment_id", "Invalid assignment id")
+	if !ok {
+		return
+	}
+
+	assignment, err := riders.Pickup(db.Tenant(c), outletId, auth.CurrentEmployeeID(c), assignmentId)
+	if !respondWithError(c, err, "Unable to pick up the order") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Order picked up successfully", "result": gin.H{"assignment": assignment}})
+}
+
+// @Summary      Deliver an order
+// @Description  The logged in rider hands over an order. The OTP given by the customer is sent as JSON, or a photo of the handover as a multipart upload. An order is refused after too many wrong OTPs and can then only be delivered with a photo.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param assignment_id path string true "Assignment ID"
+// @Param        proof  body  dtos.DeliveryProof  false  "OTP"
+// @Param photo formData file false "Photo of the handover (JPEG or PNG)"
+// @Tags         Rider
+// @Accept       json
+// @Accept       multipart/form-data
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/assignments/{assignment_id}/deliver [post]
+func Deliver(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	assignmentId, ok := setId(c, "assignment_id", "Invalid assignment id")
+	if !ok {
+		return
+	}
+
+	var proof riders.Proof
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		photo, ok := saveProofPhoto(c, assignmentId)
+		if !ok {
+			return
+		}
+		proof.Photo = photo
+	} else {
+		var proofDTO dtos.DeliveryProof
+		err := c.ShouldBindBodyWithJSON(&proofDTO)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+			return
+		}
+		proof.Otp = strings.TrimSpace(proofDTO.Otp)
+	}
+
+	assignment, err := riders.Deliver(db.Tenant(c), outletId, auth.CurrentEmployeeID(c), assignmentId, proof)
+	if err != nil && proof.Photo != "" {
+		os.Remove(proof.Photo)
+	}
+	if !respondWithError(c, err, "Unable to deliver the order") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Order delivered successfully", "result": gin.H{"assignment": assignment}})
+}
+
+// @Summary      Send my location
+// @Description  The logged in rider reports where they are while carrying an order, which is streamed to everyone tracking the order
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param assignment_id path string true "Assignment ID"
+// @Tags         Rider
+// @Accept       json
+// @Produce      json
+// @Param        location  body  dtos.RiderLocation  true  "Location"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/rider/assignments/{assignment_id}/location [post]
+func Ping(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+	assignmentId, ok := setId(c, "assignment_id", "Invalid assignment id")
+	if !ok {
+		return
+	}
+
+	var locationDTO dtos.RiderLocation
+	err := c.ShouldBindBodyWithJSON(&locationDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	event, err := riders.Ping(db.Tenant(c), outletId, auth.CurrentEmployeeID(c), assignmentId, locationDTO.Latitude, locationDTO.Longitude)
+	if !respondWithError(c, err, "Unable to send the location") {
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Location sent successfully", "result": gin.H{"event": event}})
+}
+
+// Private methods
+
+// saveProofPhoto stores the uploaded photo under UPLOAD_DIR and returns its path
+var saveProofPhoto = func(c *gin.Context, assignmentId uint) (string, bool) {
+	fileHeader, err := c.FormFile("photo")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Photo is required", "result": gin.H{"error": err.Error()}})
+		return "", false
+	}
+	if fileHeader.Size > maxProofPhotoSize {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Photo should not be larger than 5 MB"})
+		return "", false
+	}
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Photo should be a JPEG or PNG file"})
+		return "", false
+	}
+
+	dir := os.Getenv("UPLOAD_DIR")
+	if dir == "" {
+		dir = "uploads"
+	}
+	path := filepath.Join(dir, "deliveries", fmt.Sprintf("%d-%d%s", assignmentId, time.Now().UnixNano(), ext))
+	err = c.SaveUploadedFile(fileHeader, path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to save the photo", "result": gin.H{"error": err.Error()}})
+		return "", false
+	}
+	return path, true
+}
@@ -0,0 +1,157 @@
+package serviceability_handler
+
+import (
+	"easystore/customers"
+	"easystore/db"
+	"easystore/hours"
+	"easystore/models"
+	"easystore/serviceability"
+	"easystore/slots"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Check serviceability of a pincode
+// @Description  Returns the active outlets of the store delivering to a pincode, in the order orders are routed to them. No login is required.
+// @Param  public_key path string true "Public key of the store"
+// @Param  pincode path string true "Pincode"
+// @Tags         Serviceability
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /stores/{public_key}/serviceability/{pincode} [get]
+func GetServiceability(c *gin.Context) {
+	pincode := c.Param("pincode")
+	if err := customers.ValidatePincode(pincode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	outlets, err := serviceability.Outlets(db.Tenant(c), pincode, db.OrganizationOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the pincode", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Serviceability fetched successfully", "result": gin.H{"pincode": pincode, "serviceable": len(outlets) > 0, "outlets": outlets}})
+}
+
+// @Summary      Get delivery slots for a pincode
+// @Description  Returns the delivery slots of every outlet of the store delivering to a pincode on a date, with the capacity left in each. The date defaults to today. No login is required.
+// @Param  public_key path string true "Public key of the store"
+// @Param  pincode path string true "Pincode"
+// @Param  date query string false "Date (YYYY-MM-DD)"
+// @Tags         Serviceability
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /stores/{public_key}/serviceability/{pincode}/slots [get]
+func GetSlots(c *gin.Context) {
+	pincode := c.Param("pincode")
+	if err := customers.ValidatePincode(pincode); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	date := now.In(hours.Default).Format(slots.DateLayout)
+	if c.Query("date") != "" {
+		date = c.Query("date")
+		if _, err := time.Parse(slots.DateLayout, date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Date should be in YYYY-MM-DD format"})
+			return
+		}
+	}
+
+	outlets, err := serviceability.Outlets(db.Tenant(c), pincode, db.OrganizationOf(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to check the pincode", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	result := []gin.H{}
+	for _, serving := range outlets {
+		var outlet models.Outlet
+		err := db.Tenant(c).First(&outlet, serving.OutletId).Error
+		var available []slots.Slot
+		if err == nil {
+			day, _ := slots.ParseDate(outlet, date)
+			available, err = slots.Availability(db.Tenant(c), outlet, day, now)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the slots", "result": gin.H{"error": err.Error()}})
+			return
+		}
+		result = append(result, gin.H{"outlet": serving, "slots": available})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Slots fetched successfully", "result": gin.H{"pincode": pincode, "date": date, "outlets": result}})
+}
+
+// @Summary      Find the nearest outlets
+// @Description  Returns the active outlets of the store nearest to a point, closest first, with their distance in kilometres and whether they are open. Outlets can be limited to those within a radius, delivering to a pincode or open now. No login is required.
+// @Param  public_key path string true "Public key of the store"
+// @Param  latitude query number true "Latitude"
+// @Param  longitude query number true "Longitude"
+// @Param  radius_km query number false "Radius in kilometres"
+// @Param  pincode query string false "Pincode the outlets should deliver to"
+// @Param  open_now query bool false "Only outlets open now"
+// @Param  limit query int false "Number of outlets, at most 50"
+// @Tags         Serviceability
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /stores/{public_key}/outlets/nearest [get]
+func GetNearest(c *gin.Context) {
+	latitude, err := strconv.ParseFloat(c.Query("latitude"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Latitude is required"})
+		return
+	}
+	longitude, err := strconv.ParseFloat(c.Query("longitude"), 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Longitude is required"})
+		return
+	}
+	query := serviceability.NearestQuery{OrganizationId: db.OrganizationOf(c), Latitude: latitude, Longitude: longitude, Pincode: c.Query("pincode"), OpenNow: c.Query("open_now") == "true", At: time.Now()}
+	if radius := c.Query("radius_km"); radius != "" {
+		query.RadiusKm, err = strconv.ParseFloat(radius, 64)
+		if err != nil || query.RadiusKm < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Radius should be a positive number of kilometres"})
+			return
+		}
+	}
+	if query.Pincode != "" {
+		if err := customers.ValidatePincode(query.Pincode); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+	}
+	if limit := c.Query("limit"); limit != "" {
+		query.Limit, err = strconv.Atoi(limit)
+		if err != nil || query.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Limit should be a positive number"})
+			return
+		}
+	}
+
+	outlets, err := serviceability.Nearest(db.Tenant(c), query)
+	if errors.Is(err, serviceability.ErrInvalidCoordinates) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to find the nearest outlets", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Nearest outlets fetched successfully", "result": gin.H{"outlets": outlets}})
+}
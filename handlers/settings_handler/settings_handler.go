@@ -0,0 +1,124 @@
+package settings_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/settings"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Scopes of a change to the settings
+const (
+	scopeChain  = "chain"
+	scopeOutlet = "outlet"
+)
+
+// @Summary      Get the settings of an outlet
+// @Description  Fetches the settings of the chain of an outlet, the settings of the outlet itself and the settings in effect at the outlet, its own over those of its chain over the defaults
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Settings
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/settings [get]
+func GetSettings(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	respondWithSettings(c, outlet, http.StatusOK, "Settings fetched successfully")
+}
+
+// @Summary      Change the settings of an outlet
+// @Description  Changes the settings of the chain of an outlet, or of the outlet alone with scope outlet. Settings left out are kept and those named in reset are inherited again. With version the change is refused with 409 if the settings were changed since that version was fetched. Currency is one of INR, USD, EUR or AED, tax registration regular, composition or unregistered, and rounding mode none, nearest, up or down to a multiple of the rounding unit. Allowed tenders are those accepted at the counter out of cash, card, upi, gift_card, store_credit and loyalty_points.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Settings
+// @Accept       json
+// @Produce      json
+// @Param        settings  body  dtos.OutletSettings  true  "Outlet Settings"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      409  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/settings [patch]
+func UpdateSettings(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var settingsDTO dtos.OutletSettings
+	err := c.ShouldBindBodyWithJSON(&settingsDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if settingsDTO.Scope == "" {
+		settingsDTO.Scope = scopeOutlet
+	}
+	if settingsDTO.Scope != scopeChain && settingsDTO.Scope != scopeOutlet {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Scope should be chain or outlet"})
+		return
+	}
+
+	patch := settings.Patch{
+		CurrencyCode:     settingsDTO.CurrencyCode,
+		TaxRegistration:  settingsDTO.TaxRegistration,
+		ReceiptFooter:    settingsDTO.ReceiptFooter,
+		RoundingMode:     settingsDTO.RoundingMode,
+		RoundingUnit:     settingsDTO.RoundingUnit,
+		ReturnWindowDays: settingsDTO.ReturnWindowDays,
+		AllowedTenders:   settingsDTO.AllowedTenders,
+		Reset:            settingsDTO.Reset,
+		Version:          settingsDTO.Version,
+	}
+	_, err = settings.Update(db.Tenant(c), outlet, settingsDTO.Scope == scopeOutlet, patch)
+	if errors.Is(err, settings.ErrVersionConflict) {
+		c.JSON(http.StatusConflict, gin.H{"status": "failed", "message": err.Error()})
+		return
+	} else if settings.IsSettingsError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to change the settings", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	respondWithSettings(c, outlet, http.StatusAccepted, "Settings changed successfully")
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+// respondWithSettings writes the settings of the chain, of the outlet and in effect
+var respondWithSettings = func(c *gin.Context, outlet models.Outlet, status int, message string) {
+	chain, own, err := settings.Find(db.Tenant(c), outlet)
+	var effective settings.Settings
+	if err == nil {
+		effective, err = settings.Get(db.Tenant(c), outlet)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the settings", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(status, gin.H{"status": "success", "message": message, "result": gin.H{"chain": chain, "outlet": own, "effective": effective}})
+}
@@ -0,0 +1,357 @@
+package slot_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/hours"
+	"easystore/models"
+	"easystore/slots"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// @Summary      Create delivery slot templates
+// @Description  Creates weekly delivery windows of an outlet with a capacity and a cut-off before each window starts. With window_minutes the time between start and end is cut into consecutive windows.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Delivery Slot
+// @Accept       json
+// @Produce      json
+// @Param        template  body  dtos.SlotTemplate  true  "Slot Template"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-templates [post]
+func CreateTemplates(c *gin.Context) {
+	outletId, ok := setOutletId(c)
+	if !ok {
+		return
+	}
+
+	var templateDTO dtos.SlotTemplate
+	err := c.ShouldBindBodyWithJSON(&templateDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if len(templateDTO.Weekdays) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Weekdays are required"})
+		return
+	}
+
+	start, err := slots.ParseClock(templateDTO.Start)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+	end, err := slots.ParseClock(templateDTO.End)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+	// "24:00" can not be parsed, so "00:00" as the end means midnight
+	if end == 0 {
+		end = 24 * 60
+	}
+	window := templateDTO.WindowMinutes
+	if window == 0 {
+		window = end - start
+	}
+	if window <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": slots.ErrInvalidWindow.Error()})
+		return
+	}
+
+	var templates []models.DeliverySlotTemplate
+	for _, weekday := range templateDTO.Weekdays {
+		for from := start; from+window <= end; from += window {
+			template := models.DeliverySlotTemplate{
+				OutletId:      outletId,
+				Weekday:       weekday,
+				StartMinute:   from,
+				EndMinute:     from + window,
+				Capacity:      templateDTO.Capacity,
+				CutoffMinutes: templateDTO.CutoffMinutes,
+				Active:        true,
+			}
+			if err := slots.ValidateTemplate(template); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+				return
+			}
+			templates = append(templates, template)
+		}
+	}
+	if len(templates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": slots.ErrInvalidWindow.Error()})
+		return
+	}
+
+	tx := db.Tenant(c).Omit("Outlet").Create(&templates)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to create the slot templates", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Slot templates created successfully", "result": gin.H{"templates": templates}})
+}
+
+// @Summary      Get delivery slot templates
+// @Description  Lists the weekly delivery windows of an outlet
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Delivery Slot
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-templates [get]
+func GetTemplates(c *gin.Context) {
+	var templates []models.DeliverySlotTemplate
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Order("weekday, start_minute").Find(&templates)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the slot templates", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Slot templates fetched successfully", "result": gin.H{"templates": templates}})
+}
+
+// @Summary      Update a delivery slot template
+// @Description  Changes the capacity or cut-off of a delivery window, or turns it off
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param template_id path string true "Slot Template ID"
+// @Tags         Delivery Slot
+// @Accept       json
+// @Produce      json
+// @Param        template  body  dtos.SlotTemplateUpdate  true  "Slot Template"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-templates/{template_id} [put]
+func UpdateTemplate(c *gin.Context) {
+	var templateDTO dtos.SlotTemplateUpdate
+	err := c.ShouldBindBodyWithJSON(&templateDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	var template models.DeliverySlotTemplate
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).First(&template, c.Param("template_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Slot template not found"})
+		return
+	}
+
+	if templateDTO.Capacity != nil {
+		template.Capacity = *templateDTO.Capacity
+	}
+	if templateDTO.CutoffMinutes != nil {
+		template.CutoffMinutes = *templateDTO.CutoffMinutes
+	}
+	if templateDTO.Active != nil {
+		template.Active = *templateDTO.Active
+	}
+	if err := slots.ValidateTemplate(template); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	}
+
+	tx = db.Tenant(c).Model(&template).Select("capacity", "cutoff_minutes", "active").Updates(&template)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the slot template", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Slot template updated successfully", "result": gin.H{"template": template}})
+}
+
+// @Summary      Delete a delivery slot template
+// @Description  Removes a delivery window. Orders already booked into it keep their slot.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param template_id path string true "Slot Template ID"
+// @Tags         Delivery Slot
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-templates/{template_id} [delete]
+func DeleteTemplate(c *gin.Context) {
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).Delete(&models.DeliverySlotTemplate{}, c.Param("template_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the slot template", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	} else if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Slot template not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Slot template deleted successfully"})
+}
+
+// @Summary      Override the delivery slots of a date
+// @Description  Closes the delivery slots of an outlet on a holiday or changes their capacity for that date. Setting an override again for the same date replaces it.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Delivery Slot
+// @Accept       json
+// @Produce      json
+// @Param        override  body  dtos.SlotOverride  true  "Slot Override"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-overrides [post]
+func SetOverride(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+	outletId := outlet.ID
+
+	var overrideDTO dtos.SlotOverride
+	err := c.ShouldBindBodyWithJSON(&overrideDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	date, err := slots.ParseDate(outlet, overrideDTO.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Date should be in YYYY-MM-DD format"})
+		return
+	}
+	if !overrideDTO.Closed && overrideDTO.Capacity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "An override should close the date or change its capacity"})
+		return
+	}
+	if overrideDTO.Capacity != nil && *overrideDTO.Capacity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Capacity should not be negative"})
+		return
+	}
+
+	override := models.DeliverySlotOverride{OutletId: outletId, Date: date, Closed: overrideDTO.Closed, Capacity: overrideDTO.Capacity, Reason: overrideDTO.Reason}
+	tx := db.Tenant(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "outlet_id"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"closed", "capacity", "reason", "updated_at", "deleted_at"}),
+	}).Omit("Outlet").Create(&override)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to set the override", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Override set successfully", "result": gin.H{"override": override}})
+}
+
+// @Summary      Get delivery slot overrides
+// @Description  Lists the holiday and capacity overrides of an outlet from today onwards
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Delivery Slot
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-overrides [get]
+func GetOverrides(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var overrides []models.DeliverySlotOverride
+	today := time.Now().In(hours.Of(outlet)).Format(slots.DateLayout)
+	tx := db.Tenant(c).Where("outlet_id = ? AND date >= ?", outlet.ID, today).Order("date").Find(&overrides)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the overrides", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Overrides fetched successfully", "result": gin.H{"overrides": overrides}})
+}
+
+// @Summary      Delete a delivery slot override
+// @Description  Removes an override so the date follows the weekly templates again
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param override_id path string true "Override ID"
+// @Tags         Delivery Slot
+// @Produce      json
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slot-overrides/{override_id} [delete]
+func DeleteOverride(c *gin.Context) {
+	tx := db.Tenant(c).Unscoped().Where("outlet_id = ?", c.Param("outlet_id")).Delete(&models.DeliverySlotOverride{}, c.Param("override_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to delete the override", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	} else if tx.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Override not found"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Override deleted successfully"})
+}
+
+// @Summary      Get delivery slots of an outlet
+// @Description  Lists the delivery slots of an outlet on a date with the capacity left in each. There are none on the holidays of the outlet and the days it does not open.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param date query string true "Date (YYYY-MM-DD)"
+// @Tags         Delivery Slot
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/slots [get]
+func GetSlots(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	date, err := slots.ParseDate(outlet, c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Date should be in YYYY-MM-DD format"})
+		return
+	}
+
+	available, err := slots.Availability(db.Tenant(c), outlet, date, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the slots", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Slots fetched successfully", "result": gin.H{"date": date.Format(slots.DateLayout), "slots": available}})
+}
+
+// Private methods
+
+var setOutletId = func(c *gin.Context) (uint, bool) {
+	outlet, ok := setOutlet(c)
+	return outlet.ID, ok
+}
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	outletId, err := strconv.Atoi(c.Param("outlet_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid outlet id"})
+		return outlet, false
+	}
+
+	err = db.Tenant(c).First(&outlet, outletId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Outlet not found with the given ID"})
+		return outlet, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": err.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
@@ -0,0 +1,78 @@
+package tax_handler
+
+import (
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/tax"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Compute the GST breakdown of lines
+// @Description  Computes CGST/SGST or IGST and cess for each line using the HSN code and tax slab of the product. The unit price defaults to the current selling price of the varient and the pricing mode defaults to the mode of the outlet.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Tax
+// @Accept       json
+// @Produce      json
+// @Param        lines  body  dtos.TaxBreakdown  true  "Lines"
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/tax/breakdown [post]
+func Breakdown(c *gin.Context) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+
+	var request dtos.TaxBreakdown
+	err := c.ShouldBindBodyWithJSON(&request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	mode := tax.ModeFor(outlet)
+	if request.PricingMode != "" {
+		mode, err = tax.ParseMode(request.PricingMode)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+			return
+		}
+	}
+
+	if request.PlaceOfSupply != "" && !tax.ValidStateCode(request.PlaceOfSupply) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid place of supply state code"})
+		return
+	}
+
+	var lines []tax.Line
+	for _, requestLine := range request.Lines {
+		var varient models.ProductVarient
+		tx := db.Tenant(c).Joins("Product").Where("\"Product\".outlet_id = ?", outlet.ID).First(&varient, requestLine.VarientId)
+		if tx.Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find the product varient", "result": gin.H{"varient_id": requestLine.VarientId}})
+			return
+		}
+
+		unitPrice := requestLine.UnitPrice
+		if unitPrice == 0 {
+			unitPrice = varient.SellingPrice
+		}
+		lines = append(lines, tax.LineFor(varient.Product, unitPrice, requestLine.Quantity, requestLine.Discount))
+	}
+
+	breakdowns, totals, err := tax.ComputeLines(lines, mode, tax.InterstateFor(outlet, request.PlaceOfSupply))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to compute the tax", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Tax computed successfully", "result": gin.H{"pricing_mode": mode, "lines": breakdowns, "totals": totals, "hsn_summary": tax.SummarizeByHsn(breakdowns)}})
+}
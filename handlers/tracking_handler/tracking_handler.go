@@ -0,0 +1,336 @@
+package tracking_handler
+
+import (
+	"context"
+	"easystore/auth"
+	"easystore/db"
+	"easystore/models"
+	"easystore/tracking"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"gorm.io/gorm"
+)
+
+// writeWait is how long a write to a subscriber may take before it is dropped
+const writeWait = 10 * time.Second
+
+// Browsers may only open sockets from the origin of the API or one in ALLOWED_ORIGINS
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     allowedOrigin,
+}
+
+// @Summary      Track an order
+// @Description  Returns an order followed with its tracking token, with the latest location of its rider and the delivery OTP while it is out for delivery. The token is only given to the customer and staff, never to riders. No login is required.
+// @Param tracking_token path string true "Tracking Token"
+// @Tags         Tracking
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Router       /track/{tracking_token} [get]
+func GetTracking(c *gin.Context) {
+	order, ok := setTrackedOrder(c)
+	if !ok {
+		return
+	}
+
+	tx := db.Tenant(c).Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Preload("Slot").First(&order, order.ID)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the order", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	location, err := tracking.LastLocation(db.Tenant(c), order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the order", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	result := gin.H{"order": order, "location": location}
+	// The tracking token only reaches the customer and staff, never the rider, so the OTP
+	// the rider has to ask the customer for at the door is shown here
+	if order.Status == models.OrderOutForDelivery {
+		result["delivery_otp"] = order.DeliveryOtp
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Order fetched successfully", "result": result})
+}
+
+// @Summary      Stream order events to a customer
+// @Description  Streams the status changes and rider locations of an order as server-sent events. Reconnecting with the Last-Event-ID header or the last_event_id query parameter resumes after that event. The stream ends after the order is delivered, cancelled or failed. No login is required.
+// @Param tracking_token path string true "Tracking Token"
+// @Param Last-Event-ID header string false "Last event received"
+// @Param last_event_id query string false "Last event received"
+// @Tags         Tracking
+// @Produce      text/event-stream
+// @Success      200
+// @Success      204
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Router       /track/{tracking_token}/events [get]
+func CustomerEvents(c *gin.Context) {
+	order, ok := setTrackedOrder(c)
+	if !ok {
+		return
+	}
+	serveEvents(c, order)
+}
+
+// @Summary      Stream order events to a customer over WebSocket
+// @Description  Sends the status changes and rider locations of an order as WebSocket messages, each with the id, event type and data of an event. Connecting with the last_event_id query parameter resumes after that event. The socket is closed after the order is delivered, cancelled or failed. No login is required.
+// @Param tracking_token path string true "Tracking Token"
+// @Param last_event_id query string false "Last event received"
+// @Tags         Tracking
+// @Success      101
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Router       /track/{tracking_token}/ws [get]
+func CustomerSocket(c *gin.Context) {
+	order, ok := setTrackedOrder(c)
+	if !ok {
+		return
+	}
+	serveSocket(c, order)
+}
+
+// @Summary      Stream order events to staff
+// @Description  Streams the status changes and rider locations of an order of the outlet as server-sent events. Browsers, which can not set the Authorization header on event streams, pass a stream ticket in the ticket query parameter instead. Reconnecting with the Last-Event-ID header or the last_event_id query parameter resumes after that event.
+// @Param Authorization header string false "Bearer Token"
+// @Param ticket query string false "Stream Ticket"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Param Last-Event-ID header string false "Last event received"
+// @Param last_event_id query string false "Last event received"
+// @Tags         Tracking
+// @Produce      text/event-stream
+// @Success      200
+// @Success      204
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/events [get]
+func OrderEvents(c *gin.Context) {
+	order, ok := setOutletOrder(c)
+	if !ok {
+		return
+	}
+	serveEvents(c, order)
+}
+
+// @Summary      Stream order events to staff over WebSocket
+// @Description  Sends the status changes and rider locations of an order of the outlet as WebSocket messages. Browsers, which can not set the Authorization header on sockets, pass a stream ticket in the ticket query parameter instead. Connecting with the last_event_id query parameter resumes after that event.
+// @Param Authorization header string false "Bearer Token"
+// @Param ticket query string false "Stream Ticket"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Param last_event_id query string false "Last event received"
+// @Tags         Tracking
+// @Success      101
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/ws [get]
+func OrderSocket(c *gin.Context) {
+	order, ok := setOutletOrder(c)
+	if !ok {
+		return
+	}
+	serveSocket(c, order)
+}
+
+// @Summary      Issue a stream ticket for an order
+// @Description  Returns a ticket to open the event stream or socket of an order of the outlet from a browser with the ticket query parameter, as the access token should not be put in URLs. A ticket can be used once, within a minute of being issued.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param order_id path string true "Order ID"
+// @Tags         Tracking
+// @Produce      json
+// @Success      201  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/orders/{order_id}/stream-ticket [post]
+func CreateStreamTicket(c *gin.Context) {
+	order, ok := setOutletOrder(c)
+	if !ok {
+		return
+	}
+
+	token, ticket, err := auth.IssueStreamTicket(db.Tenant(c), auth.CurrentEmployeeID(c), order.OutletId, order.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to issue a stream ticket", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": "Stream ticket issued successfully", "result": gin.H{"ticket": token, "expires_at": ticket.ExpiresAt}})
+}
+
+// Private methods
+
+// allowedOrigin accepts socket requests without an origin, which do not come from browsers,
+// from the origin of the API itself and from the comma separated ALLOWED_ORIGINS
+var allowedOrigin = func(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+var setTrackedOrder = func(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	tx := db.DB.Where("tracking_token = ?", c.Param("tracking_token")).First(&order)
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+var setOutletOrder = func(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	tx := db.Tenant(c).Where("outlet_id = ?", c.Param("outlet_id")).First(&order, c.Param("order_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// lastEventId reads where a subscriber wants to resume from. EventSource sends the
+// Last-Event-ID header when it reconnects, other clients can use the query parameter.
+var lastEventId = func(c *gin.Context) uint {
+	lastId := c.GetHeader("Last-Event-ID")
+	if lastId == "" {
+		lastId = c.Query("last_event_id")
+	}
+	id, _ := strconv.ParseUint(lastId, 10, 64)
+	return uint(id)
+}
+
+// finished reports whether a subscriber has already seen the last event of an order that
+// will not change any more
+var finished = func(order models.Order, lastId uint) (bool, error) {
+	if !tracking.Final(order.Status) {
+		return false, nil
+	}
+	pending, err := tracking.Since(db.DB, order.ID, lastId)
+	return len(pending) == 0, err
+}
+
+var serveEvents = func(c *gin.Context, order models.Order) {
+	lastId := lastEventId(c)
+
+	// A finished order with nothing left to send answers 204, which stops EventSource
+	// from reconnecting
+	done, err := finished(order, lastId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the events", "result": gin.H{"error": err.Error()}})
+		return
+	} else if done {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", (3 * time.Second).Milliseconds())
+	c.Writer.Flush()
+
+	send := func(event models.OrderEvent) error {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	heartbeat := func() error {
+		if _, err := fmt.Fprint(c.Writer, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	err = tracking.Stream(c.Request.Context(), db.Tenant(c), order.ID, lastId, send, heartbeat)
+	if err != nil {
+		log.Printf("Event stream of order %d stopped: %v", order.ID, err)
+	}
+}
+
+var serveSocket = func(c *gin.Context, order models.Order) {
+	lastId := lastEventId(c)
+	done, err := finished(order, lastId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the events", "result": gin.H{"error": err.Error()}})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	if done {
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+
+	// Subscribers only send pongs and close frames, reading notices them going away
+	conn.SetReadDeadline(time.Now().Add(2 * tracking.Heartbeat))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * tracking.Heartbeat))
+	})
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(event models.OrderEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(writeWait))
+		return conn.WriteJSON(gin.H{"id": event.ID, "event": event.Type, "data": event})
+	}
+	heartbeat := func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait))
+	}
+
+	err = tracking.Stream(ctx, db.Tenant(c), order.ID, lastId, send, heartbeat)
+	if err != nil {
+		log.Printf("Socket of order %d stopped: %v", order.ID, err)
+		return
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(writeWait))
+}
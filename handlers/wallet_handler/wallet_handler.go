@@ -0,0 +1,264 @@
+package wallet_handler
+
+import (
+	"easystore/customers"
+	"easystore/db"
+	"easystore/dtos"
+	"easystore/models"
+	"easystore/wallets"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// @Summary      Issue a gift card
+// @Description  Issues a gift card of the chain of an outlet loaded with amount, optionally for a customer of the chain. The card can be spent in parts at any outlet of the chain and online until it expires after expiry_days, never when zero.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Tags         Wallets
+// @Accept       json
+// @Produce      json
+// @Param        gift_card  body  dtos.GiftCard  true  "Gift Card"
+// @Success      201  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/gift-cards [post]
+func IssueGiftCard(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	var giftCardDTO dtos.GiftCard
+	err := c.ShouldBindBodyWithJSON(&giftCardDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if giftCardDTO.ExpiryDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Expiry days should not be negative"})
+		return
+	}
+	if giftCardDTO.CustomerId != nil {
+		if _, err := customers.Find(db.Tenant(c), outlet.ChainId(), *giftCardDTO.CustomerId); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Customer not found"})
+			return
+		}
+	}
+	var expiresAt *time.Time
+	if giftCardDTO.ExpiryDays > 0 {
+		at := time.Now().AddDate(0, 0, giftCardDTO.ExpiryDays)
+		expiresAt = &at
+	}
+	reason := giftCardDTO.Reason
+	if reason == "" {
+		reason = "Issued"
+	}
+
+	card, err := wallets.IssueGiftCard(db.Tenant(c), outlet, giftCardDTO.Amount, giftCardDTO.CustomerId, expiresAt, reason)
+	if errors.Is(err, wallets.ErrInvalidAmount) {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": err.Error()})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to issue the gift card", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"status": "success", "message": "Gift card issued successfully", "result": gin.H{"gift_card": card}})
+}
+
+// @Summary      Get the gift cards
+// @Description  Lists the gift cards of the chain of an outlet, newest first, optionally filtered by status or customer
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param status query string false "Status, active or blocked"
+// @Param customer_id query string false "Customer ID"
+// @Tags         Wallets
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/gift-cards [get]
+func GetGiftCards(c *gin.Context) {
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return
+	}
+
+	query := db.Tenant(c).Where("chain_id = ?", outlet.ChainId())
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if customerId := c.Query("customer_id"); customerId != "" {
+		query = query.Where("customer_id = ?", customerId)
+	}
+
+	var cards []models.GiftCard
+	tx := query.Order("id desc").Find(&cards)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the gift cards", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Gift cards fetched successfully", "result": gin.H{"gift_cards": cards}})
+}
+
+// @Summary      Get a gift card
+// @Description  Fetches a gift card of the chain of an outlet by its code with its balance and the movements of the balance, newest first
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param code path string true "Gift Card Code"
+// @Tags         Wallets
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/gift-cards/{code} [get]
+func GetGiftCard(c *gin.Context) {
+	_, card, ok := setGiftCard(c)
+	if !ok {
+		return
+	}
+
+	balance, err := wallets.GiftCardBalance(db.Tenant(c), card.ID)
+	if err == nil {
+		err = db.Tenant(c).Where("gift_card_id = ?", card.ID).Order("id desc").Find(&card.Entries).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the gift card", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	var usable string
+	if err := wallets.Usable(card, time.Now()); err != nil {
+		usable = err.Error()
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Gift card fetched successfully", "result": gin.H{"gift_card": card, "balance": balance, "unusable_reason": usable}})
+}
+
+// @Summary      Block or unblock a gift card
+// @Description  Sets the status of a gift card of the chain of an outlet. Blocked cards can not be spent or refunded to until they are active again.
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param code path string true "Gift Card Code"
+// @Tags         Wallets
+// @Accept       json
+// @Produce      json
+// @Param        status  body  dtos.GiftCardStatus  true  "Status"
+// @Success      202  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      404  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/gift-cards/{code}/status [put]
+func UpdateGiftCardStatus(c *gin.Context) {
+	_, card, ok := setGiftCard(c)
+	if !ok {
+		return
+	}
+
+	var statusDTO dtos.GiftCardStatus
+	err := c.ShouldBindBodyWithJSON(&statusDTO)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to get the request body", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	if statusDTO.Status != models.GiftCardActive && statusDTO.Status != models.GiftCardBlocked {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Status should be active or blocked"})
+		return
+	}
+
+	tx := db.Tenant(c).Model(&card).Update("status", statusDTO.Status)
+	if tx.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to update the gift card", "result": gin.H{"error": tx.Error.Error()}})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"status": "success", "message": "Gift card updated successfully", "result": gin.H{"gift_card": card}})
+}
+
+// @Summary      Get the store credit wallet of a customer
+// @Description  Fetches the store credit balance of a customer with the credit they were given on returns and spent on sales and orders, newest first, including that of customers merged into them
+// @Param Authorization header string true "Bearer Token"
+// @Param outlet_id path string true "Outlet ID"
+// @Param customer_id path string true "Customer ID"
+// @Tags         Wallets
+// @Produce      json
+// @Success      200  {object}  dtos.SuccessResponse
+// @Failure      400  {object}  dtos.ErrorResponse
+// @Failure      500  {object}  dtos.ErrorResponse
+// @Security BearerAuth
+// @Router       /outlet/{outlet_id}/customers/{customer_id}/wallet [get]
+func GetWallet(c *gin.Context) {
+	_, customer, ok := setCustomer(c)
+	if !ok {
+		return
+	}
+
+	balance, err := wallets.StoreCreditBalance(db.Tenant(c), customer.ID)
+	var ids []uint
+	if err == nil {
+		ids, err = customers.HistoryIds(db.Tenant(c), customer.ID)
+	}
+	var entries []models.StoreCreditEntry
+	if err == nil {
+		err = db.Tenant(c).Where("customer_id IN ?", ids).Order("id desc").Find(&entries).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the wallet", "result": gin.H{"error": err.Error()}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "Wallet fetched successfully", "result": gin.H{"balance": balance, "entries": entries}})
+}
+
+// Private methods
+
+var setOutlet = func(c *gin.Context) (models.Outlet, bool) {
+	var outlet models.Outlet
+	tx := db.Tenant(c).First(&outlet, c.Param("outlet_id"))
+	if tx.Error != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Unable to find outlet", "result": gin.H{"error": tx.Error.Error()}})
+		return outlet, false
+	}
+	return outlet, true
+}
+
+var setGiftCard = func(c *gin.Context) (models.Outlet, models.GiftCard, bool) {
+	var card models.GiftCard
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return outlet, card, false
+	}
+
+	card, err := wallets.FindGiftCard(db.Tenant(c), outlet.ChainId(), c.Param("code"))
+	if errors.Is(err, wallets.ErrGiftCardNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": err.Error()})
+		return outlet, card, false
+	} else if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "failed", "message": "Unable to get the gift card", "result": gin.H{"error": err.Error()}})
+		return outlet, card, false
+	}
+	return outlet, card, true
+}
+
+var setCustomer = func(c *gin.Context) (models.Outlet, models.Customer, bool) {
+	var customer models.Customer
+	outlet, ok := setOutlet(c)
+	if !ok {
+		return outlet, customer, false
+	}
+
+	customerId, err := strconv.Atoi(c.Param("customer_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"status": "failed", "message": "Invalid customer id"})
+		return outlet, customer, false
+	}
+	customer, err = customers.Find(db.Tenant(c), outlet.ChainId(), uint(customerId))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"status": "failed", "message": "Customer not found"})
+		return outlet, customer, false
+	}
+	return outlet, customer, true
+}
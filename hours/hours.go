@@ -0,0 +1,244 @@
+package hours
+
+import (
+	"easystore/models"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	DateLayout = "2006-01-02"
+	// lookahead is how many days ahead the next opening is looked for
+	lookahead = 14
+)
+
+var (
+	ErrInvalidTimezone = errors.New("Timezone should be an IANA time zone such as Asia/Kolkata")
+	ErrInvalidWeekday  = errors.New("Weekday should be between 0 (Sunday) and 6 (Saturday)")
+	ErrInvalidWindow   = errors.New("Opening hours should close after they open and within the day")
+	ErrOverlap         = errors.New("Opening hours of a day should not overlap")
+	ErrClosed          = errors.New("Outlet is closed")
+)
+
+// Default is the time zone of outlets that do not set one. GST documents are dated in it
+// whatever the outlet.
+var Default = load(models.DefaultTimezone)
+
+var locations sync.Map
+
+// Status is whether an outlet is open at a time, and when that changes
+type Status struct {
+	Open      bool   `json:"open"`
+	Timezone  string `json:"timezone"`
+	LocalTime string `json:"local_time"`
+	// Holiday is the name of the holiday the outlet is closed for today
+	Holiday  string     `json:"holiday,omitempty"`
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+	OpensAt  *time.Time `json:"opens_at,omitempty"`
+}
+
+// window is a stretch of time an outlet is open
+type window struct {
+	open  time.Time
+	close time.Time
+}
+
+// Location returns the named time zone, Default when it is empty or unknown
+func Location(name string) *time.Location {
+	if name == "" {
+		return Default
+	}
+	if location, ok := locations.Load(name); ok {
+		return location.(*time.Location)
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return Default
+	}
+	locations.Store(name, location)
+	return location
+}
+
+// Of returns the time zone of the outlet
+func Of(outlet models.Outlet) *time.Location {
+	return Location(outlet.Timezone)
+}
+
+// ValidateTimezone checks that name is a time zone that can be loaded
+func ValidateTimezone(name string) error {
+	if name == "" || name == "Local" {
+		return ErrInvalidTimezone
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return ErrInvalidTimezone
+	}
+	return nil
+}
+
+// ValidateWeek checks the windows of a week of opening hours, which should not overlap on
+// the same day
+func ValidateWeek(week []models.OutletHours) error {
+	byDay := make(map[int][]models.OutletHours)
+	for _, hours := range week {
+		if hours.Weekday < 0 || hours.Weekday > 6 {
+			return ErrInvalidWeekday
+		}
+		if hours.OpenMinute < 0 || hours.CloseMinute > 24*60 || hours.CloseMinute <= hours.OpenMinute {
+			return ErrInvalidWindow
+		}
+		byDay[hours.Weekday] = append(byDay[hours.Weekday], hours)
+	}
+	for _, day := range byDay {
+		sort.Slice(day, func(i, j int) bool { return day[i].OpenMinute < day[j].OpenMinute })
+		for i := 1; i < len(day); i++ {
+			if day[i].OpenMinute < day[i-1].CloseMinute {
+				return ErrOverlap
+			}
+		}
+	}
+	return nil
+}
+
+// Get works out whether the outlet is open at a time in its own time zone. An inactive
+// outlet is always closed.
+func Get(tx *gorm.DB, outlet models.Outlet, at time.Time) (Status, error) {
+	location := Of(outlet)
+	local := at.In(location)
+	status := Status{Timezone: location.String(), LocalTime: local.Format("2006-01-02 15:04")}
+	if outlet.Status == "inactive" {
+		return status, nil
+	}
+
+	windows, holidays, err := schedule(tx, outlet, local, lookahead)
+	if err != nil {
+		return status, err
+	}
+	status.Holiday = holidays[local.Format(DateLayout)]
+	return during(status, windows, local, midnight(local, lookahead, location)), nil
+}
+
+// Check returns ErrClosed, with when the outlet opens next, if the outlet is closed at a
+// time
+func Check(tx *gorm.DB, outlet models.Outlet, at time.Time) error {
+	status, err := Get(tx, outlet, at)
+	if err != nil || status.Open {
+		return err
+	}
+	if status.OpensAt != nil {
+		return fmt.Errorf("%w, it opens at %s", ErrClosed, status.OpensAt.Format("02 Jan 15:04"))
+	}
+	return ErrClosed
+}
+
+// OpenOn reports whether the outlet opens at all on a calendar date, with the name of the
+// holiday it is closed for if it is one
+func OpenOn(tx *gorm.DB, outlet models.Outlet, date time.Time) (bool, string, error) {
+	if outlet.Status == "inactive" {
+		return false, "", nil
+	}
+	location := Of(outlet)
+	day := midnight(date, 0, location)
+	windows, holidays, err := schedule(tx, outlet, day, 1)
+	return len(windows) > 0, holidays[day.Format(DateLayout)], err
+}
+
+// At returns the time minutes after midnight of the calendar date in location
+func At(date time.Time, minutes int, location *time.Location) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, minutes, 0, 0, location)
+}
+
+// Private methods
+
+// schedule lists the windows the outlet is open in over days from the date of from, with
+// windows running into each other joined, and the holidays over those days by date
+func schedule(tx *gorm.DB, outlet models.Outlet, from time.Time, days int) ([]window, map[string]string, error) {
+	location := Of(outlet)
+	var week []models.OutletHours
+	err := tx.Where("outlet_id = ?", outlet.ID).Order("weekday, open_minute").Find(&week).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	var holidays []models.OutletHoliday
+	err = tx.Where("outlet_id = ? AND date >= ? AND date < ?", outlet.ID, from.Format(DateLayout), from.AddDate(0, 0, days).Format(DateLayout)).Find(&holidays).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	closed := make(map[string]string, len(holidays))
+	for _, holiday := range holidays {
+		closed[holiday.Date.Format(DateLayout)] = holiday.Name
+	}
+	return plan(week, closed, from, days, location), closed, nil
+}
+
+// plan lists the windows of a week of opening hours over days from the date of from,
+// leaving out the dates closed and joining windows that run into each other
+func plan(week []models.OutletHours, closed map[string]string, from time.Time, days int, location *time.Location) []window {
+	// Outlets without opening hours are open all day
+	if len(week) == 0 {
+		for weekday := 0; weekday < 7; weekday++ {
+			week = append(week, models.OutletHours{Weekday: weekday, OpenMinute: 0, CloseMinute: 24 * 60})
+		}
+	}
+
+	var windows []window
+	for day := 0; day < days; day++ {
+		date := midnight(from, day, location)
+		if _, ok := closed[date.Format(DateLayout)]; ok {
+			continue
+		}
+		for _, hours := range week {
+			if hours.Weekday != int(date.Weekday()) {
+				continue
+			}
+			w := window{open: At(date, hours.OpenMinute, location), close: At(date, hours.CloseMinute, location)}
+			if last := len(windows) - 1; last >= 0 && !windows[last].close.Before(w.open) {
+				windows[last].close = w.close
+				continue
+			}
+			windows = append(windows, w)
+		}
+	}
+	return windows
+}
+
+// during fills in whether the outlet is open at local from its windows, which end is as
+// far as they were worked out
+func during(status Status, windows []window, local time.Time, end time.Time) Status {
+	for _, w := range windows {
+		if !w.close.After(local) {
+			continue
+		}
+		if w.open.After(local) {
+			opensAt := w.open
+			status.OpensAt = &opensAt
+		} else {
+			status.Open = true
+			// An outlet open for as far as is looked has no closing time to show
+			if w.close.Before(end) {
+				closesAt := w.close
+				status.ClosesAt = &closesAt
+			}
+		}
+		break
+	}
+	return status
+}
+
+// midnight returns the start of the calendar date days after t in location
+func midnight(t time.Time, days int, location *time.Location) time.Time {
+	return At(t.In(location).AddDate(0, 0, days), 0, location)
+}
+
+func load(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return time.FixedZone("IST", 5*60*60+30*60)
+	}
+	return location
+}
@@ -0,0 +1,193 @@
+package hours
+
+import (
+	"easystore/models"
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", models.DefaultTimezone},
+		{"Not/AZone", models.DefaultTimezone},
+		{"Asia/Dubai", "Asia/Dubai"},
+		{"America/New_York", "America/New_York"},
+	}
+	for _, tt := range tests {
+		if got := Location(tt.name).String(); got != tt.want {
+			t.Errorf("Location(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"Asia/Kolkata", nil},
+		{"Europe/London", nil},
+		{"", ErrInvalidTimezone},
+		{"Local", ErrInvalidTimezone},
+		{"Mars/Olympus", ErrInvalidTimezone},
+	}
+	for _, tt := range tests {
+		if err := ValidateTimezone(tt.name); !errors.Is(err, tt.err) {
+			t.Errorf("ValidateTimezone(%q) error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestValidateWeek(t *testing.T) {
+	tests := []struct {
+		name string
+		week []models.OutletHours
+		err  error
+	}{
+		{"empty", nil, nil},
+		{"split day", []models.OutletHours{{Weekday: 1, OpenMinute: 540, CloseMinute: 780}, {Weekday: 1, OpenMinute: 840, CloseMinute: 1320}}, nil},
+		{"touching", []models.OutletHours{{Weekday: 1, OpenMinute: 540, CloseMinute: 780}, {Weekday: 1, OpenMinute: 780, CloseMinute: 1320}}, nil},
+		{"all day", []models.OutletHours{{Weekday: 0, OpenMinute: 0, CloseMinute: 1440}}, nil},
+		{"overlapping", []models.OutletHours{{Weekday: 2, OpenMinute: 840, CloseMinute: 1320}, {Weekday: 2, OpenMinute: 540, CloseMinute: 900}}, ErrOverlap},
+		{"same hours on other days", []models.OutletHours{{Weekday: 2, OpenMinute: 540, CloseMinute: 900}, {Weekday: 3, OpenMinute: 540, CloseMinute: 900}}, nil},
+		{"weekday", []models.OutletHours{{Weekday: 7, OpenMinute: 540, CloseMinute: 900}}, ErrInvalidWeekday},
+		{"closes before it opens", []models.OutletHours{{Weekday: 1, OpenMinute: 1320, CloseMinute: 120}}, ErrInvalidWindow},
+		{"past midnight", []models.OutletHours{{Weekday: 1, OpenMinute: 540, CloseMinute: 1441}}, ErrInvalidWindow},
+	}
+	for _, tt := range tests {
+		if err := ValidateWeek(tt.week); !errors.Is(err, tt.err) {
+			t.Errorf("%s: ValidateWeek error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	kolkata := Location("Asia/Kolkata")
+	newYork := Location("America/New_York")
+	at := func(location *time.Location, day int, hour int, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, location)
+	}
+
+	tests := []struct {
+		name     string
+		week     []models.OutletHours
+		closed   map[string]string
+		from     time.Time
+		days     int
+		location *time.Location
+		want     []window
+	}{
+		{
+			// 5 January 2026 is a Monday
+			name:     "split day",
+			week:     []models.OutletHours{{Weekday: 1, OpenMinute: 540, CloseMinute: 780}, {Weekday: 1, OpenMinute: 840, CloseMinute: 1320}},
+			from:     at(kolkata, 5, 0, 0),
+			days:     1,
+			location: kolkata,
+			want:     []window{{at(kolkata, 5, 9, 0), at(kolkata, 5, 13, 0)}, {at(kolkata, 5, 14, 0), at(kolkata, 5, 22, 0)}},
+		},
+		{
+			name:     "late night joined with the next morning",
+			week:     []models.OutletHours{{Weekday: 1, OpenMinute: 1080, CloseMinute: 1440}, {Weekday: 2, OpenMinute: 0, CloseMinute: 120}, {Weekday: 2, OpenMinute: 600, CloseMinute: 1200}},
+			from:     at(kolkata, 5, 0, 0),
+			days:     2,
+			location: kolkata,
+			want:     []window{{at(kolkata, 5, 18, 0), at(kolkata, 6, 2, 0)}, {at(kolkata, 6, 10, 0), at(kolkata, 6, 20, 0)}},
+		},
+		{
+			name:     "no hours is open all day",
+			from:     at(kolkata, 5, 15, 0),
+			days:     2,
+			location: kolkata,
+			want:     []window{{at(kolkata, 5, 0, 0), at(kolkata, 7, 0, 0)}},
+		},
+		{
+			name:     "holiday",
+			closed:   map[string]string{"2026-01-06": "Festival"},
+			from:     at(kolkata, 5, 0, 0),
+			days:     3,
+			location: kolkata,
+			want:     []window{{at(kolkata, 5, 0, 0), at(kolkata, 6, 0, 0)}, {at(kolkata, 7, 0, 0), at(kolkata, 8, 0, 0)}},
+		},
+		{
+			// 21:00 in Kolkata on Monday is still Monday morning in New York
+			name:     "in the time zone of the outlet",
+			week:     []models.OutletHours{{Weekday: 1, OpenMinute: 540, CloseMinute: 1020}},
+			from:     at(kolkata, 5, 21, 0),
+			days:     1,
+			location: newYork,
+			want:     []window{{at(newYork, 5, 9, 0), at(newYork, 5, 17, 0)}},
+		},
+	}
+	for _, tt := range tests {
+		got := plan(tt.week, tt.closed, tt.from, tt.days, tt.location)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: plan = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if !got[i].open.Equal(tt.want[i].open) || !got[i].close.Equal(tt.want[i].close) {
+				t.Errorf("%s: window %d = %s to %s, want %s to %s", tt.name, i, got[i].open, got[i].close, tt.want[i].open, tt.want[i].close)
+			}
+		}
+	}
+}
+
+func TestPlanDaylightSaving(t *testing.T) {
+	// Clocks in New York go forward an hour on 8 March 2026, a Sunday
+	newYork := Location("America/New_York")
+	from := time.Date(2026, time.March, 8, 0, 0, 0, 0, newYork)
+	windows := plan([]models.OutletHours{{Weekday: 0, OpenMinute: 0, CloseMinute: 1440}}, nil, from, 1, newYork)
+	if len(windows) != 1 {
+		t.Fatalf("plan = %v, want one window", windows)
+	}
+	if length := windows[0].close.Sub(windows[0].open); length != 23*time.Hour {
+		t.Errorf("window of 8 March = %s, want 23h", length)
+	}
+	if want := time.Date(2026, time.March, 9, 0, 0, 0, 0, newYork); !windows[0].close.Equal(want) {
+		t.Errorf("window of 8 March closes at %s, want %s", windows[0].close, want)
+	}
+}
+
+func TestDuring(t *testing.T) {
+	kolkata := Location("Asia/Kolkata")
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2026, time.January, day, hour, minute, 0, 0, kolkata)
+	}
+	windows := []window{{at(5, 9, 0), at(5, 13, 0)}, {at(5, 14, 0), at(5, 22, 0)}}
+	allWeek := []window{{at(5, 0, 0), at(19, 0, 0)}}
+	end := at(19, 0, 0)
+
+	tests := []struct {
+		name     string
+		windows  []window
+		local    time.Time
+		open     bool
+		closesAt time.Time
+		opensAt  time.Time
+	}{
+		{name: "before opening", windows: windows, local: at(5, 8, 0), opensAt: at(5, 9, 0)},
+		{name: "at opening", windows: windows, local: at(5, 9, 0), open: true, closesAt: at(5, 13, 0)},
+		{name: "lunch break", windows: windows, local: at(5, 13, 0), opensAt: at(5, 14, 0)},
+		{name: "evening", windows: windows, local: at(5, 21, 59), open: true, closesAt: at(5, 22, 0)},
+		{name: "after closing", windows: windows, local: at(5, 22, 0)},
+		{name: "open as far as is looked", windows: allWeek, local: at(6, 3, 0), open: true},
+	}
+	for _, tt := range tests {
+		got := during(Status{}, tt.windows, tt.local, end)
+		if got.Open != tt.open {
+			t.Errorf("%s: open = %v, want %v", tt.name, got.Open, tt.open)
+		}
+		if (got.ClosesAt == nil) != tt.closesAt.IsZero() || (got.ClosesAt != nil && !got.ClosesAt.Equal(tt.closesAt)) {
+			t.Errorf("%s: closes at %v, want %v", tt.name, got.ClosesAt, tt.closesAt)
+		}
+		if (got.OpensAt == nil) != tt.opensAt.IsZero() || (got.OpensAt != nil && !got.OpensAt.Equal(tt.opensAt)) {
+			t.Errorf("%s: opens at %v, want %v", tt.name, got.OpensAt, tt.opensAt)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package inventory
+
+import (
+	"easystore/models"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrNotReserved       = errors.New("stock is not reserved")
+)
+
+// Available returns the quantity of a varient that can still be sold
+func Available(tx *gorm.DB, varientId uint) (int, error) {
+	var available int
+	err := tx.Model(&models.Stock{}).
+		Select("COALESCE(SUM(quantity - reserved), 0)").
+		Where("varient_id = ?", varientId).
+		Scan(&available).Error
+	return available, err
+}
+
+// Decrement removes quantity units of a varient from stock. Stock split across rows is
+// taken from row to row, so what Available counts can be sold, and never below zero or into
+// the units reserved for orders.
+func Decrement(tx *gorm.DB, varientId uint, quantity int) error {
+	err := spread(tx, varientId, quantity, func(stock models.Stock) int {
+		return stock.Quantity - stock.Reserved
+	}, func(units int) map[string]interface{} {
+		return map[string]interface{}{"quantity": gorm.Expr("quantity - ?", units)}
+	})
+	if errors.Is(err, errNoRoom) {
+		return fmt.Errorf("%w for varient %d", ErrInsufficientStock, varientId)
+	}
+	return err
+}
+
+// Increment puts quantity units of a varient back into stock, creating the stock row
+// when the varient has never been stocked
+func Increment(tx *gorm.DB, varientId uint, quantity int) error {
+	var stock models.Stock
+	err := tx.Where("varient_id = ?", varientId).Order("id").First(&stock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.Stock{VarientId: varientId, Quantity: quantity}).Error
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Model(&stock).Update("quantity", gorm.Expr("quantity + ?", quantity)).Error
+}
+
+// WriteOff records quantity units of a varient that came back unsellable. They are kept
+// apart from the quantity on hand, creating the stock row when the varient has never been
+// stocked.
+func WriteOff(tx *gorm.DB, varientId uint, quantity int) error {
+	var stock models.Stock
+	err := tx.Where("varient_id = ?", varientId).Order("id").First(&stock).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return tx.Create(&models.Stock{VarientId: varientId, WrittenOff: quantity}).Error
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Model(&stock).Update("written_off", gorm.Expr("written_off + ?", quantity)).Error
+}
+
+// Reserve holds quantity units of a varient for an order so they can not be sold at the
+// counter until the order is delivered or released
+func Reserve(tx *gorm.DB, varientId uint, quantity int) error {
+	err := spread(tx, varientId, quantity, func(stock models.Stock) int {
+		return stock.Quantity - stock.Reserved
+	}, func(units int) map[string]interface{} {
+		return map[string]interface{}{"reserved": gorm.Expr("reserved + ?", units)}
+	})
+	if errors.Is(err, errNoRoom) {
+		return fmt.Errorf("%w for varient %d", ErrInsufficientStock, varientId)
+	}
+	return err
+}
+
+// Release gives reserved units back to the stock that can be sold
+func Release(tx *gorm.DB, varientId uint, quantity int) error {
+	return changeReserved(tx, varientId, quantity, func(units int) map[string]interface{} {
+		return map[string]interface{}{"reserved": gorm.Expr("reserved - ?", units)}
+	})
+}
+
+// Commit removes reserved units from stock once the order holding them is delivered
+func Commit(tx *gorm.DB, varientId uint, quantity int) error {
+	return changeReserved(tx, varientId, quantity, func(units int) map[string]interface{} {
+		return map[string]interface{}{
+			"reserved": gorm.Expr("reserved - ?", units),
+			"quantity": gorm.Expr("quantity - ?", units),
+		}
+	})
+}
+
+func changeReserved(tx *gorm.DB, varientId uint, quantity int, updates func(units int) map[string]interface{}) error {
+	err := spread(tx, varientId, quantity, func(stock models.Stock) int {
+		return min(stock.Reserved, stock.Quantity)
+	}, updates)
+	if errors.Is(err, errNoRoom) {
+		return fmt.Errorf("%w for varient %d", ErrNotReserved, varientId)
+	}
+	return err
+}
+
+// errNoRoom is returned by spread when the stock rows can not take the whole quantity
+var errNoRoom = errors.New("no room in stock")
+
+// spread applies quantity units to the stock rows of a varient, oldest first, each row
+// taking as many as room allows. The rows stay locked until the surrounding transaction
+// ends, so concurrent changes wait instead of working on the same units. Nothing changes
+// when the rows together have no room for the whole quantity.
+func spread(tx *gorm.DB, varientId uint, quantity int, room func(stock models.Stock) int, updates func(units int) map[string]interface{}) error {
+	var stocks []models.Stock
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("varient_id = ?", varientId).Order("id").Find(&stocks).Error
+	if err != nil {
+		return err
+	}
+
+	total := 0
+	for _, stock := range stocks {
+		total += max(room(stock), 0)
+	}
+	if total < quantity {
+		return errNoRoom
+	}
+
+	remaining := quantity
+	for _, stock := range stocks {
+		units := min(max(room(stock), 0), remaining)
+		if units == 0 {
+			continue
+		}
+		if err := tx.Model(&stock).Updates(updates(units)).Error; err != nil {
+			return err
+		}
+		remaining -= units
+		if remaining == 0 {
+			break
+		}
+	}
+	return nil
+}
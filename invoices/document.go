@@ -0,0 +1,79 @@
+package invoices
+
+import (
+	"easystore/models"
+	"easystore/tax"
+
+	"gorm.io/gorm"
+)
+
+// Line is a line as printed on an invoice
+type Line struct {
+	Name      string       `json:"name"`
+	UnitPrice models.Money `json:"unit_price"`
+	tax.Breakdown
+}
+
+// Document is everything printed on an invoice or credit note
+type Document struct {
+	Invoice   models.Invoice   `json:"invoice"`
+	Original  *models.Invoice  `json:"original,omitempty"`
+	Lines     []Line           `json:"lines"`
+	Hsn       []tax.HsnSummary `json:"hsn"`
+	Duplicate bool             `json:"duplicate"`
+}
+
+// Load reads the lines of an invoice from its sale, order or return, and the invoice a
+// credit note was issued against
+func Load(tx *gorm.DB, invoice models.Invoice) (Document, error) {
+	document := Document{Invoice: invoice}
+	interstate := tax.IsInterstate(invoice.SellerState, invoice.PlaceOfSupply)
+
+	switch {
+	case invoice.SaleId != nil:
+		var lines []models.SaleLine
+		if err := tx.Where("sale_id = ?", *invoice.SaleId).Order("id").Find(&lines).Error; err != nil {
+			return document, err
+		}
+		for _, line := range lines {
+			document.add(line.Name, line.UnitPrice, tax.Breakdown{HsnCode: line.HsnCode, Quantity: line.Quantity, GstRate: line.GstRate, CessRate: line.CessRate, TaxableValue: line.TaxableValue, Cgst: line.Cgst, Sgst: line.Sgst, Igst: line.Igst, Cess: line.Cess, Total: line.Total}, interstate)
+		}
+	case invoice.OrderId != nil:
+		var lines []models.OrderLine
+		if err := tx.Where("order_id = ?", *invoice.OrderId).Order("id").Find(&lines).Error; err != nil {
+			return document, err
+		}
+		for _, line := range lines {
+			document.add(line.Name, line.UnitPrice, tax.Breakdown{HsnCode: line.HsnCode, Quantity: line.Quantity, GstRate: line.GstRate, CessRate: line.CessRate, TaxableValue: line.TaxableValue, Cgst: line.Cgst, Sgst: line.Sgst, Igst: line.Igst, Cess: line.Cess, Total: line.Total}, interstate)
+		}
+	case invoice.ReturnId != nil:
+		var lines []models.ReturnLine
+		if err := tx.Where("return_id = ?", *invoice.ReturnId).Order("id").Find(&lines).Error; err != nil {
+			return document, err
+		}
+		for _, line := range lines {
+			document.add(line.Name, line.UnitPrice, tax.Breakdown{HsnCode: line.HsnCode, Quantity: line.Quantity, GstRate: line.GstRate, CessRate: line.CessRate, TaxableValue: line.TaxableValue, Cgst: line.Cgst, Sgst: line.Sgst, Igst: line.Igst, Cess: line.Cess, Total: line.Total}, interstate)
+		}
+	}
+
+	if invoice.InvoiceId != nil {
+		var original models.Invoice
+		if err := tx.First(&original, *invoice.InvoiceId).Error; err != nil {
+			return document, err
+		}
+		document.Original = &original
+	}
+
+	breakdowns := make([]tax.Breakdown, 0, len(document.Lines))
+	for _, line := range document.Lines {
+		breakdowns = append(breakdowns, line.Breakdown)
+	}
+	document.Hsn = tax.SummarizeByHsn(breakdowns)
+	return document, nil
+}
+
+func (d *Document) add(name string, unitPrice models.Money, breakdown tax.Breakdown, interstate bool) {
+	breakdown.Interstate = interstate
+	breakdown.TotalTax = breakdown.Cgst + breakdown.Sgst + breakdown.Igst + breakdown.Cess
+	d.Lines = append(d.Lines, Line{Name: name, UnitPrice: unitPrice, Breakdown: breakdown})
+}
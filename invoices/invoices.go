@@ -0,0 +1,231 @@
+package invoices
+
+import (
+	"easystore/hours"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoSource      = errors.New("Give one of sale_id, order_id or return_id")
+	ErrNotDelivered  = errors.New("Orders are invoiced once they are delivered")
+	ErrNumberTooLong = errors.New("Invoice number would be longer than the 16 characters GST allows")
+)
+
+// maxNumberLength is the longest invoice number GST allows
+const maxNumberLength = 16
+
+// FinancialYear returns the Indian financial year, April to March, a time falls in, such
+// as "2025-26"
+func FinancialYear(t time.Time) string {
+	t = t.In(hours.Default)
+	year := t.Year()
+	if t.Month() < time.April {
+		year--
+	}
+	return fmt.Sprintf("%d-%02d", year, (year+1)%100)
+}
+
+// Number formats the number of an invoice, for example "INV3/25/42" for the 42nd invoice of
+// outlet 3 in 2025-26. GST allows at most 16 letters, digits, dashes and slashes, unique for
+// the financial year, so the outlet is written in base 36 and the year by its first half.
+// Numbers that would still be longer are refused.
+func Number(invoiceType string, outletId uint, financialYear string, sequence int) (string, error) {
+	prefix := "INV"
+	if invoiceType == models.InvoiceCreditNote {
+		prefix = "CN"
+	}
+	outlet := strings.ToUpper(strconv.FormatUint(uint64(outletId), 36))
+	number := fmt.Sprintf("%s%s/%s/%d", prefix, outlet, financialYear[2:4], sequence)
+	if len(number) > maxNumberLength {
+		return "", fmt.Errorf("%w: %s", ErrNumberTooLong, number)
+	}
+	return number, nil
+}
+
+// IssueSale issues the tax invoice of a sale, or returns the one already issued
+func IssueSale(tx *gorm.DB, sale models.Sale) (models.Invoice, error) {
+	invoice := models.Invoice{
+		OutletId:     sale.OutletId,
+		Type:         models.InvoiceTax,
+		SaleId:       &sale.ID,
+		TaxableValue: sale.TaxableValue,
+		Cgst:         sale.Cgst,
+		Sgst:         sale.Sgst,
+		Igst:         sale.Igst,
+		Cess:         sale.Cess,
+		TotalTax:     sale.TotalTax,
+		RoundOff:     sale.RoundOff,
+		Total:        sale.Total + sale.RoundOff,
+	}
+	if sale.CustomerId != nil {
+		var customer models.Customer
+		if err := tx.Unscoped().First(&customer, *sale.CustomerId).Error; err != nil {
+			return invoice, err
+		}
+		invoice.BuyerName = customer.Name
+		invoice.BuyerPhone = customer.Phone
+	}
+	return issue(tx, invoice, "sale_id", sale.ID)
+}
+
+// IssueOrder issues the tax invoice of a delivered order, or returns the one already issued.
+// The caller makes sure the order was delivered.
+func IssueOrder(tx *gorm.DB, order models.Order) (models.Invoice, error) {
+	var customer models.Customer
+	if err := tx.Unscoped().First(&customer, order.CustomerId).Error; err != nil {
+		return models.Invoice{}, err
+	}
+	address := []string{order.AddressLine1}
+	if order.AddressLine2 != "" {
+		address = append(address, order.AddressLine2)
+	}
+	address = append(address, order.City, order.State+" - "+order.Pincode)
+
+	invoice := models.Invoice{
+		OutletId:      order.OutletId,
+		Type:          models.InvoiceTax,
+		OrderId:       &order.ID,
+		BuyerName:     customer.Name,
+		BuyerPhone:    customer.Phone,
+		BuyerAddress:  strings.Join(address, ", "),
+		PlaceOfSupply: order.PlaceOfSupply,
+		TaxableValue:  order.TaxableValue,
+		Cgst:          order.Cgst,
+		Sgst:          order.Sgst,
+		Igst:          order.Igst,
+		Cess:          order.Cess,
+		TotalTax:      order.TotalTax,
+		Total:         order.Total,
+	}
+	return issue(tx, invoice, "order_id", order.ID)
+}
+
+// IssueCreditNote issues the credit note of a return against the invoice of the sale or
+// order it came from, issuing that invoice first if it has none
+func IssueCreditNote(tx *gorm.DB, ret models.Return) (models.Invoice, error) {
+	var original models.Invoice
+	var err error
+	if ret.SaleId != nil {
+		var sale models.Sale
+		if err := tx.First(&sale, *ret.SaleId).Error; err != nil {
+			return original, err
+		}
+		original, err = IssueSale(tx, sale)
+	} else if ret.OrderId != nil {
+		var order models.Order
+		if err := tx.First(&order, *ret.OrderId).Error; err != nil {
+			return original, err
+		}
+		original, err = IssueOrder(tx, order)
+	} else {
+		err = ErrNoSource
+	}
+	if err != nil {
+		return original, err
+	}
+
+	invoice := models.Invoice{
+		OutletId:      ret.OutletId,
+		Type:          models.InvoiceCreditNote,
+		ReturnId:      &ret.ID,
+		InvoiceId:     &original.ID,
+		BuyerName:     original.BuyerName,
+		BuyerPhone:    original.BuyerPhone,
+		BuyerAddress:  original.BuyerAddress,
+		PlaceOfSupply: original.PlaceOfSupply,
+		TaxableValue:  ret.TaxableValue,
+		Cgst:          ret.Cgst,
+		Sgst:          ret.Sgst,
+		Igst:          ret.Igst,
+		Cess:          ret.Cess,
+		TotalTax:      ret.TotalTax,
+		Total:         ret.Total,
+	}
+	return issue(tx, invoice, "return_id", ret.ID)
+}
+
+// Print records a download of an invoice and returns the document to print. The invoice row
+// is locked so only one of two downloads at the same time is the original.
+func Print(tx *gorm.DB, outletId uint, invoiceId uint, employeeId *uint) (Document, error) {
+	var document Document
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var invoice models.Invoice
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outletId).First(&invoice, invoiceId).Error
+		if err != nil {
+			return err
+		}
+
+		var prints int64
+		if err := tx.Model(&models.InvoicePrint{}).Where("invoice_id = ?", invoice.ID).Count(&prints).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.InvoicePrint{InvoiceId: invoice.ID, EmployeeId: employeeId}).Error; err != nil {
+			return err
+		}
+
+		document, err = Load(tx, invoice)
+		document.Duplicate = prints > 0
+		return err
+	})
+	return document, err
+}
+
+func IsInvoiceError(err error) bool {
+	return errors.Is(err, ErrNoSource) || errors.Is(err, ErrNotDelivered)
+}
+
+// issue numbers and saves an invoice unless the source already has one. Invoices of a
+// series are issued one at a time, so the check for an existing invoice and the next
+// number both see every invoice committed before.
+func issue(tx *gorm.DB, invoice models.Invoice, column string, sourceId uint) (models.Invoice, error) {
+	var outlet models.Outlet
+	if err := tx.First(&outlet, invoice.OutletId).Error; err != nil {
+		return invoice, err
+	}
+
+	invoice.IssuedAt = time.Now()
+	invoice.FinancialYear = FinancialYear(invoice.IssuedAt)
+	lockKey := fmt.Sprintf("invoice:%d:%s:%s", invoice.OutletId, invoice.Type, invoice.FinancialYear)
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", lockKey).Error; err != nil {
+		return invoice, err
+	}
+
+	var existing models.Invoice
+	found := tx.Where(column+" = ?", sourceId).Limit(1).Find(&existing)
+	if found.Error != nil {
+		return invoice, found.Error
+	}
+	if found.RowsAffected > 0 {
+		return existing, nil
+	}
+
+	err := tx.Raw(`INSERT INTO invoice_series (outlet_id, type, financial_year, last_number) VALUES (?, ?, ?, 1)
+		ON CONFLICT (outlet_id, type, financial_year) DO UPDATE SET last_number = invoice_series.last_number + 1
+		RETURNING last_number`, invoice.OutletId, invoice.Type, invoice.FinancialYear).Scan(&invoice.Sequence).Error
+	if err != nil {
+		return invoice, err
+	}
+	invoice.Number, err = Number(invoice.Type, invoice.OutletId, invoice.FinancialYear, invoice.Sequence)
+	if err != nil {
+		return invoice, err
+	}
+
+	invoice.SellerName = outlet.Name
+	invoice.SellerAddress = outlet.Location
+	invoice.SellerGstin = outlet.Gstin
+	invoice.SellerState = outlet.StateCode
+	if invoice.PlaceOfSupply == "" {
+		invoice.PlaceOfSupply = outlet.StateCode
+	}
+
+	err = tx.Omit("Outlet", "Prints").Create(&invoice).Error
+	return invoice, err
+}
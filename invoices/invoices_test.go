@@ -0,0 +1,61 @@
+package invoices
+
+import (
+	"easystore/models"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFinancialYear(t *testing.T) {
+	ist := time.FixedZone("IST", 5*60*60+30*60)
+	tests := []struct {
+		at   time.Time
+		want string
+	}{
+		{time.Date(2025, time.March, 31, 23, 59, 59, 0, ist), "2024-25"},
+		{time.Date(2025, time.April, 1, 0, 0, 0, 0, ist), "2025-26"},
+		{time.Date(2025, time.December, 31, 12, 0, 0, 0, ist), "2025-26"},
+		{time.Date(2026, time.January, 1, 0, 0, 0, 0, ist), "2025-26"},
+		// 18:30 UTC on 31 March is already 1 April in India
+		{time.Date(2025, time.March, 31, 18, 30, 0, 0, time.UTC), "2025-26"},
+		{time.Date(2025, time.March, 31, 18, 29, 59, 0, time.UTC), "2024-25"},
+		{time.Date(2099, time.June, 1, 0, 0, 0, 0, ist), "2099-00"},
+	}
+	for _, tt := range tests {
+		if got := FinancialYear(tt.at); got != tt.want {
+			t.Errorf("FinancialYear(%s) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
+
+func TestNumber(t *testing.T) {
+	tests := []struct {
+		invoiceType string
+		outletId    uint
+		sequence    int
+		want        string
+		err         bool
+	}{
+		{invoiceType: models.InvoiceTax, outletId: 3, sequence: 42, want: "INV3/25/42"},
+		{invoiceType: models.InvoiceCreditNote, outletId: 3, sequence: 7, want: "CN3/25/7"},
+		{invoiceType: models.InvoiceTax, outletId: 12345, sequence: 123456, want: "INV9IX/25/123456"},
+		{invoiceType: models.InvoiceCreditNote, outletId: 1679615, sequence: 99999, want: "CNZZZZ/25/99999"},
+		{invoiceType: models.InvoiceTax, outletId: 12345, sequence: 1234567, err: true},
+	}
+	for _, tt := range tests {
+		got, err := Number(tt.invoiceType, tt.outletId, "2025-26", tt.sequence)
+		if tt.err {
+			if !errors.Is(err, ErrNumberTooLong) {
+				t.Errorf("Number(%s, %d, %d) error = %v, want ErrNumberTooLong", tt.invoiceType, tt.outletId, tt.sequence, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Number(%s, %d, %d) = %q, %v, want %q", tt.invoiceType, tt.outletId, tt.sequence, got, err, tt.want)
+		}
+		if len(got) > maxNumberLength {
+			t.Errorf("Number(%s, %d, %d) = %q is longer than %d", tt.invoiceType, tt.outletId, tt.sequence, got, maxNumberLength)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package invoices
+
+import (
+	"easystore/hours"
+	"easystore/models"
+	"easystore/tax"
+	"fmt"
+	"io"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+const (
+	pageMargin = 10.0
+	pageWidth  = 190.0
+	rowHeight  = 6.0
+	dateLayout = "02-01-2006"
+)
+
+// Amounts are printed without a symbol, the core PDF fonts have no rupee sign
+var printCurrency = models.Currency{Code: "INR", IndianGrouping: true}
+
+type column struct {
+	title string
+	width float64
+	align string
+}
+
+var lineColumns = []column{
+	{"#", 8, "C"}, {"Description", 54, "L"}, {"HSN/SAC", 18, "C"}, {"Qty", 12, "R"}, {"Rate", 20, "R"},
+	{"Taxable", 22, "R"}, {"GST %", 12, "R"}, {"Tax", 22, "R"}, {"Amount", 22, "R"},
+}
+
+var hsnColumns = []column{
+	{"HSN/SAC", 24, "C"}, {"Qty", 14, "R"}, {"Taxable", 28, "R"}, {"GST %", 14, "R"}, {"CGST", 22, "R"},
+	{"SGST", 22, "R"}, {"IGST", 22, "R"}, {"Cess", 20, "R"}, {"Total Tax", 24, "R"},
+}
+
+// Render writes the document as an A4 PDF
+func Render(document Document, w io.Writer) error {
+	invoice := document.Invoice
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(pageMargin, pageMargin, pageMargin)
+	pdf.SetAutoPageBreak(true, pageMargin)
+	pdf.SetTitle(invoice.Number, true)
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.AddPage()
+
+	title := "TAX INVOICE"
+	if invoice.Type == models.InvoiceCreditNote {
+		title = "CREDIT NOTE"
+	}
+	copyLabel := "ORIGINAL FOR RECIPIENT"
+	if document.Duplicate {
+		copyLabel = "DUPLICATE"
+	}
+	pdf.SetFont("Helvetica", "B", 14)
+	pdf.CellFormat(pageWidth, 8, title, "", 1, "C", false, 0, "")
+	pdf.SetFont("Helvetica", "", 8)
+	pdf.CellFormat(pageWidth, 4, copyLabel, "", 1, "R", false, 0, "")
+	pdf.Ln(2)
+
+	// Seller on the left, invoice details on the right
+	top := pdf.GetY()
+	pdf.SetFont("Helvetica", "B", 11)
+	pdf.CellFormat(110, 6, translate(invoice.SellerName), "", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(110, 5, translate(invoice.SellerAddress), "", "L", false)
+	gstin := invoice.SellerGstin
+	if gstin == "" {
+		gstin = "Unregistered"
+	}
+	pdf.CellFormat(110, 5, "GSTIN: "+gstin, "", 1, "L", false, 0, "")
+	pdf.CellFormat(110, 5, "State: "+stateLabel(invoice.SellerState), "", 1, "L", false, 0, "")
+	sellerBottom := pdf.GetY()
+
+	numberLabel := "Invoice No"
+	if invoice.Type == models.InvoiceCreditNote {
+		numberLabel = "Credit Note No"
+	}
+	details := [][2]string{
+		{numberLabel, invoice.Number},
+		{"Date", invoice.IssuedAt.In(hours.Default).Format(dateLayout)},
+	}
+	if document.Original != nil {
+		details = append(details,
+			[2]string{"Against Invoice", document.Original.Number},
+			[2]string{"Invoice Date", document.Original.IssuedAt.In(hours.Default).Format(dateLayout)})
+	}
+	pdf.SetXY(pageMargin+110, top)
+	for _, detail := range details {
+		pdf.SetX(pageMargin + 110)
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(30, 5, detail[0]+":", "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.CellFormat(50, 5, detail[1], "", 1, "L", false, 0, "")
+	}
+	if pdf.GetY() < sellerBottom {
+		pdf.SetY(sellerBottom)
+	}
+	pdf.Ln(3)
+
+	// Buyer
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(pageWidth, 5, "Bill To", "T", 1, "L", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	buyer := invoice.BuyerName
+	if buyer == "" {
+		buyer = "Walk-in customer"
+	}
+	pdf.CellFormat(pageWidth, 5, translate(buyer), "", 1, "L", false, 0, "")
+	if invoice.BuyerPhone != "" {
+		pdf.CellFormat(pageWidth, 5, "Phone: "+invoice.BuyerPhone, "", 1, "L", false, 0, "")
+	}
+	if invoice.BuyerAddress != "" {
+		pdf.MultiCell(pageWidth, 5, translate(invoice.BuyerAddress), "", "L", false)
+	}
+	pdf.CellFormat(pageWidth, 5, "Place of Supply: "+stateLabel(invoice.PlaceOfSupply), "", 1, "L", false, 0, "")
+	pdf.Ln(3)
+
+	// Lines
+	header(pdf, lineColumns)
+	pdf.SetFont("Helvetica", "", 8)
+	for i, line := range document.Lines {
+		row(pdf, lineColumns, []string{
+			fmt.Sprint(i + 1),
+			fit(pdf, translate(line.Name), lineColumns[1].width-2),
+			line.HsnCode,
+			fmt.Sprint(line.Quantity),
+			amount(line.UnitPrice),
+			amount(line.TaxableValue),
+			rate(line.GstRate, line.CessRate),
+			amount(line.TotalTax),
+			amount(line.Total),
+		})
+	}
+	pdf.Ln(2)
+
+	// Totals
+	totals := [][2]string{{"Taxable Value", amount(invoice.TaxableValue)}}
+	if invoice.Igst != 0 {
+		totals = append(totals, [2]string{"IGST", amount(invoice.Igst)})
+	} else {
+		totals = append(totals, [2]string{"CGST", amount(invoice.Cgst)}, [2]string{"SGST", amount(invoice.Sgst)})
+	}
+	if invoice.Cess != 0 {
+		totals = append(totals, [2]string{"Cess", amount(invoice.Cess)})
+	}
+	if invoice.RoundOff != 0 {
+		totals = append(totals, [2]string{"Round Off", amount(invoice.RoundOff)})
+	}
+	for _, total := range totals {
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(pageWidth-40, 5, total[0], "", 0, "R", false, 0, "")
+		pdf.CellFormat(40, 5, total[1], "", 1, "R", false, 0, "")
+	}
+	pdf.SetFont("Helvetica", "B", 10)
+	pdf.CellFormat(pageWidth-40, 7, "Total (INR)", "T", 0, "R", false, 0, "")
+	pdf.CellFormat(40, 7, amount(invoice.Total), "T", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.MultiCell(pageWidth, 5, "Amount in words: "+AmountInWords(invoice.Total), "", "L", false)
+	pdf.Ln(3)
+
+	// HSN wise summary
+	pdf.SetFont("Helvetica", "B", 9)
+	pdf.CellFormat(pageWidth, 5, "HSN/SAC Summary", "", 1, "L", false, 0, "")
+	header(pdf, hsnColumns)
+	pdf.SetFont("Helvetica", "", 8)
+	for _, summary := range document.Hsn {
+		row(pdf, hsnColumns, []string{
+			summary.HsnCode,
+			fmt.Sprint(summary.Quantity),
+			amount(summary.TaxableValue),
+			fmt.Sprint(summary.GstRate),
+			amount(summary.Cgst),
+			amount(summary.Sgst),
+			amount(summary.Igst),
+			amount(summary.Cess),
+			amount(summary.TotalTax),
+		})
+	}
+	pdf.Ln(10)
+
+	pdf.SetFont("Helvetica", "", 9)
+	pdf.CellFormat(pageWidth, 5, translate("For "+invoice.SellerName), "", 1, "R", false, 0, "")
+	pdf.Ln(10)
+	pdf.CellFormat(pageWidth, 5, "Authorised Signatory", "", 1, "R", false, 0, "")
+	pdf.SetFont("Helvetica", "I", 7)
+	pdf.CellFormat(pageWidth, 5, "This is a computer generated document", "", 1, "C", false, 0, "")
+
+	return pdf.Output(w)
+}
+
+// Private methods
+
+func header(pdf *gofpdf.Fpdf, columns []column) {
+	pdf.SetFont("Helvetica", "B", 8)
+	pdf.SetFillColor(230, 230, 230)
+	for _, col := range columns {
+		pdf.CellFormat(col.width, rowHeight, col.title, "1", 0, col.align, true, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+func row(pdf *gofpdf.Fpdf, columns []column, values []string) {
+	for i, col := range columns {
+		pdf.CellFormat(col.width, rowHeight, values[i], "1", 0, col.align, false, 0, "")
+	}
+	pdf.Ln(-1)
+}
+
+// fit shortens text that would not fit in a column
+func fit(pdf *gofpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+func amount(m models.Money) string {
+	return m.Format(printCurrency)
+}
+
+func rate(gstRate int, cessRate int) string {
+	if cessRate > 0 {
+		return fmt.Sprintf("%d+%d", gstRate, cessRate)
+	}
+	return fmt.Sprint(gstRate)
+}
+
+func stateLabel(code string) string {
+	if code == "" {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%s)", tax.StateName(code), code)
+}
@@ -0,0 +1,68 @@
+package invoices
+
+import (
+	"easystore/models"
+	"strings"
+)
+
+var (
+	ones = []string{"", "One", "Two", "Three", "Four", "Five", "Six", "Seven", "Eight", "Nine", "Ten",
+		"Eleven", "Twelve", "Thirteen", "Fourteen", "Fifteen", "Sixteen", "Seventeen", "Eighteen", "Nineteen"}
+	tens = []string{"", "", "Twenty", "Thirty", "Forty", "Fifty", "Sixty", "Seventy", "Eighty", "Ninety"}
+)
+
+// AmountInWords spells out an amount the Indian way, in crores, lakhs and thousands, for
+// example "Rupees One Lakh Twenty Thousand and Fifty Paise Only"
+func AmountInWords(amount models.Money) string {
+	words := "Rupees "
+	if amount < 0 {
+		words = "Minus " + words
+		amount = -amount
+	}
+	rupees, paise := int64(amount)/100, int64(amount)%100
+
+	words += numberInWords(rupees)
+	if paise > 0 {
+		words += " and " + belowHundred(paise) + " Paise"
+	}
+	return words + " Only"
+}
+
+func numberInWords(n int64) string {
+	if n == 0 {
+		return "Zero"
+	}
+
+	var parts []string
+	if crores := n / 10000000; crores > 0 {
+		// Amounts of a hundred crores and more are read as a number of crores
+		parts = append(parts, numberInWords(crores), "Crore")
+		n %= 10000000
+	}
+	if lakhs := n / 100000; lakhs > 0 {
+		parts = append(parts, belowHundred(lakhs), "Lakh")
+		n %= 100000
+	}
+	if thousands := n / 1000; thousands > 0 {
+		parts = append(parts, belowHundred(thousands), "Thousand")
+		n %= 1000
+	}
+	if hundreds := n / 100; hundreds > 0 {
+		parts = append(parts, ones[hundreds], "Hundred")
+		n %= 100
+	}
+	if n > 0 {
+		parts = append(parts, belowHundred(n))
+	}
+	return strings.Join(parts, " ")
+}
+
+func belowHundred(n int64) string {
+	if n < 20 {
+		return ones[n]
+	}
+	if n%10 == 0 {
+		return tens[n/10]
+	}
+	return tens[n/10] + " " + ones[n%10]
+}
@@ -0,0 +1,30 @@
+package invoices
+
+import (
+	"easystore/models"
+	"testing"
+)
+
+func TestAmountInWords(t *testing.T) {
+	tests := []struct {
+		in   models.Money
+		want string
+	}{
+		{0, "Rupees Zero Only"},
+		{5, "Rupees Zero and Five Paise Only"},
+		{100, "Rupees One Only"},
+		{1950, "Rupees Nineteen and Fifty Paise Only"},
+		{10000, "Rupees One Hundred Only"},
+		{12345678, "Rupees One Lakh Twenty Three Thousand Four Hundred Fifty Six and Seventy Eight Paise Only"},
+		{12000050, "Rupees One Lakh Twenty Thousand and Fifty Paise Only"},
+		{10000000000, "Rupees Ten Crore Only"},
+		{1234567890, "Rupees One Crore Twenty Three Lakh Forty Five Thousand Six Hundred Seventy Eight and Ninety Paise Only"},
+		{1500000000000, "Rupees One Thousand Five Hundred Crore Only"},
+		{-2500, "Minus Rupees Twenty Five Only"},
+	}
+	for _, tt := range tests {
+		if got := AmountInWords(tt.in); got != tt.want {
+			t.Errorf("AmountInWords(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package loyalty
+
+import (
+	"easystore/customers"
+	"easystore/models"
+	"easystore/settings"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TierWindow is how far back the spend a tier is worked out from goes
+const TierWindow = 365 * 24 * time.Hour
+
+var (
+	ErrNoProgram          = errors.New("Outlet has no loyalty program")
+	ErrCustomerRequired   = errors.New("Loyalty points need a customer")
+	ErrInvalidPoints      = errors.New("Points should be positive")
+	ErrInsufficientPoints = errors.New("Customer does not have enough points")
+	ErrBelowMinimum       = errors.New("Fewer points than can be redeemed at once")
+	ErrRedeemCap          = errors.New("Points can not pay for this much of the total")
+	ErrInvalidRule        = errors.New("Loyalty rule is not valid")
+)
+
+// Source is the sale or order points move on. Exactly one of the two is set.
+type Source struct {
+	SaleId  *uint
+	OrderId *uint
+}
+
+// Account is the points of a customer as seen from an outlet
+type Account struct {
+	CustomerId   uint         `json:"customer_id"`
+	Balance      int          `json:"balance"`
+	Value        models.Money `json:"value"`
+	Tier         string       `json:"tier"`
+	Spend        models.Money `json:"spend"`
+	PointsPer100 int          `json:"points_per_100"`
+	// NextTier and SpendToNextTier are empty for gold customers
+	NextTier        string       `json:"next_tier,omitempty"`
+	SpendToNextTier models.Money `json:"spend_to_next_tier,omitempty"`
+	Expiring        []Lot        `json:"expiring"`
+}
+
+// Lot is what is left of points earned together, spent and expired first in, first out
+type Lot struct {
+	EntryId   uint       `json:"entry_id"`
+	Points    int        `json:"points"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Rule returns the active loyalty rule of the outlet, its own or else the one of its chain
+func Rule(tx *gorm.DB, outlet models.Outlet) (models.LoyaltyRule, error) {
+	var rules []models.LoyaltyRule
+	err := tx.Where("chain_id = ? AND (outlet_id = ? OR outlet_id IS NULL)", outlet.ChainId(), outlet.ID).
+		Order("outlet_id IS NULL").
+		Find(&rules).Error
+	if err != nil {
+		return models.LoyaltyRule{}, err
+	}
+	if len(rules) == 0 || !rules[0].Active {
+		return models.LoyaltyRule{}, ErrNoProgram
+	}
+	return rules[0], nil
+}
+
+// ValidateRule checks the rates, thresholds and limits of a rule
+func ValidateRule(rule models.LoyaltyRule) error {
+	if rule.PointsPer100 < 0 || rule.SilverPointsPer100 < rule.PointsPer100 || rule.GoldPointsPer100 < rule.SilverPointsPer100 {
+		return fmt.Errorf("%w: earn rates should not be negative and should not drop with the tier", ErrInvalidRule)
+	}
+	if rule.SilverSpend <= 0 || rule.GoldSpend <= rule.SilverSpend {
+		return fmt.Errorf("%w: gold spend should be more than silver spend, which should be positive", ErrInvalidRule)
+	}
+	if rule.PointValue <= 0 {
+		return fmt.Errorf("%w: point value should be positive", ErrInvalidRule)
+	}
+	if rule.MinRedeemPoints < 0 || rule.ExpiryDays < 0 {
+		return fmt.Errorf("%w: minimum points and expiry days should not be negative", ErrInvalidRule)
+	}
+	if rule.MaxRedeemPercent <= 0 || rule.MaxRedeemPercent > 100 {
+		return fmt.Errorf("%w: maximum redeem percent should be between 1 and 100", ErrInvalidRule)
+	}
+	return nil
+}
+
+// TierFor returns the tier a spend over the tier window reaches under the rule
+func TierFor(rule models.LoyaltyRule, spend models.Money) string {
+	switch {
+	case spend >= rule.GoldSpend:
+		return models.TierGold
+	case spend >= rule.SilverSpend:
+		return models.TierSilver
+	}
+	return models.TierMember
+}
+
+// Rate returns the points earned for every 100 rupees in a tier
+func Rate(rule models.LoyaltyRule, tier string) int {
+	switch tier {
+	case models.TierGold:
+		return rule.GoldPointsPer100
+	case models.TierSilver:
+		return rule.SilverPointsPer100
+	}
+	return rule.PointsPer100
+}
+
+// Balance returns the points of a customer, counting those of the customers merged into it
+func Balance(tx *gorm.DB, customerId uint) (int, error) {
+	ids, err := customers.HistoryIds(tx, customerId)
+	if err != nil {
+		return 0, err
+	}
+	var balance int
+	err = tx.Model(&models.LoyaltyEntry{}).Where("customer_id IN ?", ids).Select("COALESCE(SUM(points), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+// Spend returns what a customer paid for points over the tier window up to at
+func Spend(tx *gorm.DB, customerId uint, at time.Time) (models.Money, error) {
+	ids, err := customers.HistoryIds(tx, customerId)
+	if err != nil {
+		return 0, err
+	}
+	var spend models.Money
+	err = tx.Model(&models.LoyaltyEntry{}).
+		Where("customer_id IN ? AND created_at > ?", ids, at.Add(-TierWindow)).
+		Select("COALESCE(SUM(spend), 0)").
+		Scan(&spend).Error
+	return spend, err
+}
+
+// Get returns the balance, tier and expiring points of a customer under the rule of the
+// outlet
+func Get(tx *gorm.DB, outlet models.Outlet, customerId uint, at time.Time) (Account, error) {
+	account := Account{CustomerId: customerId, Expiring: []Lot{}}
+	rule, err := Rule(tx, outlet)
+	if err != nil {
+		return account, err
+	}
+
+	account.Balance, err = Balance(tx, customerId)
+	if err != nil {
+		return account, err
+	}
+	account.Value = rule.PointValue.Mul(account.Balance)
+	account.Spend, err = Spend(tx, customerId, at)
+	if err != nil {
+		return account, err
+	}
+	account.Tier = TierFor(rule, account.Spend)
+	account.PointsPer100 = Rate(rule, account.Tier)
+	switch account.Tier {
+	case models.TierMember:
+		account.NextTier, account.SpendToNextTier = models.TierSilver, rule.SilverSpend-account.Spend
+	case models.TierSilver:
+		account.NextTier, account.SpendToNextTier = models.TierGold, rule.GoldSpend-account.Spend
+	}
+
+	lots, err := remaining(tx, customerId)
+	if err != nil {
+		return account, err
+	}
+	for _, lot := range lots {
+		if lot.ExpiresAt != nil && lot.Points > 0 {
+			account.Expiring = append(account.Expiring, lot)
+		}
+	}
+	return account, nil
+}
+
+// Quote checks that a customer can pay with points towards total at the outlet and returns
+// what the points are worth
+func Quote(tx *gorm.DB, outlet models.Outlet, customerId uint, points int, total models.Money) (models.Money, error) {
+	rule, err := Rule(tx, outlet)
+	if err != nil {
+		return 0, err
+	}
+	if points <= 0 {
+		return 0, ErrInvalidPoints
+	}
+	if points < rule.MinRedeemPoints {
+		return 0, fmt.Errorf("%w: at least %d", ErrBelowMinimum, rule.MinRedeemPoints)
+	}
+	value := rule.PointValue.Mul(points)
+	if limit := total.Percent(int64(rule.MaxRedeemPercent) * 100); value > limit {
+		outletSettings, err := settings.Get(tx, outlet)
+		if err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("%w: up to %s", ErrRedeemCap, outletSettings.Format(limit))
+	}
+
+	balance, err := Balance(tx, customerId)
+	if err != nil {
+		return 0, err
+	}
+	if points > balance {
+		return 0, fmt.Errorf("%w: %d available", ErrInsufficientPoints, balance)
+	}
+	return value, nil
+}
+
+// Redeem spends points of a customer towards total on a sale or order. The points of the
+// customer stay locked until the transaction ends, so they can not be spent twice.
+func Redeem(tx *gorm.DB, outlet models.Outlet, customerId uint, points int, total models.Money, source Source) (models.LoyaltyEntry, error) {
+	entry := models.LoyaltyEntry{CustomerId: customerId, OutletId: outlet.ID, Type: models.LoyaltyRedeem, SaleId: source.SaleId, OrderId: source.OrderId}
+	if err := lock(tx, customerId); err != nil {
+		return entry, err
+	}
+	value, err := Quote(tx, outlet, customerId, points, total)
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Points = -points
+	entry.Value = -value
+	entry.Reason = "Spent " + source.describe()
+	err = tx.Create(&entry).Error
+	return entry, err
+}
+
+// Earn gives a customer points for what they paid on a sale or order at the rate of their
+// tier. What they paid counts towards their tier even when it earns no points. Outlets
+// without a loyalty program give no points.
+func Earn(tx *gorm.DB, outlet models.Outlet, customerId uint, paid models.Money, source Source, at time.Time) error {
+	rule, err := Rule(tx, outlet)
+	if errors.Is(err, ErrNoProgram) || paid <= 0 {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := lock(tx, customerId); err != nil {
+		return err
+	}
+
+	spend, err := Spend(tx, customerId, at)
+	if err != nil {
+		return err
+	}
+	tier := TierFor(rule, spend)
+	entry := models.LoyaltyEntry{
+		CustomerId: customerId,
+		OutletId:   outlet.ID,
+		Type:       models.LoyaltyEarn,
+		Points:     int(int64(paid) * int64(Rate(rule, tier)) / 10000),
+		Spend:      paid,
+		Tier:       tier,
+		SaleId:     source.SaleId,
+		OrderId:    source.OrderId,
+		Reason:     "Earned " + source.describe(),
+		CreatedAt:  at,
+	}
+	if rule.ExpiryDays > 0 {
+		expiresAt := at.AddDate(0, 0, rule.ExpiryDays)
+		entry.ExpiresAt = &expiresAt
+	}
+	return tx.Create(&entry).Error
+}
+
+// Return takes back the points earned on the goods of a return and gives back the points
+// spent on them, in proportion to the share of the sale or order returned so far. A customer
+// who has already spent the points earned on returned goods is left with a negative balance,
+// made up by the points they earn next. It returns what the points given back are worth,
+// which is not refunded in money.
+func Return(tx *gorm.DB, ret models.Return, sourceTotal models.Money) (models.LoyaltyEntry, error) {
+	restored := models.LoyaltyEntry{Type: models.LoyaltyRestore, OutletId: ret.OutletId, ReturnId: &ret.ID}
+	if ret.CustomerId == nil || sourceTotal <= 0 {
+		return restored, nil
+	}
+	if err := lock(tx, *ret.CustomerId); err != nil {
+		return restored, err
+	}
+
+	source := Source{SaleId: ret.SaleId, OrderId: ret.OrderId}
+	column, id := source.column()
+	var returned models.Money
+	err := tx.Model(&models.Return{}).Where(column+" = ?", id).Select("COALESCE(SUM(total), 0)").Scan(&returned).Error
+	if err != nil {
+		return restored, err
+	}
+
+	moved, err := movements(tx, source)
+	if err != nil {
+		return restored, err
+	}
+
+	// What should have been taken back once this return is counted, less what already was
+	points, _ := models.Money(moved[models.LoyaltyEarn].Points).Split(int64(returned), int64(sourceTotal))
+	spend, _ := moved[models.LoyaltyEarn].Spend.Split(int64(returned), int64(sourceTotal))
+	reverse := models.LoyaltyEntry{
+		CustomerId: *ret.CustomerId,
+		OutletId:   ret.OutletId,
+		Type:       models.LoyaltyReverse,
+		Points:     -(int(points) + moved[models.LoyaltyReverse].Points),
+		Spend:      -(spend + moved[models.LoyaltyReverse].Spend),
+		SaleId:     source.SaleId,
+		OrderId:    source.OrderId,
+		ReturnId:   &ret.ID,
+		Reason:     fmt.Sprintf("Taken back on return %d", ret.ID),
+	}
+	if reverse.Points != 0 || reverse.Spend != 0 {
+		if err := tx.Create(&reverse).Error; err != nil {
+			return restored, err
+		}
+	}
+
+	points, _ = models.Money(-moved[models.LoyaltyRedeem].Points).Split(int64(returned), int64(sourceTotal))
+	value, _ := (-moved[models.LoyaltyRedeem].Value).Split(int64(returned), int64(sourceTotal))
+	restored.CustomerId = *ret.CustomerId
+	restored.Points = int(points) - moved[models.LoyaltyRestore].Points
+	restored.Value = value - moved[models.LoyaltyRestore].Value
+	restored.SaleId, restored.OrderId = source.SaleId, source.OrderId
+	restored.Reason = fmt.Sprintf("Given back on return %d", ret.ID)
+	if restored.Points == 0 && restored.Value == 0 {
+		return restored, nil
+	}
+	err = tx.Create(&restored).Error
+	return restored, err
+}
+
+// Cancel gives back the points spent on an order that will not be delivered
+func Cancel(tx *gorm.DB, order models.Order) error {
+	if order.PointsRedeemed == 0 {
+		return nil
+	}
+	if err := lock(tx, order.CustomerId); err != nil {
+		return err
+	}
+	source := Source{OrderId: &order.ID}
+	moved, err := movements(tx, source)
+	if err != nil {
+		return err
+	}
+
+	entry := models.LoyaltyEntry{
+		CustomerId: order.CustomerId,
+		OutletId:   order.OutletId,
+		Type:       models.LoyaltyRestore,
+		Points:     -moved[models.LoyaltyRedeem].Points - moved[models.LoyaltyRestore].Points,
+		Value:      -moved[models.LoyaltyRedeem].Value - moved[models.LoyaltyRestore].Value,
+		OrderId:    &order.ID,
+		Reason:     fmt.Sprintf("Given back on order %d", order.ID),
+	}
+	if entry.Points == 0 {
+		return nil
+	}
+	return tx.Create(&entry).Error
+}
+
+// Expire records the expiry of what is left of the points due to expire by now, returning
+// how many lots expired
+func Expire(tx *gorm.DB, now time.Time) (int, error) {
+	var customerIds []uint
+	err := tx.Model(&models.LoyaltyEntry{}).
+		Where("type = ? AND expires_at <= ?", models.LoyaltyEarn, now).
+		Where("NOT EXISTS (SELECT 1 FROM loyalty_entries expired WHERE expired.entry_id = loyalty_entries.id AND expired.type = ?)", models.LoyaltyExpire).
+		Distinct("customer_id").
+		Pluck("customer_id", &customerIds).Error
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, customerId := range customerIds {
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			// Points of a merged customer are spent by the customer it was merged into
+			customerId, err := survivor(tx, customerId)
+			if err != nil {
+				return err
+			}
+			if err := lock(tx, customerId); err != nil {
+				return err
+			}
+			lots, err := remaining(tx, customerId)
+			if err != nil {
+				return err
+			}
+			for _, lot := range lots {
+				if lot.ExpiresAt == nil || lot.ExpiresAt.After(now) {
+					continue
+				}
+				var earned models.LoyaltyEntry
+				if err := tx.First(&earned, lot.EntryId).Error; err != nil {
+					return err
+				}
+				// Lots spent in full are closed with an empty entry, so they are not looked at again
+				entry := models.LoyaltyEntry{CustomerId: earned.CustomerId, OutletId: earned.OutletId, Type: models.LoyaltyExpire, Points: -lot.Points, EntryId: &lot.EntryId, Reason: fmt.Sprintf("Points earned on %s expired", earned.CreatedAt.Format("2006-01-02"))}
+				if err := tx.Create(&entry).Error; err != nil {
+					return err
+				}
+				expired++
+			}
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// IsLoyaltyError reports whether err was caused by the request rather than the server
+func IsLoyaltyError(err error) bool {
+	for _, loyaltyErr := range []error{ErrNoProgram, ErrCustomerRequired, ErrInvalidPoints, ErrInsufficientPoints, ErrBelowMinimum, ErrRedeemCap, ErrInvalidRule} {
+		if errors.Is(err, loyaltyErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Private methods
+
+// lock serialises the changes to the points of a customer until the transaction ends
+func lock(tx *gorm.DB, customerId uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("loyalty:%d", customerId)).Error
+}
+
+// survivor follows a merged customer to the customer it was merged into
+func survivor(tx *gorm.DB, customerId uint) (uint, error) {
+	for {
+		var customer models.Customer
+		if err := tx.Unscoped().First(&customer, customerId).Error; err != nil {
+			return 0, err
+		}
+		if customer.MergedIntoId == nil {
+			return customer.ID, nil
+		}
+		customerId = *customer.MergedIntoId
+	}
+}
+
+// movement is the points, spend and value moved on a sale or order by one kind of entry
+type movement struct {
+	Points int
+	Spend  models.Money
+	Value  models.Money
+}
+
+// movements adds up the entries of a sale or order by their kind
+func movements(tx *gorm.DB, source Source) (map[string]movement, error) {
+	column, id := source.column()
+	var rows []struct {
+		Type string
+		movement
+	}
+	err := tx.Model(&models.LoyaltyEntry{}).
+		Select("type, COALESCE(SUM(points), 0) AS points, COALESCE(SUM(spend), 0) AS spend, COALESCE(SUM(value), 0) AS value").
+		Where(column+" = ?", id).
+		Group("type").
+		Scan(&rows).Error
+	moved := map[string]movement{}
+	for _, row := range rows {
+		moved[row.Type] = row.movement
+	}
+	return moved, err
+}
+
+// remaining works out what is left of each lot of points of a customer. Lots are the
+// entries adding points, soonest to expire first, and everything taken away is taken from
+// them in that order.
+func remaining(tx *gorm.DB, customerId uint) ([]Lot, error) {
+	ids, err := customers.HistoryIds(tx, customerId)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.LoyaltyEntry
+	err = tx.Where("customer_id IN ?", ids).Order("expires_at NULLS LAST, id").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	taken := 0
+	for _, entry := range entries {
+		if entry.Points < 0 {
+			taken -= entry.Points
+		}
+	}
+	var lots []Lot
+	for _, entry := range entries {
+		if entry.Points <= 0 {
+			continue
+		}
+		left := entry.Points - taken
+		if left < 0 {
+			left = 0
+		}
+		taken -= entry.Points - left
+		if entry.Type == models.LoyaltyEarn && entry.ExpiresAt != nil && expiredLot(entries, entry.ID) {
+			continue
+		}
+		lots = append(lots, Lot{EntryId: entry.ID, Points: left, ExpiresAt: entry.ExpiresAt})
+	}
+	return lots, nil
+}
+
+// expiredLot reports whether the expiry of an earn entry has been recorded
+func expiredLot(entries []models.LoyaltyEntry, entryId uint) bool {
+	for _, entry := range entries {
+		if entry.Type == models.LoyaltyExpire && entry.EntryId != nil && *entry.EntryId == entryId {
+			return true
+		}
+	}
+	return false
+}
+
+// column returns the column of loyalty entries and returns pointing at the source
+func (s Source) column() (string, uint) {
+	if s.SaleId != nil {
+		return "sale_id", *s.SaleId
+	}
+	return "order_id", *s.OrderId
+}
+
+func (s Source) describe() string {
+	if s.SaleId != nil {
+		return fmt.Sprintf("on sale %d", *s.SaleId)
+	}
+	return fmt.Sprintf("on order %d", *s.OrderId)
+}
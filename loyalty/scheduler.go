@@ -0,0 +1,25 @@
+package loyalty
+
+import (
+	"easystore/db"
+	"log"
+	"time"
+)
+
+// RunExpiry expires the loyalty points due to expire every interval. It blocks, so run it
+// in its own goroutine.
+func RunExpiry(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired, err := Expire(db.DB, time.Now())
+		if err != nil {
+			log.Printf("Unable to expire loyalty points: %v", err)
+			continue
+		}
+		if expired > 0 {
+			log.Printf("Expired %d lots of loyalty points", expired)
+		}
+	}
+}
@@ -3,8 +3,15 @@ package main
 import (
 	"easystore/configs/env"
 	"easystore/db"
+	"easystore/loyalty"
+	"easystore/payments"
+	"easystore/pricing"
 	"easystore/routes"
+	"easystore/settings"
+	"easystore/tracking"
+	"log"
 	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,7 +31,33 @@ func main() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	if err := db.Migrate(); err != nil {
+		log.Fatal("Unable to migrate the database. Error: ", err)
+	}
+
+	if err := payments.Setup(); err != nil {
+		log.Fatal("Unable to set up payments. Error: ", err)
+	}
+
+	// Apply scheduled price changes as they become due
+	go pricing.RunScheduler(time.Minute)
+
+	// Request and send the refunds owed on online payments
+	go payments.RunRefunds(time.Minute)
+
+	// Expire loyalty points that were not spent in time
+	go loyalty.RunExpiry(time.Hour)
+
+	// Pass order events committed by any instance on to the tracking streams of this one
+	go tracking.Listen(os.Getenv("DB_DSN"))
+
+	// Drop cached outlet settings changed through any instance
+	go settings.Listen(os.Getenv("DB_DSN"))
+
 	r := gin.Default()
+	// Handlers pass the gin context on as the context of their queries, which must see the
+	// organization put on the request
+	r.ContextWithFallback = true
 
 	routes.Intiliaze(r)
 	r.Run(":8080")
@@ -1,12 +1,48 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrSellingPriceAboveMrp = errors.New("Selling price should not be more than the MRP")
 
 type ProductVarient struct {
 	gorm.Model
-	ProductId    uint    `json:"product_id" gorm:"not null"`
-	Product      Product `gorm:"foreignKey:ProductId"`
-	Name         string  `json:"name" gorm:"not null"`
-	SellingPrice float64 `json:"selling_price" gorm:"not null;type:decimal(10,2)"`
-	Mrp          float64 `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+	ProductId uint    `json:"product_id" gorm:"not null"`
+	Product   Product `gorm:"foreignKey:ProductId"`
+	// OutletId is the outlet of the product, kept on the varient so that an SKU is unique
+	// within an outlet. It is always taken from the product, never from a request.
+	OutletId     uint   `json:"-" gorm:"not null;default:0;uniqueIndex:idx_product_varients_outlet_sku,where:sku <> '' AND deleted_at IS NULL"`
+	Name         string `json:"name" gorm:"not null"`
+	Sku          string `json:"sku" gorm:"uniqueIndex:idx_product_varients_outlet_sku,where:sku <> '' AND deleted_at IS NULL"`
+	Barcode      string `json:"barcode" gorm:"index"`
+	SellingPrice Money  `json:"selling_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp          Money  `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+}
+
+// BeforeCreate sets the outlet of a varient to that of its product
+func (pv *ProductVarient) BeforeCreate(tx *gorm.DB) error {
+	if pv.ProductId == 0 {
+		return nil
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&Product{}).Where("id = ?", pv.ProductId).Select("outlet_id").Scan(&pv.OutletId).Error
+}
+
+// Validate checks the prices of the varient. Selling a packaged product above its
+// MRP is not allowed.
+func (pv *ProductVarient) Validate() error {
+	return ValidatePrice(pv.SellingPrice, pv.Mrp)
+}
+
+// ValidatePrice checks a selling price against the MRP it is sold under
+func ValidatePrice(sellingPrice Money, mrp Money) error {
+	if sellingPrice < 0 || mrp <= 0 {
+		return errors.New("Selling price and MRP should be positive amounts")
+	}
+	if sellingPrice > mrp {
+		return ErrSellingPriceAboveMrp
+	}
+	return nil
 }
@@ -0,0 +1,55 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	BillOpen      = "open"
+	BillFinalized = "finalized"
+	BillVoided    = "voided"
+)
+
+const (
+	TenderCash = "cash"
+	TenderCard = "card"
+	TenderUpi  = "upi"
+)
+
+// TenderMethods lists the tenders accepted at the counter
+var TenderMethods = []string{TenderCash, TenderCard, TenderUpi}
+
+// Bill is a sale in progress at the counter of an outlet. Once finalized it is turned
+// into an immutable Sale and can no longer be changed.
+type Bill struct {
+	gorm.Model
+	OutletId   uint          `json:"outlet_id" gorm:"not null;index"`
+	Outlet     Outlet        `json:"-" gorm:"foreignKey:OutletId"`
+	EmployeeId uint          `json:"employee_id" gorm:"not null"`
+	Employee   Employee      `json:"-" gorm:"foreignKey:EmployeeId"`
+	CustomerId *uint         `json:"customer_id" gorm:"index"`
+	Status     string        `json:"status" gorm:"not null"`
+	SaleId     *uint         `json:"sale_id"`
+	CouponCode string        `json:"coupon_code"`
+	Lines      []BillLine    `json:"lines" gorm:"foreignKey:BillId"`
+	Payments   []BillPayment `json:"payments" gorm:"foreignKey:BillId"`
+}
+
+type BillLine struct {
+	gorm.Model
+	BillId    uint           `json:"bill_id" gorm:"not null;index"`
+	VarientId uint           `json:"varient_id" gorm:"not null"`
+	Varient   ProductVarient `json:"varient" gorm:"foreignKey:VarientId"`
+	Quantity  int            `json:"quantity" gorm:"not null"`
+	UnitPrice Money          `json:"unit_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp       Money          `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+}
+
+// BillPayment is a tender collected against a bill. A bill can be split over several tenders.
+type BillPayment struct {
+	gorm.Model
+	BillId    uint   `json:"bill_id" gorm:"not null;index"`
+	Method    string `json:"method" gorm:"not null"`
+	Amount    Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	Reference string `json:"reference"`
+	// Points is how many loyalty points a loyalty points tender spends
+	Points int `json:"points" gorm:"not null;default:0"`
+}
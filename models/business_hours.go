@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTimezone is the time zone of outlets that do not set one
+const DefaultTimezone = "Asia/Kolkata"
+
+// OutletHours is a weekly window an outlet is open in. Times are minutes since midnight in
+// the time zone of the outlet. A day can have more than one window, and an outlet without
+// any windows is open around the clock.
+type OutletHours struct {
+	gorm.Model
+	OutletId    uint   `json:"outlet_id" gorm:"not null;index"`
+	Outlet      Outlet `json:"-" gorm:"foreignKey:OutletId"`
+	Weekday     int    `json:"weekday" gorm:"not null"`
+	OpenMinute  int    `json:"open_minute" gorm:"not null"`
+	CloseMinute int    `json:"close_minute" gorm:"not null"`
+}
+
+// OutletHoliday closes an outlet for a whole date, whatever its weekly hours
+type OutletHoliday struct {
+	gorm.Model
+	OutletId uint      `json:"outlet_id" gorm:"not null;uniqueIndex:idx_outlet_holiday_date"`
+	Outlet   Outlet    `json:"-" gorm:"foreignKey:OutletId"`
+	Date     time.Time `json:"date" gorm:"not null;type:date;uniqueIndex:idx_outlet_holiday_date"`
+	Name     string    `json:"name" gorm:"not null"`
+}
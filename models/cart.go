@@ -0,0 +1,35 @@
+package models
+
+import "gorm.io/gorm"
+
+const (
+	CartActive  = "active"
+	CartOrdered = "ordered"
+)
+
+// Cart is what a customer is about to order from an outlet. A customer has at most one
+// active cart per outlet, which is kept until it is ordered.
+type Cart struct {
+	gorm.Model
+	OutletId   uint       `json:"outlet_id" gorm:"not null;uniqueIndex:idx_cart_active_customer,where:status = 'active' AND deleted_at IS NULL"`
+	Outlet     Outlet     `json:"-" gorm:"foreignKey:OutletId"`
+	CustomerId uint       `json:"customer_id" gorm:"not null;uniqueIndex:idx_cart_active_customer,where:status = 'active' AND deleted_at IS NULL"`
+	Customer   Customer   `json:"-" gorm:"foreignKey:CustomerId"`
+	AddressId  *uint      `json:"address_id"`
+	Status     string     `json:"status" gorm:"not null"`
+	OrderId    *uint      `json:"order_id"`
+	CouponCode string     `json:"coupon_code"`
+	Lines      []CartLine `json:"lines,omitempty" gorm:"foreignKey:CartId"`
+}
+
+// CartLine is a varient in a cart with the price it was last seen at, so a change of
+// price can be pointed out before the cart is ordered
+type CartLine struct {
+	gorm.Model
+	CartId    uint           `json:"cart_id" gorm:"not null;index"`
+	VarientId uint           `json:"varient_id" gorm:"not null"`
+	Varient   ProductVarient `json:"-" gorm:"foreignKey:VarientId"`
+	Quantity  int            `json:"quantity" gorm:"not null"`
+	UnitPrice Money          `json:"unit_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp       Money          `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+}
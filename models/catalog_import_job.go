@@ -0,0 +1,26 @@
+package models
+
+import "gorm.io/gorm"
+
+// CatalogImportJob tracks the progress of a bulk product import running in the background
+type CatalogImportJob struct {
+	gorm.Model
+	OutletId      uint                 `json:"outlet_id" gorm:"not null"`
+	Outlet        Outlet               `json:"-" gorm:"foreignKey:OutletId"`
+	FileName      string               `json:"file_name" gorm:"not null"`
+	Status        string               `json:"status" gorm:"not null"`
+	TotalRows     int                  `json:"total_rows" gorm:"not null"`
+	ProcessedRows int                  `json:"processed_rows" gorm:"not null"`
+	CreatedRows   int                  `json:"created_rows" gorm:"not null"`
+	UpdatedRows   int                  `json:"updated_rows" gorm:"not null"`
+	FailedRows    int                  `json:"failed_rows" gorm:"not null"`
+	RowErrors     []CatalogImportError `json:"row_errors" gorm:"foreignKey:JobId"`
+}
+
+type CatalogImportError struct {
+	gorm.Model
+	JobId   uint   `json:"job_id" gorm:"not null;index"`
+	Line    int    `json:"row" gorm:"not null"`
+	Sku     string `json:"sku"`
+	Message string `json:"message" gorm:"not null"`
+}
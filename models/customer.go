@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Customer is a shopper identified by phone. Customers belong to a chain, the organization
+// of the outlets, and are shared by all of its outlets. A customer merged into
+// another one is soft deleted and keeps pointing at the customer that replaced it.
+type Customer struct {
+	gorm.Model
+	ChainId           uint              `json:"chain_id" gorm:"not null;uniqueIndex:idx_customer_chain_phone,where:deleted_at IS NULL"`
+	Chain             Organization      `json:"-" gorm:"foreignKey:ChainId"`
+	Phone             string            `json:"phone" gorm:"not null;size:10;uniqueIndex:idx_customer_chain_phone,where:deleted_at IS NULL"`
+	Name              string            `json:"name"`
+	Email             string            `json:"email"`
+	MarketingSms      bool              `json:"marketing_sms" gorm:"not null;default:false"`
+	MarketingEmail    bool              `json:"marketing_email" gorm:"not null;default:false"`
+	MarketingWhatsapp bool              `json:"marketing_whatsapp" gorm:"not null;default:false"`
+	ConsentUpdatedAt  *time.Time        `json:"consent_updated_at"`
+	MergedIntoId      *uint             `json:"merged_into_id" gorm:"index"`
+	Addresses         []CustomerAddress `json:"addresses" gorm:"foreignKey:CustomerId"`
+}
+
+type CustomerAddress struct {
+	gorm.Model
+	CustomerId uint   `json:"customer_id" gorm:"not null;index"`
+	Label      string `json:"label"`
+	Line1      string `json:"line1" gorm:"not null"`
+	Line2      string `json:"line2"`
+	City       string `json:"city" gorm:"not null"`
+	State      string `json:"state" gorm:"not null"`
+	Pincode    string `json:"pincode" gorm:"not null;size:6;index"`
+	IsDefault  bool   `json:"is_default" gorm:"not null;default:false"`
+}
+
+// ChainId returns the chain of the outlet, its organization, whose customers it shares
+func (o Outlet) ChainId() uint {
+	return o.OrganizationId
+}
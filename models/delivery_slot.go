@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DeliverySlotTemplate is a weekly delivery window of an outlet. Times are minutes since
+// midnight in the time zone of the outlet.
+type DeliverySlotTemplate struct {
+	gorm.Model
+	OutletId      uint   `json:"outlet_id" gorm:"not null;index"`
+	Outlet        Outlet `json:"-" gorm:"foreignKey:OutletId"`
+	Weekday       int    `json:"weekday" gorm:"not null"`
+	StartMinute   int    `json:"start_minute" gorm:"not null"`
+	EndMinute     int    `json:"end_minute" gorm:"not null"`
+	Capacity      int    `json:"capacity" gorm:"not null"`
+	CutoffMinutes int    `json:"cutoff_minutes" gorm:"not null;default:0"`
+	Active        bool   `json:"active" gorm:"not null;default:true"`
+}
+
+// DeliverySlotOverride changes the slots of an outlet on a single date, closing them for a
+// holiday or changing their capacity
+type DeliverySlotOverride struct {
+	gorm.Model
+	OutletId uint      `json:"outlet_id" gorm:"not null;uniqueIndex:idx_slot_override_date"`
+	Outlet   Outlet    `json:"-" gorm:"foreignKey:OutletId"`
+	Date     time.Time `json:"date" gorm:"not null;type:date;uniqueIndex:idx_slot_override_date"`
+	Closed   bool      `json:"closed" gorm:"not null;default:false"`
+	Capacity *int      `json:"capacity"`
+	Reason   string    `json:"reason"`
+}
+
+// DeliverySlot is a template window on a date. It is created by the first booking and
+// counts the orders booked into it.
+type DeliverySlot struct {
+	gorm.Model
+	OutletId    uint      `json:"outlet_id" gorm:"not null;uniqueIndex:idx_delivery_slot"`
+	TemplateId  uint      `json:"template_id" gorm:"not null;uniqueIndex:idx_delivery_slot"`
+	Date        time.Time `json:"date" gorm:"not null;type:date;uniqueIndex:idx_delivery_slot"`
+	StartMinute int       `json:"start_minute" gorm:"not null"`
+	EndMinute   int       `json:"end_minute" gorm:"not null"`
+	Capacity    int       `json:"capacity" gorm:"not null"`
+	Booked      int       `json:"booked" gorm:"not null;default:0"`
+}
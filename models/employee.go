@@ -7,11 +7,13 @@ import (
 
 type Employee struct {
 	gorm.Model
-	Name     string `json:"name" gorm:"not null"`
-	Phone    string `json:"phone" gorm:"not null;size:10;unique"`
-	Email    string `json:"email" gorm:"not null"`
-	Password string `json:"password" gorm:"not null"`
-	Status   string `json:"status" gorm:"not null"`
+	// OrganizationId is the chain the employee works for
+	OrganizationId uint   `json:"organization_id" gorm:"not null;default:0;index"`
+	Name           string `json:"name" gorm:"not null"`
+	Phone          string `json:"phone" gorm:"not null;size:10;unique"`
+	Email          string `json:"email" gorm:"not null"`
+	Password       string `json:"password" gorm:"not null"`
+	Status         string `json:"status" gorm:"not null"`
 }
 
 // HashPassword hashes the password of an employee
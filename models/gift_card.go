@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TenderGiftCard is a tender paid from the balance of a gift card
+const TenderGiftCard = "gift_card"
+
+const (
+	GiftCardActive  = "active"
+	GiftCardBlocked = "blocked"
+)
+
+// Kinds of movement of a gift card balance
+const (
+	GiftCardIssue  = "issue"
+	GiftCardRedeem = "redeem"
+	GiftCardRefund = "refund"
+)
+
+var ErrGiftCardEntryImmutable = errors.New("gift card entries can not be changed once recorded")
+
+// GiftCard is a prepaid card of a chain, spent in parts at any of its outlets and online.
+// The balance is the sum of its entries.
+type GiftCard struct {
+	gorm.Model
+	ChainId    uint            `json:"chain_id" gorm:"not null;index"`
+	OutletId   uint            `json:"outlet_id" gorm:"not null"`
+	Code       string          `json:"code" gorm:"not null;size:16;uniqueIndex"`
+	Amount     Money           `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	CustomerId *uint           `json:"customer_id" gorm:"index"`
+	ExpiresAt  *time.Time      `json:"expires_at"`
+	Status     string          `json:"status" gorm:"not null"`
+	Entries    []GiftCardEntry `json:"entries,omitempty" gorm:"foreignKey:GiftCardId"`
+}
+
+// GiftCardEntry is a movement of the balance of a gift card, positive when it is issued or
+// refunded to and negative when it is spent
+type GiftCardEntry struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	GiftCardId uint      `json:"gift_card_id" gorm:"not null;index"`
+	OutletId   uint      `json:"outlet_id" gorm:"not null"`
+	Type       string    `json:"type" gorm:"not null"`
+	Amount     Money     `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	SaleId     *uint     `json:"sale_id" gorm:"index"`
+	OrderId    *uint     `json:"order_id" gorm:"index"`
+	ReturnId   *uint     `json:"return_id" gorm:"index"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (gce *GiftCardEntry) BeforeUpdate(tx *gorm.DB) error { return ErrGiftCardEntryImmutable }
+func (gce *GiftCardEntry) BeforeDelete(tx *gorm.DB) error { return ErrGiftCardEntryImmutable }
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invoice series
+const (
+	InvoiceTax        = "invoice"
+	InvoiceCreditNote = "credit_note"
+)
+
+var ErrInvoiceImmutable = errors.New("invoices can not be changed once issued")
+
+// InvoiceSeries holds the last number issued in a series of an outlet for a financial year.
+// Numbers are taken from it in the transaction that records the invoice, so a number is
+// only used up when its invoice is saved and the series has no gaps.
+type InvoiceSeries struct {
+	ID            uint   `json:"id" gorm:"primarykey"`
+	OutletId      uint   `json:"outlet_id" gorm:"not null;uniqueIndex:idx_invoice_series"`
+	Type          string `json:"type" gorm:"not null;uniqueIndex:idx_invoice_series"`
+	FinancialYear string `json:"financial_year" gorm:"not null;size:7;uniqueIndex:idx_invoice_series"`
+	LastNumber    int    `json:"last_number" gorm:"not null"`
+}
+
+// Invoice is the tax invoice of a sale or a delivered order, or the credit note of a
+// return. The seller and buyer are copied in when it is issued so a reprint shows them as
+// they were, and the lines are read from the sale, order or return, which never change.
+// Total is what the buyer paid, including the round off of the sale.
+type Invoice struct {
+	gorm.Model
+	OutletId      uint           `json:"outlet_id" gorm:"not null;index;uniqueIndex:idx_invoice_number"`
+	Outlet        Outlet         `json:"-" gorm:"foreignKey:OutletId"`
+	Type          string         `json:"type" gorm:"not null;uniqueIndex:idx_invoice_number"`
+	FinancialYear string         `json:"financial_year" gorm:"not null;size:7;uniqueIndex:idx_invoice_number"`
+	Sequence      int            `json:"sequence" gorm:"not null;uniqueIndex:idx_invoice_number"`
+	Number        string         `json:"number" gorm:"not null;size:16"`
+	SaleId        *uint          `json:"sale_id" gorm:"uniqueIndex"`
+	OrderId       *uint          `json:"order_id" gorm:"uniqueIndex"`
+	ReturnId      *uint          `json:"return_id" gorm:"uniqueIndex"`
+	InvoiceId     *uint          `json:"invoice_id" gorm:"index"`
+	SellerName    string         `json:"seller_name" gorm:"not null"`
+	SellerAddress string         `json:"seller_address" gorm:"not null"`
+	SellerGstin   string         `json:"seller_gstin" gorm:"size:15"`
+	SellerState   string         `json:"seller_state" gorm:"size:2"`
+	BuyerName     string         `json:"buyer_name"`
+	BuyerPhone    string         `json:"buyer_phone"`
+	BuyerAddress  string         `json:"buyer_address"`
+	PlaceOfSupply string         `json:"place_of_supply" gorm:"size:2"`
+	TaxableValue  Money          `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst          Money          `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst          Money          `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst          Money          `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess          Money          `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	TotalTax      Money          `json:"total_tax" gorm:"not null;type:decimal(10,2)"`
+	RoundOff      Money          `json:"round_off" gorm:"not null;type:decimal(10,2);default:0"`
+	Total         Money          `json:"total" gorm:"not null;type:decimal(10,2)"`
+	IssuedAt      time.Time      `json:"issued_at" gorm:"not null"`
+	Prints        []InvoicePrint `json:"prints,omitempty" gorm:"foreignKey:InvoiceId"`
+}
+
+// InvoicePrint is a download of an invoice. Every print after the first is a duplicate.
+type InvoicePrint struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	InvoiceId  uint      `json:"invoice_id" gorm:"not null;index"`
+	EmployeeId *uint     `json:"employee_id"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (i *Invoice) BeforeUpdate(tx *gorm.DB) error       { return ErrInvoiceImmutable }
+func (i *Invoice) BeforeDelete(tx *gorm.DB) error       { return ErrInvoiceImmutable }
+func (ip *InvoicePrint) BeforeUpdate(tx *gorm.DB) error { return ErrInvoiceImmutable }
+func (ip *InvoicePrint) BeforeDelete(tx *gorm.DB) error { return ErrInvoiceImmutable }
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TenderLoyaltyPoints is a tender paid with loyalty points. It is added through the loyalty
+// endpoints, never as a counter tender.
+const TenderLoyaltyPoints = "loyalty_points"
+
+// Loyalty tiers, from the rolling spend of a customer
+const (
+	TierMember = "member"
+	TierSilver = "silver"
+	TierGold   = "gold"
+)
+
+// Kinds of movement in the points ledger
+const (
+	// LoyaltyEarn is points earned on a sale or a delivered order
+	LoyaltyEarn = "earn"
+	// LoyaltyRedeem is points spent as a tender
+	LoyaltyRedeem = "redeem"
+	// LoyaltyExpire is earned points that were not spent in time
+	LoyaltyExpire = "expire"
+	// LoyaltyReverse takes back points earned on goods that were returned
+	LoyaltyReverse = "reverse"
+	// LoyaltyRestore gives back points spent on goods that were returned or an order that
+	// was not delivered
+	LoyaltyRestore = "restore"
+)
+
+var ErrLoyaltyEntryImmutable = errors.New("loyalty entries can not be changed once recorded")
+
+// LoyaltyRule is how customers of a chain earn and spend points. A rule without an outlet
+// applies to every outlet of the chain that has no rule of its own.
+type LoyaltyRule struct {
+	gorm.Model
+	ChainId  uint  `json:"chain_id" gorm:"not null;uniqueIndex:idx_loyalty_rule_chain,where:outlet_id IS NULL AND deleted_at IS NULL"`
+	OutletId *uint `json:"outlet_id" gorm:"uniqueIndex:idx_loyalty_rule_outlet,where:deleted_at IS NULL"`
+	// PointsPer100 is the points earned for every 100 rupees paid, by tier
+	PointsPer100       int `json:"points_per_100" gorm:"not null"`
+	SilverPointsPer100 int `json:"silver_points_per_100" gorm:"not null"`
+	GoldPointsPer100   int `json:"gold_points_per_100" gorm:"not null"`
+	// SilverSpend and GoldSpend are what a customer has to spend over the last year to reach
+	// the tier
+	SilverSpend Money `json:"silver_spend" gorm:"not null;type:decimal(10,2)"`
+	GoldSpend   Money `json:"gold_spend" gorm:"not null;type:decimal(10,2)"`
+	// PointValue is what a point is worth when spent
+	PointValue      Money `json:"point_value" gorm:"not null;type:decimal(10,2)"`
+	MinRedeemPoints int   `json:"min_redeem_points" gorm:"not null;default:0"`
+	// MaxRedeemPercent caps the share of a bill or order that can be paid with points
+	MaxRedeemPercent int `json:"max_redeem_percent" gorm:"not null;default:100"`
+	// ExpiryDays is how long earned points can be spent, zero for points that never expire
+	ExpiryDays int  `json:"expiry_days" gorm:"not null;default:0"`
+	Active     bool `json:"active" gorm:"not null;default:true"`
+}
+
+// LoyaltyEntry is a movement of the points of a customer, positive when points are earned
+// or given back and negative when they are spent, expire or are taken back. The balance is
+// the sum of the entries.
+type LoyaltyEntry struct {
+	ID         uint   `json:"id" gorm:"primarykey"`
+	CustomerId uint   `json:"customer_id" gorm:"not null;index"`
+	OutletId   uint   `json:"outlet_id" gorm:"not null"`
+	Type       string `json:"type" gorm:"not null"`
+	Points     int    `json:"points" gorm:"not null"`
+	// Spend is what was paid for the points earned, negative when they are reversed. It
+	// adds up to the spend the tier of the customer is worked out from.
+	Spend Money `json:"spend" gorm:"not null;type:decimal(10,2);default:0"`
+	// Value is what points spent or given back were worth, negative when they were spent
+	Value    Money  `json:"value" gorm:"not null;type:decimal(10,2);default:0"`
+	Tier     string `json:"tier,omitempty"`
+	SaleId   *uint  `json:"sale_id" gorm:"index"`
+	OrderId  *uint  `json:"order_id" gorm:"index"`
+	ReturnId *uint  `json:"return_id" gorm:"index"`
+	// EntryId is the earn entry an expiry is for
+	EntryId   *uint      `json:"entry_id" gorm:"index"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+}
+
+func (le *LoyaltyEntry) BeforeUpdate(tx *gorm.DB) error { return ErrLoyaltyEntryImmutable }
+func (le *LoyaltyEntry) BeforeDelete(tx *gorm.DB) error { return ErrLoyaltyEntryImmutable }
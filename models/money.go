@@ -0,0 +1,254 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Money is a fixed point amount counted in the minor unit of the currency (paise for INR).
+// It is stored as decimal(10,2) and encoded in JSON as a number with exactly two decimals,
+// so no float arithmetic happens between the database and the client. Money does not know
+// its currency, Amount carries one along with it.
+type Money int64
+
+// moneyScale is the number of minor units in a major unit
+const moneyScale = 100
+
+var ErrInvalidMoney = errors.New("invalid money amount")
+
+// Currency describes how an amount is displayed to people
+type Currency struct {
+	Code   string `json:"code"`
+	Symbol string `json:"symbol"`
+	// Indian grouping places separators as 1,00,000 instead of 100,000
+	IndianGrouping bool `json:"indian_grouping"`
+}
+
+var Currencies = map[string]Currency{
+	"INR": {Code: "INR", Symbol: "₹", IndianGrouping: true},
+	"USD": {Code: "USD", Symbol: "$"},
+	"EUR": {Code: "EUR", Symbol: "€"},
+	"AED": {Code: "AED", Symbol: "AED "},
+}
+
+var DefaultCurrency = Currencies["INR"]
+
+// Amount is money in a currency. It is encoded in JSON as {"amount": 12.50, "currency": "INR"}
+// and a bare number decodes as an amount in the default currency.
+type Amount struct {
+	Amount   Money  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// Amount returns m in the currency
+func (c Currency) Amount(m Money) Amount {
+	code := c.Code
+	if code == "" {
+		code = DefaultCurrency.Code
+	}
+	return Amount{Amount: m, Currency: code}
+}
+
+// String returns the amount for display in its currency
+func (a Amount) String() string {
+	return a.Amount.Format(Currencies[a.Currency])
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(trimmed, "{") {
+		*a = DefaultCurrency.Amount(0)
+		return a.Amount.UnmarshalJSON(data)
+	}
+
+	var fields struct {
+		Amount   Money  `json:"amount"`
+		Currency string `json:"currency"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	currency := DefaultCurrency
+	if fields.Currency != "" {
+		var ok bool
+		if currency, ok = Currencies[strings.ToUpper(fields.Currency)]; !ok {
+			return fmt.Errorf("%w: unknown currency %s", ErrInvalidMoney, fields.Currency)
+		}
+	}
+	*a = currency.Amount(fields.Amount)
+	return nil
+}
+
+// ParseMoney parses a decimal amount such as "12", "12.5" or "-0.75". Digits beyond the
+// second decimal are rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return 0, ErrInvalidMoney
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return 0, ErrInvalidMoney
+		}
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > math.MaxInt64/moneyScale-1 {
+		return 0, ErrInvalidMoney
+	}
+
+	fraction += "000"
+	minor, _ := strconv.ParseInt(fraction[:2], 10, 64)
+	if fraction[2] >= '5' {
+		minor++
+	}
+
+	amount := Money(units*moneyScale + minor)
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// MoneyFromFloat converts a float amount, rounding to the nearest minor unit.
+// It is meant for values that are already floats, such as spreadsheet cells.
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// String returns the amount as a plain decimal such as "1234.50"
+func (m Money) String() string {
+	sign := ""
+	amount := int64(m)
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/moneyScale, amount%moneyScale)
+}
+
+// Format returns the amount for display, for example "₹1,23,456.50"
+func (m Money) Format(currency Currency) string {
+	plain := m.String()
+	sign := ""
+	if strings.HasPrefix(plain, "-") {
+		sign = "-"
+		plain = plain[1:]
+	}
+	whole, fraction, _ := strings.Cut(plain, ".")
+
+	var groups []string
+	groupSize := 3
+	for len(whole) > groupSize {
+		groups = append([]string{whole[len(whole)-groupSize:]}, groups...)
+		whole = whole[:len(whole)-groupSize]
+		if currency.IndianGrouping {
+			groupSize = 2
+		}
+	}
+	groups = append([]string{whole}, groups...)
+
+	return sign + currency.Symbol + strings.Join(groups, ",") + "." + fraction
+}
+
+// Float64 returns the amount in major units. Use it only for display, never for arithmetic.
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// Mul multiplies the amount by a quantity
+func (m Money) Mul(quantity int) Money {
+	return m * Money(quantity)
+}
+
+// Percent returns the given percentage of the amount, expressed in basis points
+// (1800 is 18%), rounded half away from zero
+func (m Money) Percent(basisPoints int64) Money {
+	return Money(divRound(int64(m)*basisPoints, 10000))
+}
+
+// Split divides the amount in the ratio part/total, rounding the first share.
+// The two shares always add up to the amount.
+func (m Money) Split(part int64, total int64) (Money, Money) {
+	if total == 0 {
+		return 0, m
+	}
+	first := Money(divRound(int64(m)*part, total))
+	return first, m - first
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*m = 0
+		return nil
+	}
+	amount, err := ParseMoney(s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, s)
+	}
+	*m = amount
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+func (m *Money) Scan(value interface{}) error {
+	var err error
+	switch v := value.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		*m, err = ParseMoney(string(v))
+	case string:
+		*m, err = ParseMoney(v)
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		*m = MoneyFromFloat(v)
+	default:
+		err = fmt.Errorf("unable to scan %T into Money", value)
+	}
+	return err
+}
+
+func divRound(numerator int64, denominator int64) int64 {
+	quotient := numerator / denominator
+	remainder := numerator % denominator
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= abs(denominator) {
+		if (numerator < 0) != (denominator < 0) {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+	return quotient
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
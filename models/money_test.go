@@ -0,0 +1,227 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: "12", want: 1200},
+		{in: "12.5", want: 1250},
+		{in: "12.50", want: 1250},
+		{in: " 0.07 ", want: 7},
+		{in: ".75", want: 75},
+		{in: "-0.75", want: -75},
+		{in: "+3.10", want: 310},
+		{in: "1.005", want: 101},
+		{in: "1.004", want: 100},
+		{in: "-1.005", want: -101},
+		{in: "9.999", want: 1000},
+		{in: "", err: true},
+		{in: ".", err: true},
+		{in: "1,000", err: true},
+		{in: "12a", err: true},
+		{in: "1e3", err: true},
+		{in: "99999999999999999999", err: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidMoney) {
+				t.Errorf("ParseMoney(%q) error = %v, want ErrInvalidMoney", tt.in, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-75, "-0.75"},
+		{-123456, "-1234.56"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyFormat(t *testing.T) {
+	tests := []struct {
+		in       Money
+		currency Currency
+		want     string
+	}{
+		{0, Currencies["INR"], "₹0.00"},
+		{99999, Currencies["INR"], "₹999.99"},
+		{100000, Currencies["INR"], "₹1,000.00"},
+		{12345650, Currencies["INR"], "₹1,23,456.50"},
+		{1234567890, Currencies["INR"], "₹1,23,45,678.90"},
+		{-12345650, Currencies["INR"], "-₹1,23,456.50"},
+		{12345650, Currencies["USD"], "$123,456.50"},
+		{1234567890, Currencies["EUR"], "€12,345,678.90"},
+		{1050, Currencies["AED"], "AED 10.50"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Format(tt.currency); got != tt.want {
+			t.Errorf("Money(%d).Format(%s) = %q, want %q", tt.in, tt.currency.Code, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		in          Money
+		basisPoints int64
+		want        Money
+	}{
+		{10000, 1800, 1800},
+		{999, 1800, 180},
+		{25, 1800, 5},
+		{27, 1800, 5},
+		{1, 5000, 1},
+		{1, 4999, 0},
+		{-25, 1800, -5},
+		{-1, 5000, -1},
+		{12345, 0, 0},
+		{10000, 250, 250},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Percent(tt.basisPoints); got != tt.want {
+			t.Errorf("Money(%d).Percent(%d) = %d, want %d", tt.in, tt.basisPoints, got, tt.want)
+		}
+	}
+}
+
+func TestMoneySplit(t *testing.T) {
+	tests := []struct {
+		in          Money
+		part, total int64
+		first       Money
+		second      Money
+	}{
+		{101, 1, 2, 51, 50},
+		{100, 1, 2, 50, 50},
+		{1, 1, 2, 1, 0},
+		{-101, 1, 2, -51, -50},
+		{1000, 1, 3, 333, 667},
+		{1000, 2, 3, 667, 333},
+		{500, 0, 0, 0, 500},
+	}
+	for _, tt := range tests {
+		first, second := tt.in.Split(tt.part, tt.total)
+		if first != tt.first || second != tt.second {
+			t.Errorf("Money(%d).Split(%d, %d) = %d, %d, want %d, %d", tt.in, tt.part, tt.total, first, second, tt.first, tt.second)
+		}
+		if first+second != tt.in {
+			t.Errorf("Money(%d).Split(%d, %d) shares add up to %d", tt.in, tt.part, tt.total, first+second)
+		}
+	}
+}
+
+func TestMoneyFromFloat(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want Money
+	}{
+		{12.5, 1250},
+		{0.1 + 0.2, 30},
+		{19.999, 2000},
+		{-0.005, -1},
+	}
+	for _, tt := range tests {
+		if got := MoneyFromFloat(tt.in); got != tt.want {
+			t.Errorf("MoneyFromFloat(%v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(struct {
+		Price Money `json:"price"`
+	}{Money(1250)})
+	if err != nil || string(data) != `{"price":12.50}` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+
+	tests := []struct {
+		in   string
+		want Money
+		err  bool
+	}{
+		{in: `12.5`, want: 1250},
+		{in: `"12.50"`, want: 1250},
+		{in: `null`, want: 0},
+		{in: `"abc"`, err: true},
+	}
+	for _, tt := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %d, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	data, err := json.Marshal(Currencies["USD"].Amount(1250))
+	if err != nil || string(data) != `{"amount":12.50,"currency":"USD"}` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+	data, err = json.Marshal(Currency{}.Amount(5))
+	if err != nil || string(data) != `{"amount":0.05,"currency":"INR"}` {
+		t.Fatalf("Marshal without currency = %s, %v", data, err)
+	}
+
+	tests := []struct {
+		in   string
+		want Amount
+		err  bool
+	}{
+		{in: `{"amount":12.5,"currency":"EUR"}`, want: Amount{Amount: 1250, Currency: "EUR"}},
+		{in: `{"amount":"3.10","currency":"aed"}`, want: Amount{Amount: 310, Currency: "AED"}},
+		{in: `{"amount":1}`, want: Amount{Amount: 100, Currency: "INR"}},
+		{in: `7.25`, want: Amount{Amount: 725, Currency: "INR"}},
+		{in: `{"amount":1,"currency":"GBP"}`, err: true},
+		{in: `{"amount":"x"}`, err: true},
+	}
+	for _, tt := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Unmarshal(%s) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+
+	if got := Currencies["INR"].Amount(12345650).String(); got != "₹1,23,456.50" {
+		t.Errorf("Amount.String() = %q", got)
+	}
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OrderPlaced         = "placed"
+	OrderConfirmed      = "confirmed"
+	OrderPacked         = "packed"
+	OrderOutForDelivery = "out_for_delivery"
+	OrderDelivered      = "delivered"
+	OrderCancelled      = "cancelled"
+	OrderFailed         = "failed"
+)
+
+const (
+	PaymentCod    = "cod"
+	PaymentOnline = "online"
+)
+
+const (
+	PaymentPending       = "pending"
+	PaymentPaid          = "paid"
+	PaymentRefundPending = "refund_pending"
+	PaymentRefunded      = "refunded"
+)
+
+const (
+	ActorEmployee = "employee"
+	ActorCustomer = "customer"
+	ActorSystem   = "system"
+)
+
+const (
+	OrderEventStatus   = "status"
+	OrderEventLocation = "location"
+)
+
+var (
+	ErrOrderHistoryImmutable = errors.New("order history can not be changed once recorded")
+	ErrOrderEventImmutable   = errors.New("order events can not be changed once recorded")
+)
+
+// Order is a delivery order of a customer from an outlet. Its status only changes through
+// the order state machine, which records every change in the order history.
+type Order struct {
+	gorm.Model
+	OutletId      uint          `json:"outlet_id" gorm:"not null;index"`
+	Outlet        Outlet        `json:"-" gorm:"foreignKey:OutletId"`
+	CustomerId    uint          `json:"customer_id" gorm:"not null;index"`
+	Customer      Customer      `json:"-" gorm:"foreignKey:CustomerId"`
+	Status        string        `json:"status" gorm:"not null;index"`
+	PaymentMethod string        `json:"payment_method" gorm:"not null"`
+	PaymentStatus string        `json:"payment_status" gorm:"not null"`
+	AddressLine1  string        `json:"address_line1" gorm:"not null"`
+	AddressLine2  string        `json:"address_line2"`
+	City          string        `json:"city" gorm:"not null"`
+	State         string        `json:"state" gorm:"not null"`
+	Pincode       string        `json:"pincode" gorm:"not null;size:6;index"`
+	PlaceOfSupply string        `json:"place_of_supply" gorm:"size:2"`
+	SlotId        *uint         `json:"slot_id" gorm:"index"`
+	Slot          *DeliverySlot `json:"slot,omitempty" gorm:"foreignKey:SlotId"`
+	Discount      Money         `json:"discount" gorm:"not null;type:decimal(10,2);default:0"`
+	TaxableValue  Money         `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst          Money         `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst          Money         `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst          Money         `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess          Money         `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	TotalTax      Money         `json:"total_tax" gorm:"not null;type:decimal(10,2)"`
+	Total         Money         `json:"total" gorm:"not null;type:decimal(10,2)"`
+	// PointsRedeemed loyalty points worth PointsValue, gift cards and store credit paid for
+	// part of the order, the rest is paid online or on delivery
+	PointsRedeemed   int            `json:"points_redeemed" gorm:"not null;default:0"`
+	PointsValue      Money          `json:"points_value" gorm:"not null;type:decimal(10,2);default:0"`
+	GiftCardValue    Money          `json:"gift_card_value" gorm:"not null;type:decimal(10,2);default:0"`
+	StoreCreditValue Money          `json:"store_credit_value" gorm:"not null;type:decimal(10,2);default:0"`
+	AmountPaid       Money          `json:"amount_paid" gorm:"not null;type:decimal(10,2)"`
+	AmountRefunded   Money          `json:"amount_refunded" gorm:"not null;type:decimal(10,2)"`
+	DeliveryOtp      string         `json:"-" gorm:"size:6"`
+	TrackingToken    string         `json:"tracking_token,omitempty" gorm:"size:32;uniqueIndex:idx_order_tracking_token,where:tracking_token <> ''"`
+	StatusChangedAt  time.Time      `json:"status_changed_at" gorm:"not null"`
+	Lines            []OrderLine    `json:"lines" gorm:"foreignKey:OrderId"`
+	History          []OrderHistory `json:"history" gorm:"foreignKey:OrderId"`
+	Payments         []Payment      `json:"payments,omitempty" gorm:"foreignKey:OrderId"`
+}
+
+// Payable is the part of the total paid online or on delivery, after loyalty points, gift
+// cards and store credit
+func (o Order) Payable() Money {
+	return o.Total - o.PointsValue - o.GiftCardValue - o.StoreCreditValue
+}
+
+// OrderLine keeps the price and tax of an item as they were when the order was placed
+type OrderLine struct {
+	gorm.Model
+	OrderId      uint   `json:"order_id" gorm:"not null;index"`
+	VarientId    uint   `json:"varient_id" gorm:"not null"`
+	ProductId    uint   `json:"product_id" gorm:"not null"`
+	Name         string `json:"name" gorm:"not null"`
+	HsnCode      string `json:"hsn_code"`
+	Quantity     int    `json:"quantity" gorm:"not null"`
+	UnitPrice    Money  `json:"unit_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp          Money  `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+	Discount     Money  `json:"discount" gorm:"not null;type:decimal(10,2);default:0"`
+	GstRate      int    `json:"gst_rate" gorm:"not null"`
+	CessRate     int    `json:"cess_rate" gorm:"not null"`
+	TaxableValue Money  `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst         Money  `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst         Money  `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst         Money  `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess         Money  `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	Total        Money  `json:"total" gorm:"not null;type:decimal(10,2)"`
+}
+
+// OrderHistory is a status change of an order with who made it and when. An order is
+// placed with a history row that has no previous status.
+type OrderHistory struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	OrderId    uint      `json:"order_id" gorm:"not null;index"`
+	FromStatus string    `json:"from_status"`
+	ToStatus   string    `json:"to_status" gorm:"not null"`
+	ActorType  string    `json:"actor_type" gorm:"not null"`
+	ActorId    *uint     `json:"actor_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null;index"`
+}
+
+func (oh *OrderHistory) BeforeUpdate(tx *gorm.DB) error { return ErrOrderHistoryImmutable }
+func (oh *OrderHistory) BeforeDelete(tx *gorm.DB) error { return ErrOrderHistoryImmutable }
+
+// OrderEvent is something a subscriber tracking an order is told about, a status change or
+// a location of its rider. Events are numbered in the order they happened, so a subscriber
+// that reconnects can ask for the events after the last one it saw.
+type OrderEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	OrderId   uint      `json:"order_id" gorm:"not null;index"`
+	Type      string    `json:"type" gorm:"not null"`
+	Status    string    `json:"status,omitempty"`
+	Latitude  *float64  `json:"latitude,omitempty"`
+	Longitude *float64  `json:"longitude,omitempty"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (oe *OrderEvent) BeforeUpdate(tx *gorm.DB) error { return ErrOrderEventImmutable }
+func (oe *OrderEvent) BeforeDelete(tx *gorm.DB) error { return ErrOrderEventImmutable }
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"gorm.io/gorm"
+)
+
+// Organization is a retail chain. It owns its outlets, employees, customers and everything
+// shared across its outlets, and nothing of it is visible to other organizations.
+type Organization struct {
+	gorm.Model
+	Name string `json:"name" gorm:"not null"`
+	// OwnerId is the employee who signed the organization up, a manager at all its outlets
+	OwnerId *uint  `json:"owner_id"`
+	Status  string `json:"status" gorm:"not null;default:active"`
+	// PublicKey names the organization to its storefronts, which look up its outlets,
+	// pincodes and slots without logging in
+	PublicKey string `json:"public_key" gorm:"size:32;uniqueIndex:idx_organization_public_key,where:public_key <> ''"`
+}
+
+// BeforeCreate gives a new organization its public key
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.PublicKey != "" {
+		return nil
+	}
+	var err error
+	o.PublicKey, err = NewPublicKey()
+	return err
+}
+
+// NewPublicKey returns a random public key for an organization
+func NewPublicKey() (string, error) {
+	key := make([]byte, 12)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return "pk_" + hex.EncodeToString(key), nil
+}
@@ -4,14 +4,30 @@ import "gorm.io/gorm"
 
 type Outlet struct {
 	gorm.Model
-	Identifier  string   `json:"identifier" gorm:"unique;not null"`
-	Name        string   `json:"name" gorm:"unique"`
-	Description string   `json:"description" gorm:"not null"`
-	ManagerId   uint     `json:"manager_id" gorm:"not null"`
-	Manager     Employee `gorm:"foreignKey:ManagerId"`
-	Location    string   `json:"location" gorm:"not null"`
-	Phone       string   `json:"phone" gorm:"not null;size:10;unique"`
-	Email       string   `json:"email" gorm:"not null"`
-	Website     string   `json:"website" gorm:"not null"`
-	Status      string   `json:"status" gorm:"not null"`
+	Identifier  string `json:"identifier" gorm:"unique;not null"`
+	Name        string `json:"name" gorm:"unique"`
+	Description string `json:"description" gorm:"not null"`
+	// OrganizationId is the chain the outlet belongs to
+	OrganizationId uint     `json:"organization_id" gorm:"not null;default:0;index"`
+	ManagerId      uint     `json:"manager_id" gorm:"not null"`
+	Manager        Employee `gorm:"foreignKey:ManagerId"`
+	Location       string   `json:"location" gorm:"not null"`
+	// AddressLine1 to Pincode are the postal address of the outlet, and Latitude and
+	// Longitude where it is, used to find the outlets nearest to a customer
+	AddressLine1 string   `json:"address_line1"`
+	AddressLine2 string   `json:"address_line2"`
+	City         string   `json:"city"`
+	State        string   `json:"state"`
+	Pincode      string   `json:"pincode" gorm:"size:6"`
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Timezone     string   `json:"timezone" gorm:"not null;default:Asia/Kolkata"`
+	StateCode    string   `json:"state_code" gorm:"size:2"`
+	Gstin        string   `json:"gstin" gorm:"size:15"`
+	UpiId        string   `json:"upi_id"`
+	PricingMode  string   `json:"pricing_mode" gorm:"not null;default:inclusive"`
+	Phone        string   `json:"phone" gorm:"not null;size:10;unique"`
+	Email        string   `json:"email" gorm:"not null"`
+	Website      string   `json:"website" gorm:"not null"`
+	Status       string   `json:"status" gorm:"not null"`
 }
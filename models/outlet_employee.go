@@ -1,5 +1,12 @@
 package models
 
+// Roles of an employee at an outlet. The manager of an outlet always has the manager role.
+const (
+	RoleManager = "manager"
+	RoleCashier = "cashier"
+	RoleRider   = "rider"
+)
+
 type OutletEmployee struct {
 	OutletId uint `json:"outlet_id" gorm:"not null"`
 	Outlet Outlet `gorm:"foreignKey:OutletId"`
@@ -2,9 +2,12 @@ package models
 
 import "gorm.io/gorm"
 
+// OutletServicePincode is a pincode an outlet delivers to. When several outlets serve a
+// pincode, orders are routed by priority or load depending on the overlap policy.
 type OutletServicePincode struct {
 	gorm.Model
-	OutletId uint   `json:"outlet_id" gorm:"not null"`
-	Outlet   Outlet `gorm:"foreignKey:OutletId"`
-	Pincode  string `json:"pincode", gorm:"unique"`
+	OutletId uint   `json:"outlet_id" gorm:"not null;uniqueIndex:idx_outlet_service_pincode"`
+	Outlet   Outlet `json:"-" gorm:"foreignKey:OutletId"`
+	Pincode  string `json:"pincode" gorm:"not null;size:6;uniqueIndex:idx_outlet_service_pincode;index"`
+	Priority int    `json:"priority" gorm:"not null;default:0"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import "gorm.io/gorm"
+
+// GST registrations of an outlet
+const (
+	// TaxRegular is a regular GST registration, which issues tax invoices
+	TaxRegular = "regular"
+	// TaxComposition is a composition dealer, which issues bills of supply and can not
+	// collect tax from customers
+	TaxComposition = "composition"
+	// TaxUnregistered is an outlet below the GST threshold
+	TaxUnregistered = "unregistered"
+)
+
+// Rounding of bill totals at the counter
+const (
+	RoundingNone    = "none"
+	RoundingNearest = "nearest"
+	RoundingUp      = "up"
+	RoundingDown    = "down"
+)
+
+// OutletSettings is a set of settings of a chain, or of one of its outlets when OutletId is
+// set. A setting left empty is inherited, the outlet from its chain and the chain from the
+// defaults. Version goes up on every change.
+type OutletSettings struct {
+	gorm.Model
+	ChainId  uint  `json:"chain_id" gorm:"not null;uniqueIndex:idx_outlet_settings_chain,where:outlet_id IS NULL AND deleted_at IS NULL"`
+	OutletId *uint `json:"outlet_id" gorm:"uniqueIndex:idx_outlet_settings_outlet,where:deleted_at IS NULL"`
+	Version  int   `json:"version" gorm:"not null;default:1"`
+	// CurrencyCode is the currency amounts are displayed in, one of Currencies
+	CurrencyCode    *string `json:"currency_code" gorm:"size:3"`
+	TaxRegistration *string `json:"tax_registration"`
+	ReceiptFooter   *string `json:"receipt_footer"`
+	// RoundingMode and RoundingUnit round the total a bill is paid to a multiple of the unit
+	RoundingMode *string `json:"rounding_mode"`
+	RoundingUnit *Money  `json:"rounding_unit" gorm:"type:decimal(10,2)"`
+	// ReturnWindowDays applies to products of categories without a window of their own
+	ReturnWindowDays *int `json:"return_window_days"`
+	// AllowedTenders is the comma separated tenders accepted at the counter
+	AllowedTenders *string `json:"allowed_tenders"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Statuses of an online payment attempt at the provider
+const (
+	PaymentCreated    = "created"
+	PaymentAuthorized = "authorized"
+	PaymentCaptured   = "captured"
+	PaymentFailed     = "failed"
+	// PaymentReview is a payment the provider took a different amount or currency for than
+	// it was started with. It is not credited to the order until someone looks at it.
+	PaymentReview = "review"
+)
+
+const (
+	RefundRequested = "requested"
+	// RefundProcessing is a refund being sent to the provider
+	RefundProcessing = "processing"
+	RefundInitiated  = "initiated"
+	RefundProcessed  = "processed"
+)
+
+// Payment is an attempt to pay for an order online. An order can have several attempts,
+// one for each time the customer started paying.
+type Payment struct {
+	gorm.Model
+	OrderId        uint   `json:"order_id" gorm:"not null;index"`
+	Provider       string `json:"provider" gorm:"not null;uniqueIndex:idx_payment_intent"`
+	IntentRef      string `json:"intent_ref" gorm:"not null;uniqueIndex:idx_payment_intent"`
+	ClientSecret   string `json:"client_secret"`
+	PaymentRef     string `json:"payment_ref" gorm:"index"`
+	Amount         Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	AmountRefunded Money  `json:"amount_refunded" gorm:"not null;type:decimal(10,2)"`
+	Currency       string `json:"currency" gorm:"not null;size:3"`
+	Status         string `json:"status" gorm:"not null"`
+	FailureReason  string `json:"failure_reason"`
+}
+
+// PaymentRefund is money sent back to the customer against a captured payment. It is
+// requested first and sent to the provider by the refund worker.
+type PaymentRefund struct {
+	gorm.Model
+	PaymentId uint   `json:"payment_id" gorm:"not null;index"`
+	OrderId   uint   `json:"order_id" gorm:"not null;index"`
+	Amount    Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	Status    string `json:"status" gorm:"not null;index"`
+	RefundRef string `json:"refund_ref" gorm:"index"`
+	Attempts  int    `json:"attempts" gorm:"not null"`
+	LastError string `json:"last_error"`
+}
+
+// PaymentWebhook is a webhook delivery that has been handled. Providers deliver webhooks at
+// least once, so a delivery seen before is acknowledged without being applied again.
+type PaymentWebhook struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	Provider  string    `json:"provider" gorm:"not null;uniqueIndex:idx_payment_webhook_event"`
+	EventId   string    `json:"event_id" gorm:"not null;uniqueIndex:idx_payment_webhook_event"`
+	Type      string    `json:"type" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
@@ -1,6 +1,10 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
 
 type ProductCategory struct {
 	gorm.Model
@@ -8,4 +12,18 @@ type ProductCategory struct {
 	Outlet      Outlet `gorm:"foreignKey:OutletId"`
 	Title       string `json:"title" gorm:"not null"`
 	Description string `json:"description" gorm:"not null"`
+	// ReturnWindowDays is how long after a sale its products can be returned. Without it
+	// the window of the outlet applies, zero makes the products non returnable.
+	ReturnWindowDays *int `json:"return_window_days"`
+}
+
+// Validate checks the fields required to save a product category
+func (pc *ProductCategory) Validate() error {
+	if pc.Title == "" && pc.Description == "" {
+		return errors.New("Title and description should not be empty")
+	}
+	if pc.ReturnWindowDays != nil && *pc.ReturnWindowDays < 0 {
+		return errors.New("Return window should not be negative")
+	}
+	return nil
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ProductVarientPrice is an entry of the price history of a varient. Entries with a future
+// EffectiveFrom are scheduled changes and are copied to the varient once they become due.
+type ProductVarientPrice struct {
+	gorm.Model
+	VarientId     uint           `json:"varient_id" gorm:"not null;index"`
+	Varient       ProductVarient `json:"-" gorm:"foreignKey:VarientId"`
+	SellingPrice  Money          `json:"selling_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp           Money          `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+	EffectiveFrom time.Time      `json:"effective_from" gorm:"not null;index"`
+	AppliedAt     *time.Time     `json:"applied_at"`
+	CancelledAt   *time.Time     `json:"cancelled_at"`
+	ChangedById   *uint          `json:"changed_by_id"`
+	ChangedBy     *Employee      `json:"changed_by,omitempty" gorm:"foreignKey:ChangedById"`
+}
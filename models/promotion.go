@@ -0,0 +1,183 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Kinds of promotion
+const (
+	// PromotionPercent takes a percentage off the lines it covers
+	PromotionPercent = "percent"
+	// PromotionFlat takes an amount off the lines it covers together
+	PromotionFlat = "flat"
+	// PromotionBuyXGetY gives the cheapest units of every group of buy plus get units free,
+	// or at a percentage off
+	PromotionBuyXGetY = "buy_x_get_y"
+	// PromotionBundle sells every group of bundle quantity units at the bundle price
+	PromotionBundle = "bundle"
+)
+
+// Where a promotion can be used
+const (
+	ChannelAll    = "all"
+	ChannelPos    = "pos"
+	ChannelOnline = "online"
+)
+
+const (
+	PromotionActive   = "active"
+	PromotionInactive = "inactive"
+)
+
+var (
+	couponCodeRegex = regexp.MustCompile(`^[A-Z0-9]{3,20}$`)
+	clockRegex      = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+)
+
+// Promotion is a discount of an outlet. Promotions without a coupon code apply on their own
+// to every bill and cart they match, those with one only when the code is given. They are
+// applied from the highest priority down. A promotion that is not stackable only applies to
+// lines no other promotion has discounted, and no other promotion applies to them after it.
+type Promotion struct {
+	gorm.Model
+	OutletId    uint   `json:"outlet_id" gorm:"not null;index;uniqueIndex:idx_promotion_coupon,where:coupon_code <> '' AND deleted_at IS NULL"`
+	Outlet      Outlet `json:"-" gorm:"foreignKey:OutletId"`
+	Name        string `json:"name" gorm:"not null"`
+	Description string `json:"description"`
+	Type        string `json:"type" gorm:"not null"`
+	// PercentOff is the discount of percent promotions and of the free units of buy X get Y
+	// promotions, where 100 makes them free
+	PercentOff     int   `json:"percent_off" gorm:"not null;default:0"`
+	AmountOff      Money `json:"amount_off" gorm:"not null;type:decimal(10,2);default:0"`
+	BuyQuantity    int   `json:"buy_quantity" gorm:"not null;default:0"`
+	GetQuantity    int   `json:"get_quantity" gorm:"not null;default:0"`
+	BundleQuantity int   `json:"bundle_quantity" gorm:"not null;default:0"`
+	BundlePrice    Money `json:"bundle_price" gorm:"not null;type:decimal(10,2);default:0"`
+	// MinSubtotal is what the covered lines have to add up to before the promotion applies
+	MinSubtotal Money `json:"min_subtotal" gorm:"not null;type:decimal(10,2);default:0"`
+	// MaxDiscount caps the discount of the promotion on a bill or cart, zero for no cap
+	MaxDiscount Money      `json:"max_discount" gorm:"not null;type:decimal(10,2);default:0"`
+	StartsAt    *time.Time `json:"starts_at"`
+	EndsAt      *time.Time `json:"ends_at"`
+	// Days are the weekdays the promotion runs on, 0 for Sunday to 6 for Saturday, such as
+	// "1,2,3,4,5". Every day when empty.
+	Days string `json:"days"`
+	// StartTime and EndTime bound happy hours in the local time of the outlet, such as
+	// "17:00" to "19:00"
+	StartTime        string            `json:"start_time" gorm:"size:5"`
+	EndTime          string            `json:"end_time" gorm:"size:5"`
+	Channel          string            `json:"channel" gorm:"not null;default:all"`
+	CouponCode       string            `json:"coupon_code" gorm:"size:20;uniqueIndex:idx_promotion_coupon,where:coupon_code <> '' AND deleted_at IS NULL"`
+	UsageLimit       int               `json:"usage_limit" gorm:"not null;default:0"`
+	PerCustomerLimit int               `json:"per_customer_limit" gorm:"not null;default:0"`
+	Priority         int               `json:"priority" gorm:"not null;default:0"`
+	Stackable        bool              `json:"stackable" gorm:"not null;default:false"`
+	Status           string            `json:"status" gorm:"not null"`
+	Targets          []PromotionTarget `json:"targets" gorm:"foreignKey:PromotionId"`
+}
+
+// PromotionTarget is a varient, product or category a promotion covers. A promotion
+// without targets covers everything sold at the outlet.
+type PromotionTarget struct {
+	ID          uint  `json:"id" gorm:"primarykey"`
+	PromotionId uint  `json:"promotion_id" gorm:"not null;index"`
+	VarientId   *uint `json:"varient_id"`
+	ProductId   *uint `json:"product_id"`
+	CategoryId  *uint `json:"category_id"`
+}
+
+// PromotionRedemption is a use of a promotion on a sale or an order, counted against its
+// usage limits
+type PromotionRedemption struct {
+	ID          uint      `json:"id" gorm:"primarykey"`
+	PromotionId uint      `json:"promotion_id" gorm:"not null;index"`
+	CustomerId  *uint     `json:"customer_id" gorm:"index"`
+	SaleId      *uint     `json:"sale_id" gorm:"index"`
+	OrderId     *uint     `json:"order_id" gorm:"index"`
+	Discount    Money     `json:"discount" gorm:"not null;type:decimal(10,2)"`
+	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
+}
+
+// Validate checks the fields required to save a promotion
+func (p *Promotion) Validate() error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("Name is required")
+	}
+
+	switch p.Type {
+	case PromotionPercent:
+		if p.PercentOff <= 0 || p.PercentOff > 100 {
+			return errors.New("Percent off should be between 1 and 100")
+		}
+	case PromotionFlat:
+		if p.AmountOff <= 0 {
+			return errors.New("Amount off should be greater than zero")
+		}
+	case PromotionBuyXGetY:
+		if p.BuyQuantity <= 0 || p.GetQuantity <= 0 {
+			return errors.New("Buy and get quantities should be positive")
+		}
+		if p.PercentOff <= 0 || p.PercentOff > 100 {
+			return errors.New("Percent off should be between 1 and 100, 100 for free units")
+		}
+	case PromotionBundle:
+		if p.BundleQuantity < 2 {
+			return errors.New("Bundle quantity should be at least 2")
+		}
+		if p.BundlePrice <= 0 {
+			return errors.New("Bundle price should be greater than zero")
+		}
+	default:
+		return errors.New("Type should be percent, flat, buy_x_get_y or bundle")
+	}
+
+	if p.MinSubtotal < 0 || p.MaxDiscount < 0 {
+		return errors.New("Minimum subtotal and maximum discount should not be negative")
+	}
+	if p.UsageLimit < 0 || p.PerCustomerLimit < 0 {
+		return errors.New("Usage limits should not be negative")
+	}
+	if p.StartsAt != nil && p.EndsAt != nil && !p.EndsAt.After(*p.StartsAt) {
+		return errors.New("Promotion should end after it starts")
+	}
+	if (p.StartTime == "") != (p.EndTime == "") {
+		return errors.New("Happy hours need both a start and an end time")
+	}
+	if p.StartTime != "" && (!clockRegex.MatchString(p.StartTime) || !clockRegex.MatchString(p.EndTime)) {
+		return errors.New("Happy hours should be given as HH:MM")
+	}
+	if p.Days != "" {
+		for _, day := range strings.Split(p.Days, ",") {
+			if len(day) != 1 || day[0] < '0' || day[0] > '6' {
+				return errors.New("Days should be weekdays from 0 (Sunday) to 6 (Saturday) separated by commas")
+			}
+		}
+	}
+	if p.Channel != ChannelAll && p.Channel != ChannelPos && p.Channel != ChannelOnline {
+		return errors.New("Channel should be all, pos or online")
+	}
+	if p.CouponCode != "" && !couponCodeRegex.MatchString(p.CouponCode) {
+		return errors.New("Coupon code should be 3 to 20 capital letters or digits")
+	}
+	if p.Status != PromotionActive && p.Status != PromotionInactive {
+		return errors.New("Status should be active or inactive")
+	}
+
+	for _, target := range p.Targets {
+		set := 0
+		for _, id := range []*uint{target.VarientId, target.ProductId, target.CategoryId} {
+			if id != nil {
+				set++
+			}
+		}
+		if set != 1 {
+			return errors.New("Each target should name one varient, product or category")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// What happens to the goods that come back
+const (
+	ReturnRestock  = "restock"
+	ReturnWriteOff = "write_off"
+)
+
+// Where the money for a return goes
+const (
+	RefundToOriginal    = "original"
+	RefundToStoreCredit = "store_credit"
+	RefundToExchange    = "exchange"
+)
+
+// Tenders a return is refunded to besides the counter tenders
+const (
+	TenderStoreCredit = "store_credit"
+	TenderExchange    = "exchange"
+)
+
+var (
+	ErrReturnImmutable      = errors.New("returns can not be changed once recorded")
+	ErrStoreCreditImmutable = errors.New("store credit entries can not be changed once recorded")
+)
+
+// Return is goods brought back from a sale at the counter or a delivered order. Its amounts
+// are worked out from the prices and taxes of the original lines, never the current ones.
+type Return struct {
+	gorm.Model
+	OutletId     uint           `json:"outlet_id" gorm:"not null;index"`
+	Outlet       Outlet         `json:"-" gorm:"foreignKey:OutletId"`
+	SaleId       *uint          `json:"sale_id" gorm:"index"`
+	OrderId      *uint          `json:"order_id" gorm:"index"`
+	CustomerId   *uint          `json:"customer_id" gorm:"index"`
+	EmployeeId   uint           `json:"employee_id" gorm:"not null"`
+	RefundMethod string         `json:"refund_method" gorm:"not null"`
+	Reason       string         `json:"reason"`
+	TaxableValue Money          `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst         Money          `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst         Money          `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst         Money          `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess         Money          `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	TotalTax     Money          `json:"total_tax" gorm:"not null;type:decimal(10,2)"`
+	Total        Money          `json:"total" gorm:"not null;type:decimal(10,2)"`
+	Lines        []ReturnLine   `json:"lines" gorm:"foreignKey:ReturnId"`
+	Refunds      []ReturnRefund `json:"refunds" gorm:"foreignKey:ReturnId"`
+}
+
+// ReturnLine is the part of a sale or order line that came back
+type ReturnLine struct {
+	gorm.Model
+	ReturnId     uint   `json:"return_id" gorm:"not null;index"`
+	SaleLineId   *uint  `json:"sale_line_id" gorm:"index"`
+	OrderLineId  *uint  `json:"order_line_id" gorm:"index"`
+	VarientId    uint   `json:"varient_id" gorm:"not null"`
+	ProductId    uint   `json:"product_id" gorm:"not null"`
+	Name         string `json:"name" gorm:"not null"`
+	HsnCode      string `json:"hsn_code"`
+	Quantity     int    `json:"quantity" gorm:"not null"`
+	UnitPrice    Money  `json:"unit_price" gorm:"not null;type:decimal(10,2)"`
+	GstRate      int    `json:"gst_rate" gorm:"not null"`
+	CessRate     int    `json:"cess_rate" gorm:"not null"`
+	TaxableValue Money  `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst         Money  `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst         Money  `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst         Money  `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess         Money  `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	Total        Money  `json:"total" gorm:"not null;type:decimal(10,2)"`
+	Disposition  string `json:"disposition" gorm:"not null"`
+	Reason       string `json:"reason"`
+}
+
+// ReturnRefund is money given back for a return through one tender. Counter refunds are
+// paid out of the drawer of the shift they were made on.
+type ReturnRefund struct {
+	gorm.Model
+	ReturnId  uint   `json:"return_id" gorm:"not null;index"`
+	Method    string `json:"method" gorm:"not null"`
+	Amount    Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	ShiftId   *uint  `json:"shift_id" gorm:"index"`
+	Reference string `json:"reference"`
+}
+
+// StoreCreditEntry is a movement of the store credit wallet of a customer, positive when
+// credit is issued and negative when it is spent. The balance is the sum of the entries.
+type StoreCreditEntry struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	CustomerId uint      `json:"customer_id" gorm:"not null;index"`
+	OutletId   uint      `json:"outlet_id" gorm:"not null"`
+	Amount     Money     `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	SaleId     *uint     `json:"sale_id" gorm:"index"`
+	OrderId    *uint     `json:"order_id" gorm:"index"`
+	ReturnId   *uint     `json:"return_id" gorm:"index"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+}
+
+func (r *Return) BeforeUpdate(tx *gorm.DB) error             { return ErrReturnImmutable }
+func (r *Return) BeforeDelete(tx *gorm.DB) error             { return ErrReturnImmutable }
+func (rl *ReturnLine) BeforeUpdate(tx *gorm.DB) error        { return ErrReturnImmutable }
+func (rl *ReturnLine) BeforeDelete(tx *gorm.DB) error        { return ErrReturnImmutable }
+func (rr *ReturnRefund) BeforeUpdate(tx *gorm.DB) error      { return ErrReturnImmutable }
+func (rr *ReturnRefund) BeforeDelete(tx *gorm.DB) error      { return ErrReturnImmutable }
+func (sce *StoreCreditEntry) BeforeUpdate(tx *gorm.DB) error { return ErrStoreCreditImmutable }
+func (sce *StoreCreditEntry) BeforeDelete(tx *gorm.DB) error { return ErrStoreCreditImmutable }
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RiderAvailable = "available"
+	RiderOnTrip    = "on_trip"
+	RiderOffline   = "offline"
+)
+
+const (
+	AssignmentAssigned   = "assigned"
+	AssignmentAccepted   = "accepted"
+	AssignmentPickedUp   = "picked_up"
+	AssignmentDelivered  = "delivered"
+	AssignmentUnassigned = "unassigned"
+	AssignmentCancelled  = "cancelled"
+	AssignmentFailed     = "failed"
+)
+
+const (
+	ProofOtp   = "otp"
+	ProofPhoto = "photo"
+)
+
+// Rider is an employee with the rider role at one or more outlets. Only available and
+// offline are stored, a rider carrying a picked up order is reported as on trip.
+type Rider struct {
+	EmployeeId uint      `json:"employee_id" gorm:"primaryKey;autoIncrement:false"`
+	Employee   Employee  `json:"-" gorm:"foreignKey:EmployeeId"`
+	Status     string    `json:"status" gorm:"not null;default:offline"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// DeliveryAssignment hands an order to a rider. An order has at most one assignment that
+// has not ended.
+type DeliveryAssignment struct {
+	gorm.Model
+	OutletId    uint       `json:"outlet_id" gorm:"not null;index"`
+	OrderId     uint       `json:"order_id" gorm:"not null;uniqueIndex:idx_assignment_open_order,where:ended_at IS NULL"`
+	Order       *Order     `json:"order,omitempty" gorm:"foreignKey:OrderId"`
+	RiderId     uint       `json:"rider_id" gorm:"not null;index"`
+	Rider       Employee   `json:"-" gorm:"foreignKey:RiderId"`
+	AssignedBy  uint       `json:"assigned_by" gorm:"not null"`
+	Strategy    string     `json:"strategy" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	PickedUpAt  *time.Time `json:"picked_up_at"`
+	DeliveredAt *time.Time `json:"delivered_at"`
+	EndedAt     *time.Time `json:"ended_at"`
+	ProofType   string     `json:"proof_type"`
+	ProofPhoto  string     `json:"proof_photo"`
+	OtpAttempts int        `json:"-" gorm:"not null;default:0"`
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var ErrSaleImmutable = errors.New("sales can not be changed once recorded")
+
+// Sale is the immutable record of a finalized bill, with the prices and taxes as they
+// were at the time of the sale
+type Sale struct {
+	gorm.Model
+	OutletId     uint          `json:"outlet_id" gorm:"not null;index"`
+	Outlet       Outlet        `json:"-" gorm:"foreignKey:OutletId"`
+	BillId       uint          `json:"bill_id" gorm:"not null;uniqueIndex"`
+	EmployeeId   uint          `json:"employee_id" gorm:"not null"`
+	Employee     Employee      `json:"-" gorm:"foreignKey:EmployeeId"`
+	ShiftId      *uint         `json:"shift_id" gorm:"index"`
+	CustomerId   *uint         `json:"customer_id" gorm:"index"`
+	Discount     Money         `json:"discount" gorm:"not null;type:decimal(10,2);default:0"`
+	TaxableValue Money         `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst         Money         `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst         Money         `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst         Money         `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess         Money         `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	TotalTax     Money         `json:"total_tax" gorm:"not null;type:decimal(10,2)"`
+	Total        Money         `json:"total" gorm:"not null;type:decimal(10,2)"`
+	RoundOff     Money         `json:"round_off" gorm:"not null;type:decimal(10,2);default:0"`
+	Paid         Money         `json:"paid" gorm:"not null;type:decimal(10,2)"`
+	Change       Money         `json:"change" gorm:"not null;type:decimal(10,2)"`
+	Lines        []SaleLine    `json:"lines" gorm:"foreignKey:SaleId"`
+	Payments     []SalePayment `json:"payments" gorm:"foreignKey:SaleId"`
+}
+
+type SaleLine struct {
+	gorm.Model
+	SaleId       uint   `json:"sale_id" gorm:"not null;index"`
+	VarientId    uint   `json:"varient_id" gorm:"not null"`
+	ProductId    uint   `json:"product_id" gorm:"not null"`
+	Name         string `json:"name" gorm:"not null"`
+	HsnCode      string `json:"hsn_code"`
+	Quantity     int    `json:"quantity" gorm:"not null"`
+	UnitPrice    Money  `json:"unit_price" gorm:"not null;type:decimal(10,2)"`
+	Mrp          Money  `json:"mrp" gorm:"not null;type:decimal(10,2)"`
+	Discount     Money  `json:"discount" gorm:"not null;type:decimal(10,2)"`
+	GstRate      int    `json:"gst_rate" gorm:"not null"`
+	CessRate     int    `json:"cess_rate" gorm:"not null"`
+	TaxableValue Money  `json:"taxable_value" gorm:"not null;type:decimal(10,2)"`
+	Cgst         Money  `json:"cgst" gorm:"not null;type:decimal(10,2)"`
+	Sgst         Money  `json:"sgst" gorm:"not null;type:decimal(10,2)"`
+	Igst         Money  `json:"igst" gorm:"not null;type:decimal(10,2)"`
+	Cess         Money  `json:"cess" gorm:"not null;type:decimal(10,2)"`
+	Total        Money  `json:"total" gorm:"not null;type:decimal(10,2)"`
+}
+
+type SalePayment struct {
+	gorm.Model
+	SaleId    uint   `json:"sale_id" gorm:"not null;index"`
+	Method    string `json:"method" gorm:"not null"`
+	Amount    Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	Reference string `json:"reference"`
+	Points    int    `json:"points" gorm:"not null;default:0"`
+}
+
+func (s *Sale) BeforeUpdate(tx *gorm.DB) error         { return ErrSaleImmutable }
+func (s *Sale) BeforeDelete(tx *gorm.DB) error         { return ErrSaleImmutable }
+func (sl *SaleLine) BeforeUpdate(tx *gorm.DB) error    { return ErrSaleImmutable }
+func (sl *SaleLine) BeforeDelete(tx *gorm.DB) error    { return ErrSaleImmutable }
+func (sp *SalePayment) BeforeUpdate(tx *gorm.DB) error { return ErrSaleImmutable }
+func (sp *SalePayment) BeforeDelete(tx *gorm.DB) error { return ErrSaleImmutable }
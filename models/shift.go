@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ShiftOpen   = "open"
+	ShiftClosed = "closed"
+)
+
+const (
+	CashIn  = "cash_in"
+	CashOut = "cash_out"
+)
+
+// Shift is the time a cashier works a drawer of an outlet. A bill can only be finalized
+// by an employee with an open shift.
+type Shift struct {
+	gorm.Model
+	OutletId     uint             `json:"outlet_id" gorm:"not null;uniqueIndex:idx_shift_open_employee,where:status = 'open'"`
+	Outlet       Outlet           `json:"-" gorm:"foreignKey:OutletId"`
+	EmployeeId   uint             `json:"employee_id" gorm:"not null;uniqueIndex:idx_shift_open_employee,where:status = 'open'"`
+	Employee     Employee         `json:"-" gorm:"foreignKey:EmployeeId"`
+	Status       string           `json:"status" gorm:"not null"`
+	OpeningFloat Money            `json:"opening_float" gorm:"not null;type:decimal(10,2)"`
+	OpenedAt     time.Time        `json:"opened_at" gorm:"not null"`
+	ClosedAt     *time.Time       `json:"closed_at"`
+	CashEvents   []ShiftCashEvent `json:"cash_events" gorm:"foreignKey:ShiftId"`
+	Counts       []ShiftCount     `json:"counts" gorm:"foreignKey:ShiftId"`
+}
+
+// ShiftCashEvent is cash put into or taken out of the drawer outside of a sale
+type ShiftCashEvent struct {
+	gorm.Model
+	ShiftId    uint   `json:"shift_id" gorm:"not null;index"`
+	EmployeeId uint   `json:"employee_id" gorm:"not null"`
+	Type       string `json:"type" gorm:"not null"`
+	Amount     Money  `json:"amount" gorm:"not null;type:decimal(10,2)"`
+	Reason     string `json:"reason"`
+}
+
+// ShiftCount is the amount counted for a tender when the shift was closed, along with
+// the amount the system expected
+type ShiftCount struct {
+	gorm.Model
+	ShiftId  uint   `json:"shift_id" gorm:"not null;index"`
+	Method   string `json:"method" gorm:"not null"`
+	Expected Money  `json:"expected" gorm:"not null;type:decimal(10,2)"`
+	Counted  Money  `json:"counted" gorm:"not null;type:decimal(10,2)"`
+	Variance Money  `json:"variance" gorm:"not null;type:decimal(10,2)"`
+}
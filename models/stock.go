@@ -2,9 +2,14 @@ package models
 
 import "gorm.io/gorm"
 
+// Stock is the quantity of a varient on hand. Reserved units are held for orders that
+// have not been delivered yet and can not be sold. Written off units came back damaged or
+// unsellable and are counted apart from the quantity on hand.
 type Stock struct {
 	gorm.Model
 	VarientId      uint           `json:"varient_id" gorm:"not null"`
 	ProductVarient ProductVarient `gorm:"foreignKey:VarientId"`
 	Quantity       int            `json:"quantity" gorm:"not null"`
+	Reserved       int            `json:"reserved" gorm:"not null;default:0"`
+	WrittenOff     int            `json:"written_off" gorm:"not null;default:0"`
 }
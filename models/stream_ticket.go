@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StreamTicket lets a browser open the event stream or socket of an order, which can not
+// carry the Authorization header, without putting the access token in the URL. A ticket is
+// for one order, expires within a minute and can only be used once. Only the SHA-256 hash
+// of the ticket is stored.
+type StreamTicket struct {
+	gorm.Model
+	TokenHash  string     `json:"-" gorm:"not null;uniqueIndex"`
+	EmployeeId uint       `json:"employee_id" gorm:"not null"`
+	OutletId   uint       `json:"outlet_id" gorm:"not null"`
+	OrderId    uint       `json:"order_id" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt     *time.Time `json:"used_at"`
+}
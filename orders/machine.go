@@ -0,0 +1,317 @@
+package orders
+
+import (
+	"crypto/rand"
+	"easystore/hours"
+	"easystore/inventory"
+	"easystore/invoices"
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/promotions"
+	"easystore/serviceability"
+	"easystore/slots"
+	"easystore/tracking"
+	"easystore/wallets"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidTransition = errors.New("Order can not move to the requested status")
+	ErrActorNotAllowed   = errors.New("Not allowed to move the order to the requested status")
+	ErrReasonRequired    = errors.New("A reason is required for this status")
+	ErrPaymentPending    = errors.New("Order can not be confirmed before it is paid")
+)
+
+// Actor is whoever changes the status of an order
+type Actor struct {
+	Type string
+	Id   uint
+}
+
+func EmployeeActor(id uint) Actor { return Actor{Type: models.ActorEmployee, Id: id} }
+func CustomerActor(id uint) Actor { return Actor{Type: models.ActorCustomer, Id: id} }
+
+var SystemActor = Actor{Type: models.ActorSystem}
+
+// guard refuses a status change by returning an error
+type guard func(tx *gorm.DB, order *models.Order, reason string) error
+
+// effect runs in the same transaction as the status change
+type effect func(tx *gorm.DB, order *models.Order) error
+
+// transition is an edge of the order state machine
+type transition struct {
+	actors  []string
+	guards  []guard
+	effects []effect
+}
+
+var (
+	staff  = []string{models.ActorEmployee, models.ActorSystem}
+	anyone = []string{models.ActorEmployee, models.ActorSystem, models.ActorCustomer}
+)
+
+var machine = map[string]map[string]transition{
+	models.OrderPlaced: {
+		models.OrderConfirmed: {actors: staff, guards: []guard{paid}},
+		models.OrderCancelled: {actors: anyone, effects: []effect{releaseStock, releaseSlot, releasePromotions, restorePoints, refundWallets, refund, endAssignment(models.AssignmentCancelled)}},
+	},
+	models.OrderConfirmed: {
+		models.OrderPacked:    {actors: staff},
+		models.OrderCancelled: {actors: anyone, guards: []guard{reasonRequired}, effects: []effect{releaseStock, releaseSlot, releasePromotions, restorePoints, refundWallets, refund, endAssignment(models.AssignmentCancelled)}},
+	},
+	models.OrderPacked: {
+		models.OrderOutForDelivery: {actors: staff, effects: []effect{issueOtp}},
+		models.OrderCancelled:      {actors: staff, guards: []guard{reasonRequired}, effects: []effect{releaseStock, releaseSlot, releasePromotions, restorePoints, refundWallets, refund, endAssignment(models.AssignmentCancelled)}},
+	},
+	models.OrderOutForDelivery: {
+		models.OrderDelivered: {actors: staff, effects: []effect{commitStock, collectCod, issueInvoice, earnPoints, endAssignment(models.AssignmentDelivered)}},
+		models.OrderFailed:    {actors: staff, guards: []guard{reasonRequired}, effects: []effect{releaseStock, releaseSlot, releasePromotions, restorePoints, refundWallets, refund, endAssignment(models.AssignmentFailed)}},
+	},
+}
+
+// Next lists the statuses an order in status can move to
+func Next(status string) []string {
+	next := []string{}
+	for _, to := range Statuses {
+		if _, ok := machine[status][to]; ok {
+			next = append(next, to)
+		}
+	}
+	return next
+}
+
+// Statuses lists every order status in the order they are usually reached
+var Statuses = []string{
+	models.OrderPlaced,
+	models.OrderConfirmed,
+	models.OrderPacked,
+	models.OrderOutForDelivery,
+	models.OrderDelivered,
+	models.OrderCancelled,
+	models.OrderFailed,
+}
+
+// Transition moves an order of the outlet to the status to. The order row is locked so
+// concurrent transitions of the same order are applied one after the other.
+func Transition(tx *gorm.DB, outletId uint, orderId uint, to string, actor Actor, reason string) (models.Order, error) {
+	var order models.Order
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outletId).First(&order, orderId).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Where("order_id = ?", order.ID).Order("id").Find(&order.Lines).Error; err != nil {
+			return err
+		}
+
+		edge, ok := machine[order.Status][to]
+		if !ok {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, order.Status, to)
+		}
+		if !allowed(edge.actors, actor) {
+			return ErrActorNotAllowed
+		}
+		for _, check := range edge.guards {
+			if err := check(tx, &order, reason); err != nil {
+				return err
+			}
+		}
+		for _, apply := range edge.effects {
+			if err := apply(tx, &order); err != nil {
+				return err
+			}
+		}
+
+		from := order.Status
+		order.Status = to
+		order.StatusChangedAt = time.Now()
+		err = tx.Model(&order).Select("status", "status_changed_at", "payment_status", "amount_paid", "amount_refunded", "delivery_otp").Updates(&order).Error
+		if err != nil {
+			return err
+		}
+		return record(tx, &order, from, actor, reason)
+	})
+	return order, err
+}
+
+// record adds the current status of the order to its history and tells the subscribers
+// tracking the order
+func record(tx *gorm.DB, order *models.Order, from string, actor Actor, reason string) error {
+	history := models.OrderHistory{
+		OrderId:    order.ID,
+		FromStatus: from,
+		ToStatus:   order.Status,
+		ActorType:  actor.Type,
+		Reason:     reason,
+		CreatedAt:  order.StatusChangedAt,
+	}
+	if actor.Id != 0 {
+		history.ActorId = &actor.Id
+	}
+	if err := tx.Create(&history).Error; err != nil {
+		return err
+	}
+	return tracking.Emit(tx, models.OrderEvent{OrderId: order.ID, Type: models.OrderEventStatus, Status: order.Status, CreatedAt: order.StatusChangedAt})
+}
+
+func allowed(actors []string, actor Actor) bool {
+	for _, allowed := range actors {
+		if allowed == actor.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// Guards
+
+func paid(tx *gorm.DB, order *models.Order, reason string) error {
+	if order.PaymentMethod != models.PaymentCod && order.PaymentStatus != models.PaymentPaid {
+		return ErrPaymentPending
+	}
+	return nil
+}
+
+func reasonRequired(tx *gorm.DB, order *models.Order, reason string) error {
+	if reason == "" {
+		return ErrReasonRequired
+	}
+	return nil
+}
+
+// Effects
+
+func reserveStock(tx *gorm.DB, order *models.Order) error {
+	for _, line := range order.Lines {
+		if err := inventory.Reserve(tx, line.VarientId, line.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseStock(tx *gorm.DB, order *models.Order) error {
+	for _, line := range order.Lines {
+		if err := inventory.Release(tx, line.VarientId, line.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func commitStock(tx *gorm.DB, order *models.Order) error {
+	for _, line := range order.Lines {
+		if err := inventory.Commit(tx, line.VarientId, line.Quantity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseSlot gives back the delivery slot of an order that will not be delivered
+func releaseSlot(tx *gorm.DB, order *models.Order) error {
+	if order.SlotId == nil {
+		return nil
+	}
+	return slots.Release(tx, *order.SlotId)
+}
+
+// releasePromotions gives back the uses of the promotions of an order that will not be
+// delivered, so they count no more against the usage limits
+func releasePromotions(tx *gorm.DB, order *models.Order) error {
+	return promotions.Release(tx, order.ID)
+}
+
+// restorePoints gives back the loyalty points spent on an order that will not be delivered
+func restorePoints(tx *gorm.DB, order *models.Order) error {
+	return loyalty.Cancel(tx, *order)
+}
+
+// refundWallets gives back the gift cards and store credit spent on an order that will not
+// be delivered
+func refundWallets(tx *gorm.DB, order *models.Order) error {
+	return wallets.CancelOrder(tx, *order)
+}
+
+// collectCod marks a cash on delivery order as paid when it is handed over
+func collectCod(tx *gorm.DB, order *models.Order) error {
+	if order.PaymentMethod == models.PaymentCod {
+		order.PaymentStatus = models.PaymentPaid
+		order.AmountPaid = order.Payable()
+	}
+	return nil
+}
+
+// earnPoints gives the customer loyalty points for what they paid once the order is handed
+// over
+func earnPoints(tx *gorm.DB, order *models.Order) error {
+	var outlet models.Outlet
+	if err := tx.First(&outlet, order.OutletId).Error; err != nil {
+		return err
+	}
+	return loyalty.Earn(tx, outlet, order.CustomerId, order.Total-order.PointsValue, loyalty.Source{OrderId: &order.ID}, time.Now())
+}
+
+// issueInvoice issues the tax invoice of an order when it is handed over
+func issueInvoice(tx *gorm.DB, order *models.Order) error {
+	_, err := invoices.IssueOrder(tx, *order)
+	return err
+}
+
+// refund flags the amount paid for an order that will not be delivered so it can be
+// returned to the customer
+func refund(tx *gorm.DB, order *models.Order) error {
+	if order.PaymentStatus == models.PaymentPaid && order.AmountPaid > order.AmountRefunded {
+		order.PaymentStatus = models.PaymentRefundPending
+	}
+	return nil
+}
+
+// issueOtp gives the order a one time password the customer tells the rider on delivery
+func issueOtp(tx *gorm.DB, order *models.Order) error {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return err
+	}
+	order.DeliveryOtp = fmt.Sprintf("%06d", n.Int64())
+	return nil
+}
+
+// newTrackingToken returns the secret customers follow an order with
+func newTrackingToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// endAssignment closes the rider assignment of an order that is no longer on its way
+func endAssignment(status string) effect {
+	return func(tx *gorm.DB, order *models.Order) error {
+		now := time.Now()
+		updates := map[string]interface{}{"status": status, "ended_at": now}
+		if status == models.AssignmentDelivered {
+			updates["delivered_at"] = now
+		}
+		return tx.Model(&models.DeliveryAssignment{}).Where("order_id = ? AND ended_at IS NULL", order.ID).Updates(updates).Error
+	}
+}
+
+// IsOrderError reports whether err was caused by the request rather than the server
+func IsOrderError(err error) bool {
+	for _, orderErr := range []error{ErrInvalidTransition, ErrActorNotAllowed, ErrReasonRequired, ErrPaymentPending, ErrEmptyOrder, ErrNotServiceable, ErrInvalidPayment, ErrInvalidQuantity, ErrVarientUnavailable, ErrNotReschedulable, ErrOverpaid, hours.ErrClosed, serviceability.ErrNotServiceable, slots.ErrSlotClosed, slots.ErrSlotUnavailable, slots.ErrCutoffPassed, slots.ErrSlotFull, inventory.ErrInsufficientStock, gorm.ErrRecordNotFound} {
+		if errors.Is(err, orderErr) {
+			return true
+		}
+	}
+	return promotions.IsPromotionError(err) || loyalty.IsLoyaltyError(err) || wallets.IsWalletError(err)
+}
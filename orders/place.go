@@ -0,0 +1,328 @@
+package orders
+
+import (
+	"easystore/hours"
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/pricing"
+	"easystore/promotions"
+	"easystore/serviceability"
+	"easystore/slots"
+	"easystore/tax"
+	"easystore/wallets"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEmptyOrder         = errors.New("Order has no lines")
+	ErrNotServiceable     = errors.New("Outlet does not deliver to this pincode")
+	ErrInvalidPayment     = errors.New("Payment method should be cod or online")
+	ErrInvalidQuantity    = errors.New("Quantity should be positive")
+	ErrVarientUnavailable = errors.New("Product varient is not sold at this outlet")
+	ErrNotReschedulable   = errors.New("Order can no longer be rescheduled")
+	ErrOverpaid           = errors.New("Points, gift cards and store credit are worth more than the order")
+)
+
+// LineRequest is an item a customer asks for
+type LineRequest struct {
+	VarientId uint
+	Quantity  int
+}
+
+// SlotRequest is the delivery window a customer picked
+type SlotRequest struct {
+	TemplateId uint
+	Date       time.Time
+}
+
+// PlaceRequest is everything needed to place an order
+type PlaceRequest struct {
+	Outlet        models.Outlet
+	Customer      models.Customer
+	Address       models.CustomerAddress
+	PaymentMethod string
+	Lines         []LineRequest
+	Slot          *SlotRequest
+	// Coupon is the coupon code the customer gave, if any
+	Coupon string
+	// Points is the loyalty points the customer pays part of the order with
+	Points int
+	// GiftCards and StoreCredit pay for part of the order after the points
+	GiftCards   []GiftCardRequest
+	StoreCredit models.Money
+}
+
+// GiftCardRequest is an amount a customer pays from a gift card
+type GiftCardRequest struct {
+	Code   string
+	Amount models.Money
+}
+
+// Place creates an order at the current prices of the outlet less its promotions and
+// reserves its stock. Loyalty points, gift cards and store credit the customer pays with are
+// spent straight away.
+func Place(tx *gorm.DB, request PlaceRequest, actor Actor) (models.Order, error) {
+	order := models.Order{
+		OutletId:        request.Outlet.ID,
+		CustomerId:      request.Customer.ID,
+		Status:          models.OrderPlaced,
+		PaymentMethod:   request.PaymentMethod,
+		PaymentStatus:   models.PaymentPending,
+		AddressLine1:    request.Address.Line1,
+		AddressLine2:    request.Address.Line2,
+		City:            request.Address.City,
+		State:           request.Address.State,
+		Pincode:         request.Address.Pincode,
+		PlaceOfSupply:   tax.StateFromLocation(request.Address.State),
+		StatusChangedAt: time.Now(),
+	}
+	if order.PaymentMethod == "" {
+		order.PaymentMethod = models.PaymentCod
+	}
+	if order.PaymentMethod != models.PaymentCod && order.PaymentMethod != models.PaymentOnline {
+		return order, ErrInvalidPayment
+	}
+
+	quantities, varientIds, err := mergeLines(request.Lines)
+	if err != nil {
+		return order, err
+	}
+	order.TrackingToken, err = newTrackingToken()
+	if err != nil {
+		return order, err
+	}
+
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		served, err := serviceability.Serves(tx, order.OutletId, order.Pincode)
+		if err != nil {
+			return err
+		}
+		if !served {
+			return ErrNotServiceable
+		}
+
+		// Orders for a delivery slot only need the outlet to open on the day of the slot,
+		// the rest need it open now
+		if request.Slot != nil {
+			slot, err := slots.Book(tx, request.Outlet, request.Slot.TemplateId, request.Slot.Date, order.StatusChangedAt)
+			if err != nil {
+				return err
+			}
+			order.SlotId = &slot.ID
+		} else if err := hours.Check(tx, request.Outlet, order.StatusChangedAt); err != nil {
+			return err
+		}
+
+		varients := make([]models.ProductVarient, 0, len(varientIds))
+		items := make([]promotions.Item, 0, len(varientIds))
+		for _, varientId := range varientIds {
+			var varient models.ProductVarient
+			err := tx.Joins("Product").
+				Where("\"Product\".outlet_id = ? AND \"Product\".status = ?", order.OutletId, "active").
+				First(&varient, varientId).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: %d", ErrVarientUnavailable, varientId)
+			} else if err != nil {
+				return err
+			}
+
+			price, err := pricing.EffectivePrice(tx, varient, order.StatusChangedAt)
+			if err != nil {
+				return err
+			}
+			varients = append(varients, varient)
+			order.Lines = append(order.Lines, models.OrderLine{
+				VarientId: varient.ID,
+				ProductId: varient.ProductId,
+				Name:      varient.Product.Title + " " + varient.Name,
+				Quantity:  quantities[varientId],
+				UnitPrice: price.SellingPrice,
+				Mrp:       price.Mrp,
+			})
+			items = append(items, promotions.Item{Key: varient.ID, VarientId: varient.ID, ProductId: varient.ProductId, CategoryId: varient.Product.CategoryId, Quantity: quantities[varientId], UnitPrice: price.SellingPrice})
+		}
+
+		promotionContext := promotions.Context{OutletId: order.OutletId, Channel: models.ChannelOnline, CustomerId: &request.Customer.ID, Coupon: request.Coupon, At: order.StatusChangedAt.In(hours.Of(request.Outlet))}
+		applied, err := promotions.Evaluate(tx, promotionContext, items)
+		if err != nil {
+			return err
+		}
+		order.Discount = applied.Discount
+
+		taxLines := make([]tax.Line, 0, len(varients))
+		for i, varient := range varients {
+			line := &order.Lines[i]
+			line.Discount = applied.Line(varient.ID).Discount
+			taxLines = append(taxLines, tax.LineFor(varient.Product, line.UnitPrice, line.Quantity, line.Discount))
+		}
+
+		breakdowns, totals, err := tax.ComputeLines(taxLines, tax.ModeFor(request.Outlet), tax.InterstateFor(request.Outlet, order.PlaceOfSupply))
+		if err != nil {
+			return err
+		}
+		for i, breakdown := range breakdowns {
+			line := &order.Lines[i]
+			line.HsnCode = breakdown.HsnCode
+			line.GstRate = breakdown.GstRate
+			line.CessRate = breakdown.CessRate
+			line.TaxableValue = breakdown.TaxableValue
+			line.Cgst = breakdown.Cgst
+			line.Sgst = breakdown.Sgst
+			line.Igst = breakdown.Igst
+			line.Cess = breakdown.Cess
+			line.Total = breakdown.Total
+		}
+		order.TaxableValue = totals.TaxableValue
+		order.Cgst = totals.Cgst
+		order.Sgst = totals.Sgst
+		order.Igst = totals.Igst
+		order.Cess = totals.Cess
+		order.TotalTax = totals.TotalTax
+		order.Total = totals.Total
+
+		if request.Points > 0 {
+			order.PointsRedeemed = request.Points
+			order.PointsValue, err = loyalty.Quote(tx, request.Outlet, order.CustomerId, request.Points, order.Total)
+			if err != nil {
+				return err
+			}
+		}
+		for _, giftCard := range request.GiftCards {
+			_, _, err := wallets.CheckGiftCard(tx, request.Outlet, giftCard.Code, giftCard.Amount, order.StatusChangedAt)
+			if err != nil {
+				return err
+			}
+			order.GiftCardValue += giftCard.Amount
+		}
+		if request.StoreCredit > 0 {
+			if _, err := wallets.CheckStoreCredit(tx, order.CustomerId, request.StoreCredit); err != nil {
+				return err
+			}
+			order.StoreCreditValue = request.StoreCredit
+		}
+		if order.Payable() < 0 {
+			return ErrOverpaid
+		}
+		// Nothing is left to collect on an order paid in full with points, gift cards and
+		// store credit
+		if order.Payable() == 0 {
+			order.PaymentStatus = models.PaymentPaid
+		}
+
+		if err := reserveStock(tx, &order); err != nil {
+			return err
+		}
+		if err := tx.Omit("Outlet", "Customer", "Slot").Create(&order).Error; err != nil {
+			return err
+		}
+		if err := promotions.Redeem(tx, applied, promotionContext, nil, &order.ID); err != nil {
+			return err
+		}
+		if order.PointsRedeemed > 0 {
+			_, err := loyalty.Redeem(tx, request.Outlet, order.CustomerId, order.PointsRedeemed, order.Total, loyalty.Source{OrderId: &order.ID})
+			if err != nil {
+				return err
+			}
+		}
+		for _, giftCard := range request.GiftCards {
+			_, err := wallets.RedeemGiftCard(tx, request.Outlet, giftCard.Code, giftCard.Amount, wallets.Source{OrderId: &order.ID}, order.StatusChangedAt)
+			if err != nil {
+				return err
+			}
+		}
+		if order.StoreCreditValue > 0 {
+			_, err := wallets.SpendStoreCredit(tx, order.OutletId, order.CustomerId, order.StoreCreditValue, wallets.Source{OrderId: &order.ID})
+			if err != nil {
+				return err
+			}
+		}
+		return record(tx, &order, "", actor, "")
+	})
+	return order, err
+}
+
+// mergeLines adds up the quantities of lines asking for the same varient, keeping the
+// order in which the varients were first asked for
+func mergeLines(lines []LineRequest) (map[uint]int, []uint, error) {
+	if len(lines) == 0 {
+		return nil, nil, ErrEmptyOrder
+	}
+
+	quantities := make(map[uint]int)
+	var varientIds []uint
+	for _, line := range lines {
+		if line.Quantity <= 0 {
+			return nil, nil, ErrInvalidQuantity
+		}
+		if _, ok := quantities[line.VarientId]; !ok {
+			varientIds = append(varientIds, line.VarientId)
+		}
+		quantities[line.VarientId] += line.Quantity
+	}
+	return quantities, varientIds, nil
+}
+
+// MatchLines maps lines asking for varients of one outlet onto the varients of another
+// outlet of the chain carrying the same SKU, for orders routed away from the outlet they
+// were taken at
+func MatchLines(tx *gorm.DB, fromOutletId uint, toOutletId uint, lines []LineRequest) ([]LineRequest, error) {
+	if fromOutletId == toOutletId {
+		return lines, nil
+	}
+
+	matched := make([]LineRequest, 0, len(lines))
+	for _, line := range lines {
+		var from models.ProductVarient
+		err := tx.Joins("Product").Where("\"Product\".outlet_id = ?", fromOutletId).First(&from, line.VarientId).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && from.Sku == "") {
+			return nil, fmt.Errorf("%w: %d", ErrVarientUnavailable, line.VarientId)
+		} else if err != nil {
+			return nil, err
+		}
+
+		var to models.ProductVarient
+		err = tx.Joins("Product").
+			Where("\"Product\".outlet_id = ? AND \"Product\".status = ? AND product_varients.sku = ?", toOutletId, "active", from.Sku).
+			First(&to).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrVarientUnavailable, from.Sku)
+		} else if err != nil {
+			return nil, err
+		}
+		matched = append(matched, LineRequest{VarientId: to.ID, Quantity: line.Quantity})
+	}
+	return matched, nil
+}
+
+// Reschedule moves an order that has not left the outlet into another delivery slot,
+// giving back its place in the previous one
+func Reschedule(tx *gorm.DB, outlet models.Outlet, orderId uint, slot SlotRequest) (models.Order, error) {
+	var order models.Order
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outlet.ID).First(&order, orderId).Error
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderPlaced && order.Status != models.OrderConfirmed && order.Status != models.OrderPacked {
+			return ErrNotReschedulable
+		}
+
+		if order.SlotId != nil {
+			if err := slots.Release(tx, *order.SlotId); err != nil {
+				return err
+			}
+		}
+		booked, err := slots.Book(tx, outlet, slot.TemplateId, slot.Date, time.Now())
+		if err != nil {
+			return err
+		}
+		order.SlotId = &booked.ID
+		return tx.Model(&order).Update("slot_id", booked.ID).Error
+	})
+	return order, err
+}
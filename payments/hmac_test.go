@@ -0,0 +1,139 @@
+package payments
+
+import (
+	"crypto/sha256"
+	"easystore/models"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHmacVerifierSign(t *testing.T) {
+	verifier := RazorpayVerifier("whsec_test")
+	got := verifier.Sign([]byte(`{"event":"payment.captured"}`))
+	if want := "4f463a57dd128675850163391f0311888616d57bccca75c774c9cdb28134f851"; got != want {
+		t.Fatalf("Sign = %s, want %s", got, want)
+	}
+}
+
+func TestHmacVerifierVerify(t *testing.T) {
+	body := []byte(`{"event":"payment.captured"}`)
+	signature := RazorpayVerifier("whsec_test").Sign(body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		signature string
+		body      []byte
+		err       bool
+	}{
+		{name: "valid", secret: "whsec_test", signature: signature, body: body},
+		{name: "upper case hex", secret: "whsec_test", signature: strings.ToUpper(signature), body: body},
+		{name: "other secret", secret: "whsec_other", signature: signature, body: body, err: true},
+		{name: "changed body", secret: "whsec_test", signature: signature, body: []byte(`{"event":"payment.captured" }`), err: true},
+		{name: "missing signature", secret: "whsec_test", signature: "", body: body, err: true},
+		{name: "not hex", secret: "whsec_test", signature: "not-a-signature", body: body, err: true},
+		{name: "truncated signature", secret: "whsec_test", signature: signature[:32], body: body, err: true},
+		{name: "no secret", secret: "", signature: RazorpayVerifier("").Sign(body), body: body, err: true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.signature != "" {
+			header.Set("X-Razorpay-Signature", tt.signature)
+		}
+		err := RazorpayVerifier(tt.secret).Verify(header, tt.body)
+		if tt.err && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Verify error = %v, want ErrInvalidSignature", tt.name, err)
+		}
+		if !tt.err && err != nil {
+			t.Errorf("%s: Verify error = %v, want none", tt.name, err)
+		}
+	}
+}
+
+func TestParseRazorpayEvent(t *testing.T) {
+	captured := `{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","amount":12550,"currency":"INR"}}}}`
+	sum := sha256.Sum256([]byte(captured))
+
+	tests := []struct {
+		name    string
+		eventId string
+		body    string
+		want    WebhookEvent
+		err     bool
+	}{
+		{
+			name:    "captured",
+			eventId: "evt_1",
+			body:    captured,
+			want:    WebhookEvent{Id: "evt_1", Type: EventCaptured, IntentRef: "order_1", PaymentRef: "pay_1", Amount: models.Money(12550), Currency: "INR"},
+		},
+		{
+			name: "without an event id",
+			body: captured,
+			want: WebhookEvent{Id: hex.EncodeToString(sum[:]), Type: EventCaptured, IntentRef: "order_1", PaymentRef: "pay_1", Amount: models.Money(12550), Currency: "INR"},
+		},
+		{
+			name:    "failed",
+			eventId: "evt_2",
+			body:    `{"event":"payment.failed","payload":{"payment":{"entity":{"id":"pay_2","order_id":"order_2","amount":500,"error_description":"Card declined"}}}}`,
+			want:    WebhookEvent{Id: "evt_2", Type: EventFailed, IntentRef: "order_2", PaymentRef: "pay_2", Amount: models.Money(500), Error: "Card declined"},
+		},
+		{
+			name:    "refunded",
+			eventId: "evt_3",
+			body:    `{"event":"refund.processed","payload":{"refund":{"entity":{"id":"rfnd_1","payment_id":"pay_1","amount":2500}}}}`,
+			want:    WebhookEvent{Id: "evt_3", Type: EventRefunded, PaymentRef: "pay_1", RefundRef: "rfnd_1", Amount: models.Money(2500)},
+		},
+		{name: "not json", body: `event=payment.captured`, err: true},
+		{name: "no event", body: `{"payload":{}}`, err: true},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.eventId != "" {
+			header.Set("X-Razorpay-Event-Id", tt.eventId)
+		}
+		got, err := ParseRazorpayEvent(header, []byte(tt.body))
+		if tt.err {
+			if !errors.Is(err, ErrInvalidEvent) {
+				t.Errorf("%s: ParseRazorpayEvent error = %v, want ErrInvalidEvent", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: ParseRazorpayEvent = %+v, %v, want %+v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestMockProviderWebhook(t *testing.T) {
+	if _, err := NewMockProvider(""); !errors.Is(err, ErrNoWebhookSecret) {
+		t.Fatalf("NewMockProvider without a secret error = %v, want ErrNoWebhookSecret", err)
+	}
+
+	provider, err := NewMockProvider("whsec_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, body, err := provider.Simulate(EventCaptured, "order_1", "pay_1", models.Money(9900), "INR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	event, err := provider.VerifyWebhook(header, body)
+	if err != nil {
+		t.Fatalf("VerifyWebhook of a simulated webhook error = %v", err)
+	}
+	if event.Type != EventCaptured || event.IntentRef != "order_1" || event.PaymentRef != "pay_1" || event.Amount != 9900 || event.Currency != "INR" {
+		t.Errorf("VerifyWebhook = %+v", event)
+	}
+
+	other, err := NewMockProvider("whsec_other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.VerifyWebhook(header, body); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("VerifyWebhook with another secret error = %v, want ErrInvalidSignature", err)
+	}
+}
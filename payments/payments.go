@@ -0,0 +1,442 @@
+package payments
+
+import (
+	"context"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotOnline       = errors.New("Order is not paid online")
+	ErrAlreadyPaid     = errors.New("Order has already been paid")
+	ErrOrderClosed     = errors.New("Order can no longer be paid")
+	ErrUnknownPayment  = errors.New("Payment not found")
+	ErrNothingToRefund = errors.New("Nothing left to refund on the order")
+)
+
+// transitions are the statuses a payment can move to from each status. Webhooks can arrive
+// late, twice or out of order, so any other move is ignored rather than refused. A payment
+// reported failed can still be captured when the bank settles it later.
+var transitions = map[string][]string{
+	models.PaymentCreated:    {models.PaymentAuthorized, models.PaymentCaptured, models.PaymentFailed},
+	models.PaymentAuthorized: {models.PaymentCaptured, models.PaymentFailed},
+	models.PaymentFailed:     {models.PaymentCaptured},
+}
+
+// Start asks the provider to collect what is still due on an online order and records the
+// attempt. Every call starts a new attempt, earlier ones that are paid later are refunded.
+func Start(ctx context.Context, tx *gorm.DB, provider PaymentProvider, order models.Order) (models.Payment, error) {
+	payment := models.Payment{OrderId: order.ID, Provider: provider.Name(), Currency: models.DefaultCurrency.Code, Status: models.PaymentCreated}
+	if order.PaymentMethod != models.PaymentOnline {
+		return payment, ErrNotOnline
+	}
+	if closed(order) {
+		return payment, ErrOrderClosed
+	}
+	if order.PaymentStatus != models.PaymentPending {
+		return payment, ErrAlreadyPaid
+	}
+
+	payment.Amount = order.Payable() - order.AmountPaid
+	intent, err := provider.CreateIntent(ctx, IntentRequest{Reference: fmt.Sprintf("order_%d", order.ID), Amount: payment.Amount, Currency: payment.Currency})
+	if err != nil {
+		return payment, err
+	}
+	payment.IntentRef, payment.ClientSecret = intent.Ref, intent.ClientSecret
+	err = tx.Create(&payment).Error
+	return payment, err
+}
+
+// Apply applies a verified webhook event of the provider. Each delivery is applied once,
+// a redelivery returns the payment it is about with duplicate set.
+func Apply(tx *gorm.DB, provider PaymentProvider, event WebhookEvent) (payment models.Payment, duplicate bool, err error) {
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		webhook := models.PaymentWebhook{Provider: provider.Name(), EventId: event.Id, Type: event.Type}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&webhook)
+		if result.Error != nil {
+			return result.Error
+		}
+		duplicate = result.RowsAffected == 0
+
+		query := tx.Where("provider = ?", provider.Name())
+		if event.Type == EventRefunded {
+			query = query.Where("payment_ref = ?", event.PaymentRef)
+		} else {
+			query = query.Where("intent_ref = ?", event.IntentRef)
+		}
+		if err := query.First(&payment).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUnknownPayment
+		} else if err != nil {
+			return err
+		}
+		if duplicate {
+			return nil
+		}
+
+		order, err := lock(tx, &payment)
+		if err != nil {
+			return err
+		}
+		if (event.Type == EventAuthorized || event.Type == EventCaptured) && !matches(payment, event) {
+			return review(tx, &payment, event)
+		}
+		switch event.Type {
+		case EventAuthorized:
+			if advance(&payment, models.PaymentAuthorized) {
+				payment.PaymentRef = event.PaymentRef
+				return tx.Save(&payment).Error
+			}
+		case EventCaptured:
+			if payment.PaymentRef == "" {
+				payment.PaymentRef = event.PaymentRef
+			}
+			return capture(tx, &payment, &order)
+		case EventFailed:
+			if advance(&payment, models.PaymentFailed) {
+				payment.PaymentRef = event.PaymentRef
+				payment.FailureReason = event.Error
+				return tx.Save(&payment).Error
+			}
+		case EventRefunded:
+			var refund models.PaymentRefund
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("payment_id = ? AND refund_ref = ?", payment.ID, event.RefundRef).First(&refund).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// The refund is still being recorded, the provider will deliver it again
+				return ErrUnknownPayment
+			} else if err != nil {
+				return err
+			}
+			return complete(tx, &refund, &payment, &order)
+		}
+		return nil
+	})
+	return payment, duplicate, err
+}
+
+// Capture captures an authorized payment at the provider. Authorizations of orders that
+// have been paid another way or will not be delivered are left for the provider to void.
+func Capture(ctx context.Context, tx *gorm.DB, provider PaymentProvider, paymentId uint) (models.Payment, error) {
+	var payment models.Payment
+	var order models.Order
+	if err := tx.First(&payment, paymentId).Error; err != nil {
+		return payment, err
+	}
+	if err := tx.First(&order, payment.OrderId).Error; err != nil {
+		return payment, err
+	}
+	if payment.Status != models.PaymentAuthorized || closed(order) || order.PaymentStatus != models.PaymentPending {
+		return payment, nil
+	}
+
+	if err := provider.Capture(ctx, payment.PaymentRef, payment.Amount, payment.Currency); err != nil {
+		return payment, err
+	}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		order, err := lock(tx, &payment)
+		if err != nil {
+			return err
+		}
+		return capture(tx, &payment, &order)
+	})
+	return payment, err
+}
+
+// RequestRefund asks for amount of an order to be refunded against its captured payments,
+// the oldest first. The order must be locked by the caller.
+func RequestRefund(tx *gorm.DB, order models.Order, amount models.Money) error {
+	var payments []models.Payment
+	err := tx.Where("order_id = ? AND status = ?", order.ID, models.PaymentCaptured).Order("id").Find(&payments).Error
+	if err != nil {
+		return err
+	}
+	for _, payment := range payments {
+		if amount <= 0 {
+			break
+		}
+		open, err := openRefunds(tx, "payment_id", payment.ID)
+		if err != nil {
+			return err
+		}
+		refundable := payment.Amount - payment.AmountRefunded - open
+		if refundable <= 0 {
+			continue
+		}
+		if refundable > amount {
+			refundable = amount
+		}
+		refund := models.PaymentRefund{PaymentId: payment.ID, OrderId: order.ID, Amount: refundable, Status: models.RefundRequested}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		amount -= refundable
+	}
+	if amount > 0 {
+		return ErrNothingToRefund
+	}
+	return nil
+}
+
+// RequestRefunds requests refunds for what is still owed on online orders flagged
+// refund_pending, returning how many orders it requested refunds for
+func RequestRefunds(tx *gorm.DB) (int, error) {
+	var orderIds []uint
+	err := tx.Model(&models.Order{}).
+		Where("payment_method = ? AND payment_status = ?", models.PaymentOnline, models.PaymentRefundPending).
+		Pluck("id", &orderIds).Error
+	if err != nil {
+		return 0, err
+	}
+
+	requested := 0
+	for _, orderId := range orderIds {
+		err := tx.Transaction(func(tx *gorm.DB) error {
+			var order models.Order
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderId).Error
+			if err != nil || order.PaymentStatus != models.PaymentRefundPending {
+				return err
+			}
+			open, err := openRefunds(tx, "order_id", order.ID)
+			if err != nil {
+				return err
+			}
+			owed := order.AmountPaid - order.AmountRefunded - open
+			if owed <= 0 {
+				return nil
+			}
+			requested++
+			return RequestRefund(tx, order, owed)
+		})
+		if err != nil {
+			return requested, err
+		}
+	}
+	return requested, nil
+}
+
+// processingTimeout is how long a refund can stay processing before it is sent again. A
+// refund is only left processing when the worker stopped while sending it, and sending it
+// again with the same idempotency key does not refund twice.
+const processingTimeout = 10 * time.Minute
+
+// ProcessRefunds sends requested refunds to their providers, returning how many were sent.
+// A refund is marked processing before it is sent and the answer of the provider is recorded
+// afterwards, so no locks are held while the provider is called. A refund the provider turns
+// down goes back to requested and is tried again on the next run.
+func ProcessRefunds(ctx context.Context, tx *gorm.DB) (int, error) {
+	var refunds []models.PaymentRefund
+	err := tx.Where("status = ? OR (status = ? AND updated_at < ?)", models.RefundRequested, models.RefundProcessing, time.Now().Add(-processingTimeout)).
+		Order("id").Find(&refunds).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, candidate := range refunds {
+		refund, payment, claimed, err := claimRefund(tx, candidate)
+		if err != nil {
+			return sent, err
+		}
+		if !claimed {
+			continue
+		}
+
+		provider, err := Provider(payment.Provider)
+		if err != nil {
+			return sent, err
+		}
+		// The refund id keeps retries of a refund the provider already made from
+		// refunding twice
+		ref, processed, refundErr := provider.Refund(ctx, payment.PaymentRef, refund.Amount, fmt.Sprintf("refund_%d", refund.ID))
+		if refundErr == nil {
+			sent++
+		}
+		if err := recordRefund(tx, refund.ID, ref, processed, refundErr); err != nil {
+			return sent, err
+		}
+	}
+	return sent, nil
+}
+
+// claimRefund marks a refund processing, unless another worker has taken it since it was
+// listed
+func claimRefund(tx *gorm.DB, candidate models.PaymentRefund) (models.PaymentRefund, models.Payment, bool, error) {
+	var refund models.PaymentRefund
+	var payment models.Payment
+	claimed := false
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			First(&refund, candidate.ID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if refund.Status != candidate.Status || !refund.UpdatedAt.Equal(candidate.UpdatedAt) {
+			return nil
+		}
+		if err := tx.First(&payment, refund.PaymentId).Error; err != nil {
+			return err
+		}
+		refund.Status = models.RefundProcessing
+		refund.Attempts++
+		claimed = true
+		return tx.Save(&refund).Error
+	})
+	return refund, payment, claimed && err == nil, err
+}
+
+// recordRefund records what the provider answered for a refund being processed
+func recordRefund(tx *gorm.DB, refundId uint, ref string, processed bool, refundErr error) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var refund models.PaymentRefund
+		if err := tx.First(&refund, refundId).Error; err != nil {
+			return err
+		}
+		payment := models.Payment{Model: gorm.Model{ID: refund.PaymentId}}
+		order, err := lock(tx, &payment)
+		if err != nil {
+			return err
+		}
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&refund, refundId).Error
+		if err != nil || refund.Status != models.RefundProcessing {
+			// A refund webhook may have completed it already
+			return err
+		}
+
+		if refundErr != nil {
+			refund.Status = models.RefundRequested
+			refund.LastError = refundErr.Error()
+			return tx.Save(&refund).Error
+		}
+		refund.RefundRef = ref
+		if processed {
+			return complete(tx, &refund, &payment, &order)
+		}
+		refund.Status = models.RefundInitiated
+		return tx.Save(&refund).Error
+	})
+}
+
+// IsPaymentError reports whether err was caused by the request rather than the server
+func IsPaymentError(err error) bool {
+	for _, paymentErr := range []error{ErrUnknownProvider, ErrInvalidSignature, ErrInvalidEvent, ErrNotOnline, ErrAlreadyPaid, ErrOrderClosed, ErrUnknownPayment, ErrNothingToRefund, gorm.ErrRecordNotFound} {
+		if errors.Is(err, paymentErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// lock locks the order of the payment and then the payment, the same order every other
+// change to an order takes its locks in
+func lock(tx *gorm.DB, payment *models.Payment) (models.Order, error) {
+	var order models.Order
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, payment.OrderId).Error; err != nil {
+		return order, err
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(payment, payment.ID).Error
+	return order, err
+}
+
+// matches reports whether the event is for the amount and currency the payment was started
+// with. Providers that leave the currency out are taken to use the one of the payment.
+func matches(payment models.Payment, event WebhookEvent) bool {
+	return event.Amount == payment.Amount && (event.Currency == "" || strings.EqualFold(event.Currency, payment.Currency))
+}
+
+// review sets aside a payment the provider reported a different amount or currency for, so
+// that a partial or wrong capture is never booked as paid
+func review(tx *gorm.DB, payment *models.Payment, event WebhookEvent) error {
+	if payment.Status == models.PaymentReview || payment.Status == models.PaymentCaptured {
+		return nil
+	}
+	currency := event.Currency
+	if currency == "" {
+		currency = payment.Currency
+	}
+	log.Printf("Payment %d of order %d needs review: %s reported %s %s, expected %s %s", payment.ID, payment.OrderId, event.Type, event.Amount, currency, payment.Amount, payment.Currency)
+	payment.Status = models.PaymentReview
+	payment.PaymentRef = event.PaymentRef
+	payment.FailureReason = fmt.Sprintf("Provider reported %s %s, expected %s %s", event.Amount, currency, payment.Amount, payment.Currency)
+	return tx.Save(payment).Error
+}
+
+// advance moves the payment to status, reporting false when the move does not apply
+func advance(payment *models.Payment, status string) bool {
+	for _, next := range transitions[payment.Status] {
+		if next == status {
+			payment.Status = status
+			return true
+		}
+	}
+	return false
+}
+
+// capture marks the payment captured and credits it to the order. Money taken for an order
+// that will not be delivered is flagged for refund, money taken twice is refunded.
+func capture(tx *gorm.DB, payment *models.Payment, order *models.Order) error {
+	if !advance(payment, models.PaymentCaptured) {
+		return nil
+	}
+	payment.FailureReason = ""
+	if err := tx.Save(payment).Error; err != nil {
+		return err
+	}
+
+	paidBefore := order.PaymentStatus != models.PaymentPending
+	order.AmountPaid += payment.Amount
+	switch {
+	case closed(*order):
+		order.PaymentStatus = models.PaymentRefundPending
+	case paidBefore:
+		refund := models.PaymentRefund{PaymentId: payment.ID, OrderId: order.ID, Amount: payment.Amount, Status: models.RefundRequested}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+	case order.AmountPaid >= order.Payable():
+		order.PaymentStatus = models.PaymentPaid
+	}
+	return tx.Model(order).Select("payment_status", "amount_paid").Updates(order).Error
+}
+
+// complete records a refund the provider has made against the payment and the order
+func complete(tx *gorm.DB, refund *models.PaymentRefund, payment *models.Payment, order *models.Order) error {
+	if refund.Status == models.RefundProcessed {
+		return nil
+	}
+	refund.Status = models.RefundProcessed
+	refund.LastError = ""
+	if err := tx.Save(refund).Error; err != nil {
+		return err
+	}
+
+	payment.AmountRefunded += refund.Amount
+	if err := tx.Model(payment).Update("amount_refunded", payment.AmountRefunded).Error; err != nil {
+		return err
+	}
+	order.AmountRefunded += refund.Amount
+	if order.PaymentStatus == models.PaymentRefundPending && order.AmountRefunded >= order.AmountPaid {
+		order.PaymentStatus = models.PaymentRefunded
+	}
+	return tx.Model(order).Select("payment_status", "amount_refunded").Updates(order).Error
+}
+
+// openRefunds adds up the refunds of an order or payment that have not been processed yet
+func openRefunds(tx *gorm.DB, column string, id uint) (models.Money, error) {
+	var open models.Money
+	err := tx.Model(&models.PaymentRefund{}).
+		Where(column+" = ? AND status <> ?", id, models.RefundProcessed).
+		Select("COALESCE(SUM(amount), 0)").Scan(&open).Error
+	return open, err
+}
+
+func closed(order models.Order) bool {
+	return order.Status == models.OrderCancelled || order.Status == models.OrderFailed
+}
@@ -0,0 +1,26 @@
+package payments
+
+import (
+	"easystore/models"
+	"testing"
+)
+
+func TestMatches(t *testing.T) {
+	payment := models.Payment{Amount: 12550, Currency: "INR"}
+	tests := []struct {
+		event WebhookEvent
+		want  bool
+	}{
+		{WebhookEvent{Amount: 12550, Currency: "INR"}, true},
+		{WebhookEvent{Amount: 12550, Currency: "inr"}, true},
+		{WebhookEvent{Amount: 12550}, true},
+		{WebhookEvent{Amount: 12500, Currency: "INR"}, false},
+		{WebhookEvent{Amount: 12550, Currency: "USD"}, false},
+		{WebhookEvent{Amount: 0}, false},
+	}
+	for _, tt := range tests {
+		if got := matches(payment, tt.event); got != tt.want {
+			t.Errorf("matches(%+v) = %v, want %v", tt.event, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package payments
+
+import (
+	"context"
+	"easystore/models"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+)
+
+var (
+	ErrUnknownProvider  = errors.New("Payment provider is not supported")
+	ErrInvalidSignature = errors.New("Webhook signature does not match")
+	ErrInvalidEvent     = errors.New("Webhook event could not be read")
+	ErrNoWebhookSecret  = errors.New("PAYMENT_WEBHOOK_SECRET is not set")
+	ErrNoProvider       = errors.New("PAYMENT_PROVIDER must name a real payment provider in production")
+)
+
+// Webhook event types, named the way Razorpay names them
+const (
+	EventAuthorized = "payment.authorized"
+	EventCaptured   = "payment.captured"
+	EventFailed     = "payment.failed"
+	EventRefunded   = "refund.processed"
+)
+
+// IntentRequest is what a provider is asked to collect
+type IntentRequest struct {
+	Reference string
+	Amount    models.Money
+	Currency  string
+}
+
+// Intent is a payment the provider is ready to collect. The client pays against its Ref,
+// using the ClientSecret when the provider hands one out.
+type Intent struct {
+	Ref          string
+	ClientSecret string
+}
+
+// WebhookEvent is a verified webhook delivery in a form common to every provider
+type WebhookEvent struct {
+	Id         string
+	Type       string
+	IntentRef  string
+	PaymentRef string
+	RefundRef  string
+	Amount     models.Money
+	Currency   string
+	Error      string
+}
+
+// PaymentProvider is a payment gateway. Refunds carry an idempotency key so a refund that
+// is retried after a timeout is only made once.
+type PaymentProvider interface {
+	Name() string
+	CreateIntent(ctx context.Context, request IntentRequest) (Intent, error)
+	Capture(ctx context.Context, paymentRef string, amount models.Money, currency string) error
+	// Refund returns the reference of the refund and whether it has already been processed.
+	// Refunds that are not processed yet are finished by a refund webhook.
+	Refund(ctx context.Context, paymentRef string, amount models.Money, key string) (string, bool, error)
+	VerifyWebhook(header http.Header, body []byte) (WebhookEvent, error)
+}
+
+var (
+	factories   = map[string]func() (PaymentProvider, error){}
+	providers   = map[string]PaymentProvider{}
+	providersMu sync.Mutex
+)
+
+// Setup registers the mock provider outside of production and builds the provider set in
+// PAYMENT_PROVIDER, so that a provider that can not work stops the server from starting.
+// Production has no mock provider, as anyone could sign its webhooks, and so needs a real
+// provider registered and named in PAYMENT_PROVIDER.
+func Setup() error {
+	if !production() {
+		Register("mock", func() (PaymentProvider, error) {
+			return NewMockProvider(os.Getenv("PAYMENT_WEBHOOK_SECRET"))
+		})
+	} else if os.Getenv("PAYMENT_PROVIDER") == "" {
+		return ErrNoProvider
+	}
+	_, err := Current()
+	return err
+}
+
+// Register makes a provider available under name. Providers are built on first use, after
+// the environment has been loaded.
+func Register(name string, factory func() (PaymentProvider, error)) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	factories[name] = factory
+	delete(providers, name)
+}
+
+// Provider returns the provider registered under name
+func Provider(name string) (PaymentProvider, error) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+	factory, ok := factories[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	provider, err := factory()
+	if err != nil {
+		return nil, err
+	}
+	providers[name] = provider
+	return provider, nil
+}
+
+// Current returns the provider set in PAYMENT_PROVIDER, the mock provider by default
+// outside of production
+func Current() (PaymentProvider, error) {
+	name := os.Getenv("PAYMENT_PROVIDER")
+	if name == "" && !production() {
+		name = "mock"
+	}
+	return Provider(name)
+}
+
+// Private methods
+
+func production() bool {
+	return os.Getenv("ENV") == "Production"
+}
@@ -0,0 +1,29 @@
+package payments
+
+import (
+	"context"
+	"easystore/db"
+	"log"
+	"time"
+)
+
+// RunRefunds requests and sends the refunds owed to customers every interval. It blocks, so
+// run it in its own goroutine.
+func RunRefunds(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := RequestRefunds(db.DB); err != nil {
+			log.Printf("Unable to request refunds: %v", err)
+			continue
+		}
+		sent, err := ProcessRefunds(context.Background(), db.DB)
+		if err != nil {
+			log.Printf("Unable to send refunds: %v", err)
+		}
+		if sent > 0 {
+			log.Printf("Sent %d refunds", sent)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package pricing
+
+import (
+	"easystore/models"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNoPrice = errors.New("no price is effective at the given time")
+
+// Record adds the current price of the varient to its price history when it differs from
+// the previous one. A new varient is recorded by passing a nil previous varient.
+func Record(tx *gorm.DB, varient models.ProductVarient, previous *models.ProductVarient, changedById uint) error {
+	if previous != nil {
+		if previous.SellingPrice == varient.SellingPrice && previous.Mrp == varient.Mrp {
+			return nil
+		}
+		if err := ensureHistory(tx, *previous); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	price := models.ProductVarientPrice{
+		VarientId:     varient.ID,
+		SellingPrice:  varient.SellingPrice,
+		Mrp:           varient.Mrp,
+		EffectiveFrom: now,
+		AppliedAt:     &now,
+		ChangedById:   employeeID(changedById),
+	}
+	return tx.Create(&price).Error
+}
+
+// Schedule stores a price change that is applied to the varient at effectiveFrom
+func Schedule(tx *gorm.DB, varient models.ProductVarient, sellingPrice models.Money, mrp models.Money, effectiveFrom time.Time, changedById uint) (models.ProductVarientPrice, error) {
+	price := models.ProductVarientPrice{
+		VarientId:     varient.ID,
+		SellingPrice:  sellingPrice,
+		Mrp:           mrp,
+		EffectiveFrom: effectiveFrom,
+		ChangedById:   employeeID(changedById),
+	}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		// Make sure the current price is part of the history before a future one is added
+		if err := ensureHistory(tx, varient); err != nil {
+			return err
+		}
+		return tx.Create(&price).Error
+	})
+	return price, err
+}
+
+// Cancel drops a scheduled price change that has not been applied yet
+func Cancel(tx *gorm.DB, varientId uint, priceId uint) (models.ProductVarientPrice, error) {
+	var price models.ProductVarientPrice
+	err := tx.Where("varient_id = ? AND applied_at IS NULL AND cancelled_at IS NULL", varientId).First(&price, priceId).Error
+	if err != nil {
+		return price, err
+	}
+
+	now := time.Now()
+	price.CancelledAt = &now
+	err = tx.Model(&price).Update("cancelled_at", now).Error
+	return price, err
+}
+
+// EffectivePrice returns the price of the varient that was in effect at the given time
+func EffectivePrice(tx *gorm.DB, varient models.ProductVarient, at time.Time) (models.ProductVarientPrice, error) {
+	var price models.ProductVarientPrice
+	err := tx.Where("varient_id = ? AND cancelled_at IS NULL AND effective_from <= ?", varient.ID, at).
+		Order("effective_from DESC, id DESC").
+		First(&price).Error
+	if err == nil {
+		return price, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return price, err
+	}
+
+	// Varients without any history have kept their price since they were created
+	var count int64
+	err = tx.Model(&models.ProductVarientPrice{}).Where("varient_id = ? AND cancelled_at IS NULL", varient.ID).Count(&count).Error
+	if err != nil {
+		return price, err
+	}
+	if count > 0 || at.Before(varient.CreatedAt) {
+		return price, ErrNoPrice
+	}
+
+	return models.ProductVarientPrice{
+		VarientId:     varient.ID,
+		SellingPrice:  varient.SellingPrice,
+		Mrp:           varient.Mrp,
+		EffectiveFrom: varient.CreatedAt,
+	}, nil
+}
+
+// ApplyDue copies every scheduled price that became effective to its varient.
+// Rows are locked with SKIP LOCKED so several instances can run the scheduler.
+func ApplyDue(tx *gorm.DB, now time.Time) (int, error) {
+	applied := 0
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var prices []models.ProductVarientPrice
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("applied_at IS NULL AND cancelled_at IS NULL AND effective_from <= ?", now).
+			Order("effective_from, id").
+			Find(&prices).Error
+		if err != nil {
+			return err
+		}
+
+		for _, price := range prices {
+			err := tx.Model(&models.ProductVarient{}).Where("id = ?", price.VarientId).
+				Updates(map[string]interface{}{"selling_price": price.SellingPrice, "mrp": price.Mrp}).Error
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&price).Update("applied_at", now).Error
+			if err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// ensureHistory records the price of a varient that was created before price history
+// was kept, effective from the creation of the varient
+func ensureHistory(tx *gorm.DB, varient models.ProductVarient) error {
+	var count int64
+	err := tx.Model(&models.ProductVarientPrice{}).Where("varient_id = ?", varient.ID).Count(&count).Error
+	if err != nil || count > 0 {
+		return err
+	}
+
+	baseline := models.ProductVarientPrice{
+		VarientId:     varient.ID,
+		SellingPrice:  varient.SellingPrice,
+		Mrp:           varient.Mrp,
+		EffectiveFrom: varient.CreatedAt,
+		AppliedAt:     &varient.CreatedAt,
+	}
+	return tx.Create(&baseline).Error
+}
+
+func employeeID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
@@ -0,0 +1,25 @@
+package pricing
+
+import (
+	"easystore/db"
+	"log"
+	"time"
+)
+
+// RunScheduler applies due scheduled price changes every interval. It blocks, so run it
+// in its own goroutine.
+func RunScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		applied, err := ApplyDue(db.DB, time.Now())
+		if err != nil {
+			log.Printf("Unable to apply scheduled prices: %v", err)
+			continue
+		}
+		if applied > 0 {
+			log.Printf("Applied %d scheduled prices", applied)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package promotions
+
+import (
+	"easystore/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCouponNotApplied = errors.New("Coupon can not be applied")
+	ErrUsageLimit       = errors.New("Promotion has reached its usage limit")
+)
+
+// Item is a line of a bill, cart or order to evaluate promotions against
+type Item struct {
+	Key        uint
+	VarientId  uint
+	ProductId  uint
+	CategoryId uint
+	Quantity   int
+	UnitPrice  models.Money
+}
+
+// Context is where and when the items are being sold
+type Context struct {
+	OutletId   uint
+	Channel    string
+	CustomerId *uint
+	Coupon     string
+	// At is in the time zone of the outlet, which days and happy hours are read in
+	At time.Time
+}
+
+// Applied is a promotion that took money off, with what it did in words
+type Applied struct {
+	PromotionId uint         `json:"promotion_id"`
+	Name        string       `json:"name"`
+	Type        string       `json:"type"`
+	Coupon      string       `json:"coupon,omitempty"`
+	Discount    models.Money `json:"discount"`
+	Explanation string       `json:"explanation"`
+}
+
+// LineResult is the discount of a line and the promotions it came from
+type LineResult struct {
+	Key      uint         `json:"line_id"`
+	Subtotal models.Money `json:"subtotal"`
+	Discount models.Money `json:"discount"`
+	Net      models.Money `json:"net"`
+	Applied  []Applied    `json:"applied"`
+}
+
+// CouponStatus tells whether the coupon given was applied and why not when it was not
+type CouponStatus struct {
+	Code    string `json:"code"`
+	Applied bool   `json:"applied"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// Result is the discount of every line and of every promotion that applied
+type Result struct {
+	Lines      []LineResult  `json:"lines"`
+	Promotions []Applied     `json:"promotions"`
+	Subtotal   models.Money  `json:"subtotal"`
+	Discount   models.Money  `json:"discount"`
+	Net        models.Money  `json:"net"`
+	Coupon     *CouponStatus `json:"coupon,omitempty"`
+}
+
+// Line returns the result of the line with the key
+func (r Result) Line(key uint) LineResult {
+	for _, line := range r.Lines {
+		if line.Key == key {
+			return line
+		}
+	}
+	return LineResult{Key: key}
+}
+
+// line is a line being discounted. Closed lines had a promotion that does not stack.
+type line struct {
+	item      Item
+	remaining models.Money
+	closed    bool
+	result    LineResult
+}
+
+// Evaluate works out the promotions of the outlet that apply to the items. Promotions are
+// tried from the highest priority down, each on the lines still open to it, and every
+// discount is recorded against the line it was taken from.
+func Evaluate(tx *gorm.DB, context Context, items []Item) (Result, error) {
+	result := Result{Lines: []LineResult{}, Promotions: []Applied{}}
+	if context.At.IsZero() {
+		context.At = time.Now()
+	}
+	context.Coupon = strings.ToUpper(strings.TrimSpace(context.Coupon))
+	if context.Coupon != "" {
+		result.Coupon = &CouponStatus{Code: context.Coupon}
+	}
+
+	lines := make([]*line, 0, len(items))
+	for _, item := range items {
+		subtotal := item.UnitPrice.Mul(item.Quantity)
+		lines = append(lines, &line{item: item, remaining: subtotal, result: LineResult{Key: item.Key, Subtotal: subtotal, Applied: []Applied{}}})
+		result.Subtotal += subtotal
+	}
+
+	candidates, err := load(tx, context)
+	if err != nil {
+		return result, err
+	}
+	couponFound := false
+	for _, promotion := range candidates {
+		isCoupon := promotion.CouponCode != ""
+		if isCoupon {
+			couponFound = true
+		}
+		reason, err := usable(tx, promotion, context)
+		if err != nil {
+			return result, err
+		}
+		if reason != "" {
+			if isCoupon {
+				result.Coupon.Reason = reason
+			}
+			continue
+		}
+
+		applied, reason := take(promotion, lines)
+		if reason != "" {
+			if isCoupon {
+				result.Coupon.Reason = reason
+			}
+			continue
+		}
+		if applied.Discount == 0 {
+			if isCoupon {
+				result.Coupon.Reason = "No line in the cart qualifies for the coupon"
+			}
+			continue
+		}
+		result.Promotions = append(result.Promotions, applied)
+		result.Discount += applied.Discount
+		if isCoupon {
+			result.Coupon.Applied = true
+			result.Coupon.Reason = ""
+		}
+	}
+
+	if result.Coupon != nil && !couponFound {
+		result.Coupon.Reason, err = couponMissing(tx, context)
+		if err != nil {
+			return result, err
+		}
+	}
+	for _, l := range lines {
+		l.result.Net = l.remaining
+		result.Lines = append(result.Lines, l.result)
+	}
+	result.Net = result.Subtotal - result.Discount
+	return result, nil
+}
+
+// Redeem records the use of every promotion in the result on a sale or an order. The
+// promotions with usage limits are locked and counted again, so two sales at the same time
+// can not both take the last use of a coupon. A coupon that was given but did not apply
+// fails with ErrCouponNotApplied.
+func Redeem(tx *gorm.DB, result Result, context Context, saleId *uint, orderId *uint) error {
+	if result.Coupon != nil && !result.Coupon.Applied {
+		return fmt.Errorf("%w: %s", ErrCouponNotApplied, result.Coupon.Reason)
+	}
+
+	for _, applied := range result.Promotions {
+		var promotion models.Promotion
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&promotion, applied.PromotionId).Error
+		if err != nil {
+			return err
+		}
+		reason, err := usable(tx, promotion, context)
+		if err != nil {
+			return err
+		}
+		if reason != "" {
+			return fmt.Errorf("%w: %s", ErrUsageLimit, promotion.Name)
+		}
+
+		redemption := models.PromotionRedemption{PromotionId: promotion.ID, CustomerId: context.CustomerId, SaleId: saleId, OrderId: orderId, Discount: applied.Discount}
+		if err := tx.Create(&redemption).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Release gives back the uses of promotions by an order that will not be delivered
+func Release(tx *gorm.DB, orderId uint) error {
+	return tx.Where("order_id = ?", orderId).Delete(&models.PromotionRedemption{}).Error
+}
+
+func IsPromotionError(err error) bool {
+	return errors.Is(err, ErrCouponNotApplied) || errors.Is(err, ErrUsageLimit)
+}
+
+// Private methods
+
+// load fetches the active promotions of the outlet for the channel that are running at the
+// time, the coupon given among them, highest priority first
+func load(tx *gorm.DB, context Context) ([]models.Promotion, error) {
+	var candidates []models.Promotion
+	err := tx.Preload("Targets").
+		Where("outlet_id = ? AND status = ?", context.OutletId, models.PromotionActive).
+		Where("channel IN ?", []string{models.ChannelAll, context.Channel}).
+		Where("starts_at IS NULL OR starts_at <= ?", context.At).
+		Where("ends_at IS NULL OR ends_at > ?", context.At).
+		Where("coupon_code = '' OR coupon_code = ?", context.Coupon).
+		Order("priority DESC, id").
+		Find(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	running := candidates[:0]
+	for _, promotion := range candidates {
+		if inWindow(promotion, context.At) {
+			running = append(running, promotion)
+		}
+	}
+	return running, nil
+}
+
+// take applies a promotion to the lines still open to it, recording the discount against
+// each line, and returns what it took off in all or why it does not apply
+func take(promotion models.Promotion, lines []*line) (Applied, string) {
+	var open []*line
+	for _, l := range lines {
+		if !l.closed && (promotion.Stackable || len(l.result.Applied) == 0) && covers(promotion, l.item) && l.remaining > 0 {
+			open = append(open, l)
+		}
+	}
+	discounts, reason := discount(promotion, open)
+	if reason != "" {
+		return Applied{}, reason
+	}
+
+	applied := Applied{PromotionId: promotion.ID, Name: promotion.Name, Type: promotion.Type, Coupon: promotion.CouponCode, Explanation: explain(promotion)}
+	for i, l := range open {
+		if discounts[i] <= 0 {
+			continue
+		}
+		lineApplied := applied
+		lineApplied.Discount = discounts[i]
+		l.remaining -= discounts[i]
+		l.result.Discount += discounts[i]
+		l.result.Applied = append(l.result.Applied, lineApplied)
+		if !promotion.Stackable {
+			l.closed = true
+		}
+		applied.Discount += discounts[i]
+	}
+	return applied, ""
+}
+
+// inWindow reports whether the time, in the time zone of the outlet, falls on the days and
+// within the happy hours of the promotion. Happy hours ending before they start run past
+// midnight, and the hours after midnight belong to the day they started on.
+func inWindow(promotion models.Promotion, at time.Time) bool {
+	day := at.Weekday()
+	if promotion.StartTime != "" {
+		now := at.Format("15:04")
+		if promotion.StartTime <= promotion.EndTime {
+			if now < promotion.StartTime || now >= promotion.EndTime {
+				return false
+			}
+		} else if now < promotion.EndTime {
+			day = (day + 6) % 7
+		} else if now < promotion.StartTime {
+			return false
+		}
+	}
+	return promotion.Days == "" || strings.Contains(promotion.Days, strconv.Itoa(int(day)))
+}
+
+// usable checks the usage limits of a promotion, returning why it can not be used
+func usable(tx *gorm.DB, promotion models.Promotion, context Context) (string, error) {
+	if promotion.UsageLimit > 0 {
+		var used int64
+		if err := tx.Model(&models.PromotionRedemption{}).Where("promotion_id = ?", promotion.ID).Count(&used).Error; err != nil {
+			return "", err
+		}
+		if used >= int64(promotion.UsageLimit) {
+			return "Promotion has been used up", nil
+		}
+	}
+	if promotion.PerCustomerLimit > 0 {
+		if context.CustomerId == nil {
+			return "Promotion is only for known customers, add the customer first", nil
+		}
+		var used int64
+		err := tx.Model(&models.PromotionRedemption{}).Where("promotion_id = ? AND customer_id = ?", promotion.ID, *context.CustomerId).Count(&used).Error
+		if err != nil {
+			return "", err
+		}
+		if used >= int64(promotion.PerCustomerLimit) {
+			return "Customer has already used this promotion", nil
+		}
+	}
+	return "", nil
+}
+
+// couponMissing explains why a coupon code matched no running promotion
+func couponMissing(tx *gorm.DB, context Context) (string, error) {
+	var promotion models.Promotion
+	found := tx.Where("outlet_id = ? AND coupon_code = ?", context.OutletId, context.Coupon).Limit(1).Find(&promotion)
+	if found.Error != nil {
+		return "", found.Error
+	}
+	switch {
+	case found.RowsAffected == 0:
+		return "Coupon does not exist", nil
+	case promotion.Status != models.PromotionActive:
+		return "Coupon is not active", nil
+	case promotion.Channel != models.ChannelAll && promotion.Channel != context.Channel:
+		return fmt.Sprintf("Coupon is only valid for %s sales", promotion.Channel), nil
+	case promotion.EndsAt != nil && !promotion.EndsAt.After(context.At):
+		return "Coupon has expired", nil
+	}
+	return "Coupon is not valid at this time", nil
+}
+
+// covers reports whether an item is one of the targets of a promotion
+func covers(promotion models.Promotion, item Item) bool {
+	if len(promotion.Targets) == 0 {
+		return true
+	}
+	for _, target := range promotion.Targets {
+		if (target.VarientId != nil && *target.VarientId == item.VarientId) ||
+			(target.ProductId != nil && *target.ProductId == item.ProductId) ||
+			(target.CategoryId != nil && *target.CategoryId == item.CategoryId) {
+			return true
+		}
+	}
+	return false
+}
+
+// explain describes what a promotion gives in words
+func explain(promotion models.Promotion) string {
+	var text string
+	switch promotion.Type {
+	case models.PromotionPercent:
+		text = fmt.Sprintf("%d%% off", promotion.PercentOff)
+	case models.PromotionFlat:
+		text = fmt.Sprintf("%s off", promotion.AmountOff.Format(models.DefaultCurrency))
+	case models.PromotionBuyXGetY:
+		if promotion.PercentOff == 100 {
+			text = fmt.Sprintf("Buy %d get %d free", promotion.BuyQuantity, promotion.GetQuantity)
+		} else {
+			text = fmt.Sprintf("Buy %d get %d at %d%% off", promotion.BuyQuantity, promotion.GetQuantity, promotion.PercentOff)
+		}
+	case models.PromotionBundle:
+		text = fmt.Sprintf("Any %d for %s", promotion.BundleQuantity, promotion.BundlePrice.Format(models.DefaultCurrency))
+	}
+	if promotion.MinSubtotal > 0 {
+		text += fmt.Sprintf(" on %s or more", promotion.MinSubtotal.Format(models.DefaultCurrency))
+	}
+	if promotion.MaxDiscount > 0 {
+		text += fmt.Sprintf(", up to %s", promotion.MaxDiscount.Format(models.DefaultCurrency))
+	}
+	if promotion.StartTime != "" {
+		text += fmt.Sprintf(", happy hours %s to %s", promotion.StartTime, promotion.EndTime)
+	}
+	if promotion.CouponCode != "" {
+		text += " with coupon " + promotion.CouponCode
+	}
+	return text
+}
+
+// sortUnits orders units from the most to the least expensive, keeping the order of the
+// lines for units of the same price
+func sortUnits(units []unit) {
+	sort.SliceStable(units, func(i, j int) bool { return units[i].price > units[j].price })
+}
@@ -0,0 +1,177 @@
+package promotions
+
+import (
+	"easystore/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// open makes the lines of items the way Evaluate does
+func open(items ...Item) []*line {
+	lines := make([]*line, 0, len(items))
+	for _, item := range items {
+		subtotal := item.UnitPrice.Mul(item.Quantity)
+		lines = append(lines, &line{item: item, remaining: subtotal, result: LineResult{Key: item.Key, Subtotal: subtotal, Applied: []Applied{}}})
+	}
+	return lines
+}
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		items     []Item
+		want      []models.Money
+		reason    string
+	}{
+		{
+			name:      "percent rounds each line",
+			promotion: models.Promotion{Type: models.PromotionPercent, PercentOff: 10},
+			items:     []Item{{Quantity: 1, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 999}},
+			want:      []models.Money{1000, 100},
+		},
+		{
+			name:      "flat is shared by line amount",
+			promotion: models.Promotion{Type: models.PromotionFlat, AmountOff: 10000},
+			items:     []Item{{Quantity: 2, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 10000}},
+			want:      []models.Money{6667, 3333},
+		},
+		{
+			name:      "flat takes at most the lines",
+			promotion: models.Promotion{Type: models.PromotionFlat, AmountOff: 50000},
+			items:     []Item{{Quantity: 2, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 10000}},
+			want:      []models.Money{20000, 10000},
+		},
+		{
+			name:      "buy 2 get 1 gives the cheapest of every group",
+			promotion: models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1, PercentOff: 100},
+			items:     []Item{{Quantity: 2, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 5000}, {Quantity: 3, UnitPrice: 2000}},
+			want:      []models.Money{0, 5000, 2000},
+		},
+		{
+			name:      "buy 2 get 1 leaves a partial group",
+			promotion: models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1, PercentOff: 100},
+			items:     []Item{{Quantity: 5, UnitPrice: 1000}},
+			want:      []models.Money{1000},
+		},
+		{
+			name:      "buy 1 get 1 at half price",
+			promotion: models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 1, GetQuantity: 1, PercentOff: 50},
+			items:     []Item{{Quantity: 1, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 5000}},
+			want:      []models.Money{0, 2500},
+		},
+		{
+			name:      "buy 2 get 1 needs a full group",
+			promotion: models.Promotion{Type: models.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1, PercentOff: 100},
+			items:     []Item{{Quantity: 2, UnitPrice: 1000}},
+			want:      []models.Money{0},
+			reason:    "Buy 3 to use the promotion",
+		},
+		{
+			name:      "bundle shares what it takes off",
+			promotion: models.Promotion{Type: models.PromotionBundle, BundleQuantity: 3, BundlePrice: 10000},
+			items:     []Item{{Quantity: 1, UnitPrice: 5000}, {Quantity: 1, UnitPrice: 4000}, {Quantity: 1, UnitPrice: 3000}},
+			want:      []models.Money{833, 667, 500},
+		},
+		{
+			name:      "bundle worth less than its price",
+			promotion: models.Promotion{Type: models.PromotionBundle, BundleQuantity: 2, BundlePrice: 10000},
+			items:     []Item{{Quantity: 2, UnitPrice: 4000}},
+			want:      []models.Money{0},
+		},
+		{
+			name:      "max discount caps the lines together",
+			promotion: models.Promotion{Type: models.PromotionPercent, PercentOff: 50, MaxDiscount: 5000},
+			items:     []Item{{Quantity: 1, UnitPrice: 10000}, {Quantity: 1, UnitPrice: 10000}},
+			want:      []models.Money{2500, 2500},
+		},
+		{
+			name:      "min subtotal",
+			promotion: models.Promotion{Type: models.PromotionPercent, PercentOff: 10, MinSubtotal: 50000},
+			items:     []Item{{Quantity: 3, UnitPrice: 10000}},
+			want:      []models.Money{0},
+			reason:    "Add ₹200.00 more to use the promotion",
+		},
+	}
+	for _, tt := range tests {
+		got, reason := discount(tt.promotion, open(tt.items...))
+		if reason != tt.reason || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: discount = %v, %q, want %v, %q", tt.name, got, reason, tt.want, tt.reason)
+		}
+	}
+}
+
+func TestTakeStacking(t *testing.T) {
+	varientId := uint(1)
+	lines := open(Item{Key: 1, VarientId: 1, Quantity: 1, UnitPrice: 10000}, Item{Key: 2, VarientId: 2, Quantity: 1, UnitPrice: 10000})
+
+	steps := []struct {
+		name      string
+		promotion models.Promotion
+		discount  models.Money
+		reason    string
+	}{
+		// Closes the first line to every promotion after it
+		{"targeted, not stackable", models.Promotion{Type: models.PromotionPercent, PercentOff: 10, Targets: []models.PromotionTarget{{VarientId: &varientId}}}, 1000, ""},
+		// Only the second line is open to it
+		{"stackable flat", models.Promotion{Type: models.PromotionFlat, AmountOff: 1000, Stackable: true}, 1000, ""},
+		// Both lines already have a discount
+		{"not stackable after others", models.Promotion{Type: models.PromotionPercent, PercentOff: 50}, 0, "No line qualifies for the promotion"},
+		// Applies to what is left of the second line
+		{"stackable percent", models.Promotion{Type: models.PromotionPercent, PercentOff: 10, Stackable: true}, 900, ""},
+	}
+	for _, step := range steps {
+		applied, reason := take(step.promotion, lines)
+		if applied.Discount != step.discount || reason != step.reason {
+			t.Errorf("%s: take = %d, %q, want %d, %q", step.name, applied.Discount, reason, step.discount, step.reason)
+		}
+	}
+
+	if lines[0].remaining != 9000 || len(lines[0].result.Applied) != 1 {
+		t.Errorf("first line = %d with %d promotions, want 9000 with 1", lines[0].remaining, len(lines[0].result.Applied))
+	}
+	if lines[1].remaining != 8100 || len(lines[1].result.Applied) != 2 {
+		t.Errorf("second line = %d with %d promotions, want 8100 with 2", lines[1].remaining, len(lines[1].result.Applied))
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	// 5 January 2026 is a Monday
+	at := func(day int, clock string) time.Time {
+		parsed, _ := time.Parse("15:04", clock)
+		return time.Date(2026, time.January, day, parsed.Hour(), parsed.Minute(), 0, 0, time.UTC)
+	}
+	weekdays := models.Promotion{Days: "1,2,3,4,5"}
+	evening := models.Promotion{StartTime: "17:00", EndTime: "19:00"}
+	lateNight := models.Promotion{StartTime: "22:00", EndTime: "02:00"}
+	fridayNight := models.Promotion{Days: "5", StartTime: "22:00", EndTime: "02:00"}
+
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		at        time.Time
+		want      bool
+	}{
+		{"any time", models.Promotion{}, at(4, "03:00"), true},
+		{"weekday", weekdays, at(5, "12:00"), true},
+		{"weekend", weekdays, at(4, "12:00"), false},
+		{"happy hours start", evening, at(5, "17:00"), true},
+		{"happy hours end", evening, at(5, "19:00"), false},
+		{"before happy hours", evening, at(5, "16:59"), false},
+		{"past midnight start", lateNight, at(5, "22:00"), true},
+		{"past midnight before midnight", lateNight, at(5, "23:59"), true},
+		{"past midnight after midnight", lateNight, at(6, "01:59"), true},
+		{"past midnight end", lateNight, at(6, "02:00"), false},
+		{"past midnight afternoon", lateNight, at(5, "14:00"), false},
+		{"friday night", fridayNight, at(9, "23:00"), true},
+		{"saturday morning of friday night", fridayNight, at(10, "01:00"), true},
+		{"friday morning of thursday night", fridayNight, at(9, "01:00"), false},
+		{"saturday night", fridayNight, at(10, "23:00"), false},
+	}
+	for _, tt := range tests {
+		if got := inWindow(tt.promotion, tt.at); got != tt.want {
+			t.Errorf("%s: inWindow(%s) = %v, want %v", tt.name, tt.at.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
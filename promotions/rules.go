@@ -0,0 +1,125 @@
+package promotions
+
+import (
+	"easystore/models"
+	"fmt"
+)
+
+// unit is one unit of a line with its share of what is left of the line amount
+type unit struct {
+	line  int
+	price models.Money
+}
+
+// discount works out what a promotion takes off each open line, or why it does not apply
+func discount(promotion models.Promotion, open []*line) ([]models.Money, string) {
+	discounts := make([]models.Money, len(open))
+	if len(open) == 0 {
+		return discounts, "No line qualifies for the promotion"
+	}
+
+	var subtotal models.Money
+	for _, l := range open {
+		subtotal += l.remaining
+	}
+	if subtotal < promotion.MinSubtotal {
+		return discounts, fmt.Sprintf("Add %s more to use the promotion", (promotion.MinSubtotal - subtotal).Format(models.DefaultCurrency))
+	}
+
+	switch promotion.Type {
+	case models.PromotionPercent:
+		for i, l := range open {
+			discounts[i] = l.remaining.Percent(int64(promotion.PercentOff) * 100)
+		}
+	case models.PromotionFlat:
+		amount := promotion.AmountOff
+		if amount > subtotal {
+			amount = subtotal
+		}
+		weights := make([]models.Money, len(open))
+		for i, l := range open {
+			weights[i] = l.remaining
+		}
+		discounts = allocate(amount, weights)
+	case models.PromotionBuyXGetY:
+		units := expand(open)
+		group := promotion.BuyQuantity + promotion.GetQuantity
+		if len(units) < group {
+			return discounts, fmt.Sprintf("Buy %d to use the promotion", group)
+		}
+		// In every full group the cheapest units are the ones given away
+		for start := 0; start+group <= len(units); start += group {
+			for _, free := range units[start+promotion.BuyQuantity : start+group] {
+				discounts[free.line] += free.price.Percent(int64(promotion.PercentOff) * 100)
+			}
+		}
+	case models.PromotionBundle:
+		units := expand(open)
+		if len(units) < promotion.BundleQuantity {
+			return discounts, fmt.Sprintf("Buy %d to use the promotion", promotion.BundleQuantity)
+		}
+		for start := 0; start+promotion.BundleQuantity <= len(units); start += promotion.BundleQuantity {
+			bundle := units[start : start+promotion.BundleQuantity]
+			weights := make([]models.Money, len(bundle))
+			var worth models.Money
+			for i, u := range bundle {
+				weights[i] = u.price
+				worth += u.price
+			}
+			if worth <= promotion.BundlePrice {
+				continue
+			}
+			for i, share := range allocate(worth-promotion.BundlePrice, weights) {
+				discounts[bundle[i].line] += share
+			}
+		}
+	}
+
+	var total models.Money
+	for i := range discounts {
+		if discounts[i] > open[i].remaining {
+			discounts[i] = open[i].remaining
+		}
+		total += discounts[i]
+	}
+	if promotion.MaxDiscount > 0 && total > promotion.MaxDiscount {
+		discounts = allocate(promotion.MaxDiscount, discounts)
+	}
+	return discounts, ""
+}
+
+// expand splits the open lines into units, most expensive first. The amount left of a line
+// is spread over its units with the odd paise on the first ones.
+func expand(open []*line) []unit {
+	var units []unit
+	for i, l := range open {
+		quantity := models.Money(l.item.Quantity)
+		for n := models.Money(0); n < quantity; n++ {
+			price := l.remaining / quantity
+			if n < l.remaining%quantity {
+				price++
+			}
+			units = append(units, unit{line: i, price: price})
+		}
+	}
+	sortUnits(units)
+	return units
+}
+
+// allocate splits an amount in proportion to the weights. The shares add up to the amount.
+func allocate(amount models.Money, weights []models.Money) []models.Money {
+	shares := make([]models.Money, len(weights))
+	var weight models.Money
+	for _, w := range weights {
+		weight += w
+	}
+	for i, w := range weights {
+		if weight == 0 {
+			break
+		}
+		shares[i], _ = amount.Split(int64(w), int64(weight))
+		amount -= shares[i]
+		weight -= w
+	}
+	return shares
+}
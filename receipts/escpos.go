@@ -0,0 +1,74 @@
+package receipts
+
+import "bytes"
+
+// ESC/POS commands understood by common 80mm and 58mm thermal printers
+var (
+	escInit      = []byte{0x1b, 0x40}
+	escAlign     = []byte{0x1b, 0x61}
+	escBold      = []byte{0x1b, 0x45}
+	gsSize       = []byte{0x1d, 0x21}
+	gsCut        = []byte{0x1d, 0x56, 0x42, 0x00}
+	escFeedLines = []byte{0x1b, 0x64}
+)
+
+const (
+	sizeNormal byte = 0x00
+	// Double width and double height
+	sizeLarge byte = 0x11
+	// QR error correction level M, which survives a smudged print
+	qrErrorCorrection byte = 0x31
+)
+
+// ESCPOS encodes the receipt as the bytes to send to a thermal printer. The receipt ends
+// with a partial cut after feeding the paper past the cutter.
+func (r Receipt) ESCPOS() []byte {
+	var out bytes.Buffer
+	out.Write(escInit)
+	for _, b := range r.blocks {
+		out.Write(append(escAlign, b.align))
+		if b.qr != "" {
+			writeQr(&out, b.qr, r.Paper.QrSize)
+			continue
+		}
+
+		out.Write(append(escBold, flag(b.bold)))
+		if b.large {
+			out.Write(append(gsSize, sizeLarge))
+		}
+		out.WriteString(b.text)
+		out.WriteByte('\n')
+		if b.large {
+			out.Write(append(gsSize, sizeNormal))
+		}
+	}
+	out.Write(append(escFeedLines, 4))
+	out.Write(gsCut)
+	return out.Bytes()
+}
+
+// writeQr prints a model 2 QR code with the GS ( k functions: pick the model, the module
+// size and the error correction, store the data, then print it
+func writeQr(out *bytes.Buffer, data string, size byte) {
+	qrFunction(out, 0x41, 0x32, 0x00)
+	qrFunction(out, 0x43, size)
+	qrFunction(out, 0x45, qrErrorCorrection)
+	qrFunction(out, 0x50, append([]byte{0x30}, data...)...)
+	qrFunction(out, 0x51, 0x30)
+	out.WriteByte('\n')
+}
+
+// qrFunction writes GS ( k pL pH cn fn parameters, where the length covers cn, fn and the
+// parameters
+func qrFunction(out *bytes.Buffer, fn byte, parameters ...byte) {
+	length := len(parameters) + 2
+	out.Write([]byte{0x1d, 0x28, 0x6b, byte(length % 256), byte(length / 256), 0x31, fn})
+	out.Write(parameters)
+}
+
+func flag(on bool) byte {
+	if on {
+		return 1
+	}
+	return 0
+}
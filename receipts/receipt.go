@@ -0,0 +1,314 @@
+package receipts
+
+import (
+	"easystore/hours"
+	"easystore/models"
+	"easystore/settings"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Paper is a roll width of a thermal printer with the characters of the standard font
+// that fit on a line
+type Paper struct {
+	Name    string `json:"name"`
+	Columns int    `json:"columns"`
+	// QrSize is the module size of QR codes, smaller on narrow paper so they still fit
+	QrSize byte `json:"qr_size"`
+}
+
+var (
+	Paper80 = Paper{Name: "80mm", Columns: 48, QrSize: 6}
+	Paper58 = Paper{Name: "58mm", Columns: 32, QrSize: 4}
+)
+
+// What the QR code at the bottom of a receipt holds
+const (
+	QrUpi     = "upi"
+	QrInvoice = "invoice"
+	QrNone    = "none"
+)
+
+var (
+	ErrInvalidPaper  = errors.New("Paper should be 80mm or 58mm")
+	ErrInvalidQr     = errors.New("QR should be upi, invoice or none")
+	ErrNoUpiId       = errors.New("Outlet has no UPI id to take payments on")
+	ErrNoInvoice     = errors.New("Sale has no invoice to link to")
+	ErrNoInvoiceLink = errors.New("Invoice links are not configured")
+)
+
+func ParsePaper(name string) (Paper, error) {
+	switch name {
+	case "", Paper80.Name:
+		return Paper80, nil
+	case Paper58.Name:
+		return Paper58, nil
+	}
+	return Paper{}, ErrInvalidPaper
+}
+
+// Options are the choices a terminal makes when it asks for a receipt
+type Options struct {
+	Paper Paper
+	Qr    string
+	// InvoiceLink is the base URL the invoice number is appended to for invoice QR codes
+	InvoiceLink string
+	// Settings decide the currency, the title of the invoice and the footer
+	Settings settings.Settings
+}
+
+// Receipt is a laid out receipt that can be encoded for a printer or as plain text
+type Receipt struct {
+	Paper  Paper
+	blocks []block
+}
+
+type block struct {
+	text  string
+	align byte
+	bold  bool
+	large bool
+	qr    string
+}
+
+const (
+	alignLeft   byte = 0
+	alignCenter byte = 1
+	alignRight  byte = 2
+)
+
+// Build lays out the receipt of a finalized sale with the outlet as its header. The invoice
+// is nil for sales recorded before invoicing, which print their bill number instead.
+func Build(sale models.Sale, outlet models.Outlet, invoice *models.Invoice, options Options) (Receipt, error) {
+	receipt := Receipt{Paper: options.Paper}
+	width := options.Paper.Columns
+
+	qr, err := qrPayload(sale, outlet, invoice, options)
+	if err != nil {
+		return receipt, err
+	}
+
+	// Header, the name printed at double width
+	for _, line := range wrap(ascii(outlet.Name), width/2) {
+		receipt.add(block{text: line, align: alignCenter, bold: true, large: true})
+	}
+	for _, line := range wrap(ascii(outlet.Location), width) {
+		receipt.add(block{text: line, align: alignCenter})
+	}
+	if outlet.Phone != "" {
+		receipt.add(block{text: "Ph: " + outlet.Phone, align: alignCenter})
+	}
+	if outlet.Website != "" {
+		receipt.add(block{text: ascii(outlet.Website), align: alignCenter})
+	}
+	if outlet.Gstin != "" {
+		receipt.add(block{text: "GSTIN: " + outlet.Gstin, align: alignCenter})
+	}
+	receipt.rule()
+
+	if invoice != nil {
+		receipt.add(block{text: invoiceTitle(options.Settings.TaxRegistration), align: alignCenter, bold: true})
+		if options.Settings.TaxRegistration == models.TaxComposition {
+			for _, line := range wrap("Composition taxable person, not eligible to collect tax on supplies", width) {
+				receipt.add(block{text: line, align: alignCenter})
+			}
+		}
+		receipt.add(block{text: columns("Invoice: "+invoice.Number, "", width)})
+	} else {
+		receipt.add(block{text: columns(fmt.Sprintf("Bill: %d", sale.BillId), "", width)})
+	}
+	receipt.add(block{text: columns("Date: "+sale.CreatedAt.In(hours.Of(outlet)).Format("02-01-2006 15:04"), "", width)})
+	receipt.rule()
+
+	// Lines, the name wrapped on its own lines with the quantity and amount under it
+	for _, line := range sale.Lines {
+		for _, name := range wrap(ascii(line.Name), width) {
+			receipt.add(block{text: name})
+		}
+		detail := fmt.Sprintf("  %d x %s", line.Quantity, line.UnitPrice)
+		if line.Discount > 0 {
+			detail += fmt.Sprintf(" -%s", line.Discount)
+		}
+		receipt.add(block{text: columns(detail, line.Total.String(), width)})
+	}
+	receipt.rule()
+
+	// Totals
+	receipt.add(block{text: columns("Taxable value", sale.TaxableValue.String(), width)})
+	if sale.Igst != 0 {
+		receipt.add(block{text: columns("IGST", sale.Igst.String(), width)})
+	} else {
+		receipt.add(block{text: columns("CGST", sale.Cgst.String(), width)})
+		receipt.add(block{text: columns("SGST", sale.Sgst.String(), width)})
+	}
+	if sale.Cess != 0 {
+		receipt.add(block{text: columns("Cess", sale.Cess.String(), width)})
+	}
+	if sale.RoundOff != 0 {
+		receipt.add(block{text: columns("Round off", sale.RoundOff.String(), width)})
+	}
+	receipt.add(block{text: columns("TOTAL "+currencyLabel(options.Settings.Currency), (sale.Total + sale.RoundOff).String(), width), bold: true})
+	for _, payment := range sale.Payments {
+		receipt.add(block{text: columns(strings.ToUpper(payment.Method), payment.Amount.String(), width)})
+	}
+	if sale.Change > 0 {
+		receipt.add(block{text: columns("Change", sale.Change.String(), width)})
+	}
+	receipt.rule()
+
+	if qr != "" {
+		receipt.add(block{qr: qr, align: alignCenter})
+	}
+	for _, line := range strings.Split(options.Settings.ReceiptFooter, "\n") {
+		for _, wrapped := range wrap(ascii(line), width) {
+			receipt.add(block{text: wrapped, align: alignCenter})
+		}
+	}
+	return receipt, nil
+}
+
+// Text returns the receipt as plain text for terminals without a thermal printer. QR codes
+// are printed as the text they hold.
+func (r Receipt) Text() string {
+	var text strings.Builder
+	width := r.Paper.Columns
+	for _, b := range r.blocks {
+		if b.qr != "" {
+			for _, line := range wrap(b.qr, width) {
+				text.WriteString(aligned(line, alignLeft, width))
+				text.WriteByte('\n')
+			}
+			continue
+		}
+		text.WriteString(strings.TrimRight(aligned(b.text, b.align, width), " "))
+		text.WriteByte('\n')
+	}
+	return text.String()
+}
+
+func IsReceiptError(err error) bool {
+	return errors.Is(err, ErrInvalidPaper) || errors.Is(err, ErrInvalidQr) || errors.Is(err, ErrNoUpiId) ||
+		errors.Is(err, ErrNoInvoice) || errors.Is(err, ErrNoInvoiceLink)
+}
+
+// Private methods
+
+func (r *Receipt) add(b block) {
+	r.blocks = append(r.blocks, b)
+}
+
+func (r *Receipt) rule() {
+	r.add(block{text: strings.Repeat("-", r.Paper.Columns)})
+}
+
+func qrPayload(sale models.Sale, outlet models.Outlet, invoice *models.Invoice, options Options) (string, error) {
+	switch options.Qr {
+	case QrNone:
+		return "", nil
+	case QrUpi:
+		if outlet.UpiId == "" {
+			return "", ErrNoUpiId
+		}
+		// The @ of the UPI id is kept as it is, some UPI apps do not decode it
+		link := fmt.Sprintf("upi://pay?pa=%s&pn=%s&am=%s&cu=INR", outlet.UpiId, url.PathEscape(outlet.Name), sale.Total+sale.RoundOff)
+		if invoice != nil {
+			link += "&tn=" + url.PathEscape(invoice.Number)
+		}
+		return link, nil
+	case QrInvoice:
+		if invoice == nil {
+			return "", ErrNoInvoice
+		}
+		if options.InvoiceLink == "" {
+			return "", ErrNoInvoiceLink
+		}
+		return strings.TrimRight(options.InvoiceLink, "/") + "/" + url.PathEscape(invoice.Number), nil
+	}
+	return "", ErrInvalidQr
+}
+
+// invoiceTitle is what the invoice is called under a GST registration
+func invoiceTitle(registration string) string {
+	switch registration {
+	case models.TaxComposition:
+		return "BILL OF SUPPLY"
+	case models.TaxUnregistered:
+		return "INVOICE"
+	}
+	return "TAX INVOICE"
+}
+
+// currencyLabel names the currency of totals with characters the printer fonts have
+func currencyLabel(currency models.Currency) string {
+	if currency.Code == "" || currency.Code == models.DefaultCurrency.Code {
+		return "Rs."
+	}
+	return currency.Code
+}
+
+// ascii replaces characters the printer fonts do not have
+func ascii(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '?'
+		}
+		return r
+	}, text)
+}
+
+// wrap breaks text into lines of at most width characters, at spaces where it can
+func wrap(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for len(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			lines = append(lines, word[:width])
+			word = word[width:]
+		}
+		if line == "" {
+			line = word
+		} else if len(line)+1+len(word) <= width {
+			line += " " + word
+		} else {
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// columns puts left and right on one line of width characters, cutting left short if both
+// do not fit
+func columns(left string, right string, width int) string {
+	space := width - len(right) - 1
+	if right == "" {
+		space = width
+	}
+	if len(left) > space {
+		left = left[:space]
+	}
+	return left + strings.Repeat(" ", width-len(left)-len(right)) + right
+}
+
+func aligned(text string, align byte, width int) string {
+	if len(text) >= width {
+		return text
+	}
+	switch align {
+	case alignCenter:
+		padding := (width - len(text)) / 2
+		return strings.Repeat(" ", padding) + text
+	case alignRight:
+		return strings.Repeat(" ", width-len(text)) + text
+	}
+	return text
+}
@@ -0,0 +1,230 @@
+package returns
+
+import (
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/payments"
+	"easystore/wallets"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// refundSale refunds a sale through the tenders it was paid with, in the order they were
+// taken, each up to what it paid less what has already gone back through it
+func refundSale(tx *gorm.DB, ret *models.Return, amount models.Money) error {
+	var sale models.Sale
+	err := tx.Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&sale, *ret.SaleId).Error
+	if err != nil {
+		return err
+	}
+
+	paid := map[string]models.Money{}
+	var methods []string
+	for _, payment := range sale.Payments {
+		if _, ok := paid[payment.Method]; !ok {
+			methods = append(methods, payment.Method)
+		}
+		paid[payment.Method] += payment.Amount
+	}
+	paid[models.TenderCash] -= sale.Change
+
+	var refunded []struct {
+		Method string
+		Amount models.Money
+	}
+	err = tx.Model(&models.ReturnRefund{}).
+		Select("return_refunds.method, COALESCE(SUM(return_refunds.amount), 0) AS amount").
+		Joins("JOIN returns ON returns.id = return_refunds.return_id").
+		Where("returns.sale_id = ?", sale.ID).
+		Group("return_refunds.method").
+		Scan(&refunded).Error
+	if err != nil {
+		return err
+	}
+	for _, tender := range refunded {
+		paid[tender.Method] -= tender.Amount
+	}
+
+	for _, method := range methods {
+		share := paid[method]
+		if share > amount {
+			share = amount
+		}
+		if share <= 0 {
+			continue
+		}
+		switch {
+		case method == models.TenderGiftCard:
+			share, err = giftCards(tx, ret, wallets.Source{SaleId: &sale.ID}, share)
+		case method == models.TenderStoreCredit && ret.CustomerId != nil:
+			err = credit(tx, ret, share)
+		case counterTender(method):
+			err = counter(tx, ret, method, share)
+		default:
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		amount -= share
+	}
+	return rest(tx, ret, amount)
+}
+
+// refundOrder gives back the gift cards and store credit an order was paid with first, then
+// refunds an online order through its payment provider and a cash on delivery order in cash
+// from the drawer
+func refundOrder(tx *gorm.DB, ret *models.Return, amount models.Money) error {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, *ret.OrderId).Error
+	if err != nil {
+		return err
+	}
+
+	source := wallets.Source{OrderId: &order.ID}
+	if order.GiftCardValue > 0 {
+		refunded, err := giftCards(tx, ret, source, amount)
+		if err != nil {
+			return err
+		}
+		amount -= refunded
+	}
+	if order.StoreCreditValue > 0 && amount > 0 {
+		entry, err := wallets.RefundStoreCredit(tx, ret.OutletId, order.CustomerId, source, amount, &ret.ID)
+		if err != nil {
+			return err
+		}
+		if entry.Amount > 0 {
+			refund := models.ReturnRefund{ReturnId: ret.ID, Method: models.TenderStoreCredit, Amount: entry.Amount, Reference: fmt.Sprint(entry.ID)}
+			if err := tx.Create(&refund).Error; err != nil {
+				return err
+			}
+			ret.Refunds = append(ret.Refunds, refund)
+			amount -= entry.Amount
+		}
+	}
+	if amount <= 0 {
+		return nil
+	}
+
+	if order.PaymentMethod == models.PaymentOnline {
+		if err := payments.RequestRefund(tx, order, amount); err != nil {
+			return err
+		}
+		refund := models.ReturnRefund{ReturnId: ret.ID, Method: models.PaymentOnline, Amount: amount}
+		if err := tx.Create(&refund).Error; err != nil {
+			return err
+		}
+		ret.Refunds = append(ret.Refunds, refund)
+		return nil
+	}
+
+	if err := counter(tx, ret, models.TenderCash, amount); err != nil {
+		return err
+	}
+	return tx.Model(&order).Update("amount_refunded", order.AmountRefunded+amount).Error
+}
+
+// rest refunds what the original tenders could not take back
+func rest(tx *gorm.DB, ret *models.Return, amount models.Money) error {
+	if amount <= 0 {
+		return nil
+	}
+	if ret.CustomerId != nil {
+		return credit(tx, ret, amount)
+	}
+	return counter(tx, ret, models.TenderCash, amount)
+}
+
+// counter pays a refund out of the drawer of the open shift of the employee making it
+func counter(tx *gorm.DB, ret *models.Return, method string, amount models.Money) error {
+	var shift models.Shift
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).Where("outlet_id = ? AND employee_id = ? AND status = ?", ret.OutletId, ret.EmployeeId, models.ShiftOpen).First(&shift).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNoOpenShift
+	} else if err != nil {
+		return err
+	}
+
+	refund := models.ReturnRefund{ReturnId: ret.ID, Method: method, Amount: amount, ShiftId: &shift.ID}
+	if err := tx.Create(&refund).Error; err != nil {
+		return err
+	}
+	ret.Refunds = append(ret.Refunds, refund)
+	return nil
+}
+
+// credit adds the refund to the store credit wallet of the customer
+func credit(tx *gorm.DB, ret *models.Return, amount models.Money) error {
+	if ret.CustomerId == nil {
+		return ErrCustomerRequired
+	}
+	entry, err := wallets.CreditStoreCredit(tx, ret.OutletId, *ret.CustomerId, amount, &ret.ID, fmt.Sprintf("Refund of return %d", ret.ID))
+	if err != nil {
+		return err
+	}
+
+	refund := models.ReturnRefund{ReturnId: ret.ID, Method: models.TenderStoreCredit, Amount: amount, Reference: fmt.Sprint(entry.ID)}
+	if err := tx.Create(&refund).Error; err != nil {
+		return err
+	}
+	ret.Refunds = append(ret.Refunds, refund)
+	return nil
+}
+
+// giftCards gives back up to amount to the gift cards a sale or order was paid with and
+// returns how much they took
+func giftCards(tx *gorm.DB, ret *models.Return, source wallets.Source, amount models.Money) (models.Money, error) {
+	refunds, err := wallets.RefundGiftCards(tx, ret.OutletId, source, amount, &ret.ID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+	var refunded models.Money
+	for _, giftCard := range refunds {
+		refund := models.ReturnRefund{ReturnId: ret.ID, Method: models.TenderGiftCard, Amount: giftCard.Entry.Amount, Reference: giftCard.Code}
+		if err := tx.Create(&refund).Error; err != nil {
+			return refunded, err
+		}
+		ret.Refunds = append(ret.Refunds, refund)
+		refunded += giftCard.Entry.Amount
+	}
+	return refunded, nil
+}
+
+// points gives back the loyalty points spent on the goods of a return and takes back those
+// earned on them. The points given back are recorded as a refund, the rest of the return is
+// refunded in money.
+func points(tx *gorm.DB, ret *models.Return, sourceTotal models.Money) error {
+	entry, err := loyalty.Return(tx, *ret, sourceTotal)
+	if err != nil || entry.ID == 0 {
+		return err
+	}
+	refund := models.ReturnRefund{ReturnId: ret.ID, Method: models.TenderLoyaltyPoints, Amount: entry.Value, Reference: fmt.Sprint(entry.ID)}
+	if err := tx.Create(&refund).Error; err != nil {
+		return err
+	}
+	ret.Refunds = append(ret.Refunds, refund)
+	return nil
+}
+
+// Outstanding returns what is left to refund of a return
+func Outstanding(ret models.Return) models.Money {
+	outstanding := ret.Total
+	for _, refund := range ret.Refunds {
+		outstanding -= refund.Amount
+	}
+	return outstanding
+}
+
+func counterTender(method string) bool {
+	for _, tender := range models.TenderMethods {
+		if tender == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,322 @@
+package returns
+
+import (
+	"easystore/inventory"
+	"easystore/invoices"
+	"easystore/loyalty"
+	"easystore/models"
+	"easystore/payments"
+	"easystore/settings"
+	"easystore/wallets"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNoSource            = errors.New("Return should reference either a sale or an order")
+	ErrNoLines             = errors.New("Return has no lines")
+	ErrInvalidQuantity     = errors.New("Quantity should be positive")
+	ErrUnknownLine         = errors.New("Line is not part of the sale or order")
+	ErrExceedsSold         = errors.New("Quantity is more than is left to return")
+	ErrNotReturnable       = errors.New("Product can not be returned")
+	ErrWindowClosed        = errors.New("Return window has closed")
+	ErrNotDelivered        = errors.New("Only delivered orders can be returned")
+	ErrInvalidDisposition  = errors.New("Disposition should be restock or write_off")
+	ErrInvalidRefundMethod = errors.New("Refund method should be original or store_credit")
+	ErrCustomerRequired    = errors.New("Store credit can only be given to a customer")
+	ErrNoOpenShift         = errors.New("Open a shift before refunding at the counter")
+)
+
+// LineRequest is part of a sale or order line being brought back
+type LineRequest struct {
+	LineId      uint
+	Quantity    int
+	Disposition string
+	Reason      string
+}
+
+// Request is everything needed to record a return. Exactly one of SaleId and OrderId is set.
+type Request struct {
+	Outlet       models.Outlet
+	SaleId       uint
+	OrderId      uint
+	EmployeeId   uint
+	RefundMethod string
+	Reason       string
+	Lines        []LineRequest
+}
+
+// soldLine is a sale or order line as it was sold
+type soldLine struct {
+	Id           uint
+	VarientId    uint
+	ProductId    uint
+	Name         string
+	HsnCode      string
+	Quantity     int
+	UnitPrice    models.Money
+	GstRate      int
+	CessRate     int
+	TaxableValue models.Money
+	Cgst         models.Money
+	Sgst         models.Money
+	Igst         models.Money
+	Cess         models.Money
+	Total        models.Money
+}
+
+// source is the sale or order a return is made against
+type source struct {
+	sale       *models.Sale
+	order      *models.Order
+	customerId *uint
+	soldAt     time.Time
+	lines      map[uint]soldLine
+	// lineColumn is the column of return lines pointing at the lines of the source
+	lineColumn string
+}
+
+// Create records a return, puts the goods back into stock or writes them off and refunds
+// the customer, all in one transaction. Amounts are the share of the original lines being
+// returned, worked out so that returning a line in parts adds up to exactly its total.
+// Loyalty points spent on the goods are given back as points and the rest is refunded.
+// Exchanges are not refunded here, their value goes towards the sale they are exchanged for.
+func Create(tx *gorm.DB, request Request) (models.Return, error) {
+	ret := models.Return{OutletId: request.Outlet.ID, EmployeeId: request.EmployeeId, RefundMethod: request.RefundMethod, Reason: request.Reason}
+	if ret.RefundMethod == "" {
+		ret.RefundMethod = models.RefundToOriginal
+	}
+	if ret.RefundMethod != models.RefundToOriginal && ret.RefundMethod != models.RefundToStoreCredit && ret.RefundMethod != models.RefundToExchange {
+		return ret, ErrInvalidRefundMethod
+	}
+	if (request.SaleId == 0) == (request.OrderId == 0) {
+		return ret, ErrNoSource
+	}
+	if len(request.Lines) == 0 {
+		return ret, ErrNoLines
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		src, err := load(tx, request.Outlet.ID, request.SaleId, request.OrderId)
+		if err != nil {
+			return err
+		}
+		if src.sale != nil {
+			ret.SaleId = &src.sale.ID
+		} else {
+			ret.OrderId = &src.order.ID
+		}
+		ret.CustomerId = src.customerId
+		outletSettings, err := settings.Get(tx, request.Outlet)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		returning := map[uint]int{}
+		for _, lineRequest := range request.Lines {
+			if lineRequest.Quantity <= 0 {
+				return ErrInvalidQuantity
+			}
+			if lineRequest.Disposition == "" {
+				lineRequest.Disposition = models.ReturnRestock
+			}
+			if lineRequest.Disposition != models.ReturnRestock && lineRequest.Disposition != models.ReturnWriteOff {
+				return ErrInvalidDisposition
+			}
+			line, ok := src.lines[lineRequest.LineId]
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrUnknownLine, lineRequest.LineId)
+			}
+			if err := checkWindow(tx, line, outletSettings.ReturnWindowDays, src.soldAt, now); err != nil {
+				return err
+			}
+
+			returned, err := returnedQuantity(tx, src.lineColumn, line.Id)
+			if err != nil {
+				return err
+			}
+			returned += returning[line.Id]
+			if returned+lineRequest.Quantity > line.Quantity {
+				return fmt.Errorf("%w: %s", ErrExceedsSold, line.Name)
+			}
+			returning[line.Id] += lineRequest.Quantity
+
+			returnLine := portion(line, returned, lineRequest.Quantity)
+			returnLine.Disposition = lineRequest.Disposition
+			returnLine.Reason = lineRequest.Reason
+			if src.sale != nil {
+				returnLine.SaleLineId = &line.Id
+			} else {
+				returnLine.OrderLineId = &line.Id
+			}
+			ret.Lines = append(ret.Lines, returnLine)
+
+			ret.TaxableValue += returnLine.TaxableValue
+			ret.Cgst += returnLine.Cgst
+			ret.Sgst += returnLine.Sgst
+			ret.Igst += returnLine.Igst
+			ret.Cess += returnLine.Cess
+			ret.Total += returnLine.Total
+
+			if returnLine.Disposition == models.ReturnRestock {
+				err = inventory.Increment(tx, line.VarientId, lineRequest.Quantity)
+			} else {
+				err = inventory.WriteOff(tx, line.VarientId, lineRequest.Quantity)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		ret.TotalTax = ret.Cgst + ret.Sgst + ret.Igst + ret.Cess
+
+		if err := tx.Omit("Outlet", "Refunds").Create(&ret).Error; err != nil {
+			return err
+		}
+		if _, err := invoices.IssueCreditNote(tx, ret); err != nil {
+			return err
+		}
+		sourceTotal := src.order.Total
+		if src.sale != nil {
+			sourceTotal = src.sale.Total
+		}
+		if err := points(tx, &ret, sourceTotal); err != nil {
+			return err
+		}
+		if ret.RefundMethod == models.RefundToExchange {
+			return nil
+		}
+		return Refund(tx, &ret, Outstanding(ret), ret.RefundMethod)
+	})
+	return ret, err
+}
+
+// Refund gives amount of a return back to the customer. To the original tender a sale is
+// refunded through the tenders it was paid with and an order the way it was paid, online
+// refunds going back through the payment provider. Tenders that can not take money back
+// are refunded as store credit when there is a customer and in cash otherwise. Exchange
+// refunds record the value of the return taken towards a new sale.
+func Refund(tx *gorm.DB, ret *models.Return, amount models.Money, method string) error {
+	if amount <= 0 {
+		return nil
+	}
+	switch method {
+	case models.RefundToStoreCredit:
+		return credit(tx, ret, amount)
+	case models.RefundToExchange:
+		return counter(tx, ret, models.TenderExchange, amount)
+	case models.RefundToOriginal:
+		if ret.SaleId != nil {
+			return refundSale(tx, ret, amount)
+		}
+		return refundOrder(tx, ret, amount)
+	}
+	return ErrInvalidRefundMethod
+}
+
+// IsReturnError reports whether err was caused by the request rather than the server
+func IsReturnError(err error) bool {
+	for _, returnErr := range []error{ErrNoSource, ErrNoLines, ErrInvalidQuantity, ErrUnknownLine, ErrExceedsSold, ErrNotReturnable, ErrWindowClosed, ErrNotDelivered, ErrInvalidDisposition, ErrInvalidRefundMethod, ErrCustomerRequired, ErrNoOpenShift, payments.ErrNothingToRefund, gorm.ErrRecordNotFound} {
+		if errors.Is(err, returnErr) {
+			return true
+		}
+	}
+	return loyalty.IsLoyaltyError(err) || wallets.IsWalletError(err)
+}
+
+// load fetches the sale or order of the outlet being returned against. Returns against the
+// same sale or order are serialized so their quantities can not together exceed what was sold.
+func load(tx *gorm.DB, outletId uint, saleId uint, orderId uint) (source, error) {
+	src := source{lines: map[uint]soldLine{}}
+	if saleId != 0 {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("returns:sale:%d", saleId)).Error; err != nil {
+			return src, err
+		}
+		var sale models.Sale
+		err := tx.Where("outlet_id = ?", outletId).Preload("Lines").Preload("Payments", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).First(&sale, saleId).Error
+		if err != nil {
+			return src, err
+		}
+		src.sale, src.customerId, src.soldAt, src.lineColumn = &sale, sale.CustomerId, sale.CreatedAt, "sale_line_id"
+		for _, line := range sale.Lines {
+			src.lines[line.ID] = soldLine{line.ID, line.VarientId, line.ProductId, line.Name, line.HsnCode, line.Quantity, line.UnitPrice, line.GstRate, line.CessRate, line.TaxableValue, line.Cgst, line.Sgst, line.Igst, line.Cess, line.Total}
+		}
+		return src, nil
+	}
+
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outletId).First(&order, orderId).Error
+	if err != nil {
+		return src, err
+	}
+	if order.Status != models.OrderDelivered {
+		return src, ErrNotDelivered
+	}
+	if err := tx.Where("order_id = ?", order.ID).Find(&order.Lines).Error; err != nil {
+		return src, err
+	}
+	// Delivered is the last status of an order, so it changed status when it was delivered
+	src.order, src.customerId, src.soldAt, src.lineColumn = &order, &order.CustomerId, order.StatusChangedAt, "order_line_id"
+	for _, line := range order.Lines {
+		src.lines[line.ID] = soldLine{line.ID, line.VarientId, line.ProductId, line.Name, line.HsnCode, line.Quantity, line.UnitPrice, line.GstRate, line.CessRate, line.TaxableValue, line.Cgst, line.Sgst, line.Igst, line.Cess, line.Total}
+	}
+	return src, nil
+}
+
+// checkWindow refuses lines whose category return window has closed, the window of the
+// outlet applying to categories without one. Products and categories removed since the
+// sale still decide their window.
+func checkWindow(tx *gorm.DB, line soldLine, days int, soldAt time.Time, now time.Time) error {
+	var product models.Product
+	err := tx.Unscoped().Preload("Category", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).First(&product, line.ProductId).Error
+	if err != nil {
+		return err
+	}
+	if product.Category.ReturnWindowDays != nil {
+		days = *product.Category.ReturnWindowDays
+	}
+	if days == 0 {
+		return fmt.Errorf("%w: %s", ErrNotReturnable, line.Name)
+	}
+	if now.After(soldAt.AddDate(0, 0, days)) {
+		return fmt.Errorf("%w: %s could be returned for %d days", ErrWindowClosed, line.Name, days)
+	}
+	return nil
+}
+
+func returnedQuantity(tx *gorm.DB, column string, lineId uint) (int, error) {
+	var returned int
+	err := tx.Model(&models.ReturnLine{}).Select("COALESCE(SUM(quantity), 0)").Where(column+" = ?", lineId).Scan(&returned).Error
+	return returned, err
+}
+
+// portion returns the share of line for quantity units after returned units have already
+// been returned. Each amount is the rounded share of everything returned so far less the
+// rounded share of what was returned before, so the parts always add up to the line.
+func portion(line soldLine, returned int, quantity int) models.ReturnLine {
+	part := func(amount models.Money) models.Money {
+		upto, _ := amount.Split(int64(returned+quantity), int64(line.Quantity))
+		before, _ := amount.Split(int64(returned), int64(line.Quantity))
+		return upto - before
+	}
+	return models.ReturnLine{
+		VarientId:    line.VarientId,
+		ProductId:    line.ProductId,
+		Name:         line.Name,
+		HsnCode:      line.HsnCode,
+		Quantity:     quantity,
+		UnitPrice:    line.UnitPrice,
+		GstRate:      line.GstRate,
+		CessRate:     line.CessRate,
+		TaxableValue: part(line.TaxableValue),
+		Cgst:         part(line.Cgst),
+		Sgst:         part(line.Sgst),
+		Igst:         part(line.Igst),
+		Cess:         part(line.Cess),
+		Total:        part(line.Total),
+	}
+}
@@ -0,0 +1,448 @@
+package riders
+
+import (
+	"crypto/subtle"
+	"easystore/models"
+	"easystore/orders"
+	"easystore/tracking"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	StrategyManual      = "manual"
+	StrategyLeastLoaded = "least_loaded"
+)
+
+// MaxOtpAttempts is how many wrong delivery passwords a rider can give for an order
+const MaxOtpAttempts = 5
+
+var (
+	ErrNotRider          = errors.New("Employee is not a rider of this outlet")
+	ErrOtherRole         = errors.New("Employee already has another role at this outlet")
+	ErrRiderBusy         = errors.New("Rider still has orders to deliver")
+	ErrRiderOffline      = errors.New("Rider is offline")
+	ErrNoRiderAvailable  = errors.New("No rider of this outlet is available")
+	ErrInvalidStatus     = errors.New("Status should be available or offline")
+	ErrInvalidStrategy   = errors.New("Strategy should be manual or least_loaded")
+	ErrNotAssignable     = errors.New("Only confirmed or packed orders can be assigned to a rider")
+	ErrAlreadyPickedUp   = errors.New("Order has already been picked up by its rider")
+	ErrNotAssigned       = errors.New("Order is not assigned to a rider")
+	ErrInvalidAssignment = errors.New("Assignment can not move to the requested status")
+	ErrProofRequired     = errors.New("An OTP or a photo is required as proof of delivery")
+	ErrInvalidOtp        = errors.New("OTP does not match")
+	ErrTooManyAttempts   = errors.New("Too many wrong OTPs, deliver with a photo instead")
+	ErrInvalidLocation   = errors.New("Latitude should be between -90 and 90 and longitude between -180 and 180")
+)
+
+// Load is a rider of an outlet with the orders they are carrying
+type Load struct {
+	EmployeeId      uint   `json:"employee_id"`
+	Name            string `json:"name"`
+	Phone           string `json:"phone"`
+	Status          string `json:"status"`
+	OpenAssignments int64  `json:"open_assignments"`
+	PickedUp        int64  `json:"-"`
+}
+
+// Proof is what a rider hands in to show an order was delivered
+type Proof struct {
+	Otp   string
+	Photo string
+}
+
+// Add gives an employee the rider role at the outlet
+func Add(tx *gorm.DB, outletId uint, employeeId uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var employee models.Employee
+		if err := tx.First(&employee, employeeId).Error; err != nil {
+			return err
+		}
+
+		var outletEmployee models.OutletEmployee
+		err := tx.Where("outlet_id = ? AND employee_id = ?", outletId, employeeId).First(&outletEmployee).Error
+		if err == nil {
+			if outletEmployee.Role != models.RoleRider {
+				return ErrOtherRole
+			}
+		} else if errors.Is(err, gorm.ErrRecordNotFound) {
+			outletEmployee = models.OutletEmployee{OutletId: outletId, EmployeeId: employeeId, Role: models.RoleRider}
+			if err := tx.Omit("Outlet", "Employee").Create(&outletEmployee).Error; err != nil {
+				return err
+			}
+		} else {
+			return err
+		}
+
+		rider := models.Rider{EmployeeId: employeeId, Status: models.RiderOffline}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Omit("Employee").Create(&rider).Error
+	})
+}
+
+// Remove takes the rider role at the outlet away from an employee with nothing left to
+// deliver there
+func Remove(tx *gorm.DB, outletId uint, employeeId uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var open int64
+		err := tx.Model(&models.DeliveryAssignment{}).Where("outlet_id = ? AND rider_id = ? AND ended_at IS NULL", outletId, employeeId).Count(&open).Error
+		if err != nil {
+			return err
+		}
+		if open > 0 {
+			return ErrRiderBusy
+		}
+
+		result := tx.Where("outlet_id = ? AND employee_id = ? AND role = ?", outletId, employeeId, models.RoleRider).Delete(&models.OutletEmployee{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotRider
+		}
+		return nil
+	})
+}
+
+// List returns the riders of the outlet with their status and open assignments, least
+// loaded first
+func List(tx *gorm.DB, outletId uint) ([]Load, error) {
+	loads := []Load{}
+	err := tx.Table("outlet_employees").
+		Select("employees.id AS employee_id, employees.name, employees.phone, COALESCE(riders.status, ?) AS status, "+
+			"COUNT(delivery_assignments.id) AS open_assignments, COUNT(delivery_assignments.id) FILTER (WHERE delivery_assignments.status = ?) AS picked_up",
+			models.RiderOffline, models.AssignmentPickedUp).
+		Joins("JOIN employees ON employees.id = outlet_employees.employee_id AND employees.deleted_at IS NULL").
+		Joins("LEFT JOIN riders ON riders.employee_id = employees.id").
+		Joins("LEFT JOIN delivery_assignments ON delivery_assignments.rider_id = employees.id AND delivery_assignments.ended_at IS NULL AND delivery_assignments.deleted_at IS NULL").
+		Where("outlet_employees.outlet_id = ? AND outlet_employees.role = ?", outletId, models.RoleRider).
+		Group("employees.id, employees.name, employees.phone, riders.status").
+		Order("open_assignments, employees.id").
+		Scan(&loads).Error
+	for i := range loads {
+		if loads[i].PickedUp > 0 {
+			loads[i].Status = models.RiderOnTrip
+		}
+	}
+	return loads, err
+}
+
+// Status returns the status of a rider as others see it
+func Status(tx *gorm.DB, employeeId uint) (string, error) {
+	var rider models.Rider
+	err := tx.First(&rider, employeeId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", ErrNotRider
+	} else if err != nil {
+		return "", err
+	}
+
+	var pickedUp int64
+	err = tx.Model(&models.DeliveryAssignment{}).Where("rider_id = ? AND status = ? AND ended_at IS NULL", employeeId, models.AssignmentPickedUp).Count(&pickedUp).Error
+	if pickedUp > 0 {
+		return models.RiderOnTrip, err
+	}
+	return rider.Status, err
+}
+
+// SetStatus marks a rider as available for new orders or offline
+func SetStatus(tx *gorm.DB, employeeId uint, status string) error {
+	if status != models.RiderAvailable && status != models.RiderOffline {
+		return ErrInvalidStatus
+	}
+	result := tx.Model(&models.Rider{}).Where("employee_id = ?", employeeId).Updates(map[string]interface{}{"status": status, "updated_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotRider
+	}
+	return nil
+}
+
+// Assign hands a confirmed or packed order to a rider of the outlet. With the least loaded
+// strategy the available rider with the fewest open assignments is picked. An order that
+// was assigned to another rider who has not picked it up yet is taken away from them.
+func Assign(tx *gorm.DB, outletId uint, orderId uint, strategy string, riderId uint, assignedBy uint) (models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	if strategy == "" {
+		strategy = StrategyManual
+	}
+	if strategy != StrategyManual && strategy != StrategyLeastLoaded {
+		return assignment, ErrInvalidStrategy
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outletId).First(&order, orderId).Error
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderConfirmed && order.Status != models.OrderPacked {
+			return ErrNotAssignable
+		}
+
+		// Assignments of the same outlet are serialized so concurrent least loaded picks
+		// see each other
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("riders:%d", outletId)).Error; err != nil {
+			return err
+		}
+
+		if strategy == StrategyLeastLoaded {
+			riderId, err = leastLoaded(tx, outletId)
+			if err != nil {
+				return err
+			}
+		} else if err := assignable(tx, outletId, riderId); err != nil {
+			return err
+		}
+
+		if err := end(tx, order.ID, models.AssignmentUnassigned); err != nil {
+			return err
+		}
+
+		assignment = models.DeliveryAssignment{
+			OutletId:   outletId,
+			OrderId:    order.ID,
+			RiderId:    riderId,
+			AssignedBy: assignedBy,
+			Strategy:   strategy,
+			Status:     models.AssignmentAssigned,
+		}
+		return tx.Omit("Order", "Rider").Create(&assignment).Error
+	})
+	return assignment, err
+}
+
+// Unassign takes an order away from its rider before it is picked up
+func Unassign(tx *gorm.DB, outletId uint, orderId uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		var order models.Order
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("outlet_id = ?", outletId).First(&order, orderId).Error
+		if err != nil {
+			return err
+		}
+
+		var assignment models.DeliveryAssignment
+		err = tx.Where("order_id = ? AND ended_at IS NULL", order.ID).First(&assignment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotAssigned
+		} else if err != nil {
+			return err
+		}
+		return end(tx, order.ID, models.AssignmentUnassigned)
+	})
+}
+
+// Assignments lists the open assignments of a rider at the outlet with their orders. The
+// tracking tokens of the orders are left out: the tracking page shows the customer the
+// delivery OTP, which the rider must not be able to read.
+func Assignments(tx *gorm.DB, outletId uint, riderId uint) ([]models.DeliveryAssignment, error) {
+	assignments := []models.DeliveryAssignment{}
+	err := tx.Where("outlet_id = ? AND rider_id = ? AND ended_at IS NULL", outletId, riderId).
+		Preload("Order", func(db *gorm.DB) *gorm.DB { return db.Omit("tracking_token") }).Preload("Order.Lines").Preload("Order.Slot").
+		Order("id").Find(&assignments).Error
+	return assignments, err
+}
+
+// Accept is a rider agreeing to deliver an order assigned to them
+func Accept(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint) (models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		assignment, err = lockAssignment(tx, outletId, riderId, assignmentId, models.AssignmentAssigned)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		assignment.Status = models.AssignmentAccepted
+		assignment.AcceptedAt = &now
+		return tx.Model(&assignment).Select("status", "accepted_at").Updates(&assignment).Error
+	})
+	return assignment, err
+}
+
+// Pickup is a rider collecting a packed order from the outlet, which sends the order out
+// for delivery
+func Pickup(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint) (models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		assignment, err = lockAssignment(tx, outletId, riderId, assignmentId, models.AssignmentAccepted)
+		if err != nil {
+			return err
+		}
+
+		_, err = orders.Transition(tx, outletId, assignment.OrderId, models.OrderOutForDelivery, orders.EmployeeActor(riderId), "")
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		assignment.Status = models.AssignmentPickedUp
+		assignment.PickedUpAt = &now
+		return tx.Model(&assignment).Select("status", "picked_up_at").Updates(&assignment).Error
+	})
+	return assignment, err
+}
+
+// Deliver is a rider handing over an order. The customer's OTP or a photo of the handover
+// proves it was delivered. Wrong OTPs are counted outside of the delivery so they are kept
+// when the delivery is refused.
+func Deliver(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint, proof Proof) (models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	if proof.Otp == "" && proof.Photo == "" {
+		return assignment, ErrProofRequired
+	}
+
+	if proof.Photo == "" {
+		result := tx.Model(&models.DeliveryAssignment{}).
+			Where("id = ? AND outlet_id = ? AND rider_id = ? AND status = ? AND otp_attempts < ?", assignmentId, outletId, riderId, models.AssignmentPickedUp, MaxOtpAttempts).
+			Update("otp_attempts", gorm.Expr("otp_attempts + 1"))
+		if result.Error != nil {
+			return assignment, result.Error
+		}
+		if result.RowsAffected == 0 {
+			if _, err := findAssignment(tx, outletId, riderId, assignmentId, models.AssignmentPickedUp); err != nil {
+				return assignment, err
+			}
+			return assignment, ErrTooManyAttempts
+		}
+	}
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var err error
+		assignment, err = lockAssignment(tx, outletId, riderId, assignmentId, models.AssignmentPickedUp)
+		if err != nil {
+			return err
+		}
+
+		if proof.Photo == "" {
+			var order models.Order
+			if err := tx.Select("id", "delivery_otp").First(&order, assignment.OrderId).Error; err != nil {
+				return err
+			}
+			if order.DeliveryOtp == "" || subtle.ConstantTimeCompare([]byte(order.DeliveryOtp), []byte(proof.Otp)) != 1 {
+				return ErrInvalidOtp
+			}
+			assignment.ProofType = models.ProofOtp
+		} else {
+			assignment.ProofType = models.ProofPhoto
+			assignment.ProofPhoto = proof.Photo
+		}
+
+		_, err = orders.Transition(tx, outletId, assignment.OrderId, models.OrderDelivered, orders.EmployeeActor(riderId), "")
+		if err != nil {
+			return err
+		}
+		return tx.Model(&assignment).Select("proof_type", "proof_photo").Updates(&assignment).Error
+	})
+	if err != nil {
+		return assignment, err
+	}
+	return findAssignment(tx, outletId, riderId, assignmentId, models.AssignmentDelivered)
+}
+
+// Ping records where a rider carrying an order is, for the subscribers tracking it
+func Ping(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint, latitude float64, longitude float64) (models.OrderEvent, error) {
+	event := models.OrderEvent{Type: models.OrderEventLocation, Latitude: &latitude, Longitude: &longitude}
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return event, ErrInvalidLocation
+	}
+
+	assignment, err := findAssignment(tx, outletId, riderId, assignmentId, models.AssignmentPickedUp)
+	if err != nil {
+		return event, err
+	}
+	event.OrderId = assignment.OrderId
+	event.CreatedAt = time.Now()
+	return event, tracking.Emit(tx, event)
+}
+
+// IsRiderError reports whether err was caused by the request rather than the server
+func IsRiderError(err error) bool {
+	for _, riderErr := range []error{ErrNotRider, ErrOtherRole, ErrRiderBusy, ErrRiderOffline, ErrNoRiderAvailable, ErrInvalidStatus, ErrInvalidStrategy, ErrNotAssignable, ErrAlreadyPickedUp, ErrNotAssigned, ErrInvalidAssignment, ErrProofRequired, ErrInvalidOtp, ErrTooManyAttempts, ErrInvalidLocation} {
+		if errors.Is(err, riderErr) {
+			return true
+		}
+	}
+	return orders.IsOrderError(err)
+}
+
+func leastLoaded(tx *gorm.DB, outletId uint) (uint, error) {
+	loads, err := List(tx, outletId)
+	if err != nil {
+		return 0, err
+	}
+	for _, load := range loads {
+		if load.Status != models.RiderOffline {
+			return load.EmployeeId, nil
+		}
+	}
+	return 0, ErrNoRiderAvailable
+}
+
+func assignable(tx *gorm.DB, outletId uint, riderId uint) error {
+	var count int64
+	err := tx.Model(&models.OutletEmployee{}).Where("outlet_id = ? AND employee_id = ? AND role = ?", outletId, riderId, models.RoleRider).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotRider
+	}
+
+	status, err := Status(tx, riderId)
+	if err != nil {
+		return err
+	}
+	if status == models.RiderOffline {
+		return ErrRiderOffline
+	}
+	return nil
+}
+
+// end closes the open assignment of an order unless its rider already picked it up
+func end(tx *gorm.DB, orderId uint, status string) error {
+	var assignment models.DeliveryAssignment
+	err := tx.Where("order_id = ? AND ended_at IS NULL", orderId).First(&assignment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if assignment.Status == models.AssignmentPickedUp {
+		return ErrAlreadyPickedUp
+	}
+	return tx.Model(&assignment).Updates(map[string]interface{}{"status": status, "ended_at": time.Now()}).Error
+}
+
+func findAssignment(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint, status string) (models.DeliveryAssignment, error) {
+	var assignment models.DeliveryAssignment
+	err := tx.Where("outlet_id = ? AND rider_id = ?", outletId, riderId).First(&assignment, assignmentId).Error
+	if err != nil {
+		return assignment, err
+	}
+	if assignment.Status != status {
+		return assignment, fmt.Errorf("%w: %s", ErrInvalidAssignment, assignment.Status)
+	}
+	return assignment, nil
+}
+
+// lockAssignment locks the order of an assignment before the assignment itself, the same
+// order Assign takes the locks in
+func lockAssignment(tx *gorm.DB, outletId uint, riderId uint, assignmentId uint, status string) (models.DeliveryAssignment, error) {
+	assignment, err := findAssignment(tx, outletId, riderId, assignmentId, status)
+	if err != nil {
+		return assignment, err
+	}
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.Order{}, assignment.OrderId).Error
+	if err != nil {
+		return assignment, err
+	}
+	return findAssignment(tx.Clauses(clause.Locking{Strength: "UPDATE"}), outletId, riderId, assignmentId, status)
+}
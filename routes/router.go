@@ -3,11 +3,31 @@ package routes
 import (
 	"easystore/auth"
 	_ "easystore/docs"
+	"easystore/handlers/cart_handler"
+	"easystore/handlers/catalog_handler"
+	"easystore/handlers/customer_handler"
 	employeeHandler "easystore/handlers/employee"
 	outletHandler "easystore/handlers/outlet"
+	"easystore/handlers/hours_handler"
+	"easystore/handlers/invoice_handler"
+	"easystore/handlers/loyalty_handler"
+	"easystore/handlers/order_handler"
+	"easystore/handlers/organization_handler"
+	"easystore/handlers/payment_handler"
+	"easystore/handlers/pos_handler"
 	"easystore/handlers/product_category_handler"
 	"easystore/handlers/product_varient_handler"
+	"easystore/handlers/return_handler"
+	"easystore/handlers/rider_handler"
 	product_handler "easystore/handlers/products"
+	"easystore/handlers/promotion_handler"
+	"easystore/handlers/serviceability_handler"
+	"easystore/handlers/settings_handler"
+	"easystore/handlers/slot_handler"
+	"easystore/handlers/tax_handler"
+	"easystore/handlers/tracking_handler"
+	"easystore/handlers/wallet_handler"
+	"easystore/models"
 
 	"github.com/gin-gonic/gin"
 	swaggerfiles "github.com/swaggo/files"
@@ -20,17 +40,41 @@ func Intiliaze(r *gin.Engine) {
 
 	api := r.Group("/api/v1")
 	api.POST("/employee/login", employeeHandler.Login)
+	api.POST("/organizations", organization_handler.SignUp)
+
+	// Storefronts name the organization they sell for by its public key
+	storeRoutes := api.Group("/stores/:public_key")
+	storeRoutes.Use(auth.StoreMiddleware())
+	storeRoutes.GET("/serviceability/:pincode", serviceability_handler.GetServiceability)
+	storeRoutes.GET("/serviceability/:pincode/slots", serviceability_handler.GetSlots)
+	storeRoutes.GET("/outlets/nearest", serviceability_handler.GetNearest)
+
+	api.GET("/track/:tracking_token", tracking_handler.GetTracking)
+	api.GET("/track/:tracking_token/events", tracking_handler.CustomerEvents)
+	api.GET("/track/:tracking_token/ws", tracking_handler.CustomerSocket)
+
+	// Payment providers sign their webhooks instead of logging in
+	api.POST("/payments/webhooks/:provider", payment_handler.Webhook)
+	api.POST("/payments/mock/:intent_ref", payment_handler.MockPay)
+
+	organizationRoutes := api.Group("/organization")
+	organizationRoutes.Use(auth.JWTMiddleware(), auth.OrganizationMiddleware())
+	organizationRoutes.GET("", organization_handler.GetOrganization)
+	organizationRoutes.PUT("", auth.RequireOrganizationOwner(), organization_handler.UpdateOrganization)
 
 	outletRoutes := api.Group("/outlet")
-	outletRoutes.Use(auth.JWTMiddleware())
+	outletRoutes.Use(auth.JWTMiddleware(), auth.OrganizationMiddleware())
 	outletRoutes.POST("", outletHandler.Create)
 	outletRoutes.PUT("/:outlet_id", outletHandler.Update)
 	outletRoutes.GET("", outletHandler.GetOutlets)
 	outletRoutes.GET("/:outlet_id", outletHandler.GetOutlet)
-	outletRoutes.POST("/:outlet_id/assign-pincodes", outletHandler.AssignOutletServicePincode)
+	outletRoutes.POST("/:outlet_id/assign-pincodes", auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager), outletHandler.AssignOutletServicePincode)
+	outletRoutes.POST("/:outlet_id/unassign-pincodes", auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager), outletHandler.UnassignOutletServicePincode)
+	outletRoutes.PUT("/:outlet_id/pincodes", auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager), outletHandler.ReplaceOutletServicePincodes)
+	outletRoutes.GET("/:outlet_id/pincodes", auth.OutletMiddleware(), outletHandler.GetOutletServicePincodes)
 
 	employeeRoutes := api.Group("/employee")
-	employeeRoutes.Use(auth.JWTMiddleware())
+	employeeRoutes.Use(auth.JWTMiddleware(), auth.OrganizationMiddleware())
 	employeeRoutes.POST("", employeeHandler.Create)
 	employeeRoutes.PUT("/:employee_id", employeeHandler.Update)
 	employeeRoutes.GET("", employeeHandler.GetEmployees)
@@ -55,5 +99,167 @@ func Intiliaze(r *gin.Engine) {
 	productVarientRoutes.PUT("/:varient_id", product_varient_handler.Update)
 	productVarientRoutes.GET("", product_varient_handler.GetProductVarients)
 	productVarientRoutes.GET("/:varient_id", product_varient_handler.GetProductVarient)
+	productVarientRoutes.GET("/:varient_id/prices", product_varient_handler.GetPriceHistory)
+	productVarientRoutes.POST("/:varient_id/prices", auth.RequireOutletRole(models.RoleManager), product_varient_handler.SchedulePrice)
+	productVarientRoutes.DELETE("/:varient_id/prices/:price_id", auth.RequireOutletRole(models.RoleManager), product_varient_handler.CancelScheduledPrice)
+	productVarientRoutes.GET("/:varient_id/price", product_varient_handler.GetEffectivePrice)
+
+	catalogRoutes := outletRoutes.Group("/:outlet_id/catalog")
+	catalogRoutes.Use(auth.OutletMiddleware())
+	catalogRoutes.POST("/import", auth.RequireOutletRole(models.RoleManager), catalog_handler.Import)
+	catalogRoutes.GET("/import/:job_id", catalog_handler.GetImportJob)
+	catalogRoutes.GET("/export", catalog_handler.Export)
+
+	taxRoutes := outletRoutes.Group("/:outlet_id/tax")
+	taxRoutes.Use(auth.OutletMiddleware())
+	taxRoutes.POST("/breakdown", tax_handler.Breakdown)
+
+	posRoutes := outletRoutes.Group("/:outlet_id/pos")
+	posRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	posRoutes.POST("/bills", pos_handler.OpenBill)
+	posRoutes.GET("/bills/:bill_id", pos_handler.GetBill)
+	posRoutes.POST("/bills/:bill_id/lines", pos_handler.AddLine)
+	posRoutes.PUT("/bills/:bill_id/lines/:line_id", pos_handler.UpdateLine)
+	posRoutes.DELETE("/bills/:bill_id/lines/:line_id", pos_handler.RemoveLine)
+	posRoutes.PUT("/bills/:bill_id/customer", pos_handler.SetCustomer)
+	posRoutes.PUT("/bills/:bill_id/coupon", pos_handler.SetCoupon)
+	posRoutes.DELETE("/bills/:bill_id/coupon", pos_handler.RemoveCoupon)
+	posRoutes.PUT("/bills/:bill_id/points", pos_handler.SetPoints)
+	posRoutes.DELETE("/bills/:bill_id/points", pos_handler.RemovePoints)
+	posRoutes.POST("/bills/:bill_id/gift-cards", pos_handler.AddGiftCard)
+	posRoutes.PUT("/bills/:bill_id/store-credit", pos_handler.SetStoreCredit)
+	posRoutes.DELETE("/bills/:bill_id/store-credit", pos_handler.RemoveStoreCredit)
+	posRoutes.POST("/bills/:bill_id/payments", pos_handler.AddPayment)
+	posRoutes.DELETE("/bills/:bill_id/payments/:payment_id", pos_handler.RemovePayment)
+	posRoutes.POST("/bills/:bill_id/finalize", pos_handler.FinalizeBill)
+	posRoutes.POST("/bills/:bill_id/void", pos_handler.VoidBill)
+	posRoutes.GET("/sales/:sale_id", pos_handler.GetSale)
+	posRoutes.GET("/sales/:sale_id/receipt", pos_handler.GetReceipt)
+	posRoutes.POST("/exchanges", pos_handler.Exchange)
+	posRoutes.POST("/shifts", pos_handler.OpenShift)
+	posRoutes.GET("/shifts/current", pos_handler.GetCurrentShift)
+	posRoutes.POST("/shifts/:shift_id/cash-events", pos_handler.AddCashEvent)
+	posRoutes.GET("/shifts/:shift_id/report", pos_handler.GetShiftReport)
+	posRoutes.POST("/shifts/:shift_id/close", pos_handler.CloseShift)
+
+	customerRoutes := outletRoutes.Group("/:outlet_id/customers")
+	customerRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	customerRoutes.POST("", customer_handler.Create)
+	customerRoutes.GET("", customer_handler.Lookup)
+	customerRoutes.GET("/:customer_id", customer_handler.GetCustomer)
+	customerRoutes.PUT("/:customer_id", customer_handler.Update)
+	customerRoutes.PUT("/:customer_id/consent", customer_handler.UpdateConsent)
+	customerRoutes.GET("/:customer_id/purchases", customer_handler.GetPurchases)
+	customerRoutes.GET("/:customer_id/loyalty", loyalty_handler.GetAccount)
+	customerRoutes.GET("/:customer_id/loyalty/entries", loyalty_handler.GetEntries)
+	customerRoutes.GET("/:customer_id/wallet", wallet_handler.GetWallet)
+	customerRoutes.POST("/:customer_id/merge", auth.RequireOutletRole(models.RoleManager), customer_handler.Merge)
+	customerRoutes.POST("/:customer_id/addresses", customer_handler.AddAddress)
+	customerRoutes.PUT("/:customer_id/addresses/:address_id", customer_handler.UpdateAddress)
+	customerRoutes.DELETE("/:customer_id/addresses/:address_id", customer_handler.RemoveAddress)
+	customerRoutes.GET("/:customer_id/cart", cart_handler.GetCart)
+	customerRoutes.DELETE("/:customer_id/cart", cart_handler.ClearCart)
+	customerRoutes.POST("/:customer_id/cart/lines", cart_handler.AddLine)
+	customerRoutes.PUT("/:customer_id/cart/lines/:line_id", cart_handler.UpdateLine)
+	customerRoutes.DELETE("/:customer_id/cart/lines/:line_id", cart_handler.RemoveLine)
+	customerRoutes.PUT("/:customer_id/cart/address", cart_handler.SetAddress)
+	customerRoutes.PUT("/:customer_id/cart/coupon", cart_handler.SetCoupon)
+	customerRoutes.DELETE("/:customer_id/cart/coupon", cart_handler.RemoveCoupon)
+	customerRoutes.POST("/:customer_id/cart/revalidate", cart_handler.Revalidate)
+	customerRoutes.POST("/:customer_id/cart/checkout", cart_handler.Checkout)
+
+	orderRoutes := outletRoutes.Group("/:outlet_id/orders")
+	orderRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	orderRoutes.POST("", order_handler.Create)
+	orderRoutes.GET("", order_handler.GetOrders)
+	orderRoutes.GET("/:order_id", order_handler.GetOrder)
+	orderRoutes.POST("/:order_id/transitions", order_handler.Transition)
+	orderRoutes.POST("/:order_id/slot", order_handler.BookSlot)
+	orderRoutes.POST("/:order_id/rider", rider_handler.Assign)
+	orderRoutes.DELETE("/:order_id/rider", rider_handler.Unassign)
+	orderRoutes.POST("/:order_id/payments", payment_handler.StartPayment)
+	orderRoutes.GET("/:order_id/payments", payment_handler.GetPayments)
+	orderRoutes.POST("/:order_id/stream-ticket", tracking_handler.CreateStreamTicket)
+
+	returnRoutes := outletRoutes.Group("/:outlet_id/returns")
+	returnRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	returnRoutes.POST("", return_handler.Create)
+	returnRoutes.GET("", return_handler.GetReturns)
+	returnRoutes.GET("/:return_id", return_handler.GetReturn)
+
+	invoiceRoutes := outletRoutes.Group("/:outlet_id/invoices")
+	invoiceRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	invoiceRoutes.POST("", invoice_handler.Create)
+	invoiceRoutes.GET("", invoice_handler.GetInvoices)
+	invoiceRoutes.GET("/:invoice_id", invoice_handler.GetInvoice)
+	invoiceRoutes.GET("/:invoice_id/pdf", invoice_handler.DownloadInvoice)
+
+	promotionRoutes := outletRoutes.Group("/:outlet_id/promotions")
+	promotionRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager))
+	promotionRoutes.POST("", promotion_handler.Create)
+	promotionRoutes.GET("", promotion_handler.GetPromotions)
+	promotionRoutes.GET("/:promotion_id", promotion_handler.GetPromotion)
+	promotionRoutes.PUT("/:promotion_id", promotion_handler.Update)
+	promotionRoutes.DELETE("/:promotion_id", promotion_handler.Delete)
+
+	loyaltyRoutes := outletRoutes.Group("/:outlet_id/loyalty")
+	loyaltyRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager))
+	loyaltyRoutes.GET("/rules", loyalty_handler.GetRules)
+	loyaltyRoutes.PUT("/rules", loyalty_handler.SetRule)
+	loyaltyRoutes.DELETE("/rules", loyalty_handler.DeleteRule)
+
+	giftCardRoutes := outletRoutes.Group("/:outlet_id/gift-cards")
+	giftCardRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	giftCardRoutes.POST("", auth.RequireOutletRole(models.RoleManager), wallet_handler.IssueGiftCard)
+	giftCardRoutes.GET("", auth.RequireOutletRole(models.RoleManager), wallet_handler.GetGiftCards)
+	giftCardRoutes.GET("/:code", wallet_handler.GetGiftCard)
+	giftCardRoutes.PUT("/:code/status", auth.RequireOutletRole(models.RoleManager), wallet_handler.UpdateGiftCardStatus)
+
+	settingsRoutes := outletRoutes.Group("/:outlet_id/settings")
+	settingsRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	settingsRoutes.GET("", settings_handler.GetSettings)
+	settingsRoutes.PATCH("", auth.RequireOutletRole(models.RoleManager), settings_handler.UpdateSettings)
+
+	// Browsers can not set the Authorization header on event streams and sockets
+	streamRoutes := api.Group("/outlet/:outlet_id/orders/:order_id")
+	streamRoutes.Use(auth.StreamAuthMiddleware(), auth.OrganizationMiddleware(), auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager, models.RoleCashier))
+	streamRoutes.GET("/events", tracking_handler.OrderEvents)
+	streamRoutes.GET("/ws", tracking_handler.OrderSocket)
+
+	riderRoutes := outletRoutes.Group("/:outlet_id/riders")
+	riderRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleManager))
+	riderRoutes.POST("", rider_handler.AddRider)
+	riderRoutes.GET("", rider_handler.GetRiders)
+	riderRoutes.DELETE("/:rider_id", rider_handler.RemoveRider)
+
+	tripRoutes := outletRoutes.Group("/:outlet_id/rider")
+	tripRoutes.Use(auth.OutletMiddleware(), auth.RequireOutletRole(models.RoleRider))
+	tripRoutes.GET("/assignments", rider_handler.GetAssignments)
+	tripRoutes.PUT("/status", rider_handler.SetStatus)
+	tripRoutes.POST("/assignments/:assignment_id/accept", rider_handler.Accept)
+	tripRoutes.POST("/assignments/:assignment_id/pickup", rider_handler.Pickup)
+	tripRoutes.POST("/assignments/:assignment_id/deliver", rider_handler.Deliver)
+	tripRoutes.POST("/assignments/:assignment_id/location", rider_handler.Ping)
+
+	hoursRoutes := outletRoutes.Group("/:outlet_id")
+	hoursRoutes.Use(auth.OutletMiddleware())
+	hoursRoutes.GET("/hours", hours_handler.GetHours)
+	hoursRoutes.PUT("/hours", auth.RequireOutletRole(models.RoleManager), hours_handler.SetHours)
+	hoursRoutes.POST("/holidays", auth.RequireOutletRole(models.RoleManager), hours_handler.AddHoliday)
+	hoursRoutes.DELETE("/holidays/:holiday_id", auth.RequireOutletRole(models.RoleManager), hours_handler.DeleteHoliday)
+
+	outletRoutes.GET("/:outlet_id/slots", auth.OutletMiddleware(), slot_handler.GetSlots)
+	slotTemplateRoutes := outletRoutes.Group("/:outlet_id/slot-templates")
+	slotTemplateRoutes.Use(auth.OutletMiddleware())
+	slotTemplateRoutes.GET("", slot_handler.GetTemplates)
+	slotTemplateRoutes.POST("", auth.RequireOutletRole(models.RoleManager), slot_handler.CreateTemplates)
+	slotTemplateRoutes.PUT("/:template_id", auth.RequireOutletRole(models.RoleManager), slot_handler.UpdateTemplate)
+	slotTemplateRoutes.DELETE("/:template_id", auth.RequireOutletRole(models.RoleManager), slot_handler.DeleteTemplate)
+
+	slotOverrideRoutes := outletRoutes.Group("/:outlet_id/slot-overrides")
+	slotOverrideRoutes.Use(auth.OutletMiddleware())
+	slotOverrideRoutes.GET("", slot_handler.GetOverrides)
+	slotOverrideRoutes.POST("", auth.RequireOutletRole(models.RoleManager), slot_handler.SetOverride)
+	slotOverrideRoutes.DELETE("/:override_id", auth.RequireOutletRole(models.RoleManager), slot_handler.DeleteOverride)
 
 }
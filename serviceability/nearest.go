@@ -0,0 +1,148 @@
+package serviceability
+
+import (
+	"easystore/hours"
+	"easystore/models"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MaxNearest caps how many outlets a nearest-outlet lookup returns
+const MaxNearest = 50
+
+// maxCandidates caps how many outlets are checked for being open when only open outlets
+// are wanted, so a lookup in an area where most are closed stays bounded
+const maxCandidates = 200
+
+var ErrInvalidCoordinates = errors.New("Latitude should be between -90 and 90 and longitude between -180 and 180")
+
+// haversine is the great-circle distance in kilometres, on an earth of radius 6371 km,
+// between an outlet and the point given as latitude, latitude and longitude
+const haversine = "2 * 6371 * ASIN(SQRT(POWER(SIN(RADIANS(outlets.latitude - ?) / 2), 2) + " +
+	"COS(RADIANS(?)) * COS(RADIANS(outlets.latitude)) * POWER(SIN(RADIANS(outlets.longitude - ?) / 2), 2)))"
+
+// sphere is the distance in kilometres between an outlet and the point given as longitude
+// and latitude when PostGIS is installed
+const sphere = "ST_DistanceSphere(ST_MakePoint(outlets.longitude, outlets.latitude), ST_MakePoint(?, ?)) / 1000"
+
+var (
+	postgisMutex   sync.Mutex
+	postgisChecked bool
+	postgis        bool
+)
+
+// NearestQuery is a point to find the outlets nearest to, and what the outlets should be
+type NearestQuery struct {
+	// OrganizationId is the organization the outlets belong to
+	OrganizationId uint
+	Latitude       float64
+	Longitude      float64
+	// RadiusKm leaves out outlets further away, zero for any distance
+	RadiusKm float64
+	// Pincode leaves out outlets not delivering to it
+	Pincode string
+	// OpenNow leaves out outlets closed at At
+	OpenNow bool
+	At      time.Time
+	Limit   int
+}
+
+// nearbyRow is an outlet as read with its distance
+type nearbyRow struct {
+	models.Outlet
+	DistanceKm float64
+}
+
+// NearbyOutlet is an active outlet with how far it is from the point looked up and whether
+// it is open
+type NearbyOutlet struct {
+	Outlet     models.Outlet `json:"outlet"`
+	DistanceKm float64       `json:"distance_km"`
+	Status     hours.Status  `json:"open_status"`
+}
+
+// ValidateCoordinates checks that latitude and longitude are on the globe
+func ValidateCoordinates(latitude float64, longitude float64) error {
+	if latitude < -90 || latitude > 90 || longitude < -180 || longitude > 180 {
+		return ErrInvalidCoordinates
+	}
+	return nil
+}
+
+// Nearest lists the active outlets with coordinates nearest to the point of the query,
+// closest first. Distances are worked out in the database, with PostGIS when it is
+// installed and the haversine formula otherwise.
+func Nearest(tx *gorm.DB, query NearestQuery) ([]NearbyOutlet, error) {
+	result := []NearbyOutlet{}
+	if err := ValidateCoordinates(query.Latitude, query.Longitude); err != nil {
+		return result, err
+	}
+	if query.Limit <= 0 || query.Limit > MaxNearest {
+		query.Limit = MaxNearest
+	}
+
+	distance, args := haversine, []interface{}{query.Latitude, query.Latitude, query.Longitude}
+	if hasPostgis(tx) {
+		distance, args = sphere, []interface{}{query.Longitude, query.Latitude}
+	}
+	inner := tx.Model(&models.Outlet{}).
+		Select("outlets.*, "+distance+" AS distance_km", args...).
+		Where("outlets.organization_id = ? AND outlets.status = ? AND outlets.latitude IS NOT NULL AND outlets.longitude IS NOT NULL", query.OrganizationId, "active")
+	if query.Pincode != "" {
+		inner = inner.Where("EXISTS (SELECT 1 FROM outlet_service_pincodes WHERE outlet_service_pincodes.outlet_id = outlets.id AND outlet_service_pincodes.pincode = ? AND outlet_service_pincodes.deleted_at IS NULL)", query.Pincode)
+	}
+	outer := tx.Table("(?) AS outlets", inner)
+	if query.RadiusKm > 0 {
+		outer = outer.Where("distance_km <= ?", query.RadiusKm)
+	}
+	outer = outer.Order("distance_km, id")
+
+	// Closed outlets are left out after the distances are worked out, so when only open
+	// ones are wanted the nearest are read a page at a time until enough are open or
+	// maxCandidates have been checked
+	for offset := 0; offset < maxCandidates; offset += query.Limit {
+		var rows []nearbyRow
+		if err := outer.Session(&gorm.Session{}).Offset(offset).Limit(query.Limit).Find(&rows).Error; err != nil {
+			return result, err
+		}
+
+		for _, row := range rows {
+			status, err := hours.Get(tx, row.Outlet, query.At)
+			if err != nil {
+				return result, err
+			}
+			if query.OpenNow && !status.Open {
+				continue
+			}
+			result = append(result, NearbyOutlet{Outlet: row.Outlet, DistanceKm: math.Round(row.DistanceKm*100) / 100, Status: status})
+			if len(result) == query.Limit {
+				return result, nil
+			}
+		}
+		if !query.OpenNow || len(rows) < query.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+// hasPostgis reports whether the PostGIS extension is installed. The answer is kept once the
+// check succeeds; a failed check falls back to haversine and is tried again next time.
+func hasPostgis(tx *gorm.DB) bool {
+	postgisMutex.Lock()
+	defer postgisMutex.Unlock()
+	if postgisChecked {
+		return postgis
+	}
+	var installed bool
+	err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'postgis')").Scan(&installed).Error
+	if err != nil {
+		return false
+	}
+	postgis, postgisChecked = installed, true
+	return postgis
+}
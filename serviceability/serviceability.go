@@ -0,0 +1,137 @@
+package serviceability
+
+import (
+	"easystore/models"
+	"errors"
+	"os"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Policy decides whether outlets may serve the same pincode and which of them gets an
+// order when they do
+type Policy string
+
+const (
+	// Exclusive lets only one outlet serve a pincode
+	Exclusive Policy = "exclusive"
+	// Priority lets outlets overlap and routes to the outlet with the highest priority
+	Priority Policy = "priority"
+	// LeastLoaded lets outlets overlap and routes to the outlet with the fewest open orders
+	LeastLoaded Policy = "least_loaded"
+)
+
+var (
+	ErrPincodeTaken   = errors.New("Pincode is already served by another outlet")
+	ErrNotServiceable = errors.New("No outlet delivers to this pincode")
+)
+
+// ServingOutlet is an outlet delivering to a pincode
+type ServingOutlet struct {
+	OutletId   uint   `json:"outlet_id"`
+	Identifier string `json:"identifier"`
+	Name       string `json:"name"`
+	Location   string `json:"location"`
+	Phone      string `json:"phone"`
+	Priority   int    `json:"priority"`
+	OpenOrders int64  `json:"-"`
+}
+
+// CurrentPolicy returns the overlap policy set in PINCODE_OVERLAP_POLICY, exclusive by default
+func CurrentPolicy() Policy {
+	switch policy := Policy(os.Getenv("PINCODE_OVERLAP_POLICY")); policy {
+	case Priority, LeastLoaded:
+		return policy
+	}
+	return Exclusive
+}
+
+// Assign makes the outlet serve the pincode. Under the exclusive policy the pincode must not
+// be served by any other outlet of its organization. Assigning a pincode the outlet already serves updates its
+// priority.
+func Assign(tx *gorm.DB, outletId uint, pincode string, priority int, policy Policy) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		// Assignments of the same pincode are serialized so two outlets can not both take
+		// an exclusive pincode
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "pincode:"+pincode).Error; err != nil {
+			return err
+		}
+
+		if policy == Exclusive {
+			var taken int64
+			err := tx.Model(&models.OutletServicePincode{}).Where("pincode = ? AND outlet_id <> ?", pincode, outletId).
+				Where("outlet_id IN (SELECT id FROM outlets WHERE organization_id = (SELECT organization_id FROM outlets WHERE id = ?))", outletId).
+				Count(&taken).Error
+			if err != nil {
+				return err
+			}
+			if taken > 0 {
+				return ErrPincodeTaken
+			}
+		}
+
+		servicePincode := models.OutletServicePincode{OutletId: outletId, Pincode: pincode, Priority: priority}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "outlet_id"}, {Name: "pincode"}},
+			DoUpdates: clause.AssignmentColumns([]string{"priority", "updated_at"}),
+		}).Omit("Outlet").Create(&servicePincode).Error
+	})
+}
+
+// Unassign stops the outlet from serving the pincodes and returns how many it served
+func Unassign(tx *gorm.DB, outletId uint, pincodes []string) (int64, error) {
+	result := tx.Unscoped().Where("outlet_id = ? AND pincode IN ?", outletId, pincodes).Delete(&models.OutletServicePincode{})
+	return result.RowsAffected, result.Error
+}
+
+// Serves reports whether the outlet delivers to the pincode
+func Serves(tx *gorm.DB, outletId uint, pincode string) (bool, error) {
+	var count int64
+	err := tx.Model(&models.OutletServicePincode{}).Where("outlet_id = ? AND pincode = ?", outletId, pincode).Count(&count).Error
+	return count > 0, err
+}
+
+// Outlets lists the active outlets delivering to the pincode, highest priority first.
+// With a chain only the outlets of that chain are listed.
+func Outlets(tx *gorm.DB, pincode string, chainId uint) ([]ServingOutlet, error) {
+	var outlets []ServingOutlet
+	query := tx.Model(&models.OutletServicePincode{}).
+		Select("outlets.id AS outlet_id, outlets.identifier, outlets.name, outlets.location, outlets.phone, outlet_service_pincodes.priority, "+
+			"(SELECT COUNT(*) FROM orders WHERE orders.outlet_id = outlets.id AND orders.deleted_at IS NULL AND orders.status IN ?) AS open_orders", openStatuses).
+		Joins("JOIN outlets ON outlets.id = outlet_service_pincodes.outlet_id AND outlets.deleted_at IS NULL").
+		Where("outlet_service_pincodes.pincode = ? AND outlets.status = ?", pincode, "active")
+	if chainId != 0 {
+		query = query.Where("outlets.organization_id = ?", chainId)
+	}
+	err := query.Order("outlet_service_pincodes.priority DESC, outlets.id").Scan(&outlets).Error
+	return outlets, err
+}
+
+// Route picks the outlet of the chain that should deliver an order to the pincode
+func Route(tx *gorm.DB, chainId uint, pincode string, policy Policy) (models.Outlet, error) {
+	var outlet models.Outlet
+	candidates, err := Outlets(tx, pincode, chainId)
+	if err != nil {
+		return outlet, err
+	}
+	if len(candidates) == 0 {
+		return outlet, ErrNotServiceable
+	}
+
+	// Candidates are sorted by priority, so the first one wins unless load decides
+	chosen := candidates[0]
+	if policy == LeastLoaded {
+		for _, candidate := range candidates[1:] {
+			if candidate.OpenOrders < chosen.OpenOrders {
+				chosen = candidate
+			}
+		}
+	}
+
+	err = tx.First(&outlet, chosen.OutletId).Error
+	return outlet, err
+}
+
+// openStatuses are the statuses of orders an outlet still has to deliver
+var openStatuses = []string{models.OrderPlaced, models.OrderConfirmed, models.OrderPacked, models.OrderOutForDelivery}
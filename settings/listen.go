@@ -0,0 +1,60 @@
+package settings
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Listen drops the cached settings changed through any instance of the server, reconnecting
+// when the connection drops. It blocks, so run it in its own goroutine.
+func Listen(dsn string) {
+	for {
+		err := listen(dsn)
+		log.Printf("Settings listener stopped: %v", err)
+		// Changes made while reconnecting are missed, so everything is read again
+		cache.Range(func(key, entry interface{}) bool {
+			cache.Delete(key)
+			return true
+		})
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func listen(dsn string) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		chain, outlet, _ := strings.Cut(notification.Payload, ":")
+		chainId, err := strconv.ParseUint(chain, 10, 64)
+		if err != nil {
+			continue
+		}
+		if outlet == "" {
+			Invalidate(uint(chainId), nil)
+			continue
+		}
+		outletId, err := strconv.ParseUint(outlet, 10, 64)
+		if err != nil {
+			continue
+		}
+		id := uint(outletId)
+		Invalidate(uint(chainId), &id)
+	}
+}
@@ -0,0 +1,412 @@
+package settings
+
+import (
+	"easystore/models"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// DefaultReturnWindowDays is how long products of a category without its own return
+	// window can be returned when neither the outlet nor its chain sets a window
+	DefaultReturnWindowDays = 7
+	// maxFooter is the longest receipt footer, a few lines of a 58mm receipt
+	maxFooter = 200
+	// cacheTTL is how long resolved settings are used before they are read again, in case
+	// a change announced by another instance was missed
+	cacheTTL = 5 * time.Minute
+)
+
+// Channel is the Postgres notification channel changes to settings are announced on
+const Channel = "outlet_settings"
+
+var (
+	ErrInvalidCurrency        = errors.New("Currency should be one of INR, USD, EUR or AED")
+	ErrInvalidTaxRegistration = errors.New("Tax registration should be regular, composition or unregistered")
+	ErrInvalidFooter          = errors.New("Receipt footer should be at most 200 characters")
+	ErrInvalidRounding        = errors.New("Rounding mode should be none, nearest, up or down and the rounding unit positive")
+	ErrInvalidReturnWindow    = errors.New("Return window should not be negative")
+	ErrInvalidTenders         = errors.New("Allowed tenders should name at least one of cash, card, upi, gift_card, store_credit or loyalty_points")
+	ErrUnknownSetting         = errors.New("Unknown setting to reset")
+	ErrVersionConflict        = errors.New("Settings were changed since they were fetched, fetch them again")
+	ErrTenderNotAllowed       = errors.New("Tender is not accepted at this outlet")
+)
+
+// Tenders lists every tender an outlet can accept at the counter
+var Tenders = []string{models.TenderCash, models.TenderCard, models.TenderUpi, models.TenderGiftCard, models.TenderStoreCredit, models.TenderLoyaltyPoints}
+
+// cache holds the resolved settings of outlets by outlet id. It lives in the process;
+// changes made through another instance of the server reach it through Listen, and entries
+// older than cacheTTL are read again.
+var cache sync.Map
+
+// cached is the resolved settings of an outlet with the chain they were resolved for
+type cached struct {
+	chainId  uint
+	settings Settings
+	at       time.Time
+}
+
+// Settings is what an outlet runs with, its own settings over those of its chain over the
+// defaults
+type Settings struct {
+	Currency         models.Currency `json:"currency"`
+	TaxRegistration  string          `json:"tax_registration"`
+	ReceiptFooter    string          `json:"receipt_footer"`
+	RoundingMode     string          `json:"rounding_mode"`
+	RoundingUnit     models.Money    `json:"rounding_unit"`
+	ReturnWindowDays int             `json:"return_window_days"`
+	AllowedTenders   []string        `json:"allowed_tenders"`
+	// ChainVersion and OutletVersion are the versions of the settings inherited, zero when
+	// there are none
+	ChainVersion  int `json:"chain_version"`
+	OutletVersion int `json:"outlet_version"`
+}
+
+// Patch is a change to the settings of a chain or an outlet. Settings left nil are kept and
+// those named in Reset are inherited again.
+type Patch struct {
+	CurrencyCode     *string
+	TaxRegistration  *string
+	ReceiptFooter    *string
+	RoundingMode     *string
+	RoundingUnit     *models.Money
+	ReturnWindowDays *int
+	AllowedTenders   []string
+	Reset            []string
+	// Version is the version the change was made against, zero to change whatever the
+	// version
+	Version int
+}
+
+// Defaults returns the settings of an outlet whose chain sets nothing
+func Defaults() Settings {
+	return Settings{
+		Currency:         models.DefaultCurrency,
+		TaxRegistration:  models.TaxRegular,
+		ReceiptFooter:    "Thank you, visit again!",
+		RoundingMode:     models.RoundingNone,
+		RoundingUnit:     models.Money(100),
+		ReturnWindowDays: DefaultReturnWindowDays,
+		AllowedTenders:   append([]string(nil), Tenders...),
+	}
+}
+
+// Get returns the settings of the outlet, from the cache when they were resolved lately
+func Get(tx *gorm.DB, outlet models.Outlet) (Settings, error) {
+	if entry, ok := cache.Load(outlet.ID); ok && entry.(cached).chainId == outlet.ChainId() && time.Since(entry.(cached).at) < cacheTTL {
+		return entry.(cached).settings.copy(), nil
+	}
+	chain, own, err := Find(tx, outlet)
+	if err != nil {
+		return Settings{}, err
+	}
+	settings := Defaults()
+	settings.apply(chain)
+	settings.apply(own)
+	cache.Store(outlet.ID, cached{chainId: outlet.ChainId(), settings: settings.copy(), at: time.Now()})
+	return settings, nil
+}
+
+// Find returns the settings of the chain of the outlet and of the outlet itself, nil for
+// those that were never set
+func Find(tx *gorm.DB, outlet models.Outlet) (*models.OutletSettings, *models.OutletSettings, error) {
+	var rows []models.OutletSettings
+	err := tx.Where("chain_id = ? AND (outlet_id = ? OR outlet_id IS NULL)", outlet.ChainId(), outlet.ID).Find(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	var chain, own *models.OutletSettings
+	for i := range rows {
+		if rows[i].OutletId == nil {
+			chain = &rows[i]
+		} else {
+			own = &rows[i]
+		}
+	}
+	return chain, own, nil
+}
+
+// Update changes the settings of the chain of the outlet, or of the outlet alone with
+// outletOnly, and drops the cached settings of the outlets they apply to. The change is
+// announced on Channel once it commits, so other instances drop theirs too.
+func Update(tx *gorm.DB, outlet models.Outlet, outletOnly bool, patch Patch) (models.OutletSettings, error) {
+	row := models.OutletSettings{ChainId: outlet.ChainId()}
+	if outletOnly {
+		row.OutletId = &outlet.ID
+	}
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("chain_id = ?", row.ChainId)
+		if outletOnly {
+			query = query.Where("outlet_id = ?", outlet.ID)
+		} else {
+			query = query.Where("outlet_id IS NULL")
+		}
+		err := query.First(&row).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if patch.Version != 0 && patch.Version != row.Version {
+			return fmt.Errorf("%w: they are at version %d", ErrVersionConflict, row.Version)
+		}
+
+		if err := patch.apply(&row); err != nil {
+			return err
+		}
+		if err := Validate(row); err != nil {
+			return err
+		}
+		row.Version++
+		if err := tx.Save(&row).Error; err != nil {
+			return err
+		}
+		return tx.Exec("SELECT pg_notify(?, ?)", Channel, notification(row.ChainId, row.OutletId)).Error
+	})
+	if err != nil {
+		return row, err
+	}
+	Invalidate(outlet.ChainId(), row.OutletId)
+	return row, nil
+}
+
+// Invalidate drops the cached settings of an outlet, or of every outlet of the chain when
+// outletId is nil
+func Invalidate(chainId uint, outletId *uint) {
+	if outletId != nil {
+		cache.Delete(*outletId)
+		return
+	}
+	cache.Range(func(key, entry interface{}) bool {
+		if entry.(cached).chainId == chainId {
+			cache.Delete(key)
+		}
+		return true
+	})
+}
+
+// notification is the payload announcing a change to the settings of a chain, "7", or of
+// one of its outlets, "7:42"
+func notification(chainId uint, outletId *uint) string {
+	payload := strconv.FormatUint(uint64(chainId), 10)
+	if outletId != nil {
+		payload += ":" + strconv.FormatUint(uint64(*outletId), 10)
+	}
+	return payload
+}
+
+// Validate checks the settings that are set
+func Validate(row models.OutletSettings) error {
+	if row.CurrencyCode != nil {
+		if _, ok := models.Currencies[*row.CurrencyCode]; !ok {
+			return ErrInvalidCurrency
+		}
+	}
+	if row.TaxRegistration != nil {
+		switch *row.TaxRegistration {
+		case models.TaxRegular, models.TaxComposition, models.TaxUnregistered:
+		default:
+			return ErrInvalidTaxRegistration
+		}
+	}
+	if row.ReceiptFooter != nil && len([]rune(*row.ReceiptFooter)) > maxFooter {
+		return ErrInvalidFooter
+	}
+	if row.RoundingMode != nil {
+		switch *row.RoundingMode {
+		case models.RoundingNone, models.RoundingNearest, models.RoundingUp, models.RoundingDown:
+		default:
+			return ErrInvalidRounding
+		}
+	}
+	if row.RoundingUnit != nil && *row.RoundingUnit <= 0 {
+		return ErrInvalidRounding
+	}
+	if row.ReturnWindowDays != nil && *row.ReturnWindowDays < 0 {
+		return ErrInvalidReturnWindow
+	}
+	if row.AllowedTenders != nil {
+		tenders := strings.Split(*row.AllowedTenders, ",")
+		for _, tender := range tenders {
+			if !known(tender) {
+				return fmt.Errorf("%w: %s is not a tender", ErrInvalidTenders, tender)
+			}
+		}
+	}
+	return nil
+}
+
+// Accepts reports whether the outlet takes a tender at the counter
+func (s Settings) Accepts(tender string) bool {
+	for _, allowed := range s.AllowedTenders {
+		if allowed == tender {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTender returns ErrTenderNotAllowed for a tender the outlet does not take
+func (s Settings) CheckTender(tender string) error {
+	if !s.Accepts(tender) {
+		return fmt.Errorf("%w: %s", ErrTenderNotAllowed, tender)
+	}
+	return nil
+}
+
+// Round rounds a bill total to a multiple of the rounding unit
+func (s Settings) Round(total models.Money) models.Money {
+	unit := s.RoundingUnit
+	if s.RoundingMode == models.RoundingNone || unit <= 0 {
+		return total
+	}
+	remainder := total % unit
+	if remainder < 0 {
+		remainder += unit
+	}
+	if remainder == 0 {
+		return total
+	}
+	down := total - remainder
+	switch s.RoundingMode {
+	case models.RoundingUp:
+		return down + unit
+	case models.RoundingDown:
+		return down
+	}
+	if remainder*2 >= unit {
+		return down + unit
+	}
+	return down
+}
+
+// Format displays an amount in the currency of the outlet
+func (s Settings) Format(amount models.Money) string {
+	return amount.Format(s.Currency)
+}
+
+func IsSettingsError(err error) bool {
+	return errors.Is(err, ErrInvalidCurrency) || errors.Is(err, ErrInvalidTaxRegistration) || errors.Is(err, ErrInvalidFooter) ||
+		errors.Is(err, ErrInvalidRounding) || errors.Is(err, ErrInvalidReturnWindow) || errors.Is(err, ErrInvalidTenders) ||
+		errors.Is(err, ErrUnknownSetting) || errors.Is(err, ErrTenderNotAllowed)
+}
+
+// Private methods
+
+// copy returns the settings with a list of tenders of their own, so callers cannot change
+// what is cached
+func (s Settings) copy() Settings {
+	s.AllowedTenders = append([]string(nil), s.AllowedTenders...)
+	return s
+}
+
+// apply overrides the settings with those set in row
+func (s *Settings) apply(row *models.OutletSettings) {
+	if row == nil {
+		return
+	}
+	if row.OutletId == nil {
+		s.ChainVersion = row.Version
+	} else {
+		s.OutletVersion = row.Version
+	}
+	if row.CurrencyCode != nil {
+		s.Currency = models.Currencies[*row.CurrencyCode]
+	}
+	if row.TaxRegistration != nil {
+		s.TaxRegistration = *row.TaxRegistration
+	}
+	if row.ReceiptFooter != nil {
+		s.ReceiptFooter = *row.ReceiptFooter
+	}
+	if row.RoundingMode != nil {
+		s.RoundingMode = *row.RoundingMode
+	}
+	if row.RoundingUnit != nil {
+		s.RoundingUnit = *row.RoundingUnit
+	}
+	if row.ReturnWindowDays != nil {
+		s.ReturnWindowDays = *row.ReturnWindowDays
+	}
+	if row.AllowedTenders != nil {
+		s.AllowedTenders = strings.Split(*row.AllowedTenders, ",")
+	}
+}
+
+// apply makes the change to row, resetting settings before setting the others
+func (p Patch) apply(row *models.OutletSettings) error {
+	for _, name := range p.Reset {
+		switch name {
+		case "currency_code":
+			row.CurrencyCode = nil
+		case "tax_registration":
+			row.TaxRegistration = nil
+		case "receipt_footer":
+			row.ReceiptFooter = nil
+		case "rounding_mode":
+			row.RoundingMode = nil
+		case "rounding_unit":
+			row.RoundingUnit = nil
+		case "return_window_days":
+			row.ReturnWindowDays = nil
+		case "allowed_tenders":
+			row.AllowedTenders = nil
+		default:
+			return fmt.Errorf("%w: %s", ErrUnknownSetting, name)
+		}
+	}
+
+	if p.CurrencyCode != nil {
+		code := strings.ToUpper(strings.TrimSpace(*p.CurrencyCode))
+		row.CurrencyCode = &code
+	}
+	if p.TaxRegistration != nil {
+		row.TaxRegistration = p.TaxRegistration
+	}
+	if p.ReceiptFooter != nil {
+		footer := strings.TrimSpace(*p.ReceiptFooter)
+		row.ReceiptFooter = &footer
+	}
+	if p.RoundingMode != nil {
+		row.RoundingMode = p.RoundingMode
+	}
+	if p.RoundingUnit != nil {
+		row.RoundingUnit = p.RoundingUnit
+	}
+	if p.ReturnWindowDays != nil {
+		row.ReturnWindowDays = p.ReturnWindowDays
+	}
+	if p.AllowedTenders != nil {
+		// Tenders are kept once each, in the order given
+		var tenders []string
+		seen := map[string]bool{}
+		for _, tender := range p.AllowedTenders {
+			tender = strings.ToLower(strings.TrimSpace(tender))
+			if !seen[tender] {
+				seen[tender] = true
+				tenders = append(tenders, tender)
+			}
+		}
+		if len(tenders) == 0 {
+			return ErrInvalidTenders
+		}
+		joined := strings.Join(tenders, ",")
+		row.AllowedTenders = &joined
+	}
+	return nil
+}
+
+func known(tender string) bool {
+	for _, t := range Tenders {
+		if t == tender {
+			return true
+		}
+	}
+	return false
+}
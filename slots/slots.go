@@ -0,0 +1,230 @@
+package slots
+
+import (
+	"easystore/hours"
+	"easystore/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DateLayout = "2006-01-02"
+
+var (
+	ErrInvalidTime     = errors.New("Time should be in HH:MM format")
+	ErrInvalidWindow   = errors.New("Slot should end after it starts and within the day")
+	ErrInvalidWeekday  = errors.New("Weekday should be between 0 (Sunday) and 6 (Saturday)")
+	ErrInvalidCapacity = errors.New("Capacity should be positive")
+	ErrSlotClosed      = errors.New("Deliveries are closed on this date")
+	ErrSlotUnavailable = errors.New("Slot is not available on this date")
+	ErrCutoffPassed    = errors.New("Cut-off time for this slot has passed")
+	ErrSlotFull        = errors.New("Slot is fully booked")
+)
+
+// Slot is a delivery window on a date with the capacity left in it
+type Slot struct {
+	TemplateId uint      `json:"template_id"`
+	Date       string    `json:"date"`
+	Start      string    `json:"start"`
+	End        string    `json:"end"`
+	StartsAt   time.Time `json:"starts_at"`
+	CutoffAt   time.Time `json:"cutoff_at"`
+	Capacity   int       `json:"capacity"`
+	Booked     int       `json:"booked"`
+	Available  int       `json:"available"`
+	Bookable   bool      `json:"bookable"`
+}
+
+// ParseClock reads "HH:MM" as minutes since midnight
+func ParseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, ErrInvalidTime
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// FormatClock writes minutes since midnight as "HH:MM"
+func FormatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+// ParseDate reads a date in the time zone of the outlet
+func ParseDate(outlet models.Outlet, date string) (time.Time, error) {
+	return time.ParseInLocation(DateLayout, date, hours.Of(outlet))
+}
+
+// ValidateTemplate checks the window and capacity of a template
+func ValidateTemplate(template models.DeliverySlotTemplate) error {
+	if template.Weekday < 0 || template.Weekday > 6 {
+		return ErrInvalidWeekday
+	}
+	if template.StartMinute < 0 || template.EndMinute > 24*60 || template.EndMinute <= template.StartMinute {
+		return ErrInvalidWindow
+	}
+	if template.Capacity <= 0 {
+		return ErrInvalidCapacity
+	}
+	if template.CutoffMinutes < 0 {
+		return errors.New("Cut-off should not be negative")
+	}
+	return nil
+}
+
+// Availability lists the delivery slots of the outlet on date as seen at now. There are
+// none on the holidays of the outlet and the days it does not open.
+func Availability(tx *gorm.DB, outlet models.Outlet, date time.Time, now time.Time) ([]Slot, error) {
+	result := []Slot{}
+	outletId := outlet.ID
+	open, _, err := hours.OpenOn(tx, outlet, date)
+	if err != nil || !open {
+		return result, err
+	}
+	override, err := findOverride(tx, outletId, date)
+	if err != nil {
+		return result, err
+	}
+	if override != nil && override.Closed {
+		return result, nil
+	}
+
+	var templates []models.DeliverySlotTemplate
+	err = tx.Where("outlet_id = ? AND weekday = ? AND active", outletId, int(date.Weekday())).Order("start_minute").Find(&templates).Error
+	if err != nil {
+		return result, err
+	}
+
+	var booked []models.DeliverySlot
+	err = tx.Where("outlet_id = ? AND date = ?", outletId, date.Format(DateLayout)).Find(&booked).Error
+	if err != nil {
+		return result, err
+	}
+	bookedByTemplate := make(map[uint]int)
+	for _, slot := range booked {
+		bookedByTemplate[slot.TemplateId] = slot.Booked
+	}
+
+	for _, template := range templates {
+		slot := describe(template, date, override, hours.Of(outlet))
+		slot.Booked = bookedByTemplate[template.ID]
+		if slot.Available = slot.Capacity - slot.Booked; slot.Available < 0 {
+			slot.Available = 0
+		}
+		slot.Bookable = slot.Available > 0 && now.Before(slot.CutoffAt)
+		result = append(result, slot)
+	}
+	return result, nil
+}
+
+// Book takes one place in the slot of the template on date. The place is taken by a single
+// conditional update, so concurrent bookings can never go past the capacity of the slot.
+// Slots can not be booked on the days the outlet is closed.
+func Book(tx *gorm.DB, outlet models.Outlet, templateId uint, date time.Time, now time.Time) (models.DeliverySlot, error) {
+	var slot models.DeliverySlot
+	outletId := outlet.ID
+	var template models.DeliverySlotTemplate
+	err := tx.Where("outlet_id = ? AND active", outletId).First(&template, templateId).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return slot, ErrSlotUnavailable
+	} else if err != nil {
+		return slot, err
+	}
+	if template.Weekday != int(date.Weekday()) {
+		return slot, ErrSlotUnavailable
+	}
+
+	override, err := findOverride(tx, outletId, date)
+	if err != nil {
+		return slot, err
+	}
+	if override != nil && override.Closed {
+		return slot, ErrSlotClosed
+	}
+	open, _, err := hours.OpenOn(tx, outlet, date)
+	if err != nil {
+		return slot, err
+	}
+	if !open {
+		return slot, ErrSlotClosed
+	}
+
+	described := describe(template, date, override, hours.Of(outlet))
+	if !now.Before(described.CutoffAt) {
+		return slot, ErrCutoffPassed
+	}
+
+	slot = models.DeliverySlot{
+		OutletId:    outletId,
+		TemplateId:  template.ID,
+		Date:        date,
+		StartMinute: template.StartMinute,
+		EndMinute:   template.EndMinute,
+		Capacity:    described.Capacity,
+	}
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&slot).Error
+	if err != nil {
+		return slot, err
+	}
+
+	result := tx.Model(&models.DeliverySlot{}).
+		Where("outlet_id = ? AND template_id = ? AND date = ? AND booked < ?", outletId, template.ID, date.Format(DateLayout), described.Capacity).
+		Updates(map[string]interface{}{"booked": gorm.Expr("booked + 1"), "capacity": described.Capacity})
+	if result.Error != nil {
+		return slot, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return slot, ErrSlotFull
+	}
+
+	err = tx.Where("outlet_id = ? AND template_id = ? AND date = ?", outletId, template.ID, date.Format(DateLayout)).First(&slot).Error
+	return slot, err
+}
+
+// Release gives back a place taken in a slot
+func Release(tx *gorm.DB, slotId uint) error {
+	return tx.Model(&models.DeliverySlot{}).Where("id = ? AND booked > 0", slotId).Update("booked", gorm.Expr("booked - 1")).Error
+}
+
+// Describe returns the window of a booked slot of the outlet
+func Describe(outlet models.Outlet, slot models.DeliverySlot) Slot {
+	location := hours.Of(outlet)
+	date := hours.At(slot.Date, 0, location)
+	return Slot{
+		TemplateId: slot.TemplateId,
+		Date:       date.Format(DateLayout),
+		Start:      FormatClock(slot.StartMinute),
+		End:        FormatClock(slot.EndMinute),
+		StartsAt:   hours.At(date, slot.StartMinute, location),
+		Capacity:   slot.Capacity,
+		Booked:     slot.Booked,
+	}
+}
+
+func describe(template models.DeliverySlotTemplate, date time.Time, override *models.DeliverySlotOverride, location *time.Location) Slot {
+	startsAt := hours.At(date, template.StartMinute, location)
+	slot := Slot{
+		TemplateId: template.ID,
+		Date:       date.Format(DateLayout),
+		Start:      FormatClock(template.StartMinute),
+		End:        FormatClock(template.EndMinute),
+		StartsAt:   startsAt,
+		CutoffAt:   startsAt.Add(-time.Duration(template.CutoffMinutes) * time.Minute),
+		Capacity:   template.Capacity,
+	}
+	if override != nil && override.Capacity != nil {
+		slot.Capacity = *override.Capacity
+	}
+	return slot
+}
+
+func findOverride(tx *gorm.DB, outletId uint, date time.Time) (*models.DeliverySlotOverride, error) {
+	var override models.DeliverySlotOverride
+	err := tx.Where("outlet_id = ? AND date = ?", outletId, date.Format(DateLayout)).First(&override).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	return &override, err
+}
@@ -0,0 +1,245 @@
+package tax
+
+import (
+	"easystore/models"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Mode tells whether a price already contains the tax
+type Mode string
+
+const (
+	Inclusive Mode = "inclusive"
+	Exclusive Mode = "exclusive"
+)
+
+// GST slabs in percent
+var Slabs = []int{0, 5, 12, 18, 28}
+
+var (
+	ErrInvalidSlab = errors.New("GST rate should be one of 0, 5, 12, 18 or 28")
+	ErrInvalidCess = errors.New("Cess rate should be between 0 and 300")
+	ErrInvalidHsn  = errors.New("HSN/SAC code should be 4, 6 or 8 digits")
+	ErrInvalidMode = errors.New("Pricing mode should be inclusive or exclusive")
+)
+
+// Line is a single priced item to compute tax for
+type Line struct {
+	HsnCode   string       `json:"hsn_code"`
+	UnitPrice models.Money `json:"unit_price"`
+	Quantity  int          `json:"quantity"`
+	Discount  models.Money `json:"discount"`
+	GstRate   int          `json:"gst_rate"`
+	CessRate  int          `json:"cess_rate"`
+}
+
+// Breakdown is the tax computed for a line. Intra state supplies are split into CGST
+// and SGST, inter state supplies carry IGST.
+type Breakdown struct {
+	HsnCode      string       `json:"hsn_code"`
+	Quantity     int          `json:"quantity"`
+	GstRate      int          `json:"gst_rate"`
+	CessRate     int          `json:"cess_rate"`
+	Interstate   bool         `json:"interstate"`
+	TaxableValue models.Money `json:"taxable_value"`
+	Cgst         models.Money `json:"cgst"`
+	Sgst         models.Money `json:"sgst"`
+	Igst         models.Money `json:"igst"`
+	Cess         models.Money `json:"cess"`
+	TotalTax     models.Money `json:"total_tax"`
+	Total        models.Money `json:"total"`
+}
+
+// Totals adds up the breakdowns of a bill or order
+type Totals struct {
+	TaxableValue models.Money `json:"taxable_value"`
+	Cgst         models.Money `json:"cgst"`
+	Sgst         models.Money `json:"sgst"`
+	Igst         models.Money `json:"igst"`
+	Cess         models.Money `json:"cess"`
+	TotalTax     models.Money `json:"total_tax"`
+	Total        models.Money `json:"total"`
+}
+
+// HsnSummary is the tax of all lines sharing an HSN code and rate, as printed on invoices
+type HsnSummary struct {
+	HsnCode  string `json:"hsn_code"`
+	GstRate  int    `json:"gst_rate"`
+	CessRate int    `json:"cess_rate"`
+	Quantity int    `json:"quantity"`
+	Totals
+}
+
+func ValidateSlab(gstRate int, cessRate int) error {
+	valid := false
+	for _, slab := range Slabs {
+		if gstRate == slab {
+			valid = true
+		}
+	}
+	if !valid {
+		return ErrInvalidSlab
+	}
+	if cessRate < 0 || cessRate > 300 {
+		return ErrInvalidCess
+	}
+	return nil
+}
+
+func ValidateHsn(code string) error {
+	if code == "" {
+		return nil
+	}
+	if len(code) != 4 && len(code) != 6 && len(code) != 8 {
+		return ErrInvalidHsn
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return ErrInvalidHsn
+		}
+	}
+	return nil
+}
+
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case "":
+		return Inclusive, nil
+	case Inclusive, Exclusive:
+		return Mode(mode), nil
+	}
+	return "", ErrInvalidMode
+}
+
+// IsInterstate reports whether a supply from supplyState to placeOfSupply is inter state.
+// An unknown place of supply is treated as a sale over the counter of the outlet.
+func IsInterstate(supplyState string, placeOfSupply string) bool {
+	return placeOfSupply != "" && supplyState != placeOfSupply
+}
+
+// Compute returns the tax breakdown of a line. For inclusive prices the taxable value is
+// backed out of the price, for exclusive prices the tax is added on top of it.
+func Compute(line Line, mode Mode, interstate bool) (Breakdown, error) {
+	if err := ValidateSlab(line.GstRate, line.CessRate); err != nil {
+		return Breakdown{}, err
+	}
+	if line.Quantity <= 0 {
+		return Breakdown{}, fmt.Errorf("quantity should be positive, got %d", line.Quantity)
+	}
+
+	gross := line.UnitPrice.Mul(line.Quantity) - line.Discount
+	if gross < 0 {
+		return Breakdown{}, errors.New("discount is more than the line amount")
+	}
+
+	breakdown := Breakdown{
+		HsnCode:    line.HsnCode,
+		Quantity:   line.Quantity,
+		GstRate:    line.GstRate,
+		CessRate:   line.CessRate,
+		Interstate: interstate,
+	}
+
+	var gst, cess models.Money
+	switch mode {
+	case Inclusive:
+		// gross = taxable * (100 + gst + cess) / 100
+		combinedRate := int64(line.GstRate + line.CessRate)
+		var totalTax models.Money
+		breakdown.TaxableValue, totalTax = gross.Split(100, 100+combinedRate)
+		gst, cess = totalTax.Split(int64(line.GstRate), combinedRate)
+	case Exclusive:
+		breakdown.TaxableValue = gross
+		gst = gross.Percent(int64(line.GstRate) * 100)
+		cess = gross.Percent(int64(line.CessRate) * 100)
+	default:
+		return Breakdown{}, ErrInvalidMode
+	}
+
+	if interstate {
+		breakdown.Igst = gst
+	} else {
+		breakdown.Cgst, breakdown.Sgst = gst.Split(1, 2)
+	}
+	breakdown.Cess = cess
+	breakdown.TotalTax = gst + cess
+	breakdown.Total = breakdown.TaxableValue + breakdown.TotalTax
+	return breakdown, nil
+}
+
+// ComputeLines computes every line and the totals of all of them
+func ComputeLines(lines []Line, mode Mode, interstate bool) ([]Breakdown, Totals, error) {
+	var totals Totals
+	breakdowns := make([]Breakdown, 0, len(lines))
+	for i, line := range lines {
+		breakdown, err := Compute(line, mode, interstate)
+		if err != nil {
+			return nil, totals, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		breakdowns = append(breakdowns, breakdown)
+		totals.add(breakdown)
+	}
+	return breakdowns, totals, nil
+}
+
+// SummarizeByHsn groups breakdowns by HSN code and rate
+func SummarizeByHsn(breakdowns []Breakdown) []HsnSummary {
+	summaries := make(map[string]*HsnSummary)
+	var keys []string
+	for _, breakdown := range breakdowns {
+		key := fmt.Sprintf("%s/%d/%d", breakdown.HsnCode, breakdown.GstRate, breakdown.CessRate)
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &HsnSummary{HsnCode: breakdown.HsnCode, GstRate: breakdown.GstRate, CessRate: breakdown.CessRate}
+			summaries[key] = summary
+			keys = append(keys, key)
+		}
+		summary.Quantity += breakdown.Quantity
+		summary.add(breakdown)
+	}
+
+	sort.Strings(keys)
+	result := make([]HsnSummary, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *summaries[key])
+	}
+	return result
+}
+
+func (t *Totals) add(breakdown Breakdown) {
+	t.TaxableValue += breakdown.TaxableValue
+	t.Cgst += breakdown.Cgst
+	t.Sgst += breakdown.Sgst
+	t.Igst += breakdown.Igst
+	t.Cess += breakdown.Cess
+	t.TotalTax += breakdown.TotalTax
+	t.Total += breakdown.Total
+}
+
+// LineFor builds the tax line of a product sold at unitPrice
+func LineFor(product models.Product, unitPrice models.Money, quantity int, discount models.Money) Line {
+	return Line{
+		HsnCode:   product.HsnCode,
+		UnitPrice: unitPrice,
+		Quantity:  quantity,
+		Discount:  discount,
+		GstRate:   product.GstRate,
+		CessRate:  product.CessRate,
+	}
+}
+
+// ModeFor returns the pricing mode of an outlet, inclusive unless configured otherwise
+func ModeFor(outlet models.Outlet) Mode {
+	mode, err := ParseMode(outlet.PricingMode)
+	if err != nil {
+		return Inclusive
+	}
+	return mode
+}
+
+// InterstateFor reports whether a sale of the outlet to placeOfSupply is inter state
+func InterstateFor(outlet models.Outlet, placeOfSupply string) bool {
+	return IsInterstate(OutletState(outlet.StateCode, outlet.Location), placeOfSupply)
+}
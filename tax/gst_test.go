@@ -0,0 +1,181 @@
+package tax
+
+import (
+	"easystore/models"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name       string
+		line       Line
+		mode       Mode
+		interstate bool
+		want       Breakdown
+	}{
+		{
+			name: "exclusive intra state",
+			line: Line{UnitPrice: 10000, Quantity: 1, GstRate: 18},
+			mode: Exclusive,
+			want: Breakdown{TaxableValue: 10000, Cgst: 900, Sgst: 900, TotalTax: 1800, Total: 11800},
+		},
+		{
+			name: "inclusive intra state",
+			line: Line{UnitPrice: 11800, Quantity: 1, GstRate: 18},
+			mode: Inclusive,
+			want: Breakdown{TaxableValue: 10000, Cgst: 900, Sgst: 900, TotalTax: 1800, Total: 11800},
+		},
+		{
+			name:       "exclusive inter state",
+			line:       Line{UnitPrice: 10000, Quantity: 1, GstRate: 18},
+			mode:       Exclusive,
+			interstate: true,
+			want:       Breakdown{TaxableValue: 10000, Igst: 1800, TotalTax: 1800, Total: 11800},
+		},
+		{
+			name:       "inclusive inter state",
+			line:       Line{UnitPrice: 1000, Quantity: 1, GstRate: 5},
+			mode:       Inclusive,
+			interstate: true,
+			want:       Breakdown{TaxableValue: 952, Igst: 48, TotalTax: 48, Total: 1000},
+		},
+		{
+			name: "inclusive backs out a rounded taxable value",
+			line: Line{UnitPrice: 1000, Quantity: 1, GstRate: 5},
+			mode: Inclusive,
+			want: Breakdown{TaxableValue: 952, Cgst: 24, Sgst: 24, TotalTax: 48, Total: 1000},
+		},
+		{
+			name: "odd paisa of GST goes to CGST",
+			line: Line{UnitPrice: 1010, Quantity: 1, GstRate: 5},
+			mode: Exclusive,
+			want: Breakdown{TaxableValue: 1010, Cgst: 26, Sgst: 25, TotalTax: 51, Total: 1061},
+		},
+		{
+			name: "exclusive with cess",
+			line: Line{UnitPrice: 100000, Quantity: 1, GstRate: 28, CessRate: 12},
+			mode: Exclusive,
+			want: Breakdown{TaxableValue: 100000, Cgst: 14000, Sgst: 14000, Cess: 12000, TotalTax: 40000, Total: 140000},
+		},
+		{
+			name: "inclusive with cess",
+			line: Line{UnitPrice: 140000, Quantity: 1, GstRate: 28, CessRate: 12},
+			mode: Inclusive,
+			want: Breakdown{TaxableValue: 100000, Cgst: 14000, Sgst: 14000, Cess: 12000, TotalTax: 40000, Total: 140000},
+		},
+		{
+			name: "inclusive with cess rounds the GST share",
+			line: Line{UnitPrice: 9999, Quantity: 1, GstRate: 28, CessRate: 12},
+			mode: Inclusive,
+			want: Breakdown{TaxableValue: 7142, Cgst: 1000, Sgst: 1000, Cess: 857, TotalTax: 2857, Total: 9999},
+		},
+		{
+			name: "quantity and discount",
+			line: Line{UnitPrice: 10000, Quantity: 2, Discount: 2000, GstRate: 18},
+			mode: Exclusive,
+			want: Breakdown{Quantity: 2, TaxableValue: 18000, Cgst: 1620, Sgst: 1620, TotalTax: 3240, Total: 21240},
+		},
+		{
+			name: "exempt",
+			line: Line{UnitPrice: 5000, Quantity: 3, GstRate: 0},
+			mode: Inclusive,
+			want: Breakdown{Quantity: 3, TaxableValue: 15000, Total: 15000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Compute(tt.line, tt.mode, tt.interstate)
+			if err != nil {
+				t.Fatalf("Compute() error = %v", err)
+			}
+			want := tt.want
+			if want.Quantity == 0 {
+				want.Quantity = 1
+			}
+			want.GstRate, want.CessRate, want.Interstate = tt.line.GstRate, tt.line.CessRate, tt.interstate
+			if got != want {
+				t.Errorf("Compute() = %+v, want %+v", got, want)
+			}
+			if got.Cgst+got.Sgst+got.Igst+got.Cess != got.TotalTax {
+				t.Errorf("taxes add up to %d, total tax is %d", got.Cgst+got.Sgst+got.Igst+got.Cess, got.TotalTax)
+			}
+			gross := tt.line.UnitPrice.Mul(tt.line.Quantity) - tt.line.Discount
+			if tt.mode == Inclusive && got.Total != gross {
+				t.Errorf("inclusive total = %d, want the price %d", got.Total, gross)
+			}
+		})
+	}
+}
+
+func TestComputeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		line Line
+		mode Mode
+	}{
+		{name: "unknown slab", line: Line{UnitPrice: 100, Quantity: 1, GstRate: 15}, mode: Exclusive},
+		{name: "negative cess", line: Line{UnitPrice: 100, Quantity: 1, GstRate: 18, CessRate: -1}, mode: Exclusive},
+		{name: "no quantity", line: Line{UnitPrice: 100, GstRate: 18}, mode: Exclusive},
+		{name: "discount above the amount", line: Line{UnitPrice: 100, Quantity: 1, Discount: 101, GstRate: 18}, mode: Inclusive},
+		{name: "unknown mode", line: Line{UnitPrice: 100, Quantity: 1, GstRate: 18}, mode: "gross"},
+	}
+	for _, tt := range tests {
+		if _, err := Compute(tt.line, tt.mode, false); err == nil {
+			t.Errorf("%s: Compute() returned no error", tt.name)
+		}
+	}
+}
+
+func TestComputeLines(t *testing.T) {
+	lines := []Line{
+		{HsnCode: "1905", UnitPrice: 11800, Quantity: 1, GstRate: 18},
+		{HsnCode: "0401", UnitPrice: 2500, Quantity: 2, GstRate: 0},
+		{HsnCode: "1905", UnitPrice: 5900, Quantity: 2, GstRate: 18},
+	}
+	breakdowns, totals, err := ComputeLines(lines, Inclusive, false)
+	if err != nil {
+		t.Fatalf("ComputeLines() error = %v", err)
+	}
+	want := Totals{TaxableValue: 25000, Cgst: 1800, Sgst: 1800, TotalTax: 3600, Total: 28600}
+	if totals != want {
+		t.Errorf("ComputeLines() totals = %+v, want %+v", totals, want)
+	}
+
+	summaries := SummarizeByHsn(breakdowns)
+	if len(summaries) != 2 {
+		t.Fatalf("SummarizeByHsn() = %+v, want 2 groups", summaries)
+	}
+	if summaries[1].HsnCode != "1905" || summaries[1].Quantity != 3 || summaries[1].TaxableValue != 20000 || summaries[1].TotalTax != 3600 {
+		t.Errorf("SummarizeByHsn() 1905 = %+v", summaries[1])
+	}
+
+	if _, _, err := ComputeLines([]Line{{UnitPrice: 100, Quantity: 1, GstRate: 7}}, Inclusive, false); err == nil {
+		t.Error("ComputeLines() returned no error for an unknown slab")
+	}
+}
+
+func TestIsInterstate(t *testing.T) {
+	tests := []struct {
+		supplyState, placeOfSupply string
+		want                       bool
+	}{
+		{"32", "32", false},
+		{"32", "33", true},
+		{"32", "", false},
+		{"", "07", true},
+	}
+	for _, tt := range tests {
+		if got := IsInterstate(tt.supplyState, tt.placeOfSupply); got != tt.want {
+			t.Errorf("IsInterstate(%q, %q) = %v, want %v", tt.supplyState, tt.placeOfSupply, got, tt.want)
+		}
+	}
+
+	outlet := models.Outlet{Location: "Punjabi Bagh, Delhi"}
+	if InterstateFor(outlet, "07") {
+		t.Error("InterstateFor() treats a Delhi sale of a Delhi outlet as inter state")
+	}
+	outlet.StateCode = "03"
+	if !InterstateFor(outlet, "07") {
+		t.Error("InterstateFor() ignores the state code of the outlet")
+	}
+}
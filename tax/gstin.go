@@ -0,0 +1,68 @@
+package tax
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidGstin    = errors.New("GSTIN should be 15 characters with a valid check digit")
+	ErrGstinStateCode  = errors.New("GSTIN does not belong to the state of the outlet")
+	gstinCodePoints    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	gstinPanLetters    = []int{2, 3, 4, 5, 6, 11}
+	gstinPanDigits     = []int{7, 8, 9, 10}
+	gstinStateDigits   = []int{0, 1}
+	gstinDefaultLetter = 13
+)
+
+// ValidateGstin checks the format and check digit of a GSTIN and, when a state code is
+// given, that the GSTIN was registered in that state. An empty GSTIN is allowed for
+// outlets that are not registered.
+func ValidateGstin(gstin string, stateCode string) error {
+	if gstin == "" {
+		return nil
+	}
+	gstin = strings.ToUpper(gstin)
+	if len(gstin) != 15 {
+		return ErrInvalidGstin
+	}
+	for _, i := range gstinStateDigits {
+		if !isDigit(gstin[i]) {
+			return ErrInvalidGstin
+		}
+	}
+	for _, i := range gstinPanLetters {
+		if !isLetter(gstin[i]) {
+			return ErrInvalidGstin
+		}
+	}
+	for _, i := range gstinPanDigits {
+		if !isDigit(gstin[i]) {
+			return ErrInvalidGstin
+		}
+	}
+	if gstin[gstinDefaultLetter] != 'Z' || gstinCheckDigit(gstin[:14]) != gstin[14] {
+		return ErrInvalidGstin
+	}
+	if stateCode != "" && gstin[:2] != stateCode {
+		return ErrGstinStateCode
+	}
+	return nil
+}
+
+// gstinCheckDigit computes the mod 36 check character of the first 14 characters
+func gstinCheckDigit(body string) byte {
+	sum := 0
+	for i := 0; i < len(body); i++ {
+		value := strings.IndexByte(gstinCodePoints, body[i])
+		if value < 0 {
+			return 0
+		}
+		product := value * (i%2 + 1)
+		sum += product/36 + product%36
+	}
+	return gstinCodePoints[(36-sum%36)%36]
+}
+
+func isDigit(b byte) bool  { return b >= '0' && b <= '9' }
+func isLetter(b byte) bool { return b >= 'A' && b <= 'Z' }
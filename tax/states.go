@@ -0,0 +1,166 @@
+package tax
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// StateCodes maps state and union territory names to their GST state codes
+var StateCodes = map[string]string{
+	"jammu and kashmir":      "01",
+	"himachal pradesh":       "02",
+	"punjab":                 "03",
+	"chandigarh":             "04",
+	"uttarakhand":            "05",
+	"haryana":                "06",
+	"delhi":                  "07",
+	"rajasthan":              "08",
+	"uttar pradesh":          "09",
+	"bihar":                  "10",
+	"sikkim":                 "11",
+	"arunachal pradesh":      "12",
+	"nagaland":               "13",
+	"manipur":                "14",
+	"mizoram":                "15",
+	"tripura":                "16",
+	"meghalaya":              "17",
+	"assam":                  "18",
+	"west bengal":            "19",
+	"jharkhand":              "20",
+	"odisha":                 "21",
+	"chhattisgarh":           "22",
+	"madhya pradesh":         "23",
+	"gujarat":                "24",
+	"dadra and nagar haveli": "26",
+	"daman and diu":          "26",
+	"maharashtra":            "27",
+	"karnataka":              "29",
+	"goa":                    "30",
+	"lakshadweep":            "31",
+	"kerala":                 "32",
+	"tamil nadu":             "33",
+	"puducherry":             "34",
+	"andaman and nicobar":    "35",
+	"telangana":              "36",
+	"andhra pradesh":         "37",
+	"ladakh":                 "38",
+}
+
+// ValidStateCode reports whether code is a known GST state code
+func ValidStateCode(code string) bool {
+	for _, stateCode := range StateCodes {
+		if stateCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// stateAliases are other names in use for states, matched like the names in StateCodes
+var stateAliases = map[string]string{
+	"new delhi":                   "07",
+	"nct of delhi":                "07",
+	"orissa":                      "21",
+	"pondicherry":                 "34",
+	"andaman and nicobar islands": "35",
+	"dadra and nagar haveli and daman and diu": "26",
+}
+
+// StateFromLocation finds the GST state code of a free text location such as
+// "Attingal, Kerala" or "Kochi, Kerala 682001". The comma separated parts are tried from the
+// last, as addresses end with the state, and a state only matches whole words so "Punjabi
+// Bagh, Delhi" is in Delhi. A part that is a GST state code is taken as it is. It returns an
+// empty string when no state is mentioned.
+func StateFromLocation(location string) string {
+	parts := strings.Split(location, ",")
+	for i := len(parts) - 1; i >= 0; i-- {
+		words := locationWords(parts[i])
+		if len(words) == 1 && ValidStateCode(words[0]) {
+			return words[0]
+		}
+		if code := stateInWords(words); code != "" {
+			return code
+		}
+	}
+	return ""
+}
+
+// OutletState returns the GST state code of the outlet, falling back to its location
+func OutletState(stateCode string, location string) string {
+	if stateCode != "" {
+		return stateCode
+	}
+	return StateFromLocation(location)
+}
+
+// StateName returns the name of the state with the GST state code, for printing on
+// invoices. Codes shared by merged union territories return all of their names.
+func StateName(code string) string {
+	var names []string
+	for name, stateCode := range StateCodes {
+		if stateCode == code {
+			names = append(names, titleCase(name))
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, " and ")
+}
+
+func titleCase(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		if word != "and" {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// locationWords lowercases a part of a location into its words, leaving out pincodes
+func locationWords(part string) []string {
+	part = strings.ToLower(strings.ReplaceAll(part, "&", " and "))
+	var words []string
+	for _, word := range strings.FieldsFunc(part, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len(word) == 6 && strings.Trim(word, "0123456789") == "" {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// stateInWords returns the code of the state named by the longest run of whole words,
+// preferring the run that ends last
+func stateInWords(words []string) string {
+	code, matchedEnd, matchedLength := "", -1, 0
+	match := func(name string, stateCode string) {
+		nameWords := strings.Fields(name)
+		for end := len(nameWords); end <= len(words); end++ {
+			if !equalWords(words[end-len(nameWords):end], nameWords) {
+				continue
+			}
+			if end > matchedEnd || (end == matchedEnd && len(nameWords) > matchedLength) {
+				code, matchedEnd, matchedLength = stateCode, end, len(nameWords)
+			}
+		}
+	}
+	for name, stateCode := range StateCodes {
+		match(name, stateCode)
+	}
+	for name, stateCode := range stateAliases {
+		match(name, stateCode)
+	}
+	return code
+}
+
+func equalWords(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
@@ -0,0 +1,60 @@
+package tax
+
+import "testing"
+
+func TestStateFromLocation(t *testing.T) {
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{"Attingal, Kerala", "32"},
+		{"Kochi, Kerala 682001", "32"},
+		{"Punjabi Bagh, Delhi", "07"},
+		{"Punjabi Bagh, New Delhi - 110026", "07"},
+		{"Ludhiana, Punjab", "03"},
+		{"Salt Lake, Kolkata, West Bengal", "19"},
+		{"Bhopal, Madhya Pradesh", "23"},
+		{"Port Blair, Andaman & Nicobar Islands", "35"},
+		{"Srinagar, Jammu & Kashmir", "01"},
+		{"Bhubaneswar, Orissa", "21"},
+		{"Goa", "30"},
+		{"TAMIL NADU", "33"},
+		{"Keralapuram, Tamil Nadu", "33"},
+		{"Delhi Road, Meerut, Uttar Pradesh", "09"},
+		{"Thrissur Kerala", "32"},
+		{"27", "27"},
+		{"Bengaluru", ""},
+		{"99", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := StateFromLocation(tt.location); got != tt.want {
+			t.Errorf("StateFromLocation(%q) = %q, want %q", tt.location, got, tt.want)
+		}
+	}
+}
+
+func TestOutletState(t *testing.T) {
+	if got := OutletState("29", "Punjabi Bagh, Delhi"); got != "29" {
+		t.Errorf("OutletState() = %q, want the state code 29", got)
+	}
+	if got := OutletState("", "Punjabi Bagh, Delhi"); got != "07" {
+		t.Errorf("OutletState() = %q, want 07 from the location", got)
+	}
+}
+
+func TestStateName(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"32", "Kerala"},
+		{"26", "Dadra and Nagar Haveli and Daman and Diu"},
+		{"99", ""},
+	}
+	for _, tt := range tests {
+		if got := StateName(tt.code); got != tt.want {
+			t.Errorf("StateName(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
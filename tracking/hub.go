@@ -0,0 +1,101 @@
+package tracking
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// hub wakes up the streams of an order when a notification arrives for it
+var hub = &subscribers{streams: make(map[uint]map[chan struct{}]struct{})}
+
+type subscribers struct {
+	mu      sync.Mutex
+	streams map[uint]map[chan struct{}]struct{}
+}
+
+func (s *subscribers) subscribe(orderId uint) (<-chan struct{}, func()) {
+	// A wake up that is not picked up yet already covers any that follow it
+	wake := make(chan struct{}, 1)
+
+	s.mu.Lock()
+	if s.streams[orderId] == nil {
+		s.streams[orderId] = make(map[chan struct{}]struct{})
+	}
+	s.streams[orderId][wake] = struct{}{}
+	s.mu.Unlock()
+
+	return wake, func() {
+		s.mu.Lock()
+		delete(s.streams[orderId], wake)
+		if len(s.streams[orderId]) == 0 {
+			delete(s.streams, orderId)
+		}
+		s.mu.Unlock()
+	}
+}
+
+func (s *subscribers) wake(orderId uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for wake := range s.streams[orderId] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *subscribers) wakeAll() {
+	s.mu.Lock()
+	orderIds := make([]uint, 0, len(s.streams))
+	for orderId := range s.streams {
+		orderIds = append(orderIds, orderId)
+	}
+	s.mu.Unlock()
+
+	for _, orderId := range orderIds {
+		s.wake(orderId)
+	}
+}
+
+// Listen passes order event notifications from Postgres on to the streams of this
+// instance, reconnecting when the connection drops. It blocks, so run it in its own
+// goroutine.
+func Listen(dsn string) {
+	for {
+		err := listen(dsn)
+		log.Printf("Order event listener stopped: %v", err)
+		// Streams catch up with anything missed while reconnecting
+		hub.wakeAll()
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func listen(dsn string) error {
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(ctx)
+
+	if _, err := conn.Exec(ctx, "LISTEN "+Channel); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		orderId, err := strconv.ParseUint(notification.Payload, 10, 64)
+		if err != nil {
+			continue
+		}
+		hub.wake(uint(orderId))
+	}
+}
@@ -0,0 +1,106 @@
+package tracking
+
+import (
+	"context"
+	"easystore/models"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Channel is the Postgres notification channel new order events are announced on
+const Channel = "order_events"
+
+// Heartbeat is how often an idle stream is kept alive. Subscribers also catch up with the
+// database on every heartbeat, in case a notification was missed.
+const Heartbeat = 15 * time.Second
+
+// batchSize is the most events sent to a subscriber at once
+const batchSize = 100
+
+// Emit records an event of an order and announces it. Postgres only delivers the
+// notification once the transaction commits, so subscribers never see events that are
+// rolled back.
+func Emit(tx *gorm.DB, event models.OrderEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", Channel, strconv.FormatUint(uint64(event.OrderId), 10)).Error
+}
+
+// Since returns the events of an order after the event afterId, oldest first
+func Since(tx *gorm.DB, orderId uint, afterId uint) ([]models.OrderEvent, error) {
+	var events []models.OrderEvent
+	err := tx.Where("order_id = ? AND id > ?", orderId, afterId).Order("id").Limit(batchSize).Find(&events).Error
+	return events, err
+}
+
+// LastLocation returns the latest location event of an order, if there is one
+func LastLocation(tx *gorm.DB, orderId uint) (*models.OrderEvent, error) {
+	var events []models.OrderEvent
+	err := tx.Where("order_id = ? AND type = ?", orderId, models.OrderEventLocation).Order("id DESC").Limit(1).Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// Final reports whether an order in status will not change any more
+func Final(status string) bool {
+	return status == models.OrderDelivered || status == models.OrderCancelled || status == models.OrderFailed
+}
+
+// Stream sends the events of an order after lastEventId to a subscriber as they happen,
+// calling heartbeat when there was nothing to send for a while. It returns when ctx is
+// done, when sending fails or after the order reached a final status.
+func Stream(ctx context.Context, tx *gorm.DB, orderId uint, lastEventId uint, send func(models.OrderEvent) error, heartbeat func() error) error {
+	wake, unsubscribe := hub.subscribe(orderId)
+	defer unsubscribe()
+
+	ticker := time.NewTicker(Heartbeat)
+	defer ticker.Stop()
+
+	// flush sends everything recorded since the last event sent and reports whether the
+	// stream is over
+	flush := func() (bool, error) {
+		for {
+			events, err := Since(tx.WithContext(ctx), orderId, lastEventId)
+			if err != nil {
+				return false, err
+			}
+			for _, event := range events {
+				if err := send(event); err != nil {
+					return false, err
+				}
+				lastEventId = event.ID
+				if event.Type == models.OrderEventStatus && Final(event.Status) {
+					return true, nil
+				}
+			}
+			if len(events) < batchSize {
+				return false, nil
+			}
+		}
+	}
+
+	for {
+		done, err := flush()
+		if err != nil || done {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-wake:
+		case <-ticker.C:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+		}
+	}
+}
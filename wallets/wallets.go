@@ -0,0 +1,340 @@
+package wallets
+
+import (
+	"crypto/rand"
+	"easystore/customers"
+	"easystore/models"
+	"easystore/settings"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Gift card codes leave out letters and digits that are easily mistaken for one another
+const (
+	codeLength   = 16
+	codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+)
+
+var (
+	ErrGiftCardNotFound    = errors.New("Gift card not found")
+	ErrGiftCardBlocked     = errors.New("Gift card is blocked")
+	ErrGiftCardExpired     = errors.New("Gift card has expired")
+	ErrInsufficientBalance = errors.New("Gift card balance is not enough")
+	ErrInsufficientCredit  = errors.New("Store credit is not enough")
+	ErrInvalidAmount       = errors.New("Amount should be greater than zero")
+	ErrCustomerRequired    = errors.New("Store credit needs a customer")
+)
+
+// Source is the sale or order a gift card or store credit is spent on. Exactly one of the
+// two is set.
+type Source struct {
+	SaleId  *uint
+	OrderId *uint
+}
+
+// GiftCardRefund is an amount given back to a gift card
+type GiftCardRefund struct {
+	Code  string
+	Entry models.GiftCardEntry
+}
+
+// NewCode returns a random gift card code
+func NewCode() (string, error) {
+	var code strings.Builder
+	for i := 0; i < codeLength; i++ {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(codeAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		code.WriteByte(codeAlphabet[n.Int64()])
+	}
+	return code.String(), nil
+}
+
+// NormalizeCode takes out the spaces and dashes customers type gift card codes with
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(code))
+}
+
+// IssueGiftCard issues a gift card of the chain of the outlet loaded with amount
+func IssueGiftCard(tx *gorm.DB, outlet models.Outlet, amount models.Money, customerId *uint, expiresAt *time.Time, reason string) (models.GiftCard, error) {
+	card := models.GiftCard{ChainId: outlet.ChainId(), OutletId: outlet.ID, Amount: amount, CustomerId: customerId, ExpiresAt: expiresAt, Status: models.GiftCardActive}
+	if amount <= 0 {
+		return card, ErrInvalidAmount
+	}
+	code, err := NewCode()
+	if err != nil {
+		return card, err
+	}
+	card.Code = code
+
+	err = tx.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Entries").Create(&card).Error; err != nil {
+			return err
+		}
+		entry := models.GiftCardEntry{GiftCardId: card.ID, OutletId: outlet.ID, Type: models.GiftCardIssue, Amount: amount, Reason: reason}
+		if err := tx.Create(&entry).Error; err != nil {
+			return err
+		}
+		card.Entries = []models.GiftCardEntry{entry}
+		return nil
+	})
+	return card, err
+}
+
+// FindGiftCard returns the gift card of the chain with the code
+func FindGiftCard(tx *gorm.DB, chainId uint, code string) (models.GiftCard, error) {
+	var card models.GiftCard
+	err := tx.Where("chain_id = ? AND code = ?", chainId, NormalizeCode(code)).First(&card).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return card, ErrGiftCardNotFound
+	}
+	return card, err
+}
+
+// GiftCardBalance returns what is left on a gift card
+func GiftCardBalance(tx *gorm.DB, giftCardId uint) (models.Money, error) {
+	var balance models.Money
+	err := tx.Model(&models.GiftCardEntry{}).Where("gift_card_id = ?", giftCardId).Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+// Usable reports why a gift card can not be spent at, if it can not
+func Usable(card models.GiftCard, at time.Time) error {
+	if card.Status != models.GiftCardActive {
+		return ErrGiftCardBlocked
+	}
+	if card.ExpiresAt != nil && !card.ExpiresAt.After(at) {
+		return ErrGiftCardExpired
+	}
+	return nil
+}
+
+// CheckGiftCard checks that amount can be spent from a gift card of the chain of the outlet
+// without spending it
+func CheckGiftCard(tx *gorm.DB, outlet models.Outlet, code string, amount models.Money, at time.Time) (models.GiftCard, models.Money, error) {
+	card, err := FindGiftCard(tx, outlet.ChainId(), code)
+	if err != nil {
+		return card, 0, err
+	}
+	if err := Usable(card, at); err != nil {
+		return card, 0, err
+	}
+	balance, err := GiftCardBalance(tx, card.ID)
+	if err != nil {
+		return card, 0, err
+	}
+	if amount <= 0 {
+		return card, balance, ErrInvalidAmount
+	}
+	if amount > balance {
+		outletSettings, err := settings.Get(tx, outlet)
+		if err != nil {
+			return card, balance, err
+		}
+		return card, balance, fmt.Errorf("%w: %s left", ErrInsufficientBalance, outletSettings.Format(balance))
+	}
+	return card, balance, nil
+}
+
+// RedeemGiftCard spends amount from a gift card of the chain of the outlet on a sale or
+// order. The gift card stays locked until the transaction ends, so concurrent redemptions
+// can not spend the same balance twice.
+func RedeemGiftCard(tx *gorm.DB, outlet models.Outlet, code string, amount models.Money, source Source, at time.Time) (models.GiftCardEntry, error) {
+	entry := models.GiftCardEntry{OutletId: outlet.ID, Type: models.GiftCardRedeem, Amount: -amount, SaleId: source.SaleId, OrderId: source.OrderId, Reason: "Spent " + source.describe()}
+	card, err := FindGiftCard(tx.Clauses(clause.Locking{Strength: "UPDATE"}), outlet.ChainId(), code)
+	if err != nil {
+		return entry, err
+	}
+	if _, _, err := CheckGiftCard(tx, outlet, card.Code, amount, at); err != nil {
+		return entry, err
+	}
+
+	entry.GiftCardId = card.ID
+	err = tx.Create(&entry).Error
+	return entry, err
+}
+
+// RefundGiftCards gives back up to amount to the gift cards spent on a sale or order, each
+// up to what was spent from it less what it was given back. Expired and blocked cards are
+// left out. It returns what was given back to each card.
+func RefundGiftCards(tx *gorm.DB, outletId uint, source Source, amount models.Money, returnId *uint, at time.Time) ([]GiftCardRefund, error) {
+	column, id := source.column()
+	var spent []struct {
+		GiftCardId uint
+		Amount     models.Money
+	}
+	err := tx.Model(&models.GiftCardEntry{}).
+		Select("gift_card_id, -SUM(amount) AS amount").
+		Where(column+" = ? AND type IN ?", id, []string{models.GiftCardRedeem, models.GiftCardRefund}).
+		Group("gift_card_id").
+		Order("MIN(id)").
+		Scan(&spent).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var refunds []GiftCardRefund
+	for _, card := range spent {
+		if amount <= 0 {
+			break
+		}
+		share := card.Amount
+		if share > amount {
+			share = amount
+		}
+		if share <= 0 {
+			continue
+		}
+
+		var giftCard models.GiftCard
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&giftCard, card.GiftCardId).Error; err != nil {
+			return refunds, err
+		}
+		if Usable(giftCard, at) != nil {
+			continue
+		}
+		entry := models.GiftCardEntry{GiftCardId: giftCard.ID, OutletId: outletId, Type: models.GiftCardRefund, Amount: share, SaleId: source.SaleId, OrderId: source.OrderId, ReturnId: returnId, Reason: "Given back " + source.describe()}
+		if err := tx.Create(&entry).Error; err != nil {
+			return refunds, err
+		}
+		refunds = append(refunds, GiftCardRefund{Code: giftCard.Code, Entry: entry})
+		amount -= share
+	}
+	return refunds, nil
+}
+
+// StoreCreditBalance returns the store credit of a customer, counting that of the customers
+// merged into it
+func StoreCreditBalance(tx *gorm.DB, customerId uint) (models.Money, error) {
+	ids, err := customers.HistoryIds(tx, customerId)
+	if err != nil {
+		return 0, err
+	}
+	var balance models.Money
+	err = tx.Model(&models.StoreCreditEntry{}).Where("customer_id IN ?", ids).Select("COALESCE(SUM(amount), 0)").Scan(&balance).Error
+	return balance, err
+}
+
+// CheckStoreCredit checks that a customer has amount of store credit to spend
+func CheckStoreCredit(tx *gorm.DB, customerId uint, amount models.Money) (models.Money, error) {
+	balance, err := StoreCreditBalance(tx, customerId)
+	if err != nil {
+		return 0, err
+	}
+	if amount <= 0 {
+		return balance, ErrInvalidAmount
+	}
+	if amount > balance {
+		return balance, fmt.Errorf("%w: %s left", ErrInsufficientCredit, balance.Format(models.DefaultCurrency))
+	}
+	return balance, nil
+}
+
+// SpendStoreCredit spends store credit of a customer on a sale or order. The wallet of the
+// customer stays locked until the transaction ends, so concurrent spends can not spend the
+// same credit twice.
+func SpendStoreCredit(tx *gorm.DB, outletId uint, customerId uint, amount models.Money, source Source) (models.StoreCreditEntry, error) {
+	entry := models.StoreCreditEntry{CustomerId: customerId, OutletId: outletId, Amount: -amount, SaleId: source.SaleId, OrderId: source.OrderId, Reason: "Spent " + source.describe()}
+	if err := lock(tx, customerId); err != nil {
+		return entry, err
+	}
+	if _, err := CheckStoreCredit(tx, customerId, amount); err != nil {
+		return entry, err
+	}
+	err := tx.Create(&entry).Error
+	return entry, err
+}
+
+// CreditStoreCredit adds amount to the store credit of a customer
+func CreditStoreCredit(tx *gorm.DB, outletId uint, customerId uint, amount models.Money, returnId *uint, reason string) (models.StoreCreditEntry, error) {
+	entry := models.StoreCreditEntry{CustomerId: customerId, OutletId: outletId, Amount: amount, ReturnId: returnId, Reason: reason}
+	if amount <= 0 {
+		return entry, ErrInvalidAmount
+	}
+	if err := lock(tx, customerId); err != nil {
+		return entry, err
+	}
+	err := tx.Create(&entry).Error
+	return entry, err
+}
+
+// RefundStoreCredit gives back up to amount of the store credit spent on a sale or order,
+// less what was given back before, and returns the entry. Nothing is given back when the
+// entry amount is zero.
+func RefundStoreCredit(tx *gorm.DB, outletId uint, customerId uint, source Source, amount models.Money, returnId *uint) (models.StoreCreditEntry, error) {
+	entry := models.StoreCreditEntry{CustomerId: customerId, OutletId: outletId, SaleId: source.SaleId, OrderId: source.OrderId, ReturnId: returnId, Reason: "Given back " + source.describe()}
+	if err := lock(tx, customerId); err != nil {
+		return entry, err
+	}
+	column, id := source.column()
+	var spent models.Money
+	err := tx.Model(&models.StoreCreditEntry{}).Where(column+" = ?", id).Select("COALESCE(-SUM(amount), 0)").Scan(&spent).Error
+	if err != nil {
+		return entry, err
+	}
+	if spent < amount {
+		amount = spent
+	}
+	if amount <= 0 {
+		return entry, nil
+	}
+	entry.Amount = amount
+	err = tx.Create(&entry).Error
+	return entry, err
+}
+
+// CancelOrder gives back the gift cards and store credit spent on an order that will not
+// be delivered
+func CancelOrder(tx *gorm.DB, order models.Order) error {
+	source := Source{OrderId: &order.ID}
+	if order.GiftCardValue > 0 {
+		if _, err := RefundGiftCards(tx, order.OutletId, source, order.GiftCardValue, nil, time.Now()); err != nil {
+			return err
+		}
+	}
+	if order.StoreCreditValue > 0 {
+		if _, err := RefundStoreCredit(tx, order.OutletId, order.CustomerId, source, order.StoreCreditValue, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsWalletError reports whether err was caused by the request rather than the server
+func IsWalletError(err error) bool {
+	for _, walletErr := range []error{ErrGiftCardNotFound, ErrGiftCardBlocked, ErrGiftCardExpired, ErrInsufficientBalance, ErrInsufficientCredit, ErrInvalidAmount, ErrCustomerRequired} {
+		if errors.Is(err, walletErr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Private methods
+
+// lock serialises the changes to the store credit of a customer until the transaction ends
+func lock(tx *gorm.DB, customerId uint) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("store_credit:%d", customerId)).Error
+}
+
+// column returns the column of entries pointing at the source
+func (s Source) column() (string, uint) {
+	if s.SaleId != nil {
+		return "sale_id", *s.SaleId
+	}
+	return "order_id", *s.OrderId
+}
+
+func (s Source) describe() string {
+	if s.SaleId != nil {
+		return fmt.Sprintf("on sale %d", *s.SaleId)
+	}
+	return fmt.Sprintf("on order %d", *s.OrderId)
+}